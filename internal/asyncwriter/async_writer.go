@@ -67,9 +67,11 @@ func (w *Writer) runInner() error {
 }
 
 // Push appends an element to the queue.
-func (w *Writer) Push(cb func() error) {
+// It returns false when the queue is full and the element has been discarded.
+func (w *Writer) Push(cb func() error) bool {
 	ok := w.buffer.Push(cb)
 	if !ok {
 		w.writeErrLogger.Log(logger.Warn, "write queue is full")
 	}
+	return ok
 }
@@ -5,9 +5,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -101,20 +103,26 @@ type Conf struct {
 	RunOnDisconnect           string          `json:"runOnDisconnect"`
 
 	// RTSP server
-	RTSP              bool        `json:"rtsp"`
-	RTSPDisable       *bool       `json:"rtspDisable,omitempty"` // deprecated
-	Protocols         Protocols   `json:"protocols"`
-	Encryption        Encryption  `json:"encryption"`
-	RTSPAddress       string      `json:"rtspAddress"`
-	RTSPSAddress      string      `json:"rtspsAddress"`
-	RTPAddress        string      `json:"rtpAddress"`
-	RTCPAddress       string      `json:"rtcpAddress"`
-	MulticastIPRange  string      `json:"multicastIPRange"`
-	MulticastRTPPort  int         `json:"multicastRTPPort"`
-	MulticastRTCPPort int         `json:"multicastRTCPPort"`
-	ServerKey         string      `json:"serverKey"`
-	ServerCert        string      `json:"serverCert"`
-	AuthMethods       AuthMethods `json:"authMethods"`
+	RTSP                  bool        `json:"rtsp"`
+	RTSPDisable           *bool       `json:"rtspDisable,omitempty"` // deprecated
+	Protocols             Protocols   `json:"protocols"`
+	Encryption            Encryption  `json:"encryption"`
+	RTSPAddress           string      `json:"rtspAddress"`
+	RTSPSAddress          string      `json:"rtspsAddress"`
+	RTPAddress            string      `json:"rtpAddress"`
+	RTCPAddress           string      `json:"rtcpAddress"`
+	SRTP                  bool        `json:"srtp"`
+	SRTPAddress           string      `json:"srtpAddress"`
+	SRTCPAddress          string      `json:"srtcpAddress"`
+	MulticastIPRange      string      `json:"multicastIPRange"`
+	MulticastRTPPort      int         `json:"multicastRTPPort"`
+	MulticastRTCPPort     int         `json:"multicastRTCPPort"`
+	ServerKey             string      `json:"serverKey"`
+	ServerCert            string      `json:"serverCert"`
+	AuthMethods           AuthMethods `json:"authMethods"`
+	RTSPTunnel            bool        `json:"rtspTunnel"`
+	RTSPTunnelAddress     string      `json:"rtspTunnelAddress"`
+	RTSPTunnelAllowOrigin string      `json:"rtspTunnelAllowOrigin"`
 
 	// RTMP server
 	RTMP           bool       `json:"rtmp"`
@@ -142,6 +150,15 @@ type Conf struct {
 	HLSTrustedProxies  IPsOrCIDRs     `json:"hlsTrustedProxies"`
 	HLSDirectory       string         `json:"hlsDirectory"`
 
+	// HLS origin
+	HLSOriginS3Endpoint        string         `json:"hlsOriginS3Endpoint"`
+	HLSOriginS3Region          string         `json:"hlsOriginS3Region"`
+	HLSOriginS3Bucket          string         `json:"hlsOriginS3Bucket"`
+	HLSOriginS3AccessKeyID     string         `json:"hlsOriginS3AccessKeyID"`
+	HLSOriginS3SecretAccessKey string         `json:"hlsOriginS3SecretAccessKey"`
+	HLSOriginS3Prefix          string         `json:"hlsOriginS3Prefix"`
+	HLSOriginRetention         StringDuration `json:"hlsOriginRetention"`
+
 	// WebRTC server
 	WebRTC                      bool              `json:"webrtc"`
 	WebRTCDisable               *bool             `json:"webrtcDisable,omitempty"` // deprecated
@@ -166,6 +183,15 @@ type Conf struct {
 	SRT        bool   `json:"srt"`
 	SRTAddress string `json:"srtAddress"`
 
+	// ONVIF server
+	ONVIF          bool   `json:"onvif"`
+	ONVIFAddress   string `json:"onvifAddress"`
+	ONVIFDiscovery bool   `json:"onvifDiscovery"`
+
+	// Record quotas
+	RecordTotalMaxSize StringSize `json:"recordTotalMaxSize"`
+	RecordMinFreeSpace float64    `json:"recordMinFreeSpace"`
+
 	// Record (deprecated)
 	Record                *bool           `json:"record,omitempty"`                // deprecated
 	RecordPath            *string         `json:"recordPath,omitempty"`            // deprecated
@@ -204,8 +230,11 @@ func (conf *Conf) setDefaults() {
 	}
 	conf.RTSPAddress = ":8554"
 	conf.RTSPSAddress = ":8322"
+	conf.RTSPTunnelAddress = ":8555"
 	conf.RTPAddress = ":8000"
 	conf.RTCPAddress = ":8001"
+	conf.SRTPAddress = ":8004"
+	conf.SRTCPAddress = ":8005"
 	conf.MulticastIPRange = "224.1.0.0/16"
 	conf.MulticastRTPPort = 8002
 	conf.MulticastRTCPPort = 8003
@@ -231,6 +260,8 @@ func (conf *Conf) setDefaults() {
 	conf.HLSPartDuration = 200 * StringDuration(time.Millisecond)
 	conf.HLSSegmentMaxSize = 50 * 1024 * 1024
 	conf.HLSAllowOrigin = "*"
+	conf.HLSOriginS3Region = "us-east-1"
+	conf.HLSOriginRetention = 60 * StringDuration(time.Second)
 
 	// WebRTC
 	conf.WebRTC = true
@@ -248,6 +279,10 @@ func (conf *Conf) setDefaults() {
 	conf.SRT = true
 	conf.SRTAddress = ":8890"
 
+	// ONVIF
+	conf.ONVIFAddress = ":8580"
+	conf.ONVIFDiscovery = true
+
 	conf.PathDefaults.setDefaults()
 }
 
@@ -363,12 +398,24 @@ func (conf *Conf) Check() error {
 		conf.RTSP = !*conf.RTSPDisable
 	}
 	if conf.Encryption == EncryptionStrict {
-		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDP)]; ok {
+		// with SRTP, UDP media is encrypted too
+		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDP)]; ok && !conf.SRTP {
 			return fmt.Errorf("strict encryption can't be used with the UDP transport protocol")
 		}
 		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDPMulticast)]; ok {
 			return fmt.Errorf("strict encryption can't be used with the UDP-multicast transport protocol")
 		}
+		if conf.RTSPTunnel {
+			return fmt.Errorf("strict encryption can't be used with the RTSP tunnel")
+		}
+	}
+	if conf.SRTP {
+		if conf.Encryption == EncryptionNo {
+			return fmt.Errorf("'srtp' requires encryption to be 'strict' or 'optional'")
+		}
+		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDP)]; !ok {
+			return fmt.Errorf("'srtp' requires the UDP transport protocol")
+		}
 	}
 
 	// RTMP
@@ -382,6 +429,21 @@ func (conf *Conf) Check() error {
 	if conf.HLSDisable != nil {
 		conf.HLS = !*conf.HLSDisable
 	}
+	if conf.HLSOriginS3Endpoint != "" {
+		if !strings.HasPrefix(conf.HLSOriginS3Endpoint, "http://") &&
+			!strings.HasPrefix(conf.HLSOriginS3Endpoint, "https://") {
+			return fmt.Errorf("'hlsOriginS3Endpoint' must be a HTTP URL")
+		}
+		if conf.HLSOriginS3Bucket == "" {
+			return fmt.Errorf("'hlsOriginS3Bucket' must be filled when 'hlsOriginS3Endpoint' is set")
+		}
+		if !conf.HLSAlwaysRemux {
+			return fmt.Errorf("'hlsOriginS3Endpoint' can be used only when 'hlsAlwaysRemux' is enabled")
+		}
+		if conf.HLSVariant == HLSVariant(gohlslib.MuxerVariantLowLatency) {
+			return fmt.Errorf("'hlsOriginS3Endpoint' can't be used with the Low-Latency HLS variant")
+		}
+	}
 
 	// WebRTC
 
@@ -432,6 +494,16 @@ func (conf *Conf) Check() error {
 		}
 	}
 
+	// ONVIF
+	if conf.ONVIF && !conf.RTSP {
+		return fmt.Errorf("'onvif' requires the RTSP server to be enabled")
+	}
+
+	// Record quotas
+	if conf.RecordMinFreeSpace < 0 || conf.RecordMinFreeSpace > 100 {
+		return fmt.Errorf("'recordMinFreeSpace' must be between 0 and 100")
+	}
+
 	// Record
 	if conf.Record != nil {
 		conf.PathDefaults.Record = *conf.Record
@@ -463,6 +535,7 @@ func (conf *Conf) Check() error {
 	}
 
 	conf.Paths = make(map[string]*Path)
+	multicastGroups := make(map[string]string)
 
 	for _, name := range sortedKeys(conf.OptionalPaths) {
 		optional := conf.OptionalPaths[name]
@@ -479,6 +552,15 @@ func (conf *Conf) Check() error {
 		if err != nil {
 			return err
 		}
+
+		if pconf.RTSPMulticastGroup != "" {
+			key := net.JoinHostPort(pconf.RTSPMulticastGroup, strconv.FormatInt(int64(pconf.RTSPMulticastPort), 10))
+			if other, ok := multicastGroups[key]; ok {
+				return fmt.Errorf("paths '%s' and '%s' have the same 'rtspMulticastGroup' and 'rtspMulticastPort'",
+					other, name)
+			}
+			multicastGroups[key] = name
+		}
 	}
 
 	return nil
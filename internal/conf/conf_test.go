@@ -48,36 +48,48 @@ func TestConfFromFile(t *testing.T) {
 		pa, ok := conf.Paths["cam1"]
 		require.Equal(t, true, ok)
 		require.Equal(t, &Path{
-			Name:                       "cam1",
-			Source:                     "publisher",
-			SourceOnDemandStartTimeout: 10 * StringDuration(time.Second),
-			SourceOnDemandCloseAfter:   10 * StringDuration(time.Second),
-			RecordPath:                 "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f",
-			RecordFormat:               RecordFormatFMP4,
-			RecordPartDuration:         100000000,
-			RecordSegmentDuration:      3600000000000,
-			RecordDeleteAfter:          86400000000000,
-			OverridePublisher:          true,
-			RPICameraWidth:             1920,
-			RPICameraHeight:            1080,
-			RPICameraContrast:          1,
-			RPICameraSaturation:        1,
-			RPICameraSharpness:         1,
-			RPICameraExposure:          "normal",
-			RPICameraAWB:               "auto",
-			RPICameraDenoise:           "off",
-			RPICameraMetering:          "centre",
-			RPICameraFPS:               30,
-			RPICameraIDRPeriod:         60,
-			RPICameraBitrate:           1000000,
-			RPICameraProfile:           "main",
-			RPICameraLevel:             "4.1",
-			RPICameraAfMode:            "continuous",
-			RPICameraAfRange:           "normal",
-			RPICameraAfSpeed:           "normal",
-			RPICameraTextOverlay:       "%Y-%m-%d %H:%M:%S - MediaMTX",
-			RunOnDemandStartTimeout:    5 * StringDuration(time.Second),
-			RunOnDemandCloseAfter:      10 * StringDuration(time.Second),
+			Name:                         "cam1",
+			Source:                       "publisher",
+			SourceOnDemandStartTimeout:   10 * StringDuration(time.Second),
+			SourceOnDemandCloseAfter:     10 * StringDuration(time.Second),
+			AbsoluteTimeTolerance:        10 * StringDuration(time.Second),
+			RecordPath:                   "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f",
+			RecordFormat:                 RecordFormatFMP4,
+			RecordPartDuration:           100000000,
+			RecordSegmentDuration:        3600000000000,
+			RecordDeleteAfter:            86400000000000,
+			RecordTracks:                 []string{},
+			RecordPreEventDuration:       10 * StringDuration(time.Second),
+			RecordPostEventDuration:      10 * StringDuration(time.Second),
+			RecordS3Region:               "us-east-1",
+			RecordS3SpoolMaxSize:         1024 * 1024 * 1024,
+			OverridePublisher:            true,
+			RTSPMedias:                   []string{},
+			RTSPSourceFallbacks:          []string{},
+			RTSPSourcePrimaryCheckPeriod: 30 * StringDuration(time.Second),
+			RTSPMulticastTTL:             127,
+			HLSSourceFailoverAttempts:    3,
+			HLSSourceFallbacks:           []string{},
+			RPICameraWidth:               1920,
+			RPICameraHeight:              1080,
+			RPICameraContrast:            1,
+			RPICameraSaturation:          1,
+			RPICameraSharpness:           1,
+			RPICameraExposure:            "normal",
+			RPICameraAWB:                 "auto",
+			RPICameraDenoise:             "off",
+			RPICameraMetering:            "centre",
+			RPICameraFPS:                 30,
+			RPICameraIDRPeriod:           60,
+			RPICameraBitrate:             1000000,
+			RPICameraProfile:             "main",
+			RPICameraLevel:               "4.1",
+			RPICameraAfMode:              "continuous",
+			RPICameraAfRange:             "normal",
+			RPICameraAfSpeed:             "normal",
+			RPICameraTextOverlay:         "%Y-%m-%d %H:%M:%S - MediaMTX",
+			RunOnDemandStartTimeout:      5 * StringDuration(time.Second),
+			RunOnDemandCloseAfter:        10 * StringDuration(time.Second),
 		}, pa)
 	}()
 
@@ -235,11 +247,58 @@ func TestConfErrors(t *testing.T) {
 				"protocols: [multicast]\n",
 			"strict encryption can't be used with the UDP-multicast transport protocol",
 		},
+		{
+			"invalid strict encryption 3",
+			"encryption: strict\n" +
+				"protocols: [tcp]\n" +
+				"rtspTunnel: yes\n",
+			"strict encryption can't be used with the RTSP tunnel",
+		},
+		{
+			"invalid srtp 1",
+			"srtp: yes\n",
+			"'srtp' requires encryption to be 'strict' or 'optional'",
+		},
+		{
+			"invalid srtp 2",
+			"encryption: strict\n" +
+				"protocols: [tcp]\n" +
+				"srtp: yes\n",
+			"'srtp' requires the UDP transport protocol",
+		},
 		{
 			"invalid ICE server",
 			"webrtcICEServers: [testing]\n",
 			"invalid ICE server: 'testing'",
 		},
+		{
+			"manifest with shared record directory",
+			"pathDefaults:\n" +
+				"  recordPath: ./recordings/%Y-%m-%d/%path/%H-%M-%S-%f\n" +
+				"  recordManifestKey: manifest.key\n" +
+				"paths:\n" +
+				"  mypath:\n",
+			"when 'recordManifestKey' is set, 'recordPath' must contain a directory named after %path " +
+				"that precedes any other variable (i.e. ./recordings/%path/%Y-%m-%d_%H-%M-%S-%f), " +
+				"since manifests are placed in that directory",
+		},
+		{
+			"manifest with record path without directories",
+			"pathDefaults:\n" +
+				"  recordPath: '%path_%Y-%m-%d_%H-%M-%S-%f'\n" +
+				"  recordManifestKey: manifest.key\n" +
+				"paths:\n" +
+				"  mypath:\n",
+			"when 'recordManifestKey' is set, 'recordPath' must contain a directory named after %path " +
+				"that precedes any other variable (i.e. ./recordings/%path/%Y-%m-%d_%H-%M-%S-%f), " +
+				"since manifests are placed in that directory",
+		},
+		{
+			"onvif without rtsp",
+			"rtsp: no\n" +
+				"onvif: yes\n",
+			"'onvif' requires the RTSP server to be enabled",
+		},
 		{
 			"non existent parameter 2",
 			"paths:\n" +
@@ -277,6 +336,85 @@ func TestConfErrors(t *testing.T) {
 				"    srtReadPassphrase: a\n",
 			`invalid 'readRTPassphrase': must be between 10 and 79 characters`,
 		},
+		{
+			"invalid rtspParametersToSource",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspParametersToSource: yes\n",
+			"'rtspParametersToSource' can be used only when source is a RTSP URL",
+		},
+		{
+			"invalid rtspParametersWebhook",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspParametersWebhook: testing\n",
+			"'rtspParametersWebhook' must be a HTTP URL",
+		},
+		{
+			"invalid hls source max resolution",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    hlsSourceMaxResolution: 1280p\n",
+			`invalid 'hlsSourceMaxResolution': resolution must be in the WIDTHxHEIGHT format`,
+		},
+		{
+			"invalid hls source fallback",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    hlsSourceFallbacks: [rtsp://localhost/stream]\n",
+			`'rtsp://localhost/stream' is not a valid HLS URL`,
+		},
+		{
+			"hls source fallbacks without hls source",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    hlsSourceFallbacks: [http://localhost/stream.m3u8]\n",
+			`'hlsSourceFallbacks' can be used only when source is a HLS URL`,
+		},
+		{
+			"invalid rtsp multicast group",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspMulticastGroup: 192.168.1.1\n" +
+				"    rtspMulticastPort: 5000\n",
+			`'192.168.1.1' is not a valid IPv4 multicast group`,
+		},
+		{
+			"invalid rtsp multicast port",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5001\n",
+			`'rtspMulticastPort' must be an even port`,
+		},
+		{
+			"invalid rtsp multicast source",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5000\n" +
+				"    rtspMulticastSource: 192.168.1.10\n",
+			`source-specific multicast requires a group in the 232.0.0.0/8 range`,
+		},
+		{
+			"duplicate rtsp multicast group",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5000\n" +
+				"  otherpath:\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5000\n",
+			`paths 'mypath' and 'otherpath' have the same 'rtspMulticastGroup' and 'rtspMulticastPort'`,
+		},
+		{
+			"rtsp multicast group in regexp path",
+			"paths:\n" +
+				"  '~^.*$':\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5000\n",
+			`a path with a regular expression (or path 'all') cannot have a 'rtspMulticastGroup'. use another path`,
+		},
 		{
 			"all_others aliases",
 			"paths:\n" +
@@ -291,6 +429,19 @@ func TestConfErrors(t *testing.T) {
 				"  ~^.*$:\n",
 			`all_others, all and '~^.*$' are aliases`,
 		},
+		{
+			"invalid record schedule",
+			"pathDefaults:\n" +
+				"  recordSchedule: [\"mon-fri 08:00\"]\n",
+			"invalid time range '08:00'",
+		},
+		{
+			"invalid record schedule timezone",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    recordScheduleTimezone: Invalid/Zone\n",
+			"invalid 'recordScheduleTimezone': unknown time zone Invalid/Zone",
+		},
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			tmpf, err := writeTempFile([]byte(ca.conf))
@@ -303,6 +454,50 @@ func TestConfErrors(t *testing.T) {
 	}
 }
 
+func TestRecordSchedule(t *testing.T) {
+	var s RecordSchedule
+	err := s.UnmarshalJSON([]byte(`["mon-fri 08:00-18:00", "sat,sun 22:00-02:00"]`))
+	require.NoError(t, err)
+
+	byts, err := s.MarshalJSON()
+	require.NoError(t, err)
+	require.Equal(t, `["mon,tue,wed,thu,fri 08:00-18:00","sun,sat 22:00-02:00"]`, string(byts))
+
+	// 2023-11-20 is a monday
+	for _, ca := range []struct {
+		t          time.Time
+		active     bool
+		nextChange time.Time
+	}{
+		{
+			time.Date(2023, 11, 20, 7, 0, 0, 0, time.UTC),
+			false,
+			time.Date(2023, 11, 20, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2023, 11, 20, 12, 0, 0, 0, time.UTC),
+			true,
+			time.Date(2023, 11, 20, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2023, 11, 24, 19, 0, 0, 0, time.UTC),
+			false,
+			time.Date(2023, 11, 25, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2023, 11, 27, 1, 0, 0, 0, time.UTC),
+			true,
+			time.Date(2023, 11, 27, 2, 0, 0, 0, time.UTC),
+		},
+	} {
+		require.Equal(t, ca.active, s.Active(ca.t))
+		require.Equal(t, ca.nextChange, s.NextChange(ca.t))
+	}
+
+	require.Equal(t, true, RecordSchedule(nil).Active(time.Now()))
+	require.Equal(t, time.Time{}, RecordSchedule(nil).NextChange(time.Now()))
+}
+
 func TestSampleConfFile(t *testing.T) {
 	func() {
 		conf1, confPath1, err := Load("../../mediamtx.yml", nil)
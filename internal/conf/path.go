@@ -61,6 +61,18 @@ type Path struct {
 	MaxReaders                 int            `json:"maxReaders"`
 	SRTReadPassphrase          string         `json:"srtReadPassphrase"`
 	Fallback                   string         `json:"fallback"`
+	StallTimeout               StringDuration `json:"stallTimeout"`
+	AbsoluteTimeTolerance      StringDuration `json:"absoluteTimeTolerance"`
+
+	// RTSP multicast
+	RTSPMulticastGroup    string `json:"rtspMulticastGroup"`
+	RTSPMulticastPort     int    `json:"rtspMulticastPort"`
+	RTSPMulticastTTL      int    `json:"rtspMulticastTTL"`
+	RTSPMulticastSource   string `json:"rtspMulticastSource"`
+	RTSPMulticastAlwaysOn bool   `json:"rtspMulticastAlwaysOn"`
+
+	// Snapshot
+	Snapshot bool `json:"snapshot"`
 
 	// Record
 	Record                bool           `json:"record"`
@@ -68,7 +80,31 @@ type Path struct {
 	RecordFormat          RecordFormat   `json:"recordFormat"`
 	RecordPartDuration    StringDuration `json:"recordPartDuration"`
 	RecordSegmentDuration StringDuration `json:"recordSegmentDuration"`
+	RecordSegmentAlign    bool           `json:"recordSegmentAlign"`
 	RecordDeleteAfter     StringDuration `json:"recordDeleteAfter"`
+	RecordMaxSize         StringSize     `json:"recordMaxSize"`
+	RecordTracks          []string       `json:"recordTracks"`
+	RecordKeyframesOnly   bool           `json:"recordKeyframesOnly"`
+	RecordThumbnailPeriod StringDuration `json:"recordThumbnailPeriod"`
+	RecordManifestKey     string         `json:"recordManifestKey"`
+
+	// Event recording
+	RecordMode              RecordMode     `json:"recordMode"`
+	RecordPreEventDuration  StringDuration `json:"recordPreEventDuration"`
+	RecordPostEventDuration StringDuration `json:"recordPostEventDuration"`
+
+	// Recording schedule
+	RecordSchedule         RecordSchedule `json:"recordSchedule"`
+	RecordScheduleTimezone string         `json:"recordScheduleTimezone"`
+
+	// Record to S3
+	RecordS3Endpoint        string     `json:"recordS3Endpoint"`
+	RecordS3Region          string     `json:"recordS3Region"`
+	RecordS3Bucket          string     `json:"recordS3Bucket"`
+	RecordS3AccessKeyID     string     `json:"recordS3AccessKeyID"`
+	RecordS3SecretAccessKey string     `json:"recordS3SecretAccessKey"`
+	RecordS3Prefix          string     `json:"recordS3Prefix"`
+	RecordS3SpoolMaxSize    StringSize `json:"recordS3SpoolMaxSize"`
 
 	// Authentication
 	PublishUser Credential `json:"publishUser"`
@@ -90,6 +126,24 @@ type Path struct {
 	SourceAnyPortEnable *bool          `json:"sourceAnyPortEnable,omitempty"` // deprecated
 	RTSPRangeType       RTSPRangeType  `json:"rtspRangeType"`
 	RTSPRangeStart      string         `json:"rtspRangeStart"`
+	RTSPMedias          []string       `json:"rtspMedias"`
+
+	// RTSP source failover
+	RTSPSourceFallbacks          []string       `json:"rtspSourceFallbacks"`
+	RTSPSourceStallTimeout       StringDuration `json:"rtspSourceStallTimeout"`
+	RTSPSourcePrimaryCheckPeriod StringDuration `json:"rtspSourcePrimaryCheckPeriod"`
+
+	// RTSP parameters
+	RTSPParametersToSource bool   `json:"rtspParametersToSource"`
+	RTSPParametersWebhook  string `json:"rtspParametersWebhook"`
+
+	// HLS source
+	HLSSourceMaxBandwidth     int      `json:"hlsSourceMaxBandwidth"`
+	HLSSourceMaxResolution    string   `json:"hlsSourceMaxResolution"`
+	HLSSourceCodec            string   `json:"hlsSourceCodec"`
+	HLSSourceAudioLanguage    string   `json:"hlsSourceAudioLanguage"`
+	HLSSourceFailoverAttempts int      `json:"hlsSourceFailoverAttempts"`
+	HLSSourceFallbacks        []string `json:"hlsSourceFallbacks"`
 
 	// Redirect source
 	SourceRedirect string `json:"sourceRedirect"`
@@ -139,6 +193,7 @@ type Path struct {
 	RunOnReady                 string         `json:"runOnReady"`
 	RunOnReadyRestart          bool           `json:"runOnReadyRestart"`
 	RunOnNotReady              string         `json:"runOnNotReady"`
+	RunOnStall                 string         `json:"runOnStall"`
 	RunOnRead                  string         `json:"runOnRead"`
 	RunOnReadRestart           bool           `json:"runOnReadRestart"`
 	RunOnUnread                string         `json:"runOnUnread"`
@@ -151,6 +206,10 @@ func (pconf *Path) setDefaults() {
 	pconf.Source = "publisher"
 	pconf.SourceOnDemandStartTimeout = 10 * StringDuration(time.Second)
 	pconf.SourceOnDemandCloseAfter = 10 * StringDuration(time.Second)
+	pconf.AbsoluteTimeTolerance = 10 * StringDuration(time.Second)
+
+	// RTSP multicast
+	pconf.RTSPMulticastTTL = 127
 
 	// Record
 	pconf.RecordPath = "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f"
@@ -158,10 +217,28 @@ func (pconf *Path) setDefaults() {
 	pconf.RecordPartDuration = 100 * StringDuration(time.Millisecond)
 	pconf.RecordSegmentDuration = 3600 * StringDuration(time.Second)
 	pconf.RecordDeleteAfter = 24 * 3600 * StringDuration(time.Second)
+	pconf.RecordTracks = []string{}
+
+	// Event recording
+	pconf.RecordPreEventDuration = 10 * StringDuration(time.Second)
+	pconf.RecordPostEventDuration = 10 * StringDuration(time.Second)
+
+	// Record to S3
+	pconf.RecordS3Region = "us-east-1"
+	pconf.RecordS3SpoolMaxSize = 1024 * 1024 * 1024
 
 	// Publisher source
 	pconf.OverridePublisher = true
 
+	// RTSP source
+	pconf.RTSPMedias = []string{}
+	pconf.RTSPSourceFallbacks = []string{}
+	pconf.RTSPSourcePrimaryCheckPeriod = 30 * StringDuration(time.Second)
+
+	// HLS source
+	pconf.HLSSourceFailoverAttempts = 3
+	pconf.HLSSourceFallbacks = []string{}
+
 	// Raspberry Pi Camera source
 	pconf.RPICameraWidth = 1920
 	pconf.RPICameraHeight = 1080
@@ -212,6 +289,30 @@ func (pconf Path) Clone() *Path {
 	return &dest
 }
 
+// recordPathHasPathDir returns whether the record path contains a directory
+// that contains the %path variable only, and that precedes any other variable.
+// The deepest directory without variables is therefore specific to each path.
+func recordPathHasPathDir(recordPath string) bool {
+	parts := strings.FieldsFunc(recordPath, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	// the last part is the file name
+	for _, part := range parts[:len(parts)-1] {
+		if !strings.Contains(part, "%") {
+			continue
+		}
+
+		return strings.Contains(part, "%path") && !strings.Contains(strings.ReplaceAll(part, "%path", ""), "%")
+	}
+
+	return false
+}
+
 func (pconf *Path) check(conf *Conf, name string) error {
 	pconf.Name = name
 
@@ -359,6 +460,78 @@ func (pconf *Path) check(conf *Conf, name string) error {
 			}
 		}
 	}
+	if pconf.StallTimeout < 0 {
+		return fmt.Errorf("'stallTimeout' can't be negative")
+	}
+	if pconf.AbsoluteTimeTolerance < 0 {
+		return fmt.Errorf("'absoluteTimeTolerance' can't be negative")
+	}
+
+	// RTSP multicast
+
+	if pconf.RTSPMulticastGroup != "" {
+		if pconf.Regexp != nil {
+			return fmt.Errorf(
+				"a path with a regular expression (or path 'all') cannot have a 'rtspMulticastGroup'. use another path")
+		}
+
+		group := net.ParseIP(pconf.RTSPMulticastGroup)
+		if group == nil || group.To4() == nil || !group.IsMulticast() {
+			return fmt.Errorf("'%s' is not a valid IPv4 multicast group", pconf.RTSPMulticastGroup)
+		}
+		if pconf.RTSPMulticastPort <= 0 || pconf.RTSPMulticastPort > 65535 || (pconf.RTSPMulticastPort%2) != 0 {
+			return fmt.Errorf("'rtspMulticastPort' must be an even port")
+		}
+		if pconf.RTSPMulticastTTL < 1 || pconf.RTSPMulticastTTL > 255 {
+			return fmt.Errorf("'rtspMulticastTTL' must be between 1 and 255")
+		}
+		if pconf.RTSPMulticastSource != "" {
+			source := net.ParseIP(pconf.RTSPMulticastSource)
+			if source == nil || source.To4() == nil {
+				return fmt.Errorf("'%s' is not a valid IPv4 address", pconf.RTSPMulticastSource)
+			}
+			if group.To4()[0] != 232 {
+				return fmt.Errorf("source-specific multicast requires a group in the 232.0.0.0/8 range")
+			}
+		}
+	} else if pconf.RTSPMulticastAlwaysOn {
+		return fmt.Errorf("'rtspMulticastAlwaysOn' requires 'rtspMulticastGroup'")
+	}
+
+	// Record
+
+	for _, sel := range pconf.RecordTracks {
+		if sel == "" {
+			return fmt.Errorf("invalid 'recordTracks': empty selector")
+		}
+	}
+
+	if pconf.RecordManifestKey != "" && !recordPathHasPathDir(pconf.RecordPath) {
+		return fmt.Errorf("when 'recordManifestKey' is set, 'recordPath' must contain a directory " +
+			"named after %%path that precedes any other variable (i.e. ./recordings/%%path/%%Y-%%m-%%d_%%H-%%M-%%S-%%f), " +
+			"since manifests are placed in that directory")
+	}
+
+	// Recording schedule
+
+	if pconf.RecordScheduleTimezone != "" {
+		_, err := time.LoadLocation(pconf.RecordScheduleTimezone)
+		if err != nil {
+			return fmt.Errorf("invalid 'recordScheduleTimezone': %v", err)
+		}
+	}
+
+	// Record to S3
+
+	if pconf.RecordS3Endpoint != "" {
+		u, err := gourl.Parse(pconf.RecordS3Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("'recordS3Endpoint' must be a HTTP URL")
+		}
+		if pconf.RecordS3Bucket == "" {
+			return fmt.Errorf("'recordS3Bucket' must be filled when 'recordS3Endpoint' is set")
+		}
+	}
 
 	// Authentication
 
@@ -419,6 +592,73 @@ func (pconf *Path) check(conf *Conf, name string) error {
 	if pconf.SourceAnyPortEnable != nil {
 		pconf.RTSPAnyPort = *pconf.SourceAnyPortEnable
 	}
+	for _, sel := range pconf.RTSPMedias {
+		if sel == "" {
+			return fmt.Errorf("invalid 'rtspMedias': empty selector")
+		}
+	}
+	for _, fallback := range pconf.RTSPSourceFallbacks {
+		if !strings.HasPrefix(fallback, "rtsp://") && !strings.HasPrefix(fallback, "rtsps://") {
+			return fmt.Errorf("'%s' is not a valid RTSP URL", fallback)
+		}
+
+		_, err := base.ParseURL(fallback)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid RTSP URL", fallback)
+		}
+	}
+	if len(pconf.RTSPSourceFallbacks) != 0 &&
+		!strings.HasPrefix(pconf.Source, "rtsp://") && !strings.HasPrefix(pconf.Source, "rtsps://") {
+		return fmt.Errorf("'rtspSourceFallbacks' can be used only when source is a RTSP URL")
+	}
+	if pconf.RTSPSourceStallTimeout < 0 {
+		return fmt.Errorf("'rtspSourceStallTimeout' can't be negative")
+	}
+	if pconf.RTSPSourcePrimaryCheckPeriod < 0 {
+		return fmt.Errorf("'rtspSourcePrimaryCheckPeriod' can't be negative")
+	}
+
+	// RTSP parameters
+
+	if pconf.RTSPParametersToSource &&
+		!strings.HasPrefix(pconf.Source, "rtsp://") && !strings.HasPrefix(pconf.Source, "rtsps://") {
+		return fmt.Errorf("'rtspParametersToSource' can be used only when source is a RTSP URL")
+	}
+	if pconf.RTSPParametersWebhook != "" {
+		if pconf.RTSPParametersToSource {
+			return fmt.Errorf("'rtspParametersToSource' and 'rtspParametersWebhook' can't be used together")
+		}
+
+		u, err := gourl.Parse(pconf.RTSPParametersWebhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("'rtspParametersWebhook' must be a HTTP URL")
+		}
+	}
+
+	// HLS source
+
+	if pconf.HLSSourceMaxBandwidth < 0 {
+		return fmt.Errorf("'hlsSourceMaxBandwidth' can't be negative")
+	}
+	if pconf.HLSSourceMaxResolution != "" {
+		_, _, err := ParseResolution(pconf.HLSSourceMaxResolution)
+		if err != nil {
+			return fmt.Errorf("invalid 'hlsSourceMaxResolution': %v", err)
+		}
+	}
+	if pconf.HLSSourceFailoverAttempts < 0 {
+		return fmt.Errorf("'hlsSourceFailoverAttempts' can't be negative")
+	}
+	for _, fallback := range pconf.HLSSourceFallbacks {
+		u, err := gourl.Parse(fallback)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("'%s' is not a valid HLS URL", fallback)
+		}
+	}
+	if len(pconf.HLSSourceFallbacks) != 0 &&
+		!strings.HasPrefix(pconf.Source, "http://") && !strings.HasPrefix(pconf.Source, "https://") {
+		return fmt.Errorf("'hlsSourceFallbacks' can be used only when source is a HLS URL")
+	}
 
 	// Redirect source
 
@@ -498,6 +738,19 @@ func (pconf *Path) Equal(other *Path) bool {
 	return reflect.DeepEqual(pconf, other)
 }
 
+// RecordScheduleLocation returns the location in which the recording schedule is evaluated.
+func (pconf Path) RecordScheduleLocation() *time.Location {
+	if pconf.RecordScheduleTimezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(pconf.RecordScheduleTimezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
 // HasStaticSource checks whether the path has a static source.
 func (pconf Path) HasStaticSource() bool {
 	return strings.HasPrefix(pconf.Source, "rtsp://") ||
@@ -12,6 +12,8 @@ type RecordFormat int
 const (
 	RecordFormatFMP4 RecordFormat = iota
 	RecordFormatMPEGTS
+	RecordFormatMKV
+	RecordFormatWebM
 )
 
 // MarshalJSON implements json.Marshaler.
@@ -22,6 +24,12 @@ func (d RecordFormat) MarshalJSON() ([]byte, error) {
 	case RecordFormatMPEGTS:
 		out = "mpegts"
 
+	case RecordFormatMKV:
+		out = "mkv"
+
+	case RecordFormatWebM:
+		out = "webm"
+
 	default:
 		out = "fmp4"
 	}
@@ -40,6 +48,12 @@ func (d *RecordFormat) UnmarshalJSON(b []byte) error {
 	case "mpegts":
 		*d = RecordFormatMPEGTS
 
+	case "mkv":
+		*d = RecordFormatMKV
+
+	case "webm":
+		*d = RecordFormatWebM
+
 	case "fmp4":
 		*d = RecordFormatFMP4
 
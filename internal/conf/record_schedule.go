@@ -0,0 +1,233 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseWeekday(v string) (time.Weekday, error) {
+	for i, name := range weekdayNames {
+		if v == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday '%s'", v)
+}
+
+func parseTimeOfDay(v string) (time.Duration, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time '%s'", v)
+	}
+
+	h, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s'", v)
+	}
+
+	m, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time '%s'", v)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// RecordScheduleWindow is a weekly time window.
+// If End is before Start, the window ends on the following day.
+type RecordScheduleWindow struct {
+	Weekdays [7]bool
+	Start    time.Duration
+	End      time.Duration
+}
+
+func (w *RecordScheduleWindow) unmarshal(v string) error {
+	fields := strings.Fields(v)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid schedule window '%s'", v)
+	}
+
+	if fields[0] == "*" {
+		for i := range w.Weekdays {
+			w.Weekdays[i] = true
+		}
+	} else {
+		for _, item := range strings.Split(fields[0], ",") {
+			first, last, isRange := strings.Cut(item, "-")
+
+			start, err := parseWeekday(first)
+			if err != nil {
+				return err
+			}
+
+			end := start
+			if isRange {
+				end, err = parseWeekday(last)
+				if err != nil {
+					return err
+				}
+			}
+
+			for d := start; ; d = (d + 1) % 7 {
+				w.Weekdays[d] = true
+				if d == end {
+					break
+				}
+			}
+		}
+	}
+
+	first, last, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return fmt.Errorf("invalid time range '%s'", fields[1])
+	}
+
+	var err error
+	w.Start, err = parseTimeOfDay(first)
+	if err != nil {
+		return err
+	}
+
+	w.End, err = parseTimeOfDay(last)
+	if err != nil {
+		return err
+	}
+
+	if w.Start == w.End || w.Start == 24*time.Hour {
+		return fmt.Errorf("invalid time range '%s'", fields[1])
+	}
+
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (w RecordScheduleWindow) String() string {
+	var days []string
+	for i, enabled := range w.Weekdays {
+		if enabled {
+			days = append(days, weekdayNames[i])
+		}
+	}
+
+	dayStr := strings.Join(days, ",")
+	if len(days) == 7 {
+		dayStr = "*"
+	}
+
+	tod := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int((d%time.Hour)/time.Minute))
+	}
+
+	return dayStr + " " + tod(w.Start) + "-" + tod(w.End)
+}
+
+func (w RecordScheduleWindow) contains(t time.Time) bool {
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	if w.Start < w.End {
+		return w.Weekdays[t.Weekday()] && tod >= w.Start && tod < w.End
+	}
+
+	// window ends on the following day
+	return (w.Weekdays[t.Weekday()] && tod >= w.Start) ||
+		(w.Weekdays[(t.Weekday()+6)%7] && tod < w.End)
+}
+
+// RecordSchedule is the recordSchedule parameter.
+// It contains time windows in the form "mon-fri 08:00-18:00".
+type RecordSchedule []RecordScheduleWindow
+
+// MarshalJSON implements json.Marshaler.
+func (d RecordSchedule) MarshalJSON() ([]byte, error) {
+	out := make([]string, len(d))
+
+	for i, v := range d {
+		out[i] = v.String()
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *RecordSchedule) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, t := range in {
+		var w RecordScheduleWindow
+		err := w.unmarshal(t)
+		if err != nil {
+			return err
+		}
+		*d = append(*d, w)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+// Windows are separated by semicolons.
+func (d *RecordSchedule) UnmarshalEnv(_ string, v string) error {
+	byts, _ := json.Marshal(strings.Split(v, ";"))
+	return d.UnmarshalJSON(byts)
+}
+
+// Active checks whether t is inside a window.
+// An empty schedule is always active.
+func (d RecordSchedule) Active(t time.Time) bool {
+	if len(d) == 0 {
+		return true
+	}
+
+	for _, w := range d {
+		if w.contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextChange returns the first instant after t in which Active() changes.
+// It returns a zero time if Active() never changes.
+func (d RecordSchedule) NextChange(t time.Time) time.Time {
+	var candidates []time.Time
+
+	year, month, day := t.Date()
+
+	for i := 0; i <= 8; i++ {
+		for _, w := range d {
+			for _, tod := range []time.Duration{w.Start, w.End} {
+				c := time.Date(year, month, day+i, int(tod/time.Hour), int((tod%time.Hour)/time.Minute), 0, 0, t.Location())
+				if c.After(t) {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	cur := d.Active(t)
+
+	for _, c := range candidates {
+		if d.Active(c) != cur {
+			return c
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,27 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseResolution parses a resolution in the WIDTHxHEIGHT format.
+func ParseResolution(s string) (int, int, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("resolution must be in the WIDTHxHEIGHT format")
+	}
+
+	width, err := strconv.ParseUint(parts[0], 10, 31)
+	if err != nil || width == 0 {
+		return 0, 0, fmt.Errorf("invalid width: '%s'", parts[0])
+	}
+
+	height, err := strconv.ParseUint(parts[1], 10, 31)
+	if err != nil || height == 0 {
+		return 0, 0, fmt.Errorf("invalid height: '%s'", parts[1])
+	}
+
+	return int(width), int(height), nil
+}
@@ -2,8 +2,10 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
@@ -17,7 +19,9 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpserv"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
 )
 
 func interfaceIsEmpty(i interface{}) bool {
@@ -97,9 +101,24 @@ func paramName(ctx *gin.Context) (string, bool) {
 	return name[1:], true
 }
 
+func recordErrorStatus(err error) int {
+	if errors.Is(err, errPathNotFound) {
+		return http.StatusNotFound
+	}
+
+	if _, ok := err.(errPathRecordModeNotEvent); ok {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
 type apiPathManager interface {
 	apiPathsList() (*defs.APIPathList, error)
 	apiPathsGet(string) (*defs.APIPath, error)
+	apiPathsRecordStart(string) error
+	apiPathsRecordStop(string) error
+	apiPathsSnapshot(string) (*snapshot.Snapshot, error)
 }
 
 type apiHLSManager interface {
@@ -201,6 +220,11 @@ func newAPI(
 
 	group.GET("/v3/paths/list", a.onPathsList)
 	group.GET("/v3/paths/get/*name", a.onPathsGet)
+	group.POST("/v3/paths/record/start/*name", a.onPathsRecordStart)
+	group.POST("/v3/paths/record/stop/*name", a.onPathsRecordStop)
+	group.GET("/v3/paths/snapshot/*name", a.onPathsSnapshot)
+
+	group.GET("/v3/recordings/verify/*name", a.onRecordingsVerify)
 
 	if !interfaceIsEmpty(a.hlsManager) {
 		group.GET("/v3/hlsmuxers/list", a.onHLSMuxersList)
@@ -580,6 +604,58 @@ func (a *api) onPathsGet(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, data)
 }
 
+func (a *api) onPathsRecordStart(ctx *gin.Context) {
+	name, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	err := a.pathManager.apiPathsRecordStart(name)
+	if err != nil {
+		a.writeError(ctx, recordErrorStatus(err), err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onPathsRecordStop(ctx *gin.Context) {
+	name, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	err := a.pathManager.apiPathsRecordStop(name)
+	if err != nil {
+		a.writeError(ctx, recordErrorStatus(err), err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onPathsSnapshot(ctx *gin.Context) {
+	name, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	snap, err := a.pathManager.apiPathsSnapshot(name)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !snap.NTP.IsZero() {
+		ctx.Header("Last-Modified", snap.NTP.UTC().Format(http.TimeFormat))
+	}
+
+	ctx.Data(http.StatusOK, snap.ContentType, snap.Data)
+}
+
 func (a *api) onRTSPConnsList(ctx *gin.Context) {
 	data, err := a.rtspServer.apiConnsList()
 	if err != nil {
@@ -848,6 +924,43 @@ func (a *api) onRTMPSConnsKick(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *api) onRecordingsVerify(ctx *gin.Context) {
+	name, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	a.mutex.Lock()
+	c := a.conf
+	a.mutex.Unlock()
+
+	_, pathConf, _, err := getConfForPath(c.Paths, name)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordManifestKey == "" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("manifests of path '%s' are disabled", name))
+		return
+	}
+
+	key, err := record.LoadManifestPublicKey(pathConf.RecordManifestKey)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	report, err := record.VerifyManifest(filepath.Dir(record.ManifestPath(pathConf.RecordPath, name)), key)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
 func (a *api) onHLSMuxersList(ctx *gin.Context) {
 	data, err := a.hlsManager.apiMuxersList()
 	if err != nil {
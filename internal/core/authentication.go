@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/auth"
 	"github.com/bluenviron/gortsplib/v4/pkg/headers"
@@ -48,6 +49,7 @@ const (
 	authProtocolHLS    authProtocol = "hls"
 	authProtocolWebRTC authProtocol = "webrtc"
 	authProtocolSRT    authProtocol = "srt"
+	authProtocolONVIF  authProtocol = "onvif"
 )
 
 func doExternalAuthentication(
@@ -109,6 +111,17 @@ func doAuthentication(
 		}
 	}
 
+	if accessRequest.onvifToken != nil {
+		accessRequest.user = accessRequest.onvifToken.Username
+		if !accessRequest.onvifToken.IsDigest {
+			accessRequest.pass = accessRequest.onvifToken.Password
+		} else if externalAuthenticationURL != "" {
+			// the password is not available and can't be forwarded.
+			return &errAuthentication{message: "UsernameToken digests can't be used together with " +
+				"'externalAuthenticationURL', use plain text tokens or basic authentication"}
+		}
+	}
+
 	if externalAuthenticationURL != "" {
 		err := doExternalAuthentication(
 			externalAuthenticationURL,
@@ -152,6 +165,16 @@ func doAuthentication(
 			if err != nil {
 				return &errAuthentication{message: err.Error()}
 			}
+		} else if accessRequest.onvifToken != nil && accessRequest.onvifToken.IsDigest {
+			if strings.HasPrefix(pathPass, "sha256:") {
+				return &errAuthentication{message: "UsernameToken digests can't be validated against " +
+					"hashed credentials, use plain text tokens or basic authentication"}
+			}
+
+			if !checkCredential(pathUser, accessRequest.user) ||
+				!accessRequest.onvifToken.ValidateDigest(pathPass, time.Now()) {
+				return &errAuthentication{message: "invalid credentials"}
+			}
 		} else if !checkCredential(pathUser, accessRequest.user) ||
 			!checkCredential(pathPass, accessRequest.pass) {
 			return &errAuthentication{message: "invalid credentials"}
@@ -34,15 +34,25 @@ var defaultConfPaths = []string{
 	"/etc/mediamtx/mediamtx.yml",
 }
 
-func gatherCleanerEntries(paths map[string]*conf.Path) []record.CleanerEntry {
+func gatherCleanerEntries(cnf *conf.Conf) []record.CleanerEntry {
 	out := make(map[record.CleanerEntry]struct{})
 
-	for _, pa := range paths {
-		if pa.Record && pa.RecordDeleteAfter != 0 {
+	globalQuotas := cnf.RecordTotalMaxSize != 0 || cnf.RecordMinFreeSpace != 0
+
+	for _, pa := range cnf.Paths {
+		if pa.Record && (pa.RecordDeleteAfter != 0 || pa.RecordMaxSize != 0 || globalQuotas) {
 			entry := record.CleanerEntry{
-				RecordPath:        pa.RecordPath,
-				RecordFormat:      pa.RecordFormat,
-				RecordDeleteAfter: time.Duration(pa.RecordDeleteAfter),
+				RecordPath:              pa.RecordPath,
+				RecordFormat:            pa.RecordFormat,
+				RecordDeleteAfter:       time.Duration(pa.RecordDeleteAfter),
+				RecordMaxSize:           uint64(pa.RecordMaxSize),
+				RecordS3Endpoint:        pa.RecordS3Endpoint,
+				RecordS3Region:          pa.RecordS3Region,
+				RecordS3Bucket:          pa.RecordS3Bucket,
+				RecordS3AccessKeyID:     pa.RecordS3AccessKeyID,
+				RecordS3SecretAccessKey: pa.RecordS3SecretAccessKey,
+				RecordS3Prefix:          pa.RecordS3Prefix,
+				WriteTimeout:            time.Duration(cnf.WriteTimeout),
 			}
 			out[entry] = struct{}{}
 		}
@@ -67,8 +77,11 @@ func gatherCleanerEntries(paths map[string]*conf.Path) []record.CleanerEntry {
 }
 
 var cli struct {
-	Version  bool   `help:"print version"`
-	Confpath string `arg:"" default:""`
+	Version        bool   `help:"print version"`
+	RepairIndex    string `help:"rebuild indexes of recording segments in a file or directory, and exit" placeholder:"PATH"` //nolint:lll
+	VerifyManifest string `help:"verify recordings of a directory against their manifest, and exit" placeholder:"PATH"`
+	ManifestKey    string `help:"public or private key used to verify the manifest, in PEM format" placeholder:"PATH"`
+	Confpath       string `arg:"" default:""`
 }
 
 // Core is an instance of MediaMTX.
@@ -90,6 +103,7 @@ type Core struct {
 	hlsManager      *hlsManager
 	webRTCManager   *webRTCManager
 	srtServer       *srtServer
+	onvifServer     *onvifServer
 	api             *api
 	confWatcher     *confwatcher.ConfWatcher
 
@@ -126,6 +140,24 @@ func New(args []string) (*Core, bool) {
 		os.Exit(0)
 	}
 
+	if cli.RepairIndex != "" {
+		err := repairSegmentIndexes(cli.RepairIndex)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if cli.VerifyManifest != "" {
+		err := verifyManifest(cli.VerifyManifest, cli.ManifestKey)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
 	p := &Core{
@@ -292,13 +324,23 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
-	cleanerEntries := gatherCleanerEntries(p.conf.Paths)
+	if initial {
+		p.recoverRecordings()
+	}
+
+	cleanerEntries := gatherCleanerEntries(p.conf)
 	if len(cleanerEntries) != 0 &&
 		p.recordCleaner == nil {
 		p.recordCleaner = record.NewCleaner(
 			cleanerEntries,
+			uint64(p.conf.RecordTotalMaxSize),
+			p.conf.RecordMinFreeSpace,
 			p,
 		)
+
+		if p.metrics != nil {
+			p.metrics.setRecordCleaner(p.recordCleaner)
+		}
 	}
 
 	if p.pathManager == nil {
@@ -322,7 +364,11 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.Encryption == conf.EncryptionOptional) &&
 		p.rtspServer == nil {
 		_, useUDP := p.conf.Protocols[conf.Protocol(gortsplib.TransportUDP)]
-		_, useMulticast := p.conf.Protocols[conf.Protocol(gortsplib.TransportUDPMulticast)]
+
+		rtspTunnelAddress := ""
+		if p.conf.RTSPTunnel {
+			rtspTunnelAddress = p.conf.RTSPTunnelAddress
+		}
 
 		p.rtspServer, err = newRTSPServer(
 			p.conf.RTSPAddress,
@@ -330,8 +376,8 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.ReadTimeout,
 			p.conf.WriteTimeout,
 			p.conf.WriteQueueSize,
+			p.conf.UDPMaxPayloadSize,
 			useUDP,
-			useMulticast,
 			p.conf.RTPAddress,
 			p.conf.RTCPAddress,
 			p.conf.MulticastIPRange,
@@ -340,6 +386,8 @@ func (p *Core) createResources(initial bool) error {
 			false,
 			"",
 			"",
+			rtspTunnelAddress,
+			p.conf.RTSPTunnelAllowOrigin,
 			p.conf.RTSPAddress,
 			p.conf.Protocols,
 			p.conf.RunOnConnect,
@@ -359,22 +407,27 @@ func (p *Core) createResources(initial bool) error {
 		(p.conf.Encryption == conf.EncryptionStrict ||
 			p.conf.Encryption == conf.EncryptionOptional) &&
 		p.rtspsServer == nil {
+		_, useUDP := p.conf.Protocols[conf.Protocol(gortsplib.TransportUDP)]
+		useSRTP := p.conf.SRTP && useUDP
+
 		p.rtspsServer, err = newRTSPServer(
 			p.conf.RTSPSAddress,
 			p.conf.AuthMethods,
 			p.conf.ReadTimeout,
 			p.conf.WriteTimeout,
 			p.conf.WriteQueueSize,
-			false,
-			false,
-			"",
-			"",
+			p.conf.UDPMaxPayloadSize,
+			useSRTP,
+			p.conf.SRTPAddress,
+			p.conf.SRTCPAddress,
 			"",
 			0,
 			0,
 			true,
 			p.conf.ServerCert,
 			p.conf.ServerKey,
+			"",
+			"",
 			p.conf.RTSPAddress,
 			p.conf.Protocols,
 			p.conf.RunOnConnect,
@@ -459,6 +512,9 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.HLSAllowOrigin,
 			p.conf.HLSTrustedProxies,
 			p.conf.HLSDirectory,
+			newHLSOriginClient(p.conf),
+			p.conf.HLSOriginS3Prefix,
+			p.conf.HLSOriginRetention,
 			p.conf.ReadTimeout,
 			p.conf.WriteQueueSize,
 			p.pathManager,
@@ -521,6 +577,29 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
+	if p.conf.ONVIF &&
+		p.onvifServer == nil {
+		p.onvifServer = &onvifServer{
+			Address:      p.conf.ONVIFAddress,
+			Discovery:    p.conf.ONVIFDiscovery,
+			ReadTimeout:  p.conf.ReadTimeout,
+			WriteTimeout: p.conf.WriteTimeout,
+			RTSPAddress:  p.conf.RTSPAddress,
+			RTSPSAddress: p.conf.RTSPSAddress,
+			Encryption:   p.conf.Encryption,
+			PathConfs:    p.conf.Paths,
+			PathManager:  p.pathManager,
+			Parent:       p,
+
+			ExternalAuthenticationURL: p.conf.ExternalAuthenticationURL,
+		}
+		err = p.onvifServer.initialize()
+		if err != nil {
+			p.onvifServer = nil
+			return err
+		}
+	}
+
 	if p.conf.API &&
 		p.api == nil {
 		p.api, err = newAPI(
@@ -552,6 +631,39 @@ func (p *Core) createResources(initial bool) error {
 	return nil
 }
 
+// recoverRecordings recovers segments left incomplete by a previous run,
+// adds them to manifests and calls runOnRecordSegmentComplete for each of them.
+func (p *Core) recoverRecordings() {
+	recordPaths := make(map[string]struct{})
+
+	for _, pa := range p.conf.Paths {
+		if pa.Record && pa.RecordFormat == conf.RecordFormatFMP4 {
+			recordPaths[pa.RecordPath] = struct{}{}
+		}
+	}
+
+	for recordPath := range recordPaths {
+		record.RecoverSegments(recordPath, p, func(pathName string, segmentPath string) {
+			_, pathConf, matches, err := getConfForPath(p.conf.Paths, pathName)
+			if err != nil {
+				return
+			}
+
+			if pathConf.RecordManifestKey != "" {
+				key, err := record.LoadManifestPrivateKey(pathConf.RecordManifestKey)
+				if err != nil {
+					p.Log(logger.Error, "unable to load manifest key: %v", err)
+				} else {
+					record.AddToManifest(pathConf.RecordPath, pathConf.RecordFormat, pathName, key, segmentPath, p)
+				}
+			}
+
+			runOnRecordSegmentComplete(p.externalCmdPool, pathConf,
+				pathExternalCmdEnv(p.conf.RTSPAddress, pathName, matches), segmentPath, p)
+		})
+	}
+}
+
 func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeLogger := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
@@ -571,7 +683,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closeLogger
 
 	closeRecorderCleaner := newConf == nil ||
-		!reflect.DeepEqual(gatherCleanerEntries(newConf.Paths), gatherCleanerEntries(p.conf.Paths)) ||
+		!reflect.DeepEqual(gatherCleanerEntries(newConf), gatherCleanerEntries(p.conf)) ||
+		newConf.RecordTotalMaxSize != p.conf.RecordTotalMaxSize ||
+		newConf.RecordMinFreeSpace != p.conf.RecordMinFreeSpace ||
+		closeMetrics ||
 		closeLogger
 
 	closePathManager := newConf == nil ||
@@ -596,12 +711,16 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
+		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RTPAddress != p.conf.RTPAddress ||
 		newConf.RTCPAddress != p.conf.RTCPAddress ||
 		newConf.MulticastIPRange != p.conf.MulticastIPRange ||
 		newConf.MulticastRTPPort != p.conf.MulticastRTPPort ||
 		newConf.MulticastRTCPPort != p.conf.MulticastRTCPPort ||
+		newConf.RTSPTunnel != p.conf.RTSPTunnel ||
+		newConf.RTSPTunnelAddress != p.conf.RTSPTunnelAddress ||
+		newConf.RTSPTunnelAllowOrigin != p.conf.RTSPTunnelAllowOrigin ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
@@ -619,8 +738,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
+		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
 		newConf.ServerCert != p.conf.ServerCert ||
 		newConf.ServerKey != p.conf.ServerKey ||
+		newConf.SRTP != p.conf.SRTP ||
+		newConf.SRTPAddress != p.conf.SRTPAddress ||
+		newConf.SRTCPAddress != p.conf.SRTCPAddress ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
@@ -678,6 +801,13 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.HLSAllowOrigin != p.conf.HLSAllowOrigin ||
 		!reflect.DeepEqual(newConf.HLSTrustedProxies, p.conf.HLSTrustedProxies) ||
 		newConf.HLSDirectory != p.conf.HLSDirectory ||
+		newConf.HLSOriginS3Endpoint != p.conf.HLSOriginS3Endpoint ||
+		newConf.HLSOriginS3Region != p.conf.HLSOriginS3Region ||
+		newConf.HLSOriginS3Bucket != p.conf.HLSOriginS3Bucket ||
+		newConf.HLSOriginS3AccessKeyID != p.conf.HLSOriginS3AccessKeyID ||
+		newConf.HLSOriginS3SecretAccessKey != p.conf.HLSOriginS3SecretAccessKey ||
+		newConf.HLSOriginS3Prefix != p.conf.HLSOriginS3Prefix ||
+		newConf.HLSOriginRetention != p.conf.HLSOriginRetention ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		closePathManager ||
@@ -718,6 +848,22 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closePathManager ||
 		closeLogger
 
+	closeONVIFServer := newConf == nil ||
+		newConf.ONVIF != p.conf.ONVIF ||
+		newConf.ONVIFAddress != p.conf.ONVIFAddress ||
+		newConf.ONVIFDiscovery != p.conf.ONVIFDiscovery ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.WriteTimeout != p.conf.WriteTimeout ||
+		newConf.RTSPAddress != p.conf.RTSPAddress ||
+		newConf.RTSPSAddress != p.conf.RTSPSAddress ||
+		newConf.Encryption != p.conf.Encryption ||
+		newConf.ExternalAuthenticationURL != p.conf.ExternalAuthenticationURL ||
+		closePathManager ||
+		closeLogger
+	if !closeONVIFServer && p.onvifServer != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
+		p.onvifServer.confReload(newConf.Paths)
+	}
+
 	closeAPI := newConf == nil ||
 		newConf.API != p.conf.API ||
 		newConf.APIAddress != p.conf.APIAddress ||
@@ -745,6 +891,11 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		}
 	}
 
+	if closeONVIFServer && p.onvifServer != nil {
+		p.onvifServer.close()
+		p.onvifServer = nil
+	}
+
 	if closeSRTServer && p.srtServer != nil {
 		p.srtServer.close()
 		p.srtServer = nil
@@ -786,6 +937,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	}
 
 	if closeRecorderCleaner && p.recordCleaner != nil {
+		if p.metrics != nil {
+			p.metrics.setRecordCleaner(nil)
+		}
+
 		p.recordCleaner.Close()
 		p.recordCleaner = nil
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 )
 
 type hlsManagerAPIMuxersListRes struct {
@@ -43,6 +44,9 @@ type hlsManager struct {
 	partDuration              conf.StringDuration
 	segmentMaxSize            conf.StringSize
 	directory                 string
+	originClient              *s3.Client
+	originPrefix              string
+	originRetention           conf.StringDuration
 	writeQueueSize            int
 	pathManager               *pathManager
 	metrics                   *metrics
@@ -78,6 +82,9 @@ func newHLSManager(
 	allowOrigin string,
 	trustedProxies conf.IPsOrCIDRs,
 	directory string,
+	originClient *s3.Client,
+	originPrefix string,
+	originRetention conf.StringDuration,
 	readTimeout conf.StringDuration,
 	writeQueueSize int,
 	pathManager *pathManager,
@@ -95,6 +102,9 @@ func newHLSManager(
 		partDuration:              partDuration,
 		segmentMaxSize:            segmentMaxSize,
 		directory:                 directory,
+		originClient:              originClient,
+		originPrefix:              originPrefix,
+		originRetention:           originRetention,
 		writeQueueSize:            writeQueueSize,
 		pathManager:               pathManager,
 		parent:                    parent,
@@ -242,6 +252,9 @@ func (m *hlsManager) createMuxer(pathName string, remoteAddr string) *hlsMuxer {
 		m.partDuration,
 		m.segmentMaxSize,
 		m.directory,
+		m.originClient,
+		m.originPrefix,
+		m.originRetention,
 		m.writeQueueSize,
 		&m.wg,
 		pathName,
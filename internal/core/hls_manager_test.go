@@ -6,6 +6,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -220,3 +224,231 @@ func TestHLSRead(t *testing.T) {
 		Payload: []byte{0x01, 0x02, 0x03, 0x04},
 	}, pkt)*/
 }
+
+func TestHLSReadMPEGTSSegmenter(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		payload []byte
+	}{
+		{
+			"group of vop",
+			[]byte{
+				0x00, 0x00, 0x01, 0xb3, // group of VOP
+				0x01, 0x02, 0x03, 0x04,
+			},
+		},
+		{
+			"i-vop",
+			[]byte{
+				0x00, 0x00, 0x01, 0xb6, // VOP
+				0x10, 0x02, 0x03, 0x04, // I-VOP
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p, ok := newInstance("hlsAlwaysRemux: yes\n" +
+				"hlsVariant: mpegts\n" +
+				"hlsSegmentDuration: 1s\n" +
+				"paths:\n" +
+				"  all_others:\n")
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			medi := &description.Media{
+				Type: description.MediaTypeVideo,
+				Formats: []format.Format{&format.MPEG4Video{
+					PayloadTyp:     96,
+					ProfileLevelID: 1,
+					Config: []byte{
+						0x00, 0x00, 0x01, 0xb0, 0x01, 0x00, 0x00, 0x01,
+						0xb5, 0x89, 0x13, 0x00, 0x00, 0x01, 0x00, 0x00,
+						0x00, 0x01, 0x20, 0x00, 0xc4, 0x8d, 0x8a, 0xee,
+						0x05, 0x3c, 0x04, 0x64, 0x14, 0x43, 0x00, 0x00,
+						0x01, 0xb2, 0x4c, 0x61, 0x76, 0x63, 0x35, 0x38,
+						0x2e, 0x31, 0x33, 0x34, 0x2e, 0x31, 0x30, 0x30,
+					},
+				}},
+			}
+
+			v := gortsplib.TransportTCP
+			source := gortsplib.Client{
+				Transport: &v,
+			}
+			err := source.StartRecording("rtsp://localhost:8554/stream",
+				&description.Session{Medias: []*description.Media{medi}})
+			require.NoError(t, err)
+			defer source.Close()
+
+			time.Sleep(500 * time.Millisecond)
+
+			for i := 0; i < 3; i++ {
+				err = source.WritePacketRTP(medi, &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						Marker:         true,
+						PayloadType:    96,
+						SequenceNumber: 123 + uint16(i),
+						Timestamp:      45343 + uint32(i*90000),
+						SSRC:           563423,
+					},
+					Payload: ca.payload,
+				})
+				require.NoError(t, err)
+			}
+
+			hc := &http.Client{Transport: &http.Transport{}}
+
+			cnt := httpPullFile(t, hc, "http://localhost:8888/stream/index.m3u8")
+			require.Regexp(t, "#EXTM3U\n"+
+				"#EXT-X-VERSION:3\n"+
+				"#EXT-X-INDEPENDENT-SEGMENTS\n"+
+				"\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=[0-9]+,AVERAGE-BANDWIDTH=[0-9]+,CODECS=\"mp4v.20\"\n"+
+				"stream.m3u8\n", string(cnt))
+
+			cnt = httpPullFile(t, hc, "http://localhost:8888/stream/stream.m3u8")
+			require.Regexp(t, "#EXTM3U\n"+
+				"#EXT-X-VERSION:3\n"+
+				"#EXT-X-ALLOW-CACHE:NO\n"+
+				"#EXT-X-TARGETDURATION:1\n"+
+				"#EXT-X-MEDIA-SEQUENCE:0\n"+
+				"#EXT-X-PROGRAM-DATE-TIME:.+?Z\n"+
+				"#EXTINF:1\\.00000,\n"+
+				"(.*?_seg0.ts)\n"+
+				"#EXT-X-PROGRAM-DATE-TIME:.+?Z\n"+
+				"#EXTINF:1\\.00000,\n"+
+				"(.*?_seg1.ts)\n", string(cnt))
+
+			for _, seg := range regexp.MustCompile("\n(.*?_seg[0-9]+.ts)\n").FindAllStringSubmatch(string(cnt), -1) {
+				byts := httpPullFile(t, hc, "http://localhost:8888/stream/"+seg[1])
+
+				// each segment must start with a PAT (PID 0) and a PMT (PID 0x1000)
+				require.GreaterOrEqual(t, len(byts), 2*188)
+				require.Equal(t, byte(0x47), byts[0])
+				require.Equal(t, uint16(0), uint16(byts[1]&0x1f)<<8|uint16(byts[2]))
+				require.Equal(t, byte(0x47), byts[188])
+				require.Equal(t, uint16(0x1000), uint16(byts[188+1]&0x1f)<<8|uint16(byts[188+2]))
+			}
+		})
+	}
+}
+
+func TestHLSOrigin(t *testing.T) {
+	var mutex sync.Mutex
+	objects := make(map[string][]byte)
+	puts := make(map[string]int)
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/mybucket/")
+
+		switch r.Method {
+		case http.MethodPut:
+			byts, _ := io.ReadAll(r.Body)
+			objects[key] = byts
+			puts[key]++
+
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer storage.Close()
+
+	p, ok := newInstance("hlsAlwaysRemux: yes\n" +
+		"hlsVariant: mpegts\n" +
+		"hlsSegmentDuration: 1s\n" +
+		"hlsOriginS3Endpoint: " + storage.URL + "\n" +
+		"hlsOriginS3Bucket: mybucket\n" +
+		"hlsOriginS3Prefix: live/\n" +
+		"paths:\n" +
+		"  all_others:\n")
+	require.Equal(t, true, ok)
+
+	medi := &description.Media{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.MPEG4Video{
+			PayloadTyp:     96,
+			ProfileLevelID: 1,
+			Config: []byte{
+				0x00, 0x00, 0x01, 0xb0, 0x01, 0x00, 0x00, 0x01,
+				0xb5, 0x89, 0x13, 0x00, 0x00, 0x01, 0x00, 0x00,
+				0x00, 0x01, 0x20, 0x00, 0xc4, 0x8d, 0x8a, 0xee,
+				0x05, 0x3c, 0x04, 0x64, 0x14, 0x43, 0x00, 0x00,
+				0x01, 0xb2, 0x4c, 0x61, 0x76, 0x63, 0x35, 0x38,
+				0x2e, 0x31, 0x33, 0x34, 0x2e, 0x31, 0x30, 0x30,
+			},
+		}},
+	}
+
+	v := gortsplib.TransportTCP
+	source := gortsplib.Client{
+		Transport: &v,
+	}
+	err := source.StartRecording("rtsp://localhost:8554/stream",
+		&description.Session{Medias: []*description.Media{medi}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		err = source.WritePacketRTP(medi, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: 123 + uint16(i),
+				Timestamp:      45343 + uint32(i*90000),
+				SSRC:           563423,
+			},
+			Payload: []byte{
+				0x00, 0x00, 0x01, 0xb3, // group of VOP
+				0x01, 0x02, 0x03, 0x04,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	uploaded := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if _, ok := objects["live/stream/index.m3u8"]; !ok {
+			return false
+		}
+		if _, ok := objects["live/stream/stream.m3u8"]; !ok {
+			return false
+		}
+
+		for key, byts := range objects {
+			if strings.HasSuffix(key, "_seg0.ts") {
+				return len(byts) != 0 && byts[0] == 0x47
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < 50 && !uploaded(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Equal(t, true, uploaded())
+
+	// playlists are not uploaded again when they don't change
+	time.Sleep(1500 * time.Millisecond)
+
+	func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		require.Equal(t, 1, puts["live/stream/index.m3u8"])
+		require.Equal(t, 1, puts["live/stream/stream.m3u8"])
+	}()
+
+	p.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, 0, len(objects))
+}
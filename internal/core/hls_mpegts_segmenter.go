@@ -0,0 +1,330 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gohlslib/pkg/codecparams"
+	"github.com/bluenviron/gohlslib/pkg/codecs"
+	"github.com/bluenviron/gohlslib/pkg/playlist"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	hlsMPEGTSSegmenterMaxBufferSize = 64 * 1024
+)
+
+// hlsMPEGTSSegmenterNeeded checks whether a stream contains codecs that
+// are not supported by gohlslib but that can be muxed into MPEG-TS segments.
+func hlsMPEGTSSegmenterNeeded(desc *description.Session) bool {
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			switch forma.(type) {
+			case *format.MPEG4Video, *format.MPEG1Video, *format.MPEG1Audio, *format.AC3:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hlsMPEGTSSegmenterCodecs(desc *description.Session) []string {
+	var ret []string
+
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			switch forma := forma.(type) {
+			case *format.H265:
+				vps, sps, pps := forma.SafeParams()
+				ret = append(ret, codecparams.Marshal(&codecs.H265{VPS: vps, SPS: sps, PPS: pps}))
+
+			case *format.H264:
+				sps, pps := forma.SafeParams()
+				ret = append(ret, codecparams.Marshal(&codecs.H264{SPS: sps, PPS: pps}))
+
+			case *format.MPEG4Video:
+				ret = append(ret, "mp4v.20")
+
+			case *format.MPEG1Video:
+				ret = append(ret, "mp4v.6a")
+
+			case *format.Opus:
+				ret = append(ret, "opus")
+
+			case *format.MPEG4Audio:
+				ret = append(ret, codecparams.Marshal(&codecs.MPEG4Audio{Config: *forma.GetConfig()}))
+
+			case *format.MPEG1Audio:
+				ret = append(ret, "mp4a.6b")
+
+			case *format.AC3:
+				ret = append(ret, "ac-3")
+			}
+		}
+	}
+
+	return ret
+}
+
+type hlsMPEGTSSegment struct {
+	name     string
+	startDTS time.Duration
+	startNTP time.Time
+	duration time.Duration
+	buf      bytes.Buffer
+}
+
+type hlsMPEGTSSegmentWriter struct {
+	s *hlsMPEGTSSegment
+}
+
+func (w *hlsMPEGTSSegmentWriter) Write(p []byte) (int, error) {
+	return w.s.buf.Write(p)
+}
+
+// hlsMPEGTSSegmenter is a HLS muxer that generates MPEG-TS segments
+// with all the codecs supported by the MPEG-TS muxer.
+type hlsMPEGTSSegmenter struct {
+	segmentCount    int
+	segmentDuration time.Duration
+	segmentMaxSize  uint64
+
+	prefix         string
+	codecs         []string
+	sw             *hlsMPEGTSSegmentWriter
+	bw             *bufio.Writer
+	hasVideo       bool
+	currentSegment *hlsMPEGTSSegment
+	nextSegmentID  uint64
+
+	mutex              sync.Mutex
+	cond               *sync.Cond
+	closed             bool
+	segments           []*hlsMPEGTSSegment
+	segmentsByName     map[string]*hlsMPEGTSSegment
+	segmentDeleteCount int
+}
+
+func (s *hlsMPEGTSSegmenter) initialize(stream *stream.Stream, writer *asyncwriter.Writer) error {
+	var buf [6]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return err
+	}
+
+	s.prefix = hex.EncodeToString(buf[:])
+	s.codecs = hlsMPEGTSSegmenterCodecs(stream.Desc())
+	s.sw = &hlsMPEGTSSegmentWriter{}
+	s.bw = bufio.NewWriterSize(s.sw, hlsMPEGTSSegmenterMaxBufferSize)
+	s.cond = sync.NewCond(&s.mutex)
+	s.segmentsByName = make(map[string]*hlsMPEGTSSegment)
+
+	return mpegtsSetupWrite(stream, writer, s.bw, s.onWrite)
+}
+
+func (s *hlsMPEGTSSegmenter) close() {
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+
+	s.cond.Broadcast()
+}
+
+// onWrite is called before a unit is written.
+// Each segment is written with a new MPEG-TS writer, in order to make it start with
+// the program tables and to allow decoding it independently of the others.
+func (s *hlsMPEGTSSegmenter) onWrite(isVideo bool, randomAccess bool, dts time.Duration, ntp time.Time,
+) (bool, error) {
+	if isVideo {
+		s.hasVideo = true
+	}
+
+	switch {
+	case s.currentSegment == nil:
+		s.newSegment(dts, ntp)
+		return true, nil
+
+	case (!s.hasVideo || isVideo) &&
+		randomAccess &&
+		(dts-s.currentSegment.startDTS) >= s.segmentDuration:
+		s.currentSegment.duration = dts - s.currentSegment.startDTS
+		s.publishSegment(s.currentSegment)
+		s.newSegment(dts, ntp)
+		return true, nil
+
+	case uint64(s.currentSegment.buf.Len()) >= s.segmentMaxSize:
+		return false, fmt.Errorf("reached maximum segment size")
+	}
+
+	return false, nil
+}
+
+func (s *hlsMPEGTSSegmenter) newSegment(dts time.Duration, ntp time.Time) {
+	s.currentSegment = &hlsMPEGTSSegment{
+		name:     s.prefix + "_seg" + strconv.FormatUint(s.nextSegmentID, 10) + ".ts",
+		startDTS: dts,
+		startNTP: ntp,
+	}
+	s.nextSegmentID++
+	s.sw.s = s.currentSegment
+}
+
+func (s *hlsMPEGTSSegmenter) publishSegment(seg *hlsMPEGTSSegment) {
+	func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.segments = append(s.segments, seg)
+		s.segmentsByName[seg.name] = seg
+
+		if len(s.segments) > s.segmentCount {
+			delete(s.segmentsByName, s.segments[0].name)
+			s.segments = s.segments[1:]
+			s.segmentDeleteCount++
+		}
+	}()
+
+	s.cond.Broadcast()
+}
+
+func (s *hlsMPEGTSSegmenter) generateMultivariantPlaylist() ([]byte, error) {
+	var maxBandwidth uint64
+	var sizes uint64
+	var durations time.Duration
+
+	for _, seg := range s.segments {
+		size := uint64(seg.buf.Len())
+		bandwidth := 8 * size * uint64(time.Second) / uint64(seg.duration)
+		if bandwidth > maxBandwidth {
+			maxBandwidth = bandwidth
+		}
+		sizes += size
+		durations += seg.duration
+	}
+
+	averageBandwidth := int(8 * sizes * uint64(time.Second) / uint64(durations))
+
+	pl := &playlist.Multivariant{
+		Version:             3,
+		IndependentSegments: true,
+		Variants: []*playlist.MultivariantVariant{{
+			Bandwidth:        int(maxBandwidth),
+			AverageBandwidth: &averageBandwidth,
+			Codecs:           s.codecs,
+			URI:              "stream.m3u8",
+		}},
+	}
+
+	return pl.Marshal()
+}
+
+func (s *hlsMPEGTSSegmenter) generateMediaPlaylist() ([]byte, error) {
+	targetDuration := 0
+
+	// EXTINF, when rounded to the nearest integer, must be <= EXT-X-TARGETDURATION
+	for _, seg := range s.segments {
+		v := int(math.Round(seg.duration.Seconds()))
+		if v > targetDuration {
+			targetDuration = v
+		}
+	}
+
+	allowCache := false
+
+	pl := &playlist.Media{
+		Version:        3,
+		AllowCache:     &allowCache,
+		TargetDuration: targetDuration,
+		MediaSequence:  s.segmentDeleteCount,
+	}
+
+	for _, seg := range s.segments {
+		startNTP := seg.startNTP
+		pl.Segments = append(pl.Segments, &playlist.MediaSegment{
+			DateTime: &startNTP,
+			Duration: seg.duration,
+			URI:      seg.name,
+		})
+	}
+
+	return pl.Marshal()
+}
+
+// originFile returns the content and the content type of a playlist or segment.
+// Playlists are returned once the first segment is available.
+func (s *hlsMPEGTSSegmenter) originFile(name string) ([]byte, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch name {
+	case "index.m3u8", "stream.m3u8":
+		for !s.closed && len(s.segments) == 0 {
+			s.cond.Wait()
+		}
+
+		if s.closed {
+			return nil, "", fmt.Errorf("terminated")
+		}
+
+		var buf []byte
+		var err error
+		if name == "index.m3u8" {
+			buf, err = s.generateMultivariantPlaylist()
+		} else {
+			buf, err = s.generateMediaPlaylist()
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return buf, `application/vnd.apple.mpegurl`, nil
+
+	default:
+		seg, ok := s.segmentsByName[name]
+		if !ok {
+			return nil, "", errHLSOriginFileNotFound
+		}
+
+		return seg.buf.Bytes(), "video/MP2T", nil
+	}
+}
+
+func (s *hlsMPEGTSSegmenter) handle(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.URL.Path)
+
+	buf, contentType, err := s.originFile(name)
+	if err != nil {
+		if errors.Is(err, errHLSOriginFileNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch name {
+	case "index.m3u8":
+		w.Header().Set("Cache-Control", "max-age=30")
+	case "stream.m3u8":
+		w.Header().Set("Cache-Control", "no-cache")
+	default:
+		w.Header().Set("Cache-Control", "max-age=3600")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
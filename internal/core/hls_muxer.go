@@ -21,6 +21,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/unit"
 )
@@ -67,6 +68,9 @@ type hlsMuxer struct {
 	partDuration              conf.StringDuration
 	segmentMaxSize            conf.StringSize
 	directory                 string
+	originClient              *s3.Client
+	originPrefix              string
+	originRetention           conf.StringDuration
 	writeQueueSize            int
 	wg                        *sync.WaitGroup
 	pathName                  string
@@ -80,6 +84,7 @@ type hlsMuxer struct {
 	writer          *asyncwriter.Writer
 	lastRequestTime *int64
 	muxer           *gohlslib.Muxer
+	tsSegmenter     *hlsMPEGTSSegmenter
 	requests        []*hlsMuxerHandleRequestReq
 	bytesSent       *uint64
 
@@ -97,6 +102,9 @@ func newHLSMuxer(
 	partDuration conf.StringDuration,
 	segmentMaxSize conf.StringSize,
 	directory string,
+	originClient *s3.Client,
+	originPrefix string,
+	originRetention conf.StringDuration,
 	writeQueueSize int,
 	wg *sync.WaitGroup,
 	pathName string,
@@ -114,6 +122,9 @@ func newHLSMuxer(
 		partDuration:              partDuration,
 		segmentMaxSize:            segmentMaxSize,
 		directory:                 directory,
+		originClient:              originClient,
+		originPrefix:              originPrefix,
+		originRetention:           originRetention,
 		writeQueueSize:            writeQueueSize,
 		wg:                        wg,
 		pathName:                  pathName,
@@ -261,6 +272,10 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 
 	defer res.stream.RemoveReader(m.writer)
 
+	if m.variant == conf.HLSVariant(gohlslib.MuxerVariantMPEGTS) && hlsMPEGTSSegmenterNeeded(res.stream.Desc()) {
+		return m.runInnerMPEGTS(innerCtx, innerReady, res.stream)
+	}
+
 	var medias []*description.Media
 
 	videoMedia, videoTrack := m.createVideoTrack(res.stream)
@@ -274,6 +289,11 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 	}
 
 	if medias == nil {
+		if m.variant == conf.HLSVariant(gohlslib.MuxerVariantMPEGTS) {
+			return fmt.Errorf(
+				"the stream doesn't contain any supported codec, which are currently " +
+					"H265, H264, MPEG-4 Video, MPEG-1/2 Video, Opus, MPEG-4 Audio, MPEG-1 Audio, AC-3")
+		}
 		return fmt.Errorf(
 			"the stream doesn't contain any supported codec, which are currently H265, H264, Opus, MPEG-4 Audio")
 	}
@@ -300,7 +320,16 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 	if err != nil {
 		return fmt.Errorf("muxer error: %v", err)
 	}
-	defer m.muxer.Close()
+
+	// the muxer must be closed before the uploader, since the uploader
+	// may be waiting for the muxer to produce content.
+	uploader := m.startOriginUploader(&hlsOriginGohlslibSource{muxer: m.muxer})
+	defer func() {
+		m.muxer.Close()
+		if uploader != nil {
+			uploader.close()
+		}
+	}()
 
 	innerReady <- struct{}{}
 
@@ -309,6 +338,60 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 
 	m.writer.Start()
 
+	return m.runWriter(innerCtx)
+}
+
+// runInnerMPEGTS muxes streams that contain codecs not supported by gohlslib
+// by using the MPEG-TS writer shared with the SRT server.
+func (m *hlsMuxer) runInnerMPEGTS(
+	innerCtx context.Context,
+	innerReady chan struct{},
+	stream *stream.Stream,
+) error {
+	m.tsSegmenter = &hlsMPEGTSSegmenter{
+		segmentCount:    m.segmentCount,
+		segmentDuration: time.Duration(m.segmentDuration),
+		segmentMaxSize:  uint64(m.segmentMaxSize),
+	}
+
+	err := m.tsSegmenter.initialize(stream, m.writer)
+	if err != nil {
+		return err
+	}
+
+	uploader := m.startOriginUploader(m.tsSegmenter)
+	defer func() {
+		m.tsSegmenter.close()
+		if uploader != nil {
+			uploader.close()
+		}
+	}()
+
+	innerReady <- struct{}{}
+
+	m.Log(logger.Info, "is converting into HLS (MPEG-TS segmenter), %s",
+		readerMediaInfo(m.writer, stream))
+
+	m.writer.Start()
+
+	return m.runWriter(innerCtx)
+}
+
+func (m *hlsMuxer) startOriginUploader(source hlsOriginSource) *hlsOriginUploader {
+	if m.originClient == nil {
+		return nil
+	}
+
+	return newHLSOriginUploader(
+		m.originClient,
+		m.originPrefix+m.pathName+"/",
+		time.Duration(m.originRetention),
+		source,
+		m,
+	)
+}
+
+func (m *hlsMuxer) runWriter(innerCtx context.Context) error {
 	closeCheckTicker := time.NewTicker(closeCheckPeriod)
 	defer closeCheckTicker.Stop()
 
@@ -515,6 +598,11 @@ func (m *hlsMuxer) handleRequest(ctx *gin.Context) {
 		bytesSent:      m.bytesSent,
 	}
 
+	if m.tsSegmenter != nil {
+		m.tsSegmenter.handle(w, ctx.Request)
+		return
+	}
+
 	m.muxer.Handle(w, ctx.Request)
 }
 
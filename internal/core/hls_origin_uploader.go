@@ -0,0 +1,296 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/gohlslib"
+	"github.com/bluenviron/gohlslib/pkg/playlist"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+const (
+	hlsOriginUploaderCheckPeriod   = 500 * time.Millisecond
+	hlsOriginUploaderDeleteTimeout = 10 * time.Second
+)
+
+func newHLSOriginClient(cnf *conf.Conf) *s3.Client {
+	if cnf.HLSOriginS3Endpoint == "" {
+		return nil
+	}
+
+	return s3.NewClient(
+		cnf.HLSOriginS3Endpoint,
+		cnf.HLSOriginS3Region,
+		cnf.HLSOriginS3Bucket,
+		cnf.HLSOriginS3AccessKeyID,
+		cnf.HLSOriginS3SecretAccessKey,
+		time.Duration(cnf.WriteTimeout),
+	)
+}
+
+var errHLSOriginFileNotFound = errors.New("file not found")
+
+// hlsOriginSource provides the playlists and segments of a muxer.
+type hlsOriginSource interface {
+	originFile(name string) ([]byte, string, error)
+}
+
+// hlsOriginResponseWriter stores a response of a gohlslib muxer in memory.
+type hlsOriginResponseWriter struct {
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+func (w *hlsOriginResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hlsOriginResponseWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+func (w *hlsOriginResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+// hlsOriginGohlslibSource reads playlists and segments from a gohlslib muxer,
+// that provides them through its HTTP handler only.
+type hlsOriginGohlslibSource struct {
+	muxer *gohlslib.Muxer
+}
+
+func (s *hlsOriginGohlslibSource) originFile(name string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, "/"+name, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	w := &hlsOriginResponseWriter{header: make(http.Header)}
+	s.muxer.Handle(w, req)
+
+	switch w.code {
+	case http.StatusOK:
+		return w.buf.Bytes(), w.header.Get("Content-Type"), nil
+
+	case http.StatusNotFound:
+		return nil, "", errHLSOriginFileNotFound
+
+	default:
+		return nil, "", fmt.Errorf("bad status code: %d", w.code)
+	}
+}
+
+type hlsOriginFile struct {
+	removed time.Time
+}
+
+// hlsOriginUploader uploads segments and playlists generated by a muxer
+// to a S3-compatible object storage.
+type hlsOriginUploader struct {
+	client    *s3.Client
+	prefix    string
+	retention time.Duration
+	source    hlsOriginSource
+	parent    logger.Writer
+
+	ctx              context.Context
+	ctxCancel        func()
+	files            map[string]*hlsOriginFile
+	lastMedia        []byte
+	lastMultivariant []byte
+
+	done chan struct{}
+}
+
+func newHLSOriginUploader(
+	client *s3.Client,
+	prefix string,
+	retention time.Duration,
+	source hlsOriginSource,
+	parent logger.Writer,
+) *hlsOriginUploader {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	u := &hlsOriginUploader{
+		client:    client,
+		prefix:    prefix,
+		retention: retention,
+		source:    source,
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+		files:     make(map[string]*hlsOriginFile),
+		done:      make(chan struct{}),
+	}
+
+	go u.run()
+
+	return u
+}
+
+// close stops the uploader and deletes uploaded objects.
+// It must be called after the muxer has been closed.
+func (u *hlsOriginUploader) close() {
+	u.ctxCancel()
+	<-u.done
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), hlsOriginUploaderDeleteTimeout)
+	defer ctxCancel()
+
+	for name := range u.files {
+		u.client.DeleteObject(ctx, u.prefix+name) //nolint:errcheck
+	}
+	u.client.DeleteObject(ctx, u.prefix+"stream.m3u8") //nolint:errcheck
+	u.client.DeleteObject(ctx, u.prefix+"index.m3u8")  //nolint:errcheck
+}
+
+func (u *hlsOriginUploader) Log(level logger.Level, format string, args ...interface{}) {
+	u.parent.Log(level, "[origin] "+format, args...)
+}
+
+func (u *hlsOriginUploader) run() {
+	defer close(u.done)
+
+	t := time.NewTicker(hlsOriginUploaderCheckPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := u.sync()
+			if err != nil {
+				if u.ctx.Err() != nil {
+					return
+				}
+				u.Log(logger.Warn, "%v", err)
+			}
+
+		case <-u.ctx.Done():
+			return
+		}
+	}
+}
+
+func (u *hlsOriginUploader) fetch(name string) ([]byte, string, error) {
+	byts, contentType, err := u.source.originFile(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to get %s: %v", name, err)
+	}
+	return byts, contentType, nil
+}
+
+func (u *hlsOriginUploader) upload(name string, byts []byte, contentType string) error {
+	err := u.client.PutObject(u.ctx, u.prefix+name, contentType, bytes.NewReader(byts))
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %v", name, err)
+	}
+	return nil
+}
+
+func (u *hlsOriginUploader) sync() error {
+	multivariant, multivariantType, err := u.fetch("index.m3u8")
+	if err != nil {
+		return err
+	}
+
+	media, mediaType, err := u.fetch("stream.m3u8")
+	if err != nil {
+		return err
+	}
+
+	pl, err := playlist.Unmarshal(media)
+	if err != nil {
+		return err
+	}
+
+	mpl, ok := pl.(*playlist.Media)
+	if !ok {
+		return fmt.Errorf("invalid playlist")
+	}
+
+	var names []string
+	if mpl.Map != nil {
+		names = append(names, mpl.Map.URI)
+	}
+	for _, seg := range mpl.Segments {
+		names = append(names, seg.URI)
+	}
+
+	current := make(map[string]struct{})
+
+	// upload segments before playlists, in order to make sure that
+	// every segment listed in the uploaded playlists is available.
+	for _, name := range names {
+		current[name] = struct{}{}
+
+		if _, ok := u.files[name]; ok {
+			continue
+		}
+
+		byts, contentType, err := u.fetch(name)
+		if err != nil {
+			return err
+		}
+
+		err = u.upload(name, byts, contentType)
+		if err != nil {
+			return err
+		}
+
+		u.Log(logger.Debug, "uploaded %s", name)
+		u.files[name] = &hlsOriginFile{}
+	}
+
+	// upload playlists only when they change.
+	if !bytes.Equal(media, u.lastMedia) {
+		err = u.upload("stream.m3u8", media, mediaType)
+		if err != nil {
+			return err
+		}
+		u.lastMedia = media
+	}
+
+	if !bytes.Equal(multivariant, u.lastMultivariant) {
+		err = u.upload("index.m3u8", multivariant, multivariantType)
+		if err != nil {
+			return err
+		}
+		u.lastMultivariant = multivariant
+	}
+
+	now := time.Now()
+
+	for name, f := range u.files {
+		if _, ok := current[name]; ok {
+			continue
+		}
+
+		if f.removed.IsZero() {
+			f.removed = now
+		}
+
+		if now.Sub(f.removed) >= u.retention {
+			err := u.client.DeleteObject(u.ctx, u.prefix+name)
+			if err != nil {
+				return fmt.Errorf("unable to delete %s: %v", name, err)
+			}
+
+			u.Log(logger.Debug, "deleted %s", name)
+			delete(u.files, name)
+		}
+	}
+
+	return nil
+}
@@ -158,6 +158,26 @@ func onReadyHook(path *path) func() {
 	}
 }
 
+func onStallHook(path *path) {
+	if path.conf.RunOnStall == "" {
+		return
+	}
+
+	env := path.externalCmdEnv()
+	desc := path.source.APISourceDescribe()
+	env["MTX_QUERY"] = path.publisherQuery
+	env["MTX_SOURCE_TYPE"] = desc.Type
+	env["MTX_SOURCE_ID"] = desc.ID
+
+	path.Log(logger.Info, "runOnStall command launched")
+	externalcmd.NewCmd(
+		path.externalCmdPool,
+		path.conf.RunOnStall,
+		false,
+		env,
+		nil)
+}
+
 func onReadHook(
 	externalCmdPool *externalcmd.Pool,
 	pathConf *conf.Path,
@@ -3,6 +3,7 @@ package core
 import (
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpserv"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
 )
 
@@ -19,6 +21,10 @@ func metric(key string, tags string, value int64) string {
 	return key + tags + " " + strconv.FormatInt(value, 10) + "\n"
 }
 
+type metricsRecordCleaner interface {
+	Stats() map[string]record.CleanerPathStats
+}
+
 type metricsParent interface {
 	logger.Writer
 }
@@ -35,6 +41,7 @@ type metrics struct {
 	srtServer     apiSRTServer
 	hlsManager    apiHLSManager
 	webRTCManager apiWebRTCManager
+	recordCleaner metricsRecordCleaner
 }
 
 func newMetrics(
@@ -233,6 +240,31 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 		}
 	}
 
+	if !interfaceIsEmpty(m.recordCleaner) {
+		stats := m.recordCleaner.Stats()
+		if len(stats) != 0 {
+			names := make([]string, 0, len(stats))
+			for name := range stats {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				st := stats[name]
+				tags := "{name=\"" + name + "\"}"
+				out += metric("recordings_bytes", tags, int64(st.Bytes))
+				out += metric("recordings_segments", tags, int64(st.Segments))
+				out += metric("recordings_evicted_bytes", tags, int64(st.EvictedBytes))
+				out += metric("recordings_evicted_segments", tags, int64(st.EvictedSegments))
+			}
+		} else {
+			out += metric("recordings_bytes", "", 0)
+			out += metric("recordings_segments", "", 0)
+			out += metric("recordings_evicted_bytes", "", 0)
+			out += metric("recordings_evicted_segments", "", 0)
+		}
+	}
+
 	ctx.Writer.WriteHeader(http.StatusOK)
 	io.WriteString(ctx.Writer, out) //nolint:errcheck
 }
@@ -285,3 +317,10 @@ func (m *metrics) webRTCManagerSet(s apiWebRTCManager) {
 	defer m.mutex.Unlock()
 	m.webRTCManager = s
 }
+
+// setRecordCleaner is called by core.
+func (m *metrics) setRecordCleaner(s metricsRecordCleaner) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recordCleaner = s
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"time"
 
@@ -10,7 +11,6 @@ import (
 	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
 	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
 	mcmpegts "github.com/bluenviron/mediacommon/pkg/formats/mpegts"
-	"github.com/datarhei/gosrt"
 
 	"github.com/bluenviron/mediamtx/internal/asyncwriter"
 	"github.com/bluenviron/mediamtx/internal/protocols/mpegts"
@@ -22,16 +22,32 @@ func durationGoToMPEGTS(v time.Duration) int64 {
 	return int64(v.Seconds() * 90000)
 }
 
+// mpegtsOnWriteFunc is called before a unit is written.
+// When it returns true, a new MPEG-TS writer is created, in order to make
+// the following output start with the program tables (PAT and PMT).
+type mpegtsOnWriteFunc func(isVideo bool, randomAccess bool, dts time.Duration, ntp time.Time) (bool, error)
+
 func mpegtsSetupWrite(
 	stream *stream.Stream,
 	writer *asyncwriter.Writer,
 	bw *bufio.Writer,
-	sconn srt.Conn,
-	writeTimeout time.Duration,
+	onWrite mpegtsOnWriteFunc,
 ) error {
 	var w *mcmpegts.Writer
 	var tracks []*mcmpegts.Track
 
+	beforeWrite := func(isVideo bool, randomAccess bool, dts time.Duration, ntp time.Time) error {
+		reset, err := onWrite(isVideo, randomAccess, dts, ntp)
+		if err != nil {
+			return err
+		}
+
+		if reset {
+			w = mcmpegts.NewWriter(bw, tracks)
+		}
+		return nil
+	}
+
 	addTrack := func(codec mcmpegts.Codec) *mcmpegts.Track {
 		track := &mcmpegts.Track{
 			Codec: codec,
@@ -68,7 +84,11 @@ func mpegtsSetupWrite(
 						return err
 					}
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+					err = beforeWrite(true, randomAccess, dts, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
 					err = (*w).WriteH26x(track, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
 					if err != nil {
 						return err
@@ -101,7 +121,11 @@ func mpegtsSetupWrite(
 						return err
 					}
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+					err = beforeWrite(true, idrPresent, dts, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
 					err = (*w).WriteH26x(track, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), idrPresent, tunit.AU)
 					if err != nil {
 						return err
@@ -128,8 +152,14 @@ func mpegtsSetupWrite(
 					}
 					lastPTS = tunit.PTS
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-					err := (*w).WriteMPEG4Video(track, durationGoToMPEGTS(tunit.PTS), tunit.Frame)
+					randomAccess := tunit.IsRandomAccess()
+
+					err := beforeWrite(true, randomAccess, tunit.PTS, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
+					err = (*w).WriteMPEG4Video(track, durationGoToMPEGTS(tunit.PTS), tunit.Frame)
 					if err != nil {
 						return err
 					}
@@ -155,8 +185,14 @@ func mpegtsSetupWrite(
 					}
 					lastPTS = tunit.PTS
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-					err := (*w).WriteMPEG1Video(track, durationGoToMPEGTS(tunit.PTS), tunit.Frame)
+					randomAccess := bytes.Contains(tunit.Frame, []byte{0, 0, 1, 0xB8})
+
+					err := beforeWrite(true, randomAccess, tunit.PTS, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
+					err = (*w).WriteMPEG1Video(track, durationGoToMPEGTS(tunit.PTS), tunit.Frame)
 					if err != nil {
 						return err
 					}
@@ -179,8 +215,12 @@ func mpegtsSetupWrite(
 						return nil
 					}
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-					err := (*w).WriteOpus(track, durationGoToMPEGTS(tunit.PTS), tunit.Packets)
+					err := beforeWrite(false, true, tunit.PTS, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
+					err = (*w).WriteOpus(track, durationGoToMPEGTS(tunit.PTS), tunit.Packets)
 					if err != nil {
 						return err
 					}
@@ -198,8 +238,12 @@ func mpegtsSetupWrite(
 						return nil
 					}
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-					err := (*w).WriteMPEG4Audio(track, durationGoToMPEGTS(tunit.PTS), tunit.AUs)
+					err := beforeWrite(false, true, tunit.PTS, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
+					err = (*w).WriteMPEG4Audio(track, durationGoToMPEGTS(tunit.PTS), tunit.AUs)
 					if err != nil {
 						return err
 					}
@@ -215,8 +259,12 @@ func mpegtsSetupWrite(
 						return nil
 					}
 
-					sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-					err := (*w).WriteMPEG1Audio(track, durationGoToMPEGTS(tunit.PTS), tunit.Frames)
+					err := beforeWrite(false, true, tunit.PTS, tunit.NTP)
+					if err != nil {
+						return err
+					}
+
+					err = (*w).WriteMPEG1Audio(track, durationGoToMPEGTS(tunit.PTS), tunit.Frames)
 					if err != nil {
 						return err
 					}
@@ -238,8 +286,12 @@ func mpegtsSetupWrite(
 						framePTS := tunit.PTS + time.Duration(i)*ac3.SamplesPerFrame*
 							time.Second/sampleRate
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
-						err := (*w).WriteAC3(track, durationGoToMPEGTS(framePTS), frame)
+						err := beforeWrite(false, true, framePTS, tunit.NTP)
+						if err != nil {
+							return err
+						}
+
+						err = (*w).WriteAC3(track, durationGoToMPEGTS(framePTS), frame)
 						if err != nil {
 							return err
 						}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/onvif"
+)
+
+const (
+	// maximum size of a WS-Discovery message
+	onvifDiscoveryReadBufferSize = 8192
+)
+
+// onvifLocalIPs returns the IPv4 addresses of the interfaces that support multicast.
+func onvifLocalIPs() []net.IP {
+	var ret []net.IP
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	for _, iface := range ifaces {
+		if (iface.Flags&net.FlagUp) == 0 || (iface.Flags&net.FlagMulticast) == 0 ||
+			(iface.Flags&net.FlagLoopback) != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ret = append(ret, ipnet.IP)
+			}
+		}
+	}
+
+	return ret
+}
+
+type onvifDiscoveryParent interface {
+	logger.Writer
+}
+
+// onvifDiscovery answers to WS-Discovery probes and announces the device
+// when it joins and leaves the network.
+type onvifDiscovery struct {
+	Address      string
+	WriteTimeout conf.StringDuration
+	Endpoint     *onvif.Endpoint
+	Parent       onvifDiscoveryParent
+
+	mutex     sync.Mutex
+	fixedIP   net.IP
+	port      string
+	groupAddr *net.UDPAddr
+	pc        *net.UDPConn
+
+	done chan struct{}
+}
+
+func (d *onvifDiscovery) initialize() error {
+	host, port, err := net.SplitHostPort(d.Address)
+	if err != nil {
+		return err
+	}
+
+	d.port = port
+
+	// when the server is bound to a specific IP, only that IP is advertised.
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		d.fixedIP = ip
+	}
+
+	d.groupAddr, err = net.ResolveUDPAddr("udp4", onvif.DiscoveryAddress)
+	if err != nil {
+		return err
+	}
+
+	d.pc, err = net.ListenMulticastUDP("udp4", nil, d.groupAddr)
+	if err != nil {
+		return err
+	}
+
+	d.done = make(chan struct{})
+
+	var ips []net.IP
+	if d.fixedIP != nil {
+		ips = []net.IP{d.fixedIP}
+	} else {
+		ips = onvifLocalIPs()
+	}
+	d.Endpoint.XAddrs = d.xaddrs(ips)
+
+	d.send(d.Endpoint.MarshalHello, d.groupAddr)
+
+	go d.run()
+
+	return nil
+}
+
+func (d *onvifDiscovery) close() {
+	d.send(d.Endpoint.MarshalBye, d.groupAddr)
+
+	d.pc.Close()
+	<-d.done
+}
+
+func (d *onvifDiscovery) xaddrs(ips []net.IP) []string {
+	ret := make([]string, len(ips))
+	for i, ip := range ips {
+		ret[i] = "http://" + net.JoinHostPort(ip.String(), d.port) + onvifDeviceServicePath
+	}
+	return ret
+}
+
+// localIPFor returns the IP of the interface that is used to reach a client.
+func (d *onvifDiscovery) localIPFor(addr *net.UDPAddr) net.IP {
+	if d.fixedIP != nil {
+		return d.fixedIP
+	}
+
+	// no packets are sent, this only queries the routing table.
+	c, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
+
+// send marshals a message and sends it.
+// Endpoint is not safe for concurrent use, therefore marshaling is protected by a mutex.
+func (d *onvifDiscovery) send(marshal func() ([]byte, error), addr *net.UDPAddr) {
+	d.mutex.Lock()
+	byts, err := marshal()
+	d.mutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	d.pc.SetWriteDeadline(time.Now().Add(time.Duration(d.WriteTimeout)))
+	_, err = d.pc.WriteToUDP(byts, addr)
+	if err != nil {
+		d.Parent.Log(logger.Debug, "unable to send WS-Discovery message: %v", err)
+	}
+}
+
+func (d *onvifDiscovery) run() {
+	defer close(d.done)
+
+	buf := make([]byte, onvifDiscoveryReadBufferSize)
+
+	for {
+		n, addr, err := d.pc.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		var p onvif.Probe
+		err = p.Unmarshal(buf[:n])
+		if err != nil || !p.Matches() {
+			continue
+		}
+
+		ip := d.localIPFor(addr)
+		if ip == nil {
+			continue
+		}
+
+		d.Parent.Log(logger.Debug, "probe received from %v", addr)
+
+		d.send(func() ([]byte, error) {
+			return d.Endpoint.MarshalProbeMatches(&p, d.xaddrs([]net.IP{ip}))
+		}, addr)
+	}
+}
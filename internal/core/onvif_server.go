@@ -0,0 +1,637 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpserv"
+	"github.com/bluenviron/mediamtx/internal/protocols/onvif"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
+)
+
+const (
+	onvifDeviceServicePath   = "/onvif/device_service"
+	onvifMediaServicePath    = "/onvif/media_service"
+	onvifSnapshotPath        = "/onvif/snapshot"
+	onvifMaxRequestSize      = 64 * 1024
+	onvifPauseAfterAuthError = 2 * time.Second
+)
+
+// actions that can be performed without authentication, in order to allow clients
+// to synchronize their clock and to find services, as required by the ONVIF core specification.
+var onvifPreAuthActions = map[string]struct{}{
+	"GetSystemDateAndTime": {},
+	"GetCapabilities":      {},
+	"GetServices":          {},
+}
+
+// actions that refer to a profile, that are authenticated with the credentials of its path.
+var onvifProfileActions = map[string]struct{}{
+	"GetProfile":     {},
+	"GetStreamUri":   {},
+	"GetSnapshotUri": {},
+}
+
+var onvifScopes = []string{
+	"onvif://www.onvif.org/type/video_encoder",
+	"onvif://www.onvif.org/Profile/Streaming",
+	"onvif://www.onvif.org/name/MediaMTX",
+	"onvif://www.onvif.org/hardware/MediaMTX",
+}
+
+// onvifEncoding returns the ONVIF encoding of the first video track that has one.
+func onvifEncoding(tracks []string) string {
+	for _, t := range tracks {
+		switch t {
+		case "H264":
+			return "H264"
+		case "M-JPEG":
+			return "JPEG"
+		case "MPEG-4 Video":
+			return "MPEG4"
+		}
+	}
+	return ""
+}
+
+// onvifDeviceID returns an ID that doesn't change between restarts,
+// since clients use it to recognize the device.
+func onvifDeviceID(address string) uuid.UUID {
+	hostname, _ := os.Hostname()
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("mediamtx://"+hostname+"/onvif/"+address))
+}
+
+type onvifServerPathManager interface {
+	getConfForPath(req pathGetConfForPathReq) pathGetConfForPathRes
+	apiPathsList() (*defs.APIPathList, error)
+	apiPathsSnapshot(name string) (*snapshot.Snapshot, error)
+}
+
+type onvifServerParent interface {
+	logger.Writer
+}
+
+// onvifServer emulates the device and media services of an ONVIF camera.
+// Every configured path is advertised as a media profile.
+type onvifServer struct {
+	Address      string
+	Discovery    bool
+	ReadTimeout  conf.StringDuration
+	WriteTimeout conf.StringDuration
+	RTSPAddress  string
+	RTSPSAddress string
+	Encryption   conf.Encryption
+	PathConfs    map[string]*conf.Path
+	PathManager  onvifServerPathManager
+	Parent       onvifServerParent
+
+	// used to warn about configurations that reject UsernameToken digests.
+	ExternalAuthenticationURL string
+
+	id         uuid.UUID
+	port       string
+	httpServer *httpserv.WrappedServer
+	discovery  *onvifDiscovery
+
+	mutex     sync.RWMutex
+	pathConfs map[string]*conf.Path
+}
+
+func (s *onvifServer) initialize() error {
+	s.id = onvifDeviceID(s.Address)
+	s.pathConfs = s.PathConfs
+
+	var err error
+	_, s.port, err = net.SplitHostPort(s.Address)
+	if err != nil {
+		return err
+	}
+
+	router := gin.New()
+	router.SetTrustedProxies(nil) //nolint:errcheck
+
+	router.POST(onvifDeviceServicePath, s.onService)
+	router.POST(onvifMediaServicePath, s.onService)
+	router.GET(onvifSnapshotPath+"/*name", s.onSnapshot)
+
+	network, address := restrictnetwork.Restrict("tcp", s.Address)
+
+	s.httpServer, err = httpserv.NewWrappedServer(
+		network,
+		address,
+		time.Duration(s.ReadTimeout),
+		"",
+		"",
+		router,
+		s,
+	)
+	if err != nil {
+		return err
+	}
+
+	if s.Discovery {
+		s.discovery = &onvifDiscovery{
+			Address:      s.Address,
+			WriteTimeout: s.WriteTimeout,
+			Endpoint: &onvif.Endpoint{
+				ID:              s.id,
+				Scopes:          onvifScopes,
+				MetadataVersion: 1,
+				InstanceID:      uint32(time.Now().Unix()),
+			},
+			Parent: s,
+		}
+		err = s.discovery.initialize()
+		if err != nil {
+			s.httpServer.Close()
+			return err
+		}
+	}
+
+	if s.discovery != nil {
+		s.Log(logger.Info, "listener opened on %s (HTTP), %s (WS-Discovery)", address, onvif.DiscoveryAddress)
+	} else {
+		s.Log(logger.Info, "listener opened on %s (HTTP)", address)
+	}
+
+	s.warnDigestAuth(s.PathConfs)
+
+	return nil
+}
+
+func (s *onvifServer) close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if s.discovery != nil {
+		s.discovery.close()
+	}
+
+	s.httpServer.Close()
+}
+
+// Log implements logger.Writer.
+func (s *onvifServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[ONVIF] "+format, args...)
+}
+
+// confReload is called by core.
+func (s *onvifServer) confReload(pathConfs map[string]*conf.Path) {
+	s.mutex.Lock()
+	s.pathConfs = pathConfs
+	s.mutex.Unlock()
+
+	s.warnDigestAuth(pathConfs)
+}
+
+// warnDigestAuth warns about configurations in which clients that authenticate
+// with UsernameToken digests are always rejected, since the password is not available.
+func (s *onvifServer) warnDigestAuth(pathConfs map[string]*conf.Path) {
+	if s.ExternalAuthenticationURL != "" {
+		s.Log(logger.Warn, "UsernameToken digests can't be used together with 'externalAuthenticationURL', "+
+			"clients must use plain text tokens or basic authentication")
+		return
+	}
+
+	var names []string
+	for name, pathConf := range pathConfs {
+		if strings.HasPrefix(string(pathConf.ReadPass), "sha256:") {
+			names = append(names, name)
+		}
+	}
+
+	if names != nil {
+		sort.Strings(names)
+		s.Log(logger.Warn, "UsernameToken digests can't be validated against the hashed credentials of %s, "+
+			"clients must use plain text tokens or basic authentication", strings.Join(names, ", "))
+	}
+}
+
+// profileConf returns the configuration of the path that corresponds to a profile.
+// Paths with a regular expression can't be advertised.
+func (s *onvifServer) profileConf(token string) *conf.Path {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	pathConf, ok := s.pathConfs[token]
+	if !ok || pathConf.Regexp != nil {
+		return nil
+	}
+	return pathConf
+}
+
+func (s *onvifServer) profileNames() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var ret []string
+	for name, pathConf := range s.pathConfs {
+		if pathConf.Regexp == nil {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (s *onvifServer) profile(name string, tracks []string) onvif.Profile {
+	p := onvif.Profile{
+		Token: name,
+		Fixed: true,
+		Name:  name,
+	}
+
+	if enc := onvifEncoding(tracks); enc != "" {
+		p.VideoEncoderConfiguration = &onvif.VideoEncoderConfiguration{
+			Token:    name,
+			Name:     name,
+			UseCount: 1,
+			Encoding: enc,
+		}
+	}
+
+	return p
+}
+
+// pathTracks returns the tracks of ready paths.
+func (s *onvifServer) pathTracks() map[string][]string {
+	ret := make(map[string][]string)
+
+	data, err := s.PathManager.apiPathsList()
+	if err != nil {
+		return ret
+	}
+
+	for _, item := range data.Items {
+		ret[item.Name] = item.Tracks
+	}
+
+	return ret
+}
+
+// requestHost returns the host that the client used to reach the server,
+// in order to build URLs that the client is able to reach.
+func (s *onvifServer) requestHost(ctx *gin.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Request.Host)
+	if err != nil {
+		host = ctx.Request.Host
+	}
+
+	if host == "" {
+		if addr, ok := ctx.Request.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+			host = addr.IP.String()
+		}
+	}
+
+	return host
+}
+
+func (s *onvifServer) serviceURL(host string, path string) string {
+	return (&url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, s.port),
+		Path:   path,
+	}).String()
+}
+
+func (s *onvifServer) streamURL(host string, name string) string {
+	scheme := "rtsp"
+	address := s.RTSPAddress
+
+	if s.Encryption == conf.EncryptionStrict {
+		scheme = "rtsps"
+		address = s.RTSPSAddress
+	}
+
+	_, port, _ := net.SplitHostPort(address)
+
+	return (&url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, port),
+		Path:   "/" + name,
+	}).String()
+}
+
+func (s *onvifServer) writeResponse(ctx *gin.Context, res interface{}) {
+	byts, err := onvif.MarshalResponse(res)
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if f, ok := res.(*onvif.Fault); ok {
+		if f.IsSender() {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	ctx.Data(status, "application/soap+xml; charset=utf-8", byts)
+}
+
+func (s *onvifServer) onService(ctx *gin.Context) {
+	byts, err := io.ReadAll(io.LimitReader(ctx.Request.Body, onvifMaxRequestSize))
+	if err != nil {
+		return
+	}
+
+	var req onvif.Request
+	err = req.Unmarshal(byts)
+	if err != nil {
+		s.writeResponse(ctx, onvif.NewFault(onvif.FaultCodeSender, err.Error(), "ter:WellFormed"))
+		return
+	}
+
+	s.Log(logger.Debug, "[c->s] %s %s", ctx.ClientIP(), req.Action)
+
+	s.writeResponse(ctx, s.handleRequest(ctx, &req))
+}
+
+// authenticate checks whether the client is allowed to read a path.
+// Credentials are provided with a WS-Security UsernameToken or with HTTP basic authentication.
+// When both are provided, basic authentication is used, since it works with any configuration.
+func (s *onvifServer) authenticate(ctx *gin.Context, req *onvif.Request, name string) error {
+	user, pass, hasBasic := ctx.Request.BasicAuth()
+
+	var token *onvif.UsernameToken
+	if !hasBasic {
+		token = req.UsernameToken()
+	}
+
+	res := s.PathManager.getConfForPath(pathGetConfForPathReq{
+		accessRequest: pathAccessRequest{
+			name:       name,
+			query:      ctx.Request.URL.RawQuery,
+			publish:    false,
+			ip:         net.ParseIP(ctx.ClientIP()),
+			user:       user,
+			pass:       pass,
+			proto:      authProtocolONVIF,
+			onvifToken: token,
+		},
+	})
+	return res.err
+}
+
+// readableProfiles returns the profiles that the client is allowed to read.
+// The second return value is false when the client is not allowed to read any of them.
+func (s *onvifServer) readableProfiles(ctx *gin.Context, req *onvif.Request) ([]string, bool) {
+	names := s.profileNames()
+	if len(names) == 0 {
+		return nil, true
+	}
+
+	var ret []string
+	for _, name := range names {
+		if s.authenticate(ctx, req, name) == nil {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret, ret != nil
+}
+
+func (s *onvifServer) notAuthorized(ctx *gin.Context, req *onvif.Request, err error) *onvif.Fault {
+	_, _, hasCredentials := ctx.Request.BasicAuth()
+
+	if hasCredentials || req.UsernameToken() != nil {
+		s.Log(logger.Info, "connection %v failed to authenticate: %v", ctx.Request.RemoteAddr, err)
+
+		// wait some seconds to stop brute force attacks
+		<-time.After(onvifPauseAfterAuthError)
+	}
+
+	return onvif.NewFault(onvif.FaultCodeSender, "sender not authorized", "ter:NotAuthorized")
+}
+
+// authenticateProfile checks whether the client is allowed to read the path of a profile.
+// It returns a fault in case of errors.
+func (s *onvifServer) authenticateProfile(ctx *gin.Context, req *onvif.Request, token string,
+) (*conf.Path, *onvif.Fault) {
+	err := s.authenticate(ctx, req, token)
+	if err != nil {
+		if terr, ok := err.(*errAuthentication); ok {
+			return nil, s.notAuthorized(ctx, req, terr)
+		}
+		return nil, onvifNoProfileFault(token)
+	}
+
+	pathConf := s.profileConf(token)
+	if pathConf == nil {
+		return nil, onvifNoProfileFault(token)
+	}
+
+	return pathConf, nil
+}
+
+func (s *onvifServer) handleRequest(ctx *gin.Context, req *onvif.Request) interface{} {
+	host := s.requestHost(ctx)
+
+	// other actions require the client to be allowed to read at least one profile.
+	var profiles []string
+	_, isPreAuth := onvifPreAuthActions[req.Action]
+	_, isProfile := onvifProfileActions[req.Action]
+	if !isPreAuth && !isProfile {
+		var ok bool
+		profiles, ok = s.readableProfiles(ctx, req)
+		if !ok {
+			return s.notAuthorized(ctx, req, fmt.Errorf("not allowed to read any profile"))
+		}
+	}
+
+	switch req.Namespace {
+	case onvif.NamespaceDevice:
+		switch req.Action {
+		case "GetSystemDateAndTime":
+			return &onvif.GetSystemDateAndTimeResponse{
+				SystemDateAndTime: onvif.NewSystemDateAndTime(time.Now()),
+			}
+
+		case "GetDeviceInformation":
+			return &onvif.GetDeviceInformationResponse{
+				Manufacturer:    "MediaMTX",
+				Model:           "MediaMTX",
+				FirmwareVersion: version,
+				SerialNumber:    s.id.String(),
+				HardwareID:      "MediaMTX",
+			}
+
+		case "GetCapabilities":
+			return &onvif.GetCapabilitiesResponse{
+				Capabilities: onvif.Capabilities{
+					Device: onvif.DeviceCapabilities{
+						XAddr: s.serviceURL(host, onvifDeviceServicePath),
+					},
+					Media: onvif.MediaCapabilities{
+						XAddr: s.serviceURL(host, onvifMediaServicePath),
+						StreamingCapabilities: onvif.StreamingCapabilities{
+							RTPMulticast: false,
+							RTPTCP:       true,
+							RTPRTSPTCP:   true,
+						},
+					},
+				},
+			}
+
+		case "GetServices":
+			return &onvif.GetServicesResponse{
+				Services: []onvif.Service{
+					{
+						Namespace: onvif.NamespaceDevice,
+						XAddr:     s.serviceURL(host, onvifDeviceServicePath),
+						Version:   onvif.Version{Major: 2, Minor: 0},
+					},
+					{
+						Namespace: onvif.NamespaceMedia,
+						XAddr:     s.serviceURL(host, onvifMediaServicePath),
+						Version:   onvif.Version{Major: 2, Minor: 0},
+					},
+				},
+			}
+
+		case "GetScopes":
+			return &onvif.GetScopesResponse{
+				Scopes: onvif.NewScopes(onvifScopes),
+			}
+		}
+
+	case onvif.NamespaceMedia:
+		switch req.Action {
+		case "GetProfiles":
+			tracks := s.pathTracks()
+			res := &onvif.GetProfilesResponse{}
+			for _, name := range profiles {
+				res.Profiles = append(res.Profiles, s.profile(name, tracks[name]))
+			}
+			return res
+
+		case "GetProfile":
+			var gp onvif.GetProfile
+			err := req.UnmarshalAction(&gp)
+			if err != nil {
+				return onvif.NewFault(onvif.FaultCodeSender, err.Error(), "ter:InvalidArgVal")
+			}
+
+			if _, fault := s.authenticateProfile(ctx, req, gp.ProfileToken); fault != nil {
+				return fault
+			}
+
+			return &onvif.GetProfileResponse{
+				Profile: s.profile(gp.ProfileToken, s.pathTracks()[gp.ProfileToken]),
+			}
+
+		case "GetStreamUri":
+			var gsu onvif.GetStreamURI
+			err := req.UnmarshalAction(&gsu)
+			if err != nil {
+				return onvif.NewFault(onvif.FaultCodeSender, err.Error(), "ter:InvalidArgVal")
+			}
+
+			if _, fault := s.authenticateProfile(ctx, req, gsu.ProfileToken); fault != nil {
+				return fault
+			}
+
+			return &onvif.GetStreamURIResponse{
+				MediaURI: onvif.NewMediaURI(s.streamURL(host, gsu.ProfileToken)),
+			}
+
+		case "GetSnapshotUri":
+			var gsu onvif.GetSnapshotURI
+			err := req.UnmarshalAction(&gsu)
+			if err != nil {
+				return onvif.NewFault(onvif.FaultCodeSender, err.Error(), "ter:InvalidArgVal")
+			}
+
+			pathConf, fault := s.authenticateProfile(ctx, req, gsu.ProfileToken)
+			if fault != nil {
+				return fault
+			}
+
+			// snapshots are JPEG images only with M-JPEG streams.
+			if !pathConf.Snapshot || onvifEncoding(s.pathTracks()[gsu.ProfileToken]) != "JPEG" {
+				return onvif.NewFault(onvif.FaultCodeReceiver, "snapshots of this profile are not available",
+					"ter:ActionNotSupported")
+			}
+
+			return &onvif.GetSnapshotURIResponse{
+				MediaURI: onvif.NewMediaURI(s.serviceURL(host, onvifSnapshotPath+"/"+gsu.ProfileToken)),
+			}
+
+		case "GetVideoSources":
+			res := &onvif.GetVideoSourcesResponse{}
+			for _, name := range profiles {
+				res.VideoSources = append(res.VideoSources, onvif.VideoSource{Token: name})
+			}
+			return res
+		}
+	}
+
+	return onvif.NewFault(onvif.FaultCodeReceiver, "action not supported", "ter:ActionNotSupported")
+}
+
+func onvifNoProfileFault(token string) *onvif.Fault {
+	return onvif.NewFault(onvif.FaultCodeSender, "profile '"+token+"' not found",
+		"ter:InvalidArgVal", "ter:NoProfile")
+}
+
+func (s *onvifServer) onSnapshot(ctx *gin.Context) {
+	name := strings.TrimPrefix(ctx.Param("name"), "/")
+
+	user, pass, hasCredentials := ctx.Request.BasicAuth()
+
+	res := s.PathManager.getConfForPath(pathGetConfForPathReq{
+		accessRequest: pathAccessRequest{
+			name:    name,
+			query:   ctx.Request.URL.RawQuery,
+			publish: false,
+			ip:      net.ParseIP(ctx.ClientIP()),
+			user:    user,
+			pass:    pass,
+			proto:   authProtocolONVIF,
+		},
+	})
+	if res.err != nil {
+		if terr, ok := res.err.(*errAuthentication); ok {
+			if !hasCredentials {
+				ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				ctx.Writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			s.Log(logger.Info, "connection %v failed to authenticate: %v", ctx.Request.RemoteAddr, terr.message)
+
+			// wait some seconds to stop brute force attacks
+			<-time.After(onvifPauseAfterAuthError)
+
+			ctx.Writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	snap, err := s.PathManager.apiPathsSnapshot(name)
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ctx.Data(http.StatusOK, snap.ContentType, snap.Data)
+}
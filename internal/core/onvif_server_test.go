@@ -0,0 +1,376 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/stretchr/testify/require"
+)
+
+func onvifRequest(t *testing.T, hc *http.Client, service string, body string) (int, []byte) {
+	return onvifRequestWithHeader(t, hc, service, "", body)
+}
+
+func onvifRequestWithHeader(t *testing.T, hc *http.Client, service string, header string, body string) (int, []byte) {
+	res, err := hc.Post("http://localhost:8580/onvif/"+service, "application/soap+xml",
+		bytes.NewReader([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`+
+			`<s:Header>`+header+`</s:Header>`+
+			`<s:Body xmlns:trt="http://www.onvif.org/ver10/media/wsdl"`+
+			` xmlns:tds="http://www.onvif.org/ver10/device/wsdl">`+
+			body+
+			`</s:Body></s:Envelope>`)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	byts, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, byts
+}
+
+func TestONVIFServer(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"onvif: yes\n" +
+		"onvifDiscovery: no\n" +
+		"paths:\n" +
+		"  cam1:\n" +
+		"  cam2:\n" +
+		"    snapshot: yes\n" +
+		"  ~^regexp$:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	source := gortsplib.Client{}
+
+	err := source.StartRecording("rtsp://127.0.0.1:8554/cam1",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	source2 := gortsplib.Client{}
+
+	err = source2.StartRecording("rtsp://127.0.0.1:8554/cam2",
+		&description.Session{Medias: []*description.Media{{
+			Type:    description.MediaTypeVideo,
+			Formats: []format.Format{&format.MJPEG{}},
+		}}})
+	require.NoError(t, err)
+	defer source2.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	t.Run("device information", func(t *testing.T) {
+		status, byts := onvifRequest(t, hc, "device_service", `<tds:GetDeviceInformation/>`)
+		require.Equal(t, http.StatusOK, status)
+
+		var res struct {
+			Manufacturer string `xml:"Body>GetDeviceInformationResponse>Manufacturer"`
+			SerialNumber string `xml:"Body>GetDeviceInformationResponse>SerialNumber"`
+		}
+		err := xml.Unmarshal(byts, &res)
+		require.NoError(t, err)
+		require.Equal(t, "MediaMTX", res.Manufacturer)
+		require.NotEqual(t, "", res.SerialNumber)
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		status, byts := onvifRequest(t, hc, "device_service",
+			`<tds:GetCapabilities><tds:Category>All</tds:Category></tds:GetCapabilities>`)
+		require.Equal(t, http.StatusOK, status)
+
+		var res struct {
+			MediaXAddr string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+		}
+		err := xml.Unmarshal(byts, &res)
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost:8580/onvif/media_service", res.MediaXAddr)
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		status, byts := onvifRequest(t, hc, "media_service", `<trt:GetProfiles/>`)
+		require.Equal(t, http.StatusOK, status)
+
+		var res struct {
+			Profiles []struct {
+				Token    string `xml:"token,attr"`
+				Name     string `xml:"Name"`
+				Encoding string `xml:"VideoEncoderConfiguration>Encoding"`
+			} `xml:"Body>GetProfilesResponse>Profiles"`
+		}
+		err := xml.Unmarshal(byts, &res)
+		require.NoError(t, err)
+		require.Len(t, res.Profiles, 2)
+		require.Equal(t, "cam1", res.Profiles[0].Token)
+		require.Equal(t, "cam1", res.Profiles[0].Name)
+		require.Equal(t, "H264", res.Profiles[0].Encoding)
+		require.Equal(t, "cam2", res.Profiles[1].Token)
+		require.Equal(t, "JPEG", res.Profiles[1].Encoding)
+	})
+
+	t.Run("stream uri", func(t *testing.T) {
+		status, byts := onvifRequest(t, hc, "media_service",
+			`<trt:GetStreamUri><trt:StreamSetup>`+
+				`<Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream>`+
+				`<Transport xmlns="http://www.onvif.org/ver10/schema"><Protocol>RTSP</Protocol></Transport>`+
+				`</trt:StreamSetup><trt:ProfileToken>cam1</trt:ProfileToken></trt:GetStreamUri>`)
+		require.Equal(t, http.StatusOK, status)
+
+		var res struct {
+			URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+		}
+		err := xml.Unmarshal(byts, &res)
+		require.NoError(t, err)
+		require.Equal(t, "rtsp://localhost:8554/cam1", res.URI)
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		status, _ := onvifRequest(t, hc, "media_service",
+			`<trt:GetStreamUri><trt:ProfileToken>regexp</trt:ProfileToken></trt:GetStreamUri>`)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("snapshot uri", func(t *testing.T) {
+		status, _ := onvifRequest(t, hc, "media_service",
+			`<trt:GetSnapshotUri><trt:ProfileToken>cam1</trt:ProfileToken></trt:GetSnapshotUri>`)
+		require.Equal(t, http.StatusInternalServerError, status)
+
+		status, byts := onvifRequest(t, hc, "media_service",
+			`<trt:GetSnapshotUri><trt:ProfileToken>cam2</trt:ProfileToken></trt:GetSnapshotUri>`)
+		require.Equal(t, http.StatusOK, status)
+
+		var res struct {
+			URI string `xml:"Body>GetSnapshotUriResponse>MediaUri>Uri"`
+		}
+		err := xml.Unmarshal(byts, &res)
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost:8580/onvif/snapshot/cam2", res.URI)
+	})
+
+	t.Run("unsupported action", func(t *testing.T) {
+		status, _ := onvifRequest(t, hc, "device_service", `<tds:SystemReboot/>`)
+		require.Equal(t, http.StatusInternalServerError, status)
+	})
+}
+
+func onvifUsernameToken(user string, pass string, digest bool) string {
+	if !digest {
+		return `<Security xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+			`<UsernameToken><Username>` + user + `</Username><Password>` + pass + `</Password></UsernameToken>` +
+			`</Security>`
+	}
+
+	nonce := []byte("0123456789abcdef")
+	created := time.Now().UTC().Format(time.RFC3339)
+
+	h := sha1.New() //nolint:gosec
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(pass))
+
+	return `<Security xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+		`<UsernameToken><Username>` + user + `</Username>` +
+		`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` +
+		base64.StdEncoding.EncodeToString(h.Sum(nil)) + `</Password>` +
+		`<Nonce>` + base64.StdEncoding.EncodeToString(nonce) + `</Nonce>` +
+		`<Created>` + created + `</Created></UsernameToken>` +
+		`</Security>`
+}
+
+func TestONVIFServerAuth(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"onvif: yes\n" +
+		"onvifDiscovery: no\n" +
+		"paths:\n" +
+		"  cam1:\n" +
+		"    readUser: myuser\n" +
+		"    readPass: mypass\n" +
+		"  cam2:\n" +
+		"    readUser: otheruser\n" +
+		"    readPass: otherpass\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	streamURI := `<trt:GetStreamUri><trt:ProfileToken>cam1</trt:ProfileToken></trt:GetStreamUri>`
+
+	t.Run("pre-auth", func(t *testing.T) {
+		status, _ := onvifRequest(t, hc, "device_service", `<tds:GetSystemDateAndTime/>`)
+		require.Equal(t, http.StatusOK, status)
+
+		status, _ = onvifRequest(t, hc, "device_service",
+			`<tds:GetCapabilities><tds:Category>All</tds:Category></tds:GetCapabilities>`)
+		require.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		for _, ca := range []struct {
+			service string
+			body    string
+		}{
+			{"device_service", `<tds:GetDeviceInformation/>`},
+			{"media_service", `<trt:GetProfiles/>`},
+			{"media_service", streamURI},
+		} {
+			status, byts := onvifRequest(t, hc, ca.service, ca.body)
+			require.Equal(t, http.StatusBadRequest, status)
+			require.Contains(t, string(byts), "ter:NotAuthorized")
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		status, byts := onvifRequestWithHeader(t, hc, "media_service",
+			onvifUsernameToken("myuser", "wrongpass", true), streamURI)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Contains(t, string(byts), "ter:NotAuthorized")
+	})
+
+	for _, ca := range []string{"text", "digest"} {
+		t.Run(ca, func(t *testing.T) {
+			header := onvifUsernameToken("myuser", "mypass", ca == "digest")
+
+			status, byts := onvifRequestWithHeader(t, hc, "media_service", header, streamURI)
+			require.Equal(t, http.StatusOK, status)
+
+			var res struct {
+				URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+			}
+			err := xml.Unmarshal(byts, &res)
+			require.NoError(t, err)
+			require.Equal(t, "rtsp://localhost:8554/cam1", res.URI)
+
+			// only profiles that can be read are listed
+			status, byts = onvifRequestWithHeader(t, hc, "media_service", header, `<trt:GetProfiles/>`)
+			require.Equal(t, http.StatusOK, status)
+
+			var res2 struct {
+				Profiles []struct {
+					Token string `xml:"token,attr"`
+				} `xml:"Body>GetProfilesResponse>Profiles"`
+			}
+			err = xml.Unmarshal(byts, &res2)
+			require.NoError(t, err)
+			require.Len(t, res2.Profiles, 1)
+			require.Equal(t, "cam1", res2.Profiles[0].Token)
+		})
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8580/onvif/media_service",
+			bytes.NewReader([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+
+				`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`+
+				`<s:Body xmlns:trt="http://www.onvif.org/ver10/media/wsdl">`+
+				streamURI+
+				`</s:Body></s:Envelope>`)))
+		require.NoError(t, err)
+		req.SetBasicAuth("myuser", "mypass")
+
+		res, err := hc.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
+
+func TestONVIFServerAuthHashed(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"onvif: yes\n" +
+		"onvifDiscovery: no\n" +
+		"paths:\n" +
+		"  cam1:\n" +
+		"    readUser: sha256:" + sha256Base64("myuser") + "\n" +
+		"    readPass: sha256:" + sha256Base64("mypass") + "\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	streamURI := `<trt:GetStreamUri><trt:ProfileToken>cam1</trt:ProfileToken></trt:GetStreamUri>`
+
+	t.Run("digest", func(t *testing.T) {
+		status, byts := onvifRequestWithHeader(t, hc, "media_service",
+			onvifUsernameToken("myuser", "mypass", true), streamURI)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Contains(t, string(byts), "ter:NotAuthorized")
+	})
+
+	t.Run("text", func(t *testing.T) {
+		status, _ := onvifRequestWithHeader(t, hc, "media_service",
+			onvifUsernameToken("myuser", "mypass", false), streamURI)
+		require.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("basic and digest", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8580/onvif/media_service",
+			bytes.NewReader([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+
+				`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`+
+				`<s:Header>`+onvifUsernameToken("myuser", "mypass", true)+`</s:Header>`+
+				`<s:Body xmlns:trt="http://www.onvif.org/ver10/media/wsdl">`+
+				streamURI+
+				`</s:Body></s:Envelope>`)))
+		require.NoError(t, err)
+		req.SetBasicAuth("myuser", "mypass")
+
+		res, err := hc.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
+
+func TestONVIFDiscovery(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"onvif: yes\n" +
+		"paths:\n" +
+		"  cam1:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	_, err = pc.WriteTo([]byte(`<?xml version="1.0" encoding="UTF-8"?>`+
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"`+
+		` xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing">`+
+		`<s:Header><a:MessageID>uuid:0a6dc791-2be6-4991-9af1-454778a1917a</a:MessageID></s:Header>`+
+		`<s:Body><Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">`+
+		`<Types xmlns:dn="http://www.onvif.org/ver10/network/wsdl">dn:NetworkVideoTransmitter</Types>`+
+		`</Probe></s:Body></s:Envelope>`),
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 3702})
+	require.NoError(t, err)
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 8192)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+
+	var res struct {
+		RelatesTo string `xml:"Header>RelatesTo"`
+		XAddrs    string `xml:"Body>ProbeMatches>ProbeMatch>XAddrs"`
+	}
+	err = xml.Unmarshal(buf[:n], &res)
+	require.NoError(t, err)
+	require.Equal(t, "uuid:0a6dc791-2be6-4991-9af1-454778a1917a", res.RelatesTo)
+	require.Equal(t, "http://127.0.0.1:8580/onvif/device_service", res.XAddrs)
+}
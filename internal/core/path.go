@@ -17,10 +17,17 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/multicast"
+	"github.com/bluenviron/mediamtx/internal/protocols/onvif"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
+// period of the check for stalled streams.
+var pathStallCheckPeriod = 1 * time.Second
+
 func newEmptyTimer() *time.Timer {
 	t := time.NewTimer(0)
 	<-t.C
@@ -36,6 +43,15 @@ func (e errPathNoOnePublishing) Error() string {
 	return fmt.Sprintf("no one is publishing to path '%s'", e.pathName)
 }
 
+type errPathRecordModeNotEvent struct {
+	pathName string
+}
+
+// Error implements the error interface.
+func (e errPathRecordModeNotEvent) Error() string {
+	return fmt.Sprintf("record mode of path '%s' is not 'event'", e.pathName)
+}
+
 type pathParent interface {
 	logger.Writer
 	pathReady(*path)
@@ -67,6 +83,7 @@ type pathAccessRequest struct {
 	rtspRequest *base.Request
 	rtspBaseURL *base.URL
 	rtspNonce   string
+	onvifToken  *onvif.UsernameToken
 }
 
 type pathRemoveReaderReq struct {
@@ -102,9 +119,10 @@ type pathDescribeReq struct {
 }
 
 type pathAddReaderRes struct {
-	path   *path
-	stream *stream.Stream
-	err    error
+	path            *path
+	stream          *stream.Stream
+	multicastSender *multicast.Sender
+	err             error
 }
 
 type pathAddReaderReq struct {
@@ -161,6 +179,29 @@ type pathAPIPathsGetReq struct {
 	res  chan pathAPIPathsGetRes
 }
 
+type pathAPIPathsRecordReq struct {
+	start bool
+	res   chan error
+}
+
+type pathParameterForwarderRes struct {
+	forwarder defs.StaticSourceParameterForwarder
+	err       error
+}
+
+type pathParameterForwarderReq struct {
+	res chan pathParameterForwarderRes
+}
+
+type pathAPIPathsSnapshotRes struct {
+	snap *snapshot.Snapshot
+	err  error
+}
+
+type pathAPIPathsSnapshotReq struct {
+	res chan pathAPIPathsSnapshotRes
+}
+
 type path struct {
 	rtspAddress       string
 	readTimeout       conf.StringDuration
@@ -182,6 +223,8 @@ type path struct {
 	publisherQuery                 string
 	stream                         *stream.Stream
 	recordAgent                    *record.Agent
+	snapshotter                    *snapshot.Snapshotter
+	multicastSender                *multicast.Sender
 	readyTime                      time.Time
 	onUnDemandHook                 func(string)
 	onNotReadyHook                 func()
@@ -194,6 +237,12 @@ type path struct {
 	onDemandPublisherState         pathOnDemandState
 	onDemandPublisherReadyTimer    *time.Timer
 	onDemandPublisherCloseTimer    *time.Timer
+	recordScheduleTimer            *time.Timer
+	recordScheduleActive           bool
+	recordScheduleNextChange       time.Time
+	stallTimer                     *time.Timer
+	stalled                        bool
+	stallReconnectTime             time.Time
 
 	// in
 	chReloadConf              chan *conf.Path
@@ -207,6 +256,9 @@ type path struct {
 	chAddReader               chan pathAddReaderReq
 	chRemoveReader            chan pathRemoveReaderReq
 	chAPIPathsGet             chan pathAPIPathsGetReq
+	chAPIPathsRecord          chan pathAPIPathsRecordReq
+	chAPIPathsSnapshot        chan pathAPIPathsSnapshotReq
+	chParameterForwarder      chan pathParameterForwarderReq
 
 	// out
 	done chan struct{}
@@ -249,6 +301,8 @@ func newPath(
 		onDemandStaticSourceCloseTimer: newEmptyTimer(),
 		onDemandPublisherReadyTimer:    newEmptyTimer(),
 		onDemandPublisherCloseTimer:    newEmptyTimer(),
+		recordScheduleTimer:            newEmptyTimer(),
+		stallTimer:                     newEmptyTimer(),
 		chReloadConf:                   make(chan *conf.Path),
 		chStaticSourceSetReady:         make(chan defs.PathSourceStaticSetReadyReq),
 		chStaticSourceSetNotReady:      make(chan defs.PathSourceStaticSetNotReadyReq),
@@ -260,6 +314,9 @@ func newPath(
 		chAddReader:                    make(chan pathAddReaderReq),
 		chRemoveReader:                 make(chan pathRemoveReaderReq),
 		chAPIPathsGet:                  make(chan pathAPIPathsGetReq),
+		chAPIPathsRecord:               make(chan pathAPIPathsRecordReq),
+		chAPIPathsSnapshot:             make(chan pathAPIPathsSnapshotReq),
+		chParameterForwarder:           make(chan pathParameterForwarderReq),
 		done:                           make(chan struct{}),
 	}
 
@@ -303,6 +360,8 @@ func (pa *path) run() {
 		}
 	}
 
+	pa.updateRecordSchedule()
+
 	onUnInitHook := onInitHook(pa)
 
 	err := pa.runInner()
@@ -316,6 +375,8 @@ func (pa *path) run() {
 	pa.onDemandStaticSourceCloseTimer.Stop()
 	pa.onDemandPublisherReadyTimer.Stop()
 	pa.onDemandPublisherCloseTimer.Stop()
+	pa.recordScheduleTimer.Stop()
+	pa.stallTimer.Stop()
 
 	onUnInitHook()
 
@@ -375,6 +436,12 @@ func (pa *path) runInner() error {
 		case <-pa.onDemandPublisherCloseTimer.C:
 			pa.doOnDemandPublisherCloseTimer()
 
+		case <-pa.recordScheduleTimer.C:
+			pa.doRecordScheduleTimer()
+
+		case <-pa.stallTimer.C:
+			pa.doStallTimer()
+
 		case newConf := <-pa.chReloadConf:
 			pa.doReloadConf(newConf)
 
@@ -428,12 +495,54 @@ func (pa *path) runInner() error {
 		case req := <-pa.chAPIPathsGet:
 			pa.doAPIPathsGet(req)
 
+		case req := <-pa.chAPIPathsRecord:
+			pa.doAPIPathsRecord(req)
+
+		case req := <-pa.chAPIPathsSnapshot:
+			pa.doAPIPathsSnapshot(req)
+
+		case req := <-pa.chParameterForwarder:
+			pa.doParameterForwarder(req)
+
 		case <-pa.ctx.Done():
 			return fmt.Errorf("terminated")
 		}
 	}
 }
 
+func (pa *path) doAPIPathsRecord(req pathAPIPathsRecordReq) {
+	if pa.conf.RecordMode != conf.RecordModeEvent {
+		req.res <- errPathRecordModeNotEvent{pathName: pa.name}
+		return
+	}
+
+	if pa.recordAgent == nil {
+		req.res <- fmt.Errorf("path '%s' is not being recorded", pa.name)
+		return
+	}
+
+	if req.start {
+		req.res <- pa.recordAgent.StartEvent()
+	} else {
+		req.res <- pa.recordAgent.StopEvent()
+	}
+}
+
+func (pa *path) doAPIPathsSnapshot(req pathAPIPathsSnapshotReq) {
+	if !pa.conf.Snapshot {
+		req.res <- pathAPIPathsSnapshotRes{err: fmt.Errorf("snapshots of path '%s' are disabled", pa.name)}
+		return
+	}
+
+	if pa.snapshotter == nil {
+		req.res <- pathAPIPathsSnapshotRes{err: fmt.Errorf("no one is publishing to path '%s'", pa.name)}
+		return
+	}
+
+	snap, err := pa.snapshotter.Get()
+	req.res <- pathAPIPathsSnapshotRes{snap: snap, err: err}
+}
+
 func (pa *path) doOnDemandStaticSourceReadyTimer() {
 	for _, req := range pa.describeRequestsOnHold {
 		req.res <- pathDescribeRes{err: fmt.Errorf("source of path '%s' has timed out", pa.name)}
@@ -480,11 +589,74 @@ func (pa *path) doReloadConf(newConf *conf.Path) {
 		go pa.source.(*staticSourceHandler).reloadConf(newConf)
 	}
 
-	if pa.conf.Record {
+	pa.updateRecordSchedule()
+}
+
+func (pa *path) doRecordScheduleTimer() {
+	pa.updateRecordSchedule()
+}
+
+// doStallTimer checks whether the stream is receiving data.
+// When it isn't, the path is marked as stalled and static sources are asked to reconnect,
+// until data is received again.
+// The path stays ready, in order to allow sources that support it (RTSP)
+// to keep the stream and its readers.
+func (pa *path) doStallTimer() {
+	timeout := time.Duration(pa.conf.StallTimeout)
+	medias := pa.stream.StalledMedias(timeout)
+
+	if len(medias) == 0 {
+		if pa.stalled {
+			pa.Log(logger.Info, "stream is not stalled anymore")
+			pa.stalled = false
+		}
+		pa.stallTimer = time.NewTimer(pathStallCheckPeriod)
+		return
+	}
+
+	if !pa.stalled {
+		pa.Log(logger.Warn, "stream is stalled: no data received for %v on %s",
+			timeout, strings.Join(mediasDescription(medias), ", "))
+		pa.stalled = true
+
+		onStallHook(pa)
+	}
+
+	if source, ok := pa.source.(*staticSourceHandler); ok && time.Since(pa.stallReconnectTime) >= timeout {
+		pa.stallReconnectTime = time.Now()
+		go source.reconnect()
+	}
+
+	pa.stallTimer = time.NewTimer(pathStallCheckPeriod)
+}
+
+func (pa *path) shouldRecord() bool {
+	return pa.conf.Record && pa.recordScheduleActive
+}
+
+// updateRecordSchedule evaluates the recording schedule,
+// starts or stops recording, and arms the timer of the next window boundary.
+func (pa *path) updateRecordSchedule() {
+	pa.recordScheduleTimer.Stop()
+	pa.recordScheduleTimer = newEmptyTimer()
+
+	now := time.Now().In(pa.conf.RecordScheduleLocation())
+	pa.recordScheduleActive = pa.conf.RecordSchedule.Active(now)
+	pa.recordScheduleNextChange = pa.conf.RecordSchedule.NextChange(now)
+
+	if !pa.recordScheduleNextChange.IsZero() {
+		pa.recordScheduleTimer = time.NewTimer(pa.recordScheduleNextChange.Sub(now))
+	}
+
+	if pa.shouldRecord() {
 		if pa.stream != nil && pa.recordAgent == nil {
+			pa.Log(logger.Debug, "recording schedule is active")
 			pa.startRecording()
 		}
 	} else if pa.recordAgent != nil {
+		if pa.conf.Record {
+			pa.Log(logger.Debug, "recording schedule is not active")
+		}
 		pa.recordAgent.Close()
 		pa.recordAgent = nil
 	}
@@ -726,10 +898,36 @@ func (pa *path) doAPIPathsGet(req pathAPIPathsGetReq) {
 				}
 				return ret
 			}(),
+			Stalled:   pa.stalled,
+			Recording: pa.recordAgent != nil,
+			RecordSchedule: func() *defs.APIPathRecordSchedule {
+				if len(pa.conf.RecordSchedule) == 0 {
+					return nil
+				}
+				v := &defs.APIPathRecordSchedule{
+					Active: pa.recordScheduleActive,
+				}
+				if !pa.recordScheduleNextChange.IsZero() {
+					t := pa.recordScheduleNextChange
+					v.NextChange = &t
+				}
+				return v
+			}(),
 		},
 	}
 }
 
+func (pa *path) doParameterForwarder(req pathParameterForwarderReq) {
+	if ssh, ok := pa.source.(*staticSourceHandler); ok {
+		if fw := ssh.parameterForwarder(); fw != nil {
+			req.res <- pathParameterForwarderRes{forwarder: fw}
+			return
+		}
+	}
+
+	req.res <- pathParameterForwarderRes{err: fmt.Errorf("source of path '%s' can't receive parameters", pa.name)}
+}
+
 func (pa *path) safeConf() *conf.Path {
 	pa.confMutex.RLock()
 	defer pa.confMutex.RUnlock()
@@ -744,16 +942,18 @@ func (pa *path) shouldClose() bool {
 		len(pa.readerAddRequestsOnHold) == 0
 }
 
-func (pa *path) externalCmdEnv() externalcmd.Environment {
-	_, port, _ := net.SplitHostPort(pa.rtspAddress)
+// pathExternalCmdEnv returns the environment of external commands of a path.
+// matches are the submatches of the path name against the regular expression of its configuration.
+func pathExternalCmdEnv(rtspAddress string, name string, matches []string) externalcmd.Environment {
+	_, port, _ := net.SplitHostPort(rtspAddress)
 	env := externalcmd.Environment{
-		"MTX_PATH":  pa.name,
-		"RTSP_PATH": pa.name, // deprecated
+		"MTX_PATH":  name,
+		"RTSP_PATH": name, // deprecated
 		"RTSP_PORT": port,
 	}
 
-	if len(pa.matches) > 1 {
-		for i, ma := range pa.matches[1:] {
+	if len(matches) > 1 {
+		for i, ma := range matches[1:] {
 			env["G"+strconv.FormatInt(int64(i+1), 10)] = ma
 		}
 	}
@@ -761,6 +961,33 @@ func (pa *path) externalCmdEnv() externalcmd.Environment {
 	return env
 }
 
+// runOnRecordSegmentComplete launches the runOnRecordSegmentComplete command of a path, if set.
+func runOnRecordSegmentComplete(
+	pool *externalcmd.Pool,
+	pathConf *conf.Path,
+	env externalcmd.Environment,
+	segmentPath string,
+	l logger.Writer,
+) {
+	if pathConf.RunOnRecordSegmentComplete == "" {
+		return
+	}
+
+	env["MTX_SEGMENT_PATH"] = segmentPath
+
+	l.Log(logger.Info, "runOnRecordSegmentComplete command launched")
+	externalcmd.NewCmd(
+		pool,
+		pathConf.RunOnRecordSegmentComplete,
+		false,
+		env,
+		nil)
+}
+
+func (pa *path) externalCmdEnv() externalcmd.Environment {
+	return pathExternalCmdEnv(pa.rtspAddress, pa.name, pa.matches)
+}
+
 func (pa *path) onDemandStaticSourceStart() {
 	pa.source.(*staticSourceHandler).start(true)
 
@@ -828,12 +1055,29 @@ func (pa *path) setReady(desc *description.Session, allocateEncoder bool) error
 		return err
 	}
 
-	if pa.conf.Record {
+	if pa.conf.Snapshot || pa.conf.RecordThumbnailPeriod != 0 {
+		pa.snapshotter = &snapshot.Snapshotter{
+			WriteQueueSize: pa.writeQueueSize,
+			Stream:         pa.stream,
+			Parent:         pa,
+		}
+		pa.snapshotter.Initialize()
+	}
+
+	if pa.conf.RTSPMulticastGroup != "" {
+		pa.startMulticast()
+	}
+
+	if pa.shouldRecord() {
 		pa.startRecording()
 	}
 
 	pa.readyTime = time.Now()
 
+	if pa.conf.StallTimeout != 0 {
+		pa.stallTimer = time.NewTimer(pathStallCheckPeriod)
+	}
+
 	pa.onNotReadyHook = onReadyHook(pa)
 
 	pa.parent.pathReady(pa)
@@ -865,17 +1109,51 @@ func (pa *path) setNotReady() {
 
 	pa.onNotReadyHook()
 
+	pa.stallTimer.Stop()
+	pa.stallTimer = newEmptyTimer()
+	pa.stalled = false
+
 	if pa.recordAgent != nil {
 		pa.recordAgent.Close()
 		pa.recordAgent = nil
 	}
 
+	if pa.snapshotter != nil {
+		pa.snapshotter.Close()
+		pa.snapshotter = nil
+	}
+
+	if pa.multicastSender != nil {
+		pa.multicastSender.Close()
+		pa.multicastSender = nil
+	}
+
 	if pa.stream != nil {
 		pa.stream.Close()
 		pa.stream = nil
 	}
 }
 
+func (pa *path) startMulticast() {
+	sender := &multicast.Sender{
+		Group:          net.ParseIP(pa.conf.RTSPMulticastGroup),
+		Port:           pa.conf.RTSPMulticastPort,
+		TTL:            pa.conf.RTSPMulticastTTL,
+		Source:         net.ParseIP(pa.conf.RTSPMulticastSource),
+		AlwaysOn:       pa.conf.RTSPMulticastAlwaysOn,
+		WriteQueueSize: pa.writeQueueSize,
+		Stream:         pa.stream,
+		Parent:         pa,
+	}
+	err := sender.Initialize()
+	if err != nil {
+		pa.Log(logger.Warn, "unable to send to multicast group: %v", err)
+		return
+	}
+
+	pa.multicastSender = sender
+}
+
 func (pa *path) startRecording() {
 	pa.recordAgent = &record.Agent{
 		WriteQueueSize:  pa.writeQueueSize,
@@ -883,6 +1161,11 @@ func (pa *path) startRecording() {
 		Format:          pa.conf.RecordFormat,
 		PartDuration:    time.Duration(pa.conf.RecordPartDuration),
 		SegmentDuration: time.Duration(pa.conf.RecordSegmentDuration),
+		SegmentAlign:    pa.conf.RecordSegmentAlign,
+		Tracks:          pa.conf.RecordTracks,
+		KeyframesOnly:   pa.conf.RecordKeyframesOnly,
+		ThumbnailPeriod: time.Duration(pa.conf.RecordThumbnailPeriod),
+		Snapshotter:     pa.snapshotter,
 		PathName:        pa.name,
 		Stream:          pa.stream,
 		OnSegmentCreate: func(segmentPath string) {
@@ -900,21 +1183,36 @@ func (pa *path) startRecording() {
 			}
 		},
 		OnSegmentComplete: func(segmentPath string) {
-			if pa.conf.RunOnRecordSegmentComplete != "" {
-				env := pa.externalCmdEnv()
-				env["MTX_SEGMENT_PATH"] = segmentPath
-
-				pa.Log(logger.Info, "runOnRecordSegmentComplete command launched")
-				externalcmd.NewCmd(
-					pa.externalCmdPool,
-					pa.conf.RunOnRecordSegmentComplete,
-					false,
-					env,
-					nil)
-			}
+			runOnRecordSegmentComplete(pa.externalCmdPool, pa.conf, pa.externalCmdEnv(), segmentPath, pa)
 		},
-		Parent: pa,
+		Parent:            pa,
+		Mode:              pa.conf.RecordMode,
+		PreEventDuration:  time.Duration(pa.conf.RecordPreEventDuration),
+		PostEventDuration: time.Duration(pa.conf.RecordPostEventDuration),
+	}
+
+	if pa.conf.RecordManifestKey != "" {
+		key, err := record.LoadManifestPrivateKey(pa.conf.RecordManifestKey)
+		if err != nil {
+			pa.Log(logger.Error, "unable to load manifest key: %v", err)
+		} else {
+			pa.recordAgent.ManifestKey = key
+		}
 	}
+
+	if pa.conf.RecordS3Endpoint != "" {
+		pa.recordAgent.S3Client = s3.NewClient(
+			pa.conf.RecordS3Endpoint,
+			pa.conf.RecordS3Region,
+			pa.conf.RecordS3Bucket,
+			pa.conf.RecordS3AccessKeyID,
+			pa.conf.RecordS3SecretAccessKey,
+			time.Duration(pa.writeTimeout),
+		)
+		pa.recordAgent.S3Prefix = pa.conf.RecordS3Prefix
+		pa.recordAgent.S3SpoolMaxSize = uint64(pa.conf.RecordS3SpoolMaxSize)
+	}
+
 	pa.recordAgent.Initialize()
 }
 
@@ -933,8 +1231,9 @@ func (pa *path) executeRemovePublisher() {
 func (pa *path) addReaderPost(req pathAddReaderReq) {
 	if _, ok := pa.readers[req.author]; ok {
 		req.res <- pathAddReaderRes{
-			path:   pa,
-			stream: pa.stream,
+			path:            pa,
+			stream:          pa.stream,
+			multicastSender: pa.multicastSender,
 		}
 		return
 	}
@@ -963,8 +1262,9 @@ func (pa *path) addReaderPost(req pathAddReaderReq) {
 	}
 
 	req.res <- pathAddReaderRes{
-		path:   pa,
-		stream: pa.stream,
+		path:            pa,
+		stream:          pa.stream,
+		multicastSender: pa.multicastSender,
 	}
 }
 
@@ -1095,3 +1395,42 @@ func (pa *path) apiPathsGet(req pathAPIPathsGetReq) (*defs.APIPath, error) {
 		return nil, fmt.Errorf("terminated")
 	}
 }
+
+// apiPathsSnapshot is called by api.
+func (pa *path) apiPathsSnapshot(req pathAPIPathsSnapshotReq) (*snapshot.Snapshot, error) {
+	req.res = make(chan pathAPIPathsSnapshotRes)
+	select {
+	case pa.chAPIPathsSnapshot <- req:
+		res := <-req.res
+		return res.snap, res.err
+
+	case <-pa.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// apiPathsRecord is called by api.
+func (pa *path) apiPathsRecord(req pathAPIPathsRecordReq) error {
+	req.res = make(chan error)
+	select {
+	case pa.chAPIPathsRecord <- req:
+		return <-req.res
+
+	case <-pa.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// parameterForwarder returns the static source, if it can forward parameter requests.
+// The request is forwarded outside of the path routine, since it involves the network.
+func (pa *path) parameterForwarder() (defs.StaticSourceParameterForwarder, error) {
+	req := pathParameterForwarderReq{res: make(chan pathParameterForwarderRes)}
+	select {
+	case pa.chParameterForwarder <- req:
+		res := <-req.res
+		return res.forwarder, res.err
+
+	case <-pa.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -10,12 +11,21 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
 )
 
+var errPathNotFound = errors.New("path not found")
+
 func pathConfCanBeUpdated(oldPathConf *conf.Path, newPathConf *conf.Path) bool {
 	clone := oldPathConf.Clone()
 
 	clone.Record = newPathConf.Record
+	clone.RecordSchedule = newPathConf.RecordSchedule
+	clone.RecordScheduleTimezone = newPathConf.RecordScheduleTimezone
+
+	clone.RTSPMedias = newPathConf.RTSPMedias
+	clone.RTSPParametersToSource = newPathConf.RTSPParametersToSource
+	clone.RTSPParametersWebhook = newPathConf.RTSPParametersWebhook
 
 	clone.RPICameraBrightness = newPathConf.RPICameraBrightness
 	clone.RPICameraContrast = newPathConf.RPICameraContrast
@@ -384,7 +394,7 @@ func (pm *pathManager) doAPIPathsList(req pathAPIPathsListReq) {
 func (pm *pathManager) doAPIPathsGet(req pathAPIPathsGetReq) {
 	path, ok := pm.paths[req.name]
 	if !ok {
-		req.res <- pathAPIPathsGetRes{err: fmt.Errorf("path not found")}
+		req.res <- pathAPIPathsGetRes{err: errPathNotFound}
 		return
 	}
 
@@ -593,3 +603,54 @@ func (pm *pathManager) apiPathsGet(name string) (*defs.APIPath, error) {
 		return nil, fmt.Errorf("terminated")
 	}
 }
+
+// apiPathsRecordStart is called by api.
+func (pm *pathManager) apiPathsRecordStart(name string) error {
+	return pm.apiPathsRecord(name, true)
+}
+
+// apiPathsRecordStop is called by api.
+func (pm *pathManager) apiPathsRecordStop(name string) error {
+	return pm.apiPathsRecord(name, false)
+}
+
+// apiPathsSnapshot is called by api.
+func (pm *pathManager) apiPathsSnapshot(name string) (*snapshot.Snapshot, error) {
+	req := pathAPIPathsGetReq{
+		name: name,
+		res:  make(chan pathAPIPathsGetRes),
+	}
+
+	select {
+	case pm.chAPIPathsGet <- req:
+		res := <-req.res
+		if res.err != nil {
+			return nil, res.err
+		}
+
+		return res.path.apiPathsSnapshot(pathAPIPathsSnapshotReq{})
+
+	case <-pm.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+func (pm *pathManager) apiPathsRecord(name string, start bool) error {
+	req := pathAPIPathsGetReq{
+		name: name,
+		res:  make(chan pathAPIPathsGetRes),
+	}
+
+	select {
+	case pm.chAPIPathsGet <- req:
+		res := <-req.res
+		if res.err != nil {
+			return res.err
+		}
+
+		return res.path.apiPathsRecord(pathAPIPathsRecordReq{start: start})
+
+	case <-pm.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
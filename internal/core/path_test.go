@@ -11,20 +11,27 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
 	"github.com/bluenviron/gortsplib/v4/pkg/headers"
 	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
 	"github.com/datarhei/gosrt"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/stretchr/testify/require"
 
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/rtmp"
 	"github.com/bluenviron/mediamtx/internal/protocols/webrtc"
+	"github.com/bluenviron/mediamtx/internal/unit"
 )
 
 var runOnDemandSampleScript = `
@@ -297,6 +304,350 @@ func TestPathRunOnReady(t *testing.T) {
 	require.Equal(t, "test query=value\n", string(byts))
 }
 
+func TestPathStall(t *testing.T) {
+	for _, ca := range []string{"publisher", "static source"} {
+		t.Run(ca, func(t *testing.T) {
+			onStallFile := filepath.Join(os.TempDir(), "onstall")
+			defer os.Remove(onStallFile)
+
+			var pathName string
+			var conf string
+
+			if ca == "publisher" {
+				pathName = "test"
+				conf = "  test:\n" +
+					"    stallTimeout: 1s\n" +
+					"    runOnStall: sh -c 'echo \"$MTX_PATH $MTX_SOURCE_TYPE\" > " + onStallFile + "'\n"
+			} else {
+				pathName = "proxied"
+				conf = "  test:\n" +
+					"  proxied:\n" +
+					"    source: rtsp://localhost:8554/test\n" +
+					"    sourceOnDemand: yes\n" +
+					"    rtspTransport: tcp\n" +
+					"    stallTimeout: 1s\n" +
+					"    runOnStall: sh -c 'echo \"$MTX_PATH $MTX_SOURCE_TYPE\" > " + onStallFile + "'\n"
+			}
+
+			p, ok := newInstance("api: yes\n" +
+				"rtmp: no\n" +
+				"hls: no\n" +
+				"webrtc: no\n" +
+				"paths:\n" + conf)
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			hc := &http.Client{Transport: &http.Transport{}}
+
+			getPath := func(name string) defs.APIPath {
+				var out defs.APIPath
+				httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/paths/get/"+name, nil, &out)
+				return out
+			}
+
+			source := gortsplib.Client{}
+			err := source.StartRecording(
+				"rtsp://localhost:8554/test",
+				&description.Session{Medias: []*description.Media{testMediaH264}})
+			require.NoError(t, err)
+			defer source.Close()
+
+			i := 0
+			writeFrames := func(n int) {
+				for j := 0; j < n; j++ {
+					err = source.WritePacketRTP(testMediaH264, &rtp.Packet{
+						Header: rtp.Header{
+							Version:        2,
+							PayloadType:    96,
+							SequenceNumber: 123 + uint16(i),
+							Timestamp:      45343 + uint32(i)*9000,
+							SSRC:           563423,
+							Marker:         true,
+						},
+						Payload: []byte{5, 1, 2, 3, 4},
+					})
+					require.NoError(t, err)
+					i++
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+
+			var received atomic.Int64
+			var upstreamReaders []defs.APIPathSourceOrReader
+
+			if ca == "static source" {
+				reader := gortsplib.Client{
+					Transport: func() *gortsplib.Transport {
+						v := gortsplib.TransportTCP
+						return &v
+					}(),
+				}
+
+				u, err := base.ParseURL("rtsp://localhost:8554/proxied")
+				require.NoError(t, err)
+
+				err = reader.Start(u.Scheme, u.Host)
+				require.NoError(t, err)
+				defer reader.Close()
+
+				desc, _, err := reader.Describe(u)
+				require.NoError(t, err)
+
+				err = reader.SetupAll(desc.BaseURL, desc.Medias)
+				require.NoError(t, err)
+
+				reader.OnPacketRTPAny(func(_ *description.Media, _ format.Format, _ *rtp.Packet) {
+					received.Add(1)
+				})
+
+				_, err = reader.Play(nil)
+				require.NoError(t, err)
+
+				writeFrames(5)
+
+				upstreamReaders = getPath("test").Readers
+				require.Equal(t, 1, len(upstreamReaders))
+			}
+
+			require.Equal(t, false, getPath(pathName).Stalled)
+
+			// the publisher doesn't send any data
+			time.Sleep(2500 * time.Millisecond)
+
+			pa := getPath(pathName)
+			require.Equal(t, true, pa.Stalled)
+			require.Equal(t, true, pa.Ready)
+
+			byts, err := os.ReadFile(onStallFile)
+			require.NoError(t, err)
+
+			if ca == "publisher" {
+				require.Equal(t, "test rtspSession\n", string(byts))
+			} else {
+				require.Equal(t, "proxied rtspSource\n", string(byts))
+
+				// the source has reconnected to the upstream server.
+				// Since it keeps reconnecting while stalled, wait for a new connection.
+				reconnected := false
+				for i := 0; i < 20 && !reconnected; i++ {
+					readers := getPath("test").Readers
+					reconnected = len(readers) == 1 && readers[0].ID != upstreamReaders[0].ID
+					if !reconnected {
+						time.Sleep(100 * time.Millisecond)
+					}
+				}
+				require.Equal(t, true, reconnected)
+			}
+
+			// the publisher resumes sending data
+			receivedBefore := received.Load()
+			writeFrames(15)
+
+			require.Equal(t, false, getPath(pathName).Stalled)
+
+			if ca == "static source" {
+				// the stream has been preserved and the reader is still receiving data
+				require.Greater(t, received.Load(), receivedBefore)
+			}
+		})
+	}
+}
+
+type testReader struct{}
+
+func (testReader) close() {}
+
+func (testReader) apiReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{Type: "testReader"}
+}
+
+func (testReader) Log(logger.Level, string, ...interface{}) {}
+
+// readUnitNTPs reads the absolute time of the units of a path.
+func readUnitNTPs(t *testing.T, p *Core, pathName string) (chan time.Time, func()) {
+	res := p.pathManager.addReader(pathAddReaderReq{
+		author: testReader{},
+		accessRequest: pathAccessRequest{
+			name:     pathName,
+			skipAuth: true,
+		},
+	})
+	require.NoError(t, res.err)
+
+	ch := make(chan time.Time, 64)
+
+	w := asyncwriter.New(512, testReader{})
+	medi := res.stream.Desc().Medias[0]
+	res.stream.AddReader(w, medi, medi.Formats[0], func(u unit.Unit) error {
+		ch <- u.GetNTP()
+		return nil
+	})
+	w.Start()
+
+	return ch, func() {
+		res.stream.RemoveReader(w)
+		w.Stop()
+		res.path.removeReader(pathRemoveReaderReq{author: testReader{}})
+	}
+}
+
+func lastNTP(ch chan time.Time) time.Time {
+	var ntp time.Time
+	for {
+		select {
+		case ntp = <-ch:
+		case <-time.After(500 * time.Millisecond):
+			return ntp
+		}
+	}
+}
+
+func ntpTimeGoToRTCP(v time.Time) uint64 {
+	s := uint64(v.UnixNano()) + 2208988800*1000000000
+	return (s/1000000000)<<32 | (s % 1000000000)
+}
+
+func TestPathAbsoluteTime(t *testing.T) {
+	for _, ca := range []string{
+		"rtsp in tolerance",
+		"rtsp out of tolerance",
+		"webrtc in tolerance",
+		"webrtc out of tolerance",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			p, ok := newInstance("rtmp: no\n" +
+				"hls: no\n" +
+				"paths:\n" +
+				"  all_others:\n" +
+				"    absoluteTimeTolerance: 10s\n")
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			// sender clocks are 5 seconds or 1 hour ahead of the server clock
+			var offset time.Duration
+			if strings.HasSuffix(ca, "in tolerance") {
+				offset = 5 * time.Second
+			} else {
+				offset = time.Hour
+			}
+
+			base := time.Now()
+			rtpTime := func(offset time.Duration) uint32 {
+				return 45343 + uint32((time.Since(base)+offset).Seconds()*90000)
+			}
+
+			var writeRTP func(pkt *rtp.Packet)
+			var rtpOffset time.Duration
+
+			if strings.HasPrefix(ca, "rtsp") {
+				source := gortsplib.Client{
+					Transport: func() *gortsplib.Transport {
+						v := gortsplib.TransportTCP
+						return &v
+					}(),
+				}
+				err := source.StartRecording(
+					"rtsp://localhost:8554/teststream",
+					&description.Session{Medias: []*description.Media{testMediaH264}})
+				require.NoError(t, err)
+				defer source.Close()
+
+				writeRTP = func(pkt *rtp.Packet) {
+					err := source.WritePacketRTP(testMediaH264, pkt)
+					require.NoError(t, err)
+				}
+
+				// sender reports are associated with tracks through the SSRC of RTP packets
+				writeRTP(&rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						Marker:         true,
+						PayloadType:    96,
+						SequenceNumber: 1122,
+						Timestamp:      rtpTime(0),
+						SSRC:           563423,
+					},
+					Payload: []byte{5},
+				})
+
+				err = source.WritePacketRTCP(testMediaH264, &rtcp.SenderReport{
+					SSRC:    563423,
+					NTPTime: ntpTimeGoToRTCP(base.Add(offset)),
+					RTPTime: 45343,
+				})
+				require.NoError(t, err)
+			} else {
+				hc := &http.Client{Transport: &http.Transport{}}
+
+				su, err := url.Parse("http://localhost:8889/teststream/whip")
+				require.NoError(t, err)
+
+				s := &webrtc.WHIPClient{
+					HTTPClient: hc,
+					URL:        su,
+				}
+
+				tracks, err := s.Publish(context.Background(), testMediaH264.Formats[0], nil)
+				require.NoError(t, err)
+				defer checkClose(t, s.Close)
+
+				writeRTP = func(pkt *rtp.Packet) {
+					err := tracks[0].WriteRTP(pkt)
+					require.NoError(t, err)
+				}
+
+				// the sender report interceptor of the client sends the current time.
+				// Simulate a sender clock that is ahead of the server clock by
+				// writing a packet whose timestamp is ahead of the others.
+				rtpOffset = offset
+
+				for i := 0; i < 15; i++ {
+					writeRTP(&rtp.Packet{
+						Header: rtp.Header{
+							Version:        2,
+							Marker:         true,
+							PayloadType:    96,
+							SequenceNumber: 1123 + uint16(i),
+							Timestamp:      rtpTime(0),
+							SSRC:           563423,
+						},
+						Payload: []byte{5},
+					})
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+
+			time.Sleep(200 * time.Millisecond)
+
+			ch, removeReader := readUnitNTPs(t, p, "teststream")
+			defer removeReader()
+
+			writeRTP(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 1123 + 15,
+					Timestamp:      rtpTime(rtpOffset),
+					SSRC:           563423,
+				},
+				Payload: []byte{5},
+			})
+			now := time.Now()
+
+			ntp := lastNTP(ch)
+			require.NotEqual(t, time.Time{}, ntp)
+
+			if strings.HasSuffix(ca, "in tolerance") {
+				require.InDelta(t, 0, ntp.Sub(now.Add(offset)).Seconds(), 0.2)
+			} else {
+				// fallback to the reception time
+				require.InDelta(t, 0, ntp.Sub(now).Seconds(), 0.2)
+			}
+		})
+	}
+}
+
 func TestPathRunOnRead(t *testing.T) {
 	for _, ca := range []string{"rtsp", "rtmp", "srt", "webrtc"} {
 		t.Run(ca, func(t *testing.T) {
@@ -476,7 +827,7 @@ func TestPathRecord(t *testing.T) {
 
 	time.Sleep(500 * time.Millisecond)
 
-	files, err := os.ReadDir(filepath.Join(dir, "mystream"))
+	files, err := filepath.Glob(filepath.Join(dir, "mystream", "*.mp4"))
 	require.NoError(t, err)
 	require.Equal(t, 1, len(files))
 
@@ -511,11 +862,157 @@ func TestPathRecord(t *testing.T) {
 
 	time.Sleep(500 * time.Millisecond)
 
-	files, err = os.ReadDir(filepath.Join(dir, "mystream"))
+	files, err = filepath.Glob(filepath.Join(dir, "mystream", "*.mp4"))
 	require.NoError(t, err)
 	require.Equal(t, 2, len(files))
 }
 
+func TestPathRecordEvent(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rtsp-path-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, ok := newInstance("api: yes\n" +
+		"record: yes\n" +
+		"recordPath: " + filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f") + "\n" +
+		"paths:\n" +
+		"  continuous:\n" +
+		"  all_others:\n" +
+		"    record: yes\n" +
+		"    recordMode: event\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	source := gortsplib.Client{}
+	err = source.StartRecording(
+		"rtsp://localhost:8554/mystream",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	writePackets := func(start int, count int) {
+		for i := start; i < (start + count); i++ {
+			err := source.WritePacketRTP(testMediaH264, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 1123 + uint16(i),
+					Timestamp:      45343 + 90000*uint32(i),
+					SSRC:           563423,
+				},
+				Payload: []byte{5},
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	writePackets(0, 4)
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.ReadDir(filepath.Join(dir, "mystream"))
+	require.Error(t, err)
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	httpRequest(t, hc, http.MethodPost, "http://localhost:9997/v3/paths/record/start/mystream", nil, nil)
+
+	writePackets(4, 4)
+
+	time.Sleep(500 * time.Millisecond)
+
+	httpRequest(t, hc, http.MethodPost, "http://localhost:9997/v3/paths/record/stop/mystream", nil, nil)
+
+	time.Sleep(500 * time.Millisecond)
+
+	files, err := filepath.Glob(filepath.Join(dir, "mystream", "*.mp4"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+
+	res, err := hc.Post("http://localhost:9997/v3/paths/record/start/nonexisting", "", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	checkError(t, "path not found", res.Body)
+
+	source2 := gortsplib.Client{}
+	err = source2.StartRecording(
+		"rtsp://localhost:8554/continuous",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source2.Close()
+
+	res2, err := hc.Post("http://localhost:9997/v3/paths/record/start/continuous", "", nil)
+	require.NoError(t, err)
+	defer res2.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, res2.StatusCode)
+	checkError(t, "record mode of path 'continuous' is not 'event'", res2.Body)
+}
+
+func TestPathRecordSchedule(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rtsp-path-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a window that is surely not active now
+	inactiveDay := []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}[(time.Now().UTC().Weekday()+3)%7]
+
+	p, ok := newInstance("api: yes\n" +
+		"record: yes\n" +
+		"recordPath: " + filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f") + "\n" +
+		"paths:\n" +
+		"  all_others:\n" +
+		"    record: yes\n" +
+		"    recordSchedule: [\"" + inactiveDay + " 00:00-24:00\"]\n" +
+		"    recordScheduleTimezone: UTC\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	source := gortsplib.Client{}
+	err = source.StartRecording(
+		"rtsp://localhost:8554/mystream",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	hc := &http.Client{Transport: &http.Transport{}}
+
+	type recordSchedule struct {
+		Active     bool       `json:"active"`
+		NextChange *time.Time `json:"nextChange"`
+	}
+
+	type pathRes struct {
+		Recording      bool            `json:"recording"`
+		RecordSchedule *recordSchedule `json:"recordSchedule"`
+	}
+
+	var out pathRes
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/paths/get/mystream", nil, &out)
+	require.Equal(t, false, out.Recording)
+	require.NotNil(t, out.RecordSchedule)
+	require.Equal(t, false, out.RecordSchedule.Active)
+	require.NotNil(t, out.RecordSchedule.NextChange)
+
+	httpRequest(t, hc, http.MethodPatch, "http://localhost:9997/v3/config/paths/patch/all_others", map[string]interface{}{
+		"recordSchedule": []string{"* 00:00-24:00"},
+	}, nil)
+
+	time.Sleep(500 * time.Millisecond)
+
+	out = pathRes{}
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/paths/get/mystream", nil, &out)
+	require.Equal(t, pathRes{
+		Recording: true,
+		RecordSchedule: &recordSchedule{
+			Active: true,
+		},
+	}, out)
+}
+
 func TestPathFallback(t *testing.T) {
 	for _, ca := range []string{
 		"absolute",
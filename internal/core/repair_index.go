@@ -0,0 +1,44 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+)
+
+// repairSegmentIndexes rebuilds the indexes of all fMP4 segments inside a path.
+func repairSegmentIndexes(root string) error {
+	count := 0
+
+	err := filepath.Walk(root, func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(fpath, ".mp4") || record.IsThumbnailPath(fpath) {
+			return nil
+		}
+
+		index, err := record.RepairSegmentIndex(fpath)
+		if err != nil {
+			return fmt.Errorf("unable to repair index of %s: %v", fpath, err)
+		}
+
+		fmt.Printf("%s: %d parts\n", fpath, len(index))
+		count++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("no fMP4 segments found in %s", root)
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/savp"
 )
 
 const (
@@ -25,23 +26,29 @@ type rtspConnParent interface {
 	logger.Writer
 	getISTLS() bool
 	getServer() *gortsplib.Server
+	getSRTP() *savp.Server
 }
 
 type rtspConn struct {
 	*conn
 
-	isTLS       bool
-	rtspAddress string
-	authMethods []headers.AuthMethod
-	readTimeout conf.StringDuration
-	pathManager *pathManager
-	rconn       *gortsplib.ServerConn
-	parent      rtspConnParent
-
-	uuid         uuid.UUID
-	created      time.Time
-	authNonce    string
-	authFailures int
+	isTLS             bool
+	rtspAddress       string
+	authMethods       []headers.AuthMethod
+	readTimeout       conf.StringDuration
+	udpMaxPayloadSize int
+	pathManager       *pathManager
+	rconn             *gortsplib.ServerConn
+	parent            rtspConnParent
+
+	uuid          uuid.UUID
+	created       time.Time
+	authNonce     string
+	authFailures  int
+	editResponse  func(*base.Response)
+	afterResponse func()
+	srtpKeys      map[string]*savp.Key
+	srtpSetup     *savp.ServerSetup
 }
 
 func newRTSPConn(
@@ -49,6 +56,7 @@ func newRTSPConn(
 	rtspAddress string,
 	authMethods []headers.AuthMethod,
 	readTimeout conf.StringDuration,
+	udpMaxPayloadSize int,
 	runOnConnect string,
 	runOnConnectRestart bool,
 	runOnDisconnect string,
@@ -58,15 +66,16 @@ func newRTSPConn(
 	parent rtspConnParent,
 ) *rtspConn {
 	c := &rtspConn{
-		isTLS:       isTLS,
-		rtspAddress: rtspAddress,
-		authMethods: authMethods,
-		readTimeout: readTimeout,
-		pathManager: pathManager,
-		rconn:       conn,
-		parent:      parent,
-		uuid:        uuid.New(),
-		created:     time.Now(),
+		isTLS:             isTLS,
+		rtspAddress:       rtspAddress,
+		authMethods:       authMethods,
+		readTimeout:       readTimeout,
+		udpMaxPayloadSize: udpMaxPayloadSize,
+		pathManager:       pathManager,
+		rconn:             conn,
+		parent:            parent,
+		uuid:              uuid.New(),
+		created:           time.Now(),
 	}
 
 	c.conn = newConn(
@@ -120,11 +129,58 @@ func (c *rtspConn) onClose(err error) {
 // onRequest is called by rtspServer.
 func (c *rtspConn) onRequest(req *base.Request) {
 	c.Log(logger.Debug, "[c->s] %v", req)
+
+	if srtp := c.parent.getSRTP(); srtp != nil {
+		c.onRequestSRTP(srtp, req)
+	}
+}
+
+// onRequestSRTP collects the SRTP keys of publishers and converts setups with the RTP/SAVP profile,
+// that is not supported by gortsplib, into setups with the TCP transport protocol.
+func (c *rtspConn) onRequestSRTP(srtp *savp.Server, req *base.Request) {
+	c.srtpSetup = nil
+
+	switch req.Method {
+	case base.Announce:
+		keys, err := savp.KeysFromSDP(req.Body)
+		if err == nil {
+			c.srtpKeys = keys
+		}
+
+	case base.Setup:
+		c.srtpSetup = srtp.DecodeSetup(c.rconn.NetConn().(*savp.Conn), req)
+	}
+}
+
+// addSRTPKeys adds SRTP keys to the session description of a DESCRIBE response.
+func (c *rtspConn) addSRTPKeys(res *base.Response) {
+	if res.StatusCode != base.StatusOK {
+		return
+	}
+
+	byts, keys, err := savp.AddKeysToSDP(res.Body)
+	if err != nil {
+		c.Log(logger.Warn, "unable to add SRTP keys: %v", err)
+		return
+	}
+
+	res.Body = byts
+	c.srtpKeys = keys
 }
 
 // OnResponse is called by rtspServer.
 func (c *rtspConn) OnResponse(res *base.Response) {
+	if c.editResponse != nil {
+		c.editResponse(res)
+		c.editResponse = nil
+	}
+
 	c.Log(logger.Debug, "[s->c] %v", res)
+
+	if c.afterResponse != nil {
+		c.afterResponse()
+		c.afterResponse = nil
+	}
 }
 
 // onDescribe is called by rtspServer.
@@ -147,6 +203,17 @@ func (c *rtspConn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 		}
 	}
 
+	start, err := rtspPlaybackStart(ctx.Query)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, nil, err
+	}
+
+	if !start.IsZero() {
+		return c.onDescribePlayback(ctx, start)
+	}
+
 	res := c.pathManager.describe(pathDescribeReq{
 		accessRequest: pathAccessRequest{
 			name:        ctx.Path,
@@ -198,6 +265,43 @@ func (c *rtspConn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 	}, stream, nil
 }
 
+// onDescribePlayback describes recordings of a path.
+// Recordings are read by the session, that is created by SETUP requests.
+func (c *rtspConn) onDescribePlayback(ctx *gortsplib.ServerHandlerOnDescribeCtx, start time.Time,
+) (*base.Response, *gortsplib.ServerStream, error) {
+	res := c.pathManager.getConfForPath(pathGetConfForPathReq{
+		accessRequest: pathAccessRequest{
+			name:        ctx.Path,
+			query:       ctx.Query,
+			ip:          c.ip(),
+			proto:       authProtocolRTSP,
+			id:          &c.uuid,
+			rtspRequest: ctx.Request,
+			rtspNonce:   c.authNonce,
+		},
+	})
+	if res.err != nil {
+		if terr, ok := res.err.(*errAuthentication); ok {
+			res, err := c.handleAuthError(terr)
+			return res, nil, err
+		}
+
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, nil, res.err
+	}
+
+	byts, err := rtspPlaybackDescription(res.conf, ctx.Path, start, ctx.Request.URL)
+	if err != nil {
+		return rtspPlaybackErrorResponse(err), nil, err
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+		Body:       byts,
+	}, nil, nil
+}
+
 func (c *rtspConn) handleAuthError(authErr error) (*base.Response, error) {
 	c.authFailures++
 
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+
+	"github.com/bluenviron/mediamtx/internal/multicast"
+)
+
+// rtspSetupMediaIndex returns the index of the media that a SETUP request refers to.
+// Medias of the server are identified by a "trackID=N" control attribute,
+// and requests without it refer to the first media.
+func rtspSetupMediaIndex(u *base.URL) (int, bool) {
+	pathAndQuery, ok := u.RTSPPathAndQuery()
+	if !ok {
+		return 0, false
+	}
+
+	i := strings.LastIndex(pathAndQuery, "/trackID=")
+	if i < 0 {
+		return 0, true
+	}
+
+	tmp, err := strconv.ParseUint(pathAndQuery[i+len("/trackID="):], 10, 31)
+	if err != nil {
+		return 0, false
+	}
+
+	return int(tmp), true
+}
+
+// rtspMulticastResponse replaces the destination of a SETUP response
+// with the multicast group of the path.
+func rtspMulticastResponse(res *base.Response, sender *multicast.Sender, mediaIndex int) {
+	if res.StatusCode != base.StatusOK {
+		return
+	}
+
+	var th headers.Transport
+	err := th.Unmarshal(res.Header["Transport"])
+	if err != nil {
+		return
+	}
+
+	group := sender.Group
+	th.Destination = &group
+
+	ports := multicast.Ports(sender.Port, mediaIndex)
+	th.Ports = &ports
+
+	ttl := uint(sender.TTL)
+	th.TTL = &ttl
+
+	if sender.Source != nil {
+		source := sender.Source
+		th.Source = &source
+	}
+
+	res.Header["Transport"] = th.Marshal()
+}
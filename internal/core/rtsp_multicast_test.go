@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/multicast"
+)
+
+func TestRTSPSetupMediaIndex(t *testing.T) {
+	for _, ca := range []struct {
+		url string
+		idx int
+	}{
+		{"rtsp://localhost:8554/mypath/", 0},
+		{"rtsp://localhost:8554/mypath/trackID=0", 0},
+		{"rtsp://localhost:8554/mypath/trackID=2", 2},
+		{"rtsp://localhost:8554/mypath?key=val/trackID=1", 1},
+	} {
+		t.Run(ca.url, func(t *testing.T) {
+			u, err := base.ParseURL(ca.url)
+			require.NoError(t, err)
+
+			idx, ok := rtspSetupMediaIndex(u)
+			require.True(t, ok)
+			require.Equal(t, ca.idx, idx)
+		})
+	}
+}
+
+func TestRTSPMulticastResponse(t *testing.T) {
+	de := headers.TransportDeliveryMulticast
+	ip := net.ParseIP("224.1.0.1")
+	ttl := uint(127)
+
+	res := &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"Transport": headers.Transport{
+				Protocol:    headers.TransportProtocolUDP,
+				Delivery:    &de,
+				Destination: &ip,
+				TTL:         &ttl,
+				Ports:       &[2]int{8002, 8003},
+			}.Marshal(),
+		},
+	}
+
+	rtspMulticastResponse(res, &multicast.Sender{
+		Group:  net.ParseIP("232.1.1.1"),
+		Port:   5000,
+		TTL:    16,
+		Source: net.ParseIP("192.168.1.10"),
+	}, 1)
+
+	var th headers.Transport
+	err := th.Unmarshal(res.Header["Transport"])
+	require.NoError(t, err)
+
+	require.Equal(t, "232.1.1.1", th.Destination.String())
+	require.Equal(t, "192.168.1.10", th.Source.String())
+	require.Equal(t, &[2]int{5002, 5003}, th.Ports)
+	require.Equal(t, uint(16), *th.TTL)
+}
+
+func multicastInterfaceIP(t *testing.T) net.IP {
+	intfs, err := net.Interfaces()
+	require.NoError(t, err)
+
+	for _, intf := range intfs {
+		if (intf.Flags&net.FlagUp) == 0 || (intf.Flags&net.FlagMulticast) == 0 || (intf.Flags&net.FlagLoopback) != 0 {
+			continue
+		}
+
+		addrs, err := intf.Addrs()
+		require.NoError(t, err)
+
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				return ipnet.IP
+			}
+		}
+	}
+
+	t.Skip("no multicast interface available")
+	return nil
+}
+
+func TestRTSPMulticastGroup(t *testing.T) {
+	for _, ca := range []string{
+		"read",
+		"always on",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			conf := "rtmp: no\n" +
+				"hls: no\n" +
+				"webrtc: no\n" +
+				"srt: no\n" +
+				"protocols: [tcp]\n" +
+				"multicastIPRange: 239.9.9.9/32\n" +
+				"paths:\n" +
+				"  teststream:\n" +
+				"    rtspMulticastGroup: 239.1.1.1\n" +
+				"    rtspMulticastPort: 5000\n"
+
+			if ca == "always on" {
+				conf += "    rtspMulticastAlwaysOn: yes\n"
+			}
+
+			conf += "  otherstream:\n"
+
+			p, ok := newInstance(conf)
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			source := gortsplib.Client{}
+
+			err := source.StartRecording(
+				"rtsp://127.0.0.1:8554/teststream",
+				&description.Session{Medias: []*description.Media{testMediaH264}})
+			require.NoError(t, err)
+			defer source.Close()
+
+			// static group
+			group, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{
+				IP:   net.ParseIP("239.1.1.1"),
+				Port: 5000,
+			})
+			require.NoError(t, err)
+			defer group.Close()
+
+			// dynamic group that the RTSP server allocates to the path
+			dynamicGroup, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{
+				IP:   net.ParseIP("239.9.9.9"),
+				Port: 8002,
+			})
+			require.NoError(t, err)
+			defer dynamicGroup.Close()
+
+			if ca == "read" {
+				// the RTSP client doesn't allow reading multicast streams from localhost
+				ip := multicastInterfaceIP(t)
+
+				reader := gortsplib.Client{
+					Transport: func() *gortsplib.Transport {
+						v := gortsplib.TransportUDPMulticast
+						return &v
+					}(),
+				}
+
+				u, err := base.ParseURL("rtsp://" + ip.String() + ":8554/teststream")
+				require.NoError(t, err)
+
+				err = reader.Start(u.Scheme, u.Host)
+				require.NoError(t, err)
+				defer reader.Close()
+
+				desc, _, err := reader.Describe(u)
+				require.NoError(t, err)
+
+				res, err := reader.Setup(desc.BaseURL, desc.Medias[0], 0, 0)
+				require.NoError(t, err)
+
+				var th headers.Transport
+				err = th.Unmarshal(res.Header["Transport"])
+				require.NoError(t, err)
+				require.Equal(t, "239.1.1.1", th.Destination.String())
+				require.Equal(t, &[2]int{5000, 5001}, th.Ports)
+
+				_, err = reader.Play(nil)
+				require.NoError(t, err)
+			}
+
+			done := make(chan struct{})
+			defer func() { <-done }()
+
+			ctx, ctxCancel := context.WithCancel(context.Background())
+			defer ctxCancel()
+
+			go func() {
+				defer close(done)
+
+				for i := uint16(0); ; i++ {
+					select {
+					case <-time.After(50 * time.Millisecond):
+					case <-ctx.Done():
+						return
+					}
+
+					source.WritePacketRTP(testMediaH264, &rtp.Packet{ //nolint:errcheck
+						Header: rtp.Header{
+							Version:        2,
+							PayloadType:    96,
+							SequenceNumber: 123 + i,
+							Timestamp:      45343,
+							SSRC:           563423,
+							Marker:         true,
+						},
+						Payload: []byte{5, 1},
+					})
+				}
+			}()
+
+			buf := make([]byte, 1500)
+			group.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := group.ReadFrom(buf)
+			require.NoError(t, err)
+
+			var pkt rtp.Packet
+			err = pkt.Unmarshal(buf[:n])
+			require.NoError(t, err)
+			require.Equal(t, []byte{5, 1}, pkt.Payload)
+
+			// packets are not sent twice
+			dynamicGroup.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			_, _, err = dynamicGroup.ReadFrom(buf)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRTSPMulticastProtocolDisabled(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"srt: no\n" +
+		"protocols: [tcp]\n" +
+		"paths:\n" +
+		"  all_others:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	source := gortsplib.Client{}
+
+	err := source.StartRecording(
+		"rtsp://127.0.0.1:8554/teststream",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	reader := gortsplib.Client{
+		Transport: func() *gortsplib.Transport {
+			v := gortsplib.TransportUDPMulticast
+			return &v
+		}(),
+	}
+
+	u, err := base.ParseURL("rtsp://127.0.0.1:8554/teststream")
+	require.NoError(t, err)
+
+	err = reader.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	desc, _, err := reader.Describe(u)
+	require.NoError(t, err)
+
+	_, err = reader.Setup(desc.BaseURL, desc.Medias[0], 0, 0)
+	require.EqualError(t, err, "bad status code: 461 (Unsupported Transport)")
+}
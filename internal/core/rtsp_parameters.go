@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/google/uuid"
+)
+
+const (
+	rtspParametersWebhookTimeout = 10 * time.Second
+)
+
+// defaultParameterResponse returns the response that gortsplib sends
+// when GET_PARAMETER and SET_PARAMETER requests are not handled.
+func defaultParameterResponse(req *base.Request) *base.Response {
+	// GET_PARAMETER is used like a ping when reading, and sometimes
+	// also when publishing; reply with 200
+	if req.Method == base.GetParameter {
+		return &base.Response{
+			StatusCode: base.StatusOK,
+			Header: base.Header{
+				"Content-Type": base.HeaderValue{"text/parameters"},
+			},
+			Body: []byte{},
+		}
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusNotImplemented,
+	}
+}
+
+// doRTSPParametersWebhook sends a GET_PARAMETER or SET_PARAMETER request to a HTTP endpoint.
+// The status code, the content type and the body of the HTTP response are returned to the client.
+func doRTSPParametersWebhook(
+	ur string,
+	ip net.IP,
+	pathName string,
+	id uuid.UUID,
+	req *base.Request,
+) (*base.Response, error) {
+	enc, _ := json.Marshal(struct {
+		IP          string    `json:"ip"`
+		Path        string    `json:"path"`
+		ID          uuid.UUID `json:"id"`
+		Method      string    `json:"method"`
+		ContentType string    `json:"contentType"`
+		Body        string    `json:"body"`
+	}{
+		IP:     ip.String(),
+		Path:   pathName,
+		ID:     id,
+		Method: string(req.Method),
+		ContentType: func() string {
+			if v, ok := req.Header["Content-Type"]; ok && len(v) == 1 {
+				return v[0]
+			}
+			return ""
+		}(),
+		Body: string(req.Body),
+	})
+
+	hc := &http.Client{Timeout: rtspParametersWebhookTimeout}
+
+	res, err := hc.Post(ur, "application/json", bytes.NewReader(enc))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &base.Response{
+		StatusCode: base.StatusCode(res.StatusCode),
+		Header:     base.Header{},
+		Body:       body,
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "" && len(body) != 0 {
+		ret.Header["Content-Type"] = base.HeaderValue{ct}
+	}
+
+	return ret, nil
+}
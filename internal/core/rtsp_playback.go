@@ -0,0 +1,154 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+)
+
+// rtspPlaybackStart returns the position requested by a RTSP request.
+// Requests that read recordings contain a "start" query parameter, in RFC3339 format.
+// It returns a zero time in case of requests that read live streams.
+func rtspPlaybackStart(query string) (time.Time, error) {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return time.Time{}, nil //nolint:nilerr
+	}
+
+	start := v.Get("start")
+	if start == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start: %v", err)
+	}
+
+	return t, nil
+}
+
+// rtspPlaybackDescription returns the description of recordings of a path,
+// in the same format of the ones generated by the RTSP server for streams.
+// Recordings are read by the session that is created by the following SETUP requests.
+func rtspPlaybackDescription(
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	u *base.URL,
+) ([]byte, error) {
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		return nil, fmt.Errorf("playback is supported with the fMP4 record format only")
+	}
+
+	desc, err := playback.Describe(pathConf.RecordPath, pathName, start)
+	if err != nil {
+		return nil, err
+	}
+
+	contentBase, err := base.ParseURL(u.String() + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	for i, medi := range desc.Medias {
+		// use the absolute URL of tracks, like the RTSP server does
+		medi.Control = "trackID=" + strconv.FormatInt(int64(i), 10)
+		cu, err := medi.URL(contentBase)
+		if err != nil {
+			return nil, err
+		}
+		medi.Control = cu.String()
+	}
+
+	return desc.Marshal(false)
+}
+
+func newRTSPPlayback(
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	udpMaxPayloadSize int,
+	parent logger.Writer,
+) (*playback.Playback, error) {
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		return nil, fmt.Errorf("playback is supported with the fMP4 record format only")
+	}
+
+	p := &playback.Playback{
+		RecordPath:        pathConf.RecordPath,
+		PathName:          pathName,
+		Start:             start,
+		UDPMaxPayloadSize: udpMaxPayloadSize,
+		Parent:            parent,
+	}
+	err := p.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func rtspPlaybackErrorResponse(err error) *base.Response {
+	if errors.Is(err, playback.ErrNoRecordings) {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusBadRequest,
+	}
+}
+
+// rtspPlaybackRange returns the position requested by the Range header of a PLAY request.
+// Absolute times (clock=) are used as they are, while NPT times are relative to the initial position.
+// It returns a zero time when the header is not present.
+func rtspPlaybackRange(header base.Header, initial time.Time) (time.Time, error) {
+	v, ok := header["Range"]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	var r headers.Range
+	err := r.Unmarshal(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch rv := r.Value.(type) {
+	case *headers.RangeUTC:
+		return rv.Start, nil
+
+	case *headers.RangeNPT:
+		return initial.Add(rv.Start), nil
+
+	default:
+		return time.Time{}, fmt.Errorf("unsupported range: %v", v)
+	}
+}
+
+// rtspPlaybackScale returns the speed requested by the Scale header of a PLAY request.
+func rtspPlaybackScale(header base.Header) (float64, error) {
+	v, ok := header["Scale"]
+	if !ok || len(v) != 1 {
+		return 1, nil
+	}
+
+	scale, err := strconv.ParseFloat(v[0], 64)
+	if err != nil || scale <= 0 {
+		return 0, fmt.Errorf("invalid scale: %v", v[0])
+	}
+
+	return scale, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 	"sync"
@@ -19,17 +20,25 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpserv"
+	"github.com/bluenviron/mediamtx/internal/protocols/rtsptunnel"
+	"github.com/bluenviron/mediamtx/internal/protocols/savp"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
 )
 
 type rtspServerParent interface {
 	logger.Writer
 }
 
-func printAddresses(srv *gortsplib.Server) string {
+func printAddresses(srv *gortsplib.Server, tunnelAddress string, srtp *savp.Server) string {
 	var ret []string
 
 	ret = append(ret, fmt.Sprintf("%s (TCP)", srv.RTSPAddress))
 
+	if tunnelAddress != "" {
+		ret = append(ret, fmt.Sprintf("%s (HTTP/WebSocket tunnel)", tunnelAddress))
+	}
+
 	if srv.UDPRTPAddress != "" {
 		ret = append(ret, fmt.Sprintf("%s (UDP/RTP)", srv.UDPRTPAddress))
 	}
@@ -38,12 +47,18 @@ func printAddresses(srv *gortsplib.Server) string {
 		ret = append(ret, fmt.Sprintf("%s (UDP/RTCP)", srv.UDPRTCPAddress))
 	}
 
+	if srtp != nil {
+		ret = append(ret, fmt.Sprintf("%s (UDP/SRTP)", srtp.RTPAddress))
+		ret = append(ret, fmt.Sprintf("%s (UDP/SRTCP)", srtp.RTCPAddress))
+	}
+
 	return strings.Join(ret, ", ")
 }
 
 type rtspServer struct {
 	authMethods         []headers.AuthMethod
 	readTimeout         conf.StringDuration
+	udpMaxPayloadSize   int
 	isTLS               bool
 	rtspAddress         string
 	protocols           map[conf.Protocol]struct{}
@@ -55,13 +70,16 @@ type rtspServer struct {
 	pathManager         *pathManager
 	parent              rtspServerParent
 
-	ctx       context.Context
-	ctxCancel func()
-	wg        sync.WaitGroup
-	srv       *gortsplib.Server
-	mutex     sync.RWMutex
-	conns     map[*gortsplib.ServerConn]*rtspConn
-	sessions  map[*gortsplib.ServerSession]*rtspSession
+	ctx            context.Context
+	ctxCancel      func()
+	wg             sync.WaitGroup
+	srv            *gortsplib.Server
+	srtp           *savp.Server
+	tunnelListener *rtsptunnel.Listener
+	tunnelServer   *httpserv.WrappedServer
+	mutex          sync.RWMutex
+	conns          map[*gortsplib.ServerConn]*rtspConn
+	sessions       map[*gortsplib.ServerSession]*rtspSession
 }
 
 func newRTSPServer(
@@ -70,8 +88,8 @@ func newRTSPServer(
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
 	writeQueueSize int,
+	udpMaxPayloadSize int,
 	useUDP bool,
-	useMulticast bool,
 	rtpAddress string,
 	rtcpAddress string,
 	multicastIPRange string,
@@ -80,6 +98,8 @@ func newRTSPServer(
 	isTLS bool,
 	serverCert string,
 	serverKey string,
+	tunnelAddress string,
+	tunnelAllowOrigin string,
 	rtspAddress string,
 	protocols map[conf.Protocol]struct{},
 	runOnConnect string,
@@ -95,6 +115,7 @@ func newRTSPServer(
 	s := &rtspServer{
 		authMethods:         authMethods,
 		readTimeout:         readTimeout,
+		udpMaxPayloadSize:   udpMaxPayloadSize,
 		isTLS:               isTLS,
 		rtspAddress:         rtspAddress,
 		protocols:           protocols,
@@ -120,11 +141,24 @@ func newRTSPServer(
 	}
 
 	if useUDP {
-		s.srv.UDPRTPAddress = rtpAddress
-		s.srv.UDPRTCPAddress = rtcpAddress
+		// gortsplib doesn't allow to use TLS together with UDP,
+		// therefore UDP media of the RTSPS server is exchanged with SRTP outside of it.
+		if isTLS {
+			s.srtp = &savp.Server{
+				RTPAddress:   rtpAddress,
+				RTCPAddress:  rtcpAddress,
+				WriteTimeout: time.Duration(writeTimeout),
+			}
+		} else {
+			s.srv.UDPRTPAddress = rtpAddress
+			s.srv.UDPRTCPAddress = rtcpAddress
+		}
 	}
 
-	if useMulticast {
+	// UDP-multicast is always enabled, in order to allow reading static multicast groups.
+	// Dynamic multicast groups are blocked by rtspSession when the multicast
+	// transport protocol is disabled.
+	if multicastIPRange != "" {
 		s.srv.MulticastIPRange = multicastIPRange
 		s.srv.MulticastRTPPort = multicastRTPPort
 		s.srv.MulticastRTCPPort = multicastRTCPPort
@@ -136,15 +170,72 @@ func newRTSPServer(
 			return nil, err
 		}
 
-		s.srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		// with SRTP, media is extracted from decrypted connections,
+		// therefore TLS is applied to accepted connections here.
+		if s.srtp != nil {
+			s.srv.Listen = func(network string, address string) (net.Listener, error) {
+				ln, err := net.Listen(network, address)
+				if err != nil {
+					return nil, err
+				}
+
+				return s.srtp.WrapListener(tls.NewListener(ln, tlsConfig)), nil
+			}
+		} else {
+			s.srv.TLSConfig = tlsConfig
+		}
+	}
+
+	// connections tunnelled through HTTP or WebSocket are passed to the server
+	// together with the ones accepted by the TCP listener.
+	if tunnelAddress != "" {
+		s.srv.Listen = func(network string, address string) (net.Listener, error) {
+			ln, err := net.Listen(network, address)
+			if err != nil {
+				return nil, err
+			}
+
+			s.tunnelListener = rtsptunnel.NewListener(ln, tunnelAllowOrigin)
+			return s.tunnelListener, nil
+		}
+	}
+
+	if s.srtp != nil {
+		err := s.srtp.Initialize()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	err := s.srv.Start()
 	if err != nil {
+		if s.srtp != nil {
+			s.srtp.Close()
+		}
 		return nil, err
 	}
 
-	s.Log(logger.Info, "listener opened on %s", printAddresses(s.srv))
+	if tunnelAddress != "" {
+		network, address := restrictnetwork.Restrict("tcp", tunnelAddress)
+
+		s.tunnelServer, err = httpserv.NewWrappedServer(
+			network,
+			address,
+			time.Duration(readTimeout),
+			"",
+			"",
+			s.tunnelListener,
+			s,
+		)
+		if err != nil {
+			s.srv.Close()
+			return nil, err
+		}
+	}
+
+	s.Log(logger.Info, "listener opened on %s", printAddresses(s.srv, tunnelAddress, s.srtp))
 
 	if metrics != nil {
 		if !isTLS {
@@ -178,6 +269,10 @@ func (s *rtspServer) getServer() *gortsplib.Server {
 	return s.srv
 }
 
+func (s *rtspServer) getSRTP() *savp.Server {
+	return s.srtp
+}
+
 func (s *rtspServer) close() {
 	s.Log(logger.Info, "listener is closing")
 	s.ctxCancel()
@@ -206,6 +301,16 @@ outer:
 
 	s.ctxCancel()
 
+	// tunnelled connections are closed together with the RTSP server,
+	// therefore the HTTP server can be closed without waiting for them.
+	if s.tunnelServer != nil {
+		s.tunnelServer.Close()
+	}
+
+	if s.srtp != nil {
+		s.srtp.Close()
+	}
+
 	if s.metrics != nil {
 		if !s.isTLS {
 			s.metrics.setRTSPServer(nil)
@@ -222,6 +327,7 @@ func (s *rtspServer) OnConnOpen(ctx *gortsplib.ServerHandlerOnConnOpenCtx) {
 		s.rtspAddress,
 		s.authMethods,
 		s.readTimeout,
+		s.udpMaxPayloadSize,
 		s.runOnConnect,
 		s.runOnConnectRestart,
 		s.runOnDisconnect,
@@ -262,6 +368,7 @@ func (s *rtspServer) OnSessionOpen(ctx *gortsplib.ServerHandlerOnSessionOpenCtx)
 	se := newRTSPSession(
 		s.isTLS,
 		s.protocols,
+		s.udpMaxPayloadSize,
 		ctx.Session,
 		ctx.Conn,
 		s.externalCmdPool,
@@ -289,7 +396,15 @@ func (s *rtspServer) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionCloseCt
 func (s *rtspServer) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 ) (*base.Response, *gortsplib.ServerStream, error) {
 	c := ctx.Conn.UserData().(*rtspConn)
-	return c.onDescribe(ctx)
+	res, stream, err := c.onDescribe(ctx)
+
+	// the RTP/SAVP profile is advertised only to clients that ask for it,
+	// since other clients wouldn't be able to read the stream.
+	if s.srtp != nil && stream != nil && savp.KeysRequested(ctx.Request) {
+		c.editResponse = c.addSRTPKeys
+	}
+
+	return res, stream, err
 }
 
 // OnAnnounce implements gortsplib.ServerHandlerOnAnnounce.
@@ -324,6 +439,30 @@ func (s *rtspServer) OnPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Resp
 	return se.onPause(ctx)
 }
 
+// OnGetParameter implements gortsplib.ServerHandlerOnGetParameter.
+func (s *rtspServer) OnGetParameter(ctx *gortsplib.ServerHandlerOnGetParameterCtx) (*base.Response, error) {
+	if ctx.Session == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}, nil
+	}
+
+	se := ctx.Session.UserData().(*rtspSession)
+	return se.onParameter(ctx.Request)
+}
+
+// OnSetParameter implements gortsplib.ServerHandlerOnSetParameter.
+func (s *rtspServer) OnSetParameter(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+	if ctx.Session == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}, nil
+	}
+
+	se := ctx.Session.UserData().(*rtspSession)
+	return se.onParameter(ctx.Request)
+}
+
 // OnPacketLost implements gortsplib.ServerHandlerOnDecodeError.
 func (s *rtspServer) OnPacketLost(ctx *gortsplib.ServerHandlerOnPacketLostCtx) {
 	se := ctx.Session.UserData().(*rtspSession)
@@ -1,12 +1,29 @@
 package core
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/mediamtx/internal/protocols/savp"
+	"github.com/gorilla/websocket"
 	"github.com/pion/rtp"
+	"github.com/pion/srtp/v2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -348,3 +365,617 @@ func TestRTSPServerPublisherOverride(t *testing.T) {
 		})
 	}
 }
+
+func TestRTSPServerPlayback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rtsp-server-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"recordPath: " + filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f") + "\n" +
+		"recordPartDuration: 100ms\n" +
+		"paths:\n" +
+		"  all_others:\n" +
+		"    record: yes\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	start := time.Now().Add(-time.Second)
+
+	source := gortsplib.Client{}
+	err = source.StartRecording(
+		"rtsp://localhost:8554/mystream",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	for i := 0; i < 4; i++ {
+		err := source.WritePacketRTP(testMediaH264, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: 1123 + uint16(i),
+				Timestamp:      45343 + 90000/5*uint32(i),
+				SSRC:           563423,
+			},
+			Payload: []byte{5, byte(i)},
+		})
+		require.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	t.Run("no recordings", func(t *testing.T) {
+		c := gortsplib.Client{}
+
+		u, err := base.ParseURL("rtsp://localhost:8554/otherstream?start=" +
+			url.QueryEscape(start.Format(time.RFC3339)))
+		require.NoError(t, err)
+
+		err = c.Start(u.Scheme, u.Host)
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, _, err = c.Describe(u)
+		require.EqualError(t, err, "bad status code: 404 (Not Found)")
+	})
+
+	t.Run("read", func(t *testing.T) {
+		c := gortsplib.Client{}
+
+		u, err := base.ParseURL("rtsp://localhost:8554/mystream?start=" +
+			url.QueryEscape(start.Format(time.RFC3339)))
+		require.NoError(t, err)
+
+		err = c.Start(u.Scheme, u.Host)
+		require.NoError(t, err)
+		defer c.Close()
+
+		// DESCRIBE requests don't read recordings, that are read by the session only
+		var desc *description.Session
+		for i := 0; i < 3; i++ {
+			desc, _, err = c.Describe(u)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(desc.Medias))
+		}
+
+		err = c.SetupAll(desc.BaseURL, desc.Medias)
+		require.NoError(t, err)
+
+		frameRecv := make(chan []byte, 10)
+
+		c.OnPacketRTP(desc.Medias[0], desc.Medias[0].Formats[0], func(pkt *rtp.Packet) {
+			frameRecv <- pkt.Payload
+		})
+
+		res, err := c.Play(&headers.Range{Value: &headers.RangeUTC{Start: start}})
+		require.NoError(t, err)
+		require.Equal(t, base.HeaderValue{"1"}, res.Header["Scale"])
+
+		// the first frame is preceded by SPS and PPS
+		require.Equal(t, byte(24), (<-frameRecv)[0]&0x1F)
+	})
+}
+
+// testHTTPTunnelConn is a client-side connection tunnelled through a GET and a POST request.
+type testHTTPTunnelConn struct {
+	net.Conn
+	br   *bufio.Reader
+	post net.Conn
+}
+
+func (c *testHTTPTunnelConn) Read(p []byte) (int, error) {
+	return c.br.Read(p)
+}
+
+func (c *testHTTPTunnelConn) Write(p []byte) (int, error) {
+	_, err := c.post.Write([]byte(base64.StdEncoding.EncodeToString(p)))
+	return len(p), err
+}
+
+func (c *testHTTPTunnelConn) Close() error {
+	c.post.Close()
+	return c.Conn.Close()
+}
+
+func dialTestHTTPTunnel(address string) (net.Conn, error) {
+	get, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = get.Write([]byte("GET /teststream HTTP/1.0\r\n" +
+		"x-sessioncookie: testcookie\r\n" +
+		"Accept: application/x-rtsp-tunnelled\r\n" +
+		"\r\n"))
+	if err != nil {
+		get.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(get)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		get.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		get.Close()
+		return nil, fmt.Errorf("bad status code: %v", res.StatusCode)
+	}
+
+	post, err := net.Dial("tcp", address)
+	if err != nil {
+		get.Close()
+		return nil, err
+	}
+
+	_, err = post.Write([]byte("POST /teststream HTTP/1.0\r\n" +
+		"x-sessioncookie: testcookie\r\n" +
+		"Content-Type: application/x-rtsp-tunnelled\r\n" +
+		"Content-Length: 32767\r\n" +
+		"\r\n"))
+	if err != nil {
+		get.Close()
+		post.Close()
+		return nil, err
+	}
+
+	return &testHTTPTunnelConn{
+		Conn: get,
+		br:   br,
+		post: post,
+	}, nil
+}
+
+// testWebSocketConn is a client-side connection tunnelled through WebSocket.
+type testWebSocketConn struct {
+	net.Conn
+	wc     *websocket.Conn
+	reader io.Reader
+}
+
+func (c *testWebSocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.wc.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (c *testWebSocketConn) Write(p []byte) (int, error) {
+	err := c.wc.WriteMessage(websocket.BinaryMessage, p)
+	return len(p), err
+}
+
+func (c *testWebSocketConn) Close() error {
+	return c.wc.Close()
+}
+
+func dialTestWebSocket(address string) (net.Conn, error) {
+	d := websocket.Dialer{
+		Subprotocols: []string{"rtsp.onvif.org"},
+	}
+
+	wc, res, err := d.Dial("ws://"+address+"/teststream", nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return &testWebSocketConn{
+		Conn: wc.UnderlyingConn(),
+		wc:   wc,
+	}, nil
+}
+
+func TestRTSPServerTunnel(t *testing.T) {
+	for _, ca := range []string{"http", "websocket"} {
+		t.Run(ca, func(t *testing.T) {
+			p, ok := newInstance("rtmp: no\n" +
+				"hls: no\n" +
+				"webrtc: no\n" +
+				"rtspTunnel: yes\n" +
+				"paths:\n" +
+				"  all_others:\n")
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			source := gortsplib.Client{}
+
+			err := source.StartRecording("rtsp://localhost:8554/teststream",
+				&description.Session{Medias: []*description.Media{testMediaH264}})
+			require.NoError(t, err)
+			defer source.Close()
+
+			transport := gortsplib.TransportTCP
+
+			reader := gortsplib.Client{
+				Transport: &transport,
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					if ca == "http" {
+						return dialTestHTTPTunnel("localhost:8555")
+					}
+					return dialTestWebSocket("localhost:8555")
+				},
+			}
+
+			u, err := base.ParseURL("rtsp://localhost:8554/teststream")
+			require.NoError(t, err)
+
+			err = reader.Start(u.Scheme, u.Host)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			desc, _, err := reader.Describe(u)
+			require.NoError(t, err)
+
+			err = reader.SetupAll(desc.BaseURL, desc.Medias)
+			require.NoError(t, err)
+
+			recv := make(chan struct{})
+
+			reader.OnPacketRTP(desc.Medias[0], desc.Medias[0].Formats[0], func(pkt *rtp.Packet) {
+				require.Equal(t, []byte{5, 1, 2, 3, 4}, pkt.Payload)
+				close(recv)
+			})
+
+			_, err = reader.Play(nil)
+			require.NoError(t, err)
+
+			err = source.WritePacketRTP(testMediaH264, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 57899,
+					Timestamp:      345234345,
+					SSRC:           978651231,
+				},
+				Payload: []byte{5, 1, 2, 3, 4},
+			})
+			require.NoError(t, err)
+
+			<-recv
+		})
+	}
+}
+
+func TestRTSPServerSRTP(t *testing.T) {
+	serverCertFpath, err := writeTempFile(serverCert)
+	require.NoError(t, err)
+	defer os.Remove(serverCertFpath)
+
+	serverKeyFpath, err := writeTempFile(serverKey)
+	require.NoError(t, err)
+	defer os.Remove(serverKeyFpath)
+
+	for _, ca := range []string{
+		"srtp",
+		"encrypted",
+		"tcp",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			p, ok := newInstance("rtmp: no\n" +
+				"hls: no\n" +
+				"webrtc: no\n" +
+				"encryption: optional\n" +
+				"serverCert: " + serverCertFpath + "\n" +
+				"serverKey: " + serverKeyFpath + "\n" +
+				"srtp: yes\n" +
+				"paths:\n" +
+				"  all_others:\n")
+			require.Equal(t, true, ok)
+			defer p.Close()
+
+			u, err := base.ParseURL("rtsps://localhost:8322/teststream")
+			require.NoError(t, err)
+
+			source := gortsplib.Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+			sourceSRTP := &savp.Client{}
+			sourceSRTP.Attach(&source)
+
+			err = sourceSRTP.Start(&source, u.Host)
+			require.NoError(t, err)
+			defer source.Close()
+
+			medias := []*description.Media{testMediaH264}
+
+			_, err = source.Announce(u, &description.Session{Medias: medias})
+			require.NoError(t, err)
+
+			err = source.SetupAll(u, medias)
+			require.NoError(t, err)
+
+			_, err = source.Record()
+			require.NoError(t, err)
+
+			writePacket := func() {
+				err = source.WritePacketRTP(testMediaH264, &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						Marker:         true,
+						PayloadType:    96,
+						SequenceNumber: 57899,
+						Timestamp:      345234345,
+						SSRC:           978651231,
+					},
+					Payload: []byte{5, 1, 2, 3, 4},
+				})
+				require.NoError(t, err)
+			}
+
+			switch ca {
+			case "srtp", "tcp":
+				reader := gortsplib.Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+
+				if ca == "srtp" {
+					readerSRTP := &savp.Client{}
+					readerSRTP.Attach(&reader)
+
+					err = readerSRTP.Start(&reader, u.Host)
+					require.NoError(t, err)
+				} else {
+					transport := gortsplib.TransportTCP
+					reader.Transport = &transport
+
+					err = reader.Start(u.Scheme, u.Host)
+					require.NoError(t, err)
+				}
+				defer reader.Close()
+
+				desc, res, err := reader.Describe(u)
+				require.NoError(t, err)
+
+				// the RTP/SAVP profile is advertised only to clients that ask for it
+				if ca == "srtp" {
+					require.Contains(t, string(res.Body), "RTP/SAVP")
+				} else {
+					require.NotContains(t, string(res.Body), "RTP/SAVP")
+					require.NotContains(t, string(res.Body), "a=crypto")
+				}
+
+				err = reader.SetupAll(desc.BaseURL, desc.Medias)
+				require.NoError(t, err)
+
+				recv := make(chan struct{})
+
+				reader.OnPacketRTP(desc.Medias[0], desc.Medias[0].Formats[0], func(pkt *rtp.Packet) {
+					require.Equal(t, []byte{5, 1, 2, 3, 4}, pkt.Payload)
+					close(recv)
+				})
+
+				_, err = reader.Play(nil)
+				require.NoError(t, err)
+
+				writePacket()
+
+				<-recv
+
+			case "encrypted":
+				nconn, err := tls.Dial("tcp", "localhost:8322", &tls.Config{InsecureSkipVerify: true})
+				require.NoError(t, err)
+				defer nconn.Close()
+				br := bufio.NewReader(nconn)
+
+				do := func(req base.Request) *base.Response {
+					byts, err2 := req.Marshal()
+					require.NoError(t, err2)
+					_, err2 = nconn.Write(byts)
+					require.NoError(t, err2)
+
+					var res base.Response
+					err2 = res.Unmarshal(br)
+					require.NoError(t, err2)
+					require.Equal(t, base.StatusOK, res.StatusCode)
+					return &res
+				}
+
+				res := do(base.Request{
+					Method: base.Describe,
+					URL:    u,
+					Header: base.Header{
+						"CSeq":      base.HeaderValue{"1"},
+						"Supported": base.HeaderValue{savp.FeatureTag},
+					},
+				})
+
+				keys, err := savp.KeysFromSDP(res.Body)
+				require.NoError(t, err)
+				require.Equal(t, 1, len(keys))
+
+				var key *savp.Key
+				var control string
+				for k, v := range keys {
+					control, key = k, v
+				}
+
+				rtpConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer rtpConn.Close()
+
+				rtcpConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer rtcpConn.Close()
+
+				// the control attribute contains an absolute URL
+				su, err := base.ParseURL(control)
+				require.NoError(t, err)
+
+				res = do(base.Request{
+					Method: base.Setup,
+					URL:    su,
+					Header: base.Header{
+						"CSeq": base.HeaderValue{"2"},
+						"Transport": base.HeaderValue{fmt.Sprintf("RTP/SAVP;unicast;client_port=%d-%d",
+							rtpConn.LocalAddr().(*net.UDPAddr).Port, rtcpConn.LocalAddr().(*net.UDPAddr).Port)},
+					},
+				})
+
+				var sx headers.Session
+				err = sx.Unmarshal(res.Header["Session"])
+				require.NoError(t, err)
+
+				do(base.Request{
+					Method: base.Play,
+					URL:    u,
+					Header: base.Header{
+						"CSeq":    base.HeaderValue{"3"},
+						"Session": base.HeaderValue{sx.Session},
+					},
+				})
+
+				writePacket()
+
+				buf := make([]byte, 1500)
+				rtpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := rtpConn.ReadFrom(buf)
+				require.NoError(t, err)
+
+				// the payload on the wire is encrypted
+				var pkt rtp.Packet
+				err = pkt.Unmarshal(buf[:n])
+				require.NoError(t, err)
+				require.NotEqual(t, []byte{5, 1, 2, 3, 4}, pkt.Payload)
+
+				ctx, err := srtp.CreateContext(key.MasterKey, key.MasterSalt, srtp.ProtectionProfileAes128CmHmacSha1_80)
+				require.NoError(t, err)
+
+				dec, err := ctx.DecryptRTP(nil, buf[:n], nil)
+				require.NoError(t, err)
+
+				err = pkt.Unmarshal(dec)
+				require.NoError(t, err)
+				require.Equal(t, []byte{5, 1, 2, 3, 4}, pkt.Payload)
+			}
+		})
+	}
+}
+
+func TestRTSPServerParametersWebhook(t *testing.T) {
+	p, ok := newInstance("rtmp: no\n" +
+		"hls: no\n" +
+		"webrtc: no\n" +
+		"paths:\n" +
+		"  all_others:\n" +
+		"    rtspParametersWebhook: http://localhost:9121/parameters\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/parameters", r.URL.Path)
+
+			var in struct {
+				IP          string `json:"ip"`
+				Path        string `json:"path"`
+				ID          string `json:"id"`
+				Method      string `json:"method"`
+				ContentType string `json:"contentType"`
+				Body        string `json:"body"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&in)
+			require.NoError(t, err)
+
+			require.Equal(t, "127.0.0.1", in.IP)
+			require.Equal(t, "teststream", in.Path)
+			require.NotEqual(t, "", in.ID)
+			require.Equal(t, "SET_PARAMETER", in.Method)
+			require.Equal(t, "text/parameters", in.ContentType)
+			require.Equal(t, "ptz: left\r\n", in.Body)
+
+			w.Header().Set("Content-Type", "text/parameters")
+			w.Write([]byte("ptz: ok\r\n")) //nolint:errcheck
+		}),
+	}
+
+	ln, err := net.Listen("tcp", "localhost:9121")
+	require.NoError(t, err)
+
+	go hs.Serve(ln)
+	defer hs.Shutdown(context.Background())
+
+	source := gortsplib.Client{}
+
+	err = source.StartRecording("rtsp://127.0.0.1:8554/teststream",
+		&description.Session{Medias: []*description.Media{testMediaH264}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	u, err := base.ParseURL("rtsp://127.0.0.1:8554/teststream")
+	require.NoError(t, err)
+
+	var session string
+
+	transport := gortsplib.TransportUDP
+
+	reader := gortsplib.Client{
+		Transport: &transport,
+		OnResponse: func(res *base.Response) {
+			if v, ok := res.Header["Session"]; ok {
+				var sx headers.Session
+				err := sx.Unmarshal(v)
+				require.NoError(t, err)
+				session = sx.Session
+			}
+		},
+	}
+
+	err = reader.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	desc, _, err := reader.Describe(u)
+	require.NoError(t, err)
+
+	err = reader.SetupAll(desc.BaseURL, desc.Medias)
+	require.NoError(t, err)
+
+	_, err = reader.Play(nil)
+	require.NoError(t, err)
+
+	nconn, err := net.Dial("tcp", "127.0.0.1:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+
+	byts, err := base.Request{
+		Method: base.SetParameter,
+		URL:    u,
+		Header: base.Header{
+			"CSeq":         base.HeaderValue{"1"},
+			"Session":      base.HeaderValue{session},
+			"Content-Type": base.HeaderValue{"text/parameters"},
+		},
+		Body: []byte("ptz: left\r\n"),
+	}.Marshal()
+	require.NoError(t, err)
+
+	_, err = nconn.Write(byts)
+	require.NoError(t, err)
+
+	var res base.Response
+	err = res.Unmarshal(bufio.NewReader(nconn))
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	require.Equal(t, base.HeaderValue{"text/parameters"}, res.Header["Content-Type"])
+	require.Equal(t, []byte("ptz: ok\r\n"), res.Body)
+}
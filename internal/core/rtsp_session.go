@@ -4,12 +4,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/auth"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
 	"github.com/google/uuid"
 	"github.com/pion/rtp"
 
@@ -17,33 +19,41 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/multicast"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/protocols/savp"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
 type rtspSessionPathManager interface {
 	addPublisher(req pathAddPublisherReq) pathAddPublisherRes
 	addReader(req pathAddReaderReq) pathAddReaderRes
+	getConfForPath(req pathGetConfForPathReq) pathGetConfForPathRes
 }
 
 type rtspSessionParent interface {
 	logger.Writer
 	getISTLS() bool
 	getServer() *gortsplib.Server
+	getSRTP() *savp.Server
 }
 
 type rtspSession struct {
-	isTLS           bool
-	protocols       map[conf.Protocol]struct{}
-	session         *gortsplib.ServerSession
-	author          *gortsplib.ServerConn
-	externalCmdPool *externalcmd.Pool
-	pathManager     rtspSessionPathManager
-	parent          rtspSessionParent
+	isTLS             bool
+	protocols         map[conf.Protocol]struct{}
+	udpMaxPayloadSize int
+	session           *gortsplib.ServerSession
+	author            *gortsplib.ServerConn
+	externalCmdPool   *externalcmd.Pool
+	pathManager       rtspSessionPathManager
+	parent            rtspSessionParent
 
 	uuid            uuid.UUID
 	created         time.Time
 	path            *path
 	stream          *stream.Stream
+	playback        *playback.Playback
+	multicastSender *multicast.Sender
 	onUnreadHook    func()
 	mutex           sync.Mutex
 	state           gortsplib.ServerSessionState
@@ -56,6 +66,7 @@ type rtspSession struct {
 func newRTSPSession(
 	isTLS bool,
 	protocols map[conf.Protocol]struct{},
+	udpMaxPayloadSize int,
 	session *gortsplib.ServerSession,
 	sc *gortsplib.ServerConn,
 	externalCmdPool *externalcmd.Pool,
@@ -63,15 +74,16 @@ func newRTSPSession(
 	parent rtspSessionParent,
 ) *rtspSession {
 	s := &rtspSession{
-		isTLS:           isTLS,
-		protocols:       protocols,
-		session:         session,
-		author:          sc,
-		externalCmdPool: externalCmdPool,
-		pathManager:     pathManager,
-		parent:          parent,
-		uuid:            uuid.New(),
-		created:         time.Now(),
+		isTLS:             isTLS,
+		protocols:         protocols,
+		udpMaxPayloadSize: udpMaxPayloadSize,
+		session:           session,
+		author:            sc,
+		externalCmdPool:   externalCmdPool,
+		pathManager:       pathManager,
+		parent:            parent,
+		uuid:              uuid.New(),
+		created:           time.Now(),
 	}
 
 	s.decodeErrLogger = logger.NewLimitedLogger(s)
@@ -98,16 +110,27 @@ func (s *rtspSession) Log(level logger.Level, format string, args ...interface{}
 
 // onClose is called by rtspServer.
 func (s *rtspSession) onClose(err error) {
-	if s.session.State() == gortsplib.ServerSessionStatePlay {
+	if s.playback != nil {
+		s.playback.Close()
+		s.playback = nil
+	}
+
+	if s.session.State() == gortsplib.ServerSessionStatePlay && s.onUnreadHook != nil {
 		s.onUnreadHook()
+
+		if s.multicastSender != nil {
+			s.multicastSender.RemoveSession()
+		}
 	}
 
-	switch s.session.State() {
-	case gortsplib.ServerSessionStatePrePlay, gortsplib.ServerSessionStatePlay:
-		s.path.removeReader(pathRemoveReaderReq{author: s})
+	if s.path != nil {
+		switch s.session.State() {
+		case gortsplib.ServerSessionStatePrePlay, gortsplib.ServerSessionStatePlay:
+			s.path.removeReader(pathRemoveReaderReq{author: s})
 
-	case gortsplib.ServerSessionStatePreRecord, gortsplib.ServerSessionStateRecord:
-		s.path.removePublisher(pathRemovePublisherReq{author: s})
+		case gortsplib.ServerSessionStatePreRecord, gortsplib.ServerSessionStateRecord:
+			s.path.removePublisher(pathRemovePublisherReq{author: s})
+		}
 	}
 
 	s.path = nil
@@ -184,11 +207,12 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 	}
 	ctx.Path = ctx.Path[1:]
 
-	// in case the client is setupping a stream with UDP or UDP-multicast, and these
-	// transport protocols are disabled, gortsplib already blocks the request.
-	// we have only to handle the case in which the transport protocol is TCP
-	// and it is disabled.
-	if ctx.Transport == gortsplib.TransportTCP {
+	// in case the client is setupping a stream with UDP, and this
+	// transport protocol is disabled, gortsplib already blocks the request.
+	// we have only to handle the cases in which the transport protocol is TCP
+	// or UDP-multicast and it is disabled.
+	// setups with the RTP/SAVP profile are converted into setups with the TCP transport protocol.
+	if ctx.Transport == gortsplib.TransportTCP && c.srtpSetup == nil {
 		if _, ok := s.protocols[conf.Protocol(gortsplib.TransportTCP)]; !ok {
 			return &base.Response{
 				StatusCode: base.StatusUnsupportedTransport,
@@ -196,6 +220,13 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 		}
 	}
 
+	if c.srtpSetup != nil {
+		res, err := s.setupSRTP(c, s.parent.getSRTP(), ctx)
+		if res != nil {
+			return res, nil, err
+		}
+	}
+
 	switch s.session.State() {
 	case gortsplib.ServerSessionStateInitial, gortsplib.ServerSessionStatePrePlay: // play
 		baseURL := &base.URL{
@@ -221,6 +252,17 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 			}
 		}
 
+		start, err := rtspPlaybackStart(ctx.Query)
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}, nil, err
+		}
+
+		if !start.IsZero() {
+			return s.onSetupPlayback(c, ctx, start, baseURL)
+		}
+
 		res := s.pathManager.addReader(pathAddReaderReq{
 			author: s,
 			accessRequest: pathAccessRequest{
@@ -253,21 +295,52 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 			}
 		}
 
+		// the RTSP server always supports UDP-multicast, in order to allow reading
+		// static multicast groups. Dynamic groups are allocated only when the multicast
+		// transport protocol is enabled.
+		if ctx.Transport == gortsplib.TransportUDPMulticast && res.multicastSender == nil {
+			if _, ok := s.protocols[conf.Protocol(gortsplib.TransportUDPMulticast)]; !ok {
+				res.path.removeReader(pathRemoveReaderReq{author: s})
+				return &base.Response{
+					StatusCode: base.StatusUnsupportedTransport,
+				}, nil, nil
+			}
+		}
+
 		s.path = res.path
 		s.stream = res.stream
 
-		s.mutex.Lock()
-		s.state = gortsplib.ServerSessionStatePrePlay
-		s.pathName = ctx.Path
-		s.mutex.Unlock()
-
 		var stream *gortsplib.ServerStream
-		if !s.parent.getISTLS() {
+
+		switch {
+		// paths with a static multicast group are read from the group, that is fed by
+		// the multicast sender of the path. Sessions are setupped with a stream
+		// that doesn't receive any packet, in order to avoid sending packets twice.
+		case ctx.Transport == gortsplib.TransportUDPMulticast && res.multicastSender != nil:
+			mediaIndex, ok := rtspSetupMediaIndex(ctx.Request.URL)
+			if !ok {
+				mediaIndex = 0
+			}
+
+			s.multicastSender = res.multicastSender
+			c.editResponse = func(r *base.Response) {
+				rtspMulticastResponse(r, res.multicastSender, mediaIndex)
+			}
+
+			stream = res.multicastSender.RTSPStream(s.parent.getServer())
+
+		case !s.parent.getISTLS():
 			stream = res.stream.RTSPStream(s.parent.getServer())
-		} else {
+
+		default:
 			stream = res.stream.RTSPSStream(s.parent.getServer())
 		}
 
+		s.mutex.Lock()
+		s.state = gortsplib.ServerSessionStatePrePlay
+		s.pathName = ctx.Path
+		s.mutex.Unlock()
+
 		return &base.Response{
 			StatusCode: base.StatusOK,
 		}, stream, nil
@@ -279,8 +352,97 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 	}
 }
 
+// setupSRTP allows a session to exchange UDP media with SRTP.
+// It returns a response in case of errors.
+func (s *rtspSession) setupSRTP(c *rtspConn, srtp *savp.Server, ctx *gortsplib.ServerHandlerOnSetupCtx,
+) (*base.Response, error) {
+	key := savp.FindKey(c.srtpKeys, ctx.Request.URL)
+	if key == nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, fmt.Errorf("SRTP key not found")
+	}
+
+	setup := c.srtpSetup
+
+	err := srtp.Setup(c.rconn.NetConn().(*savp.Conn), setup, key)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	c.editResponse = func(res *base.Response) {
+		if res.StatusCode == base.StatusOK {
+			srtp.EncodeSetupResponse(setup, res)
+		}
+	}
+
+	return nil, nil
+}
+
+// onSetupPlayback setups a session that reads recordings of a path.
+func (s *rtspSession) onSetupPlayback(
+	c *rtspConn,
+	ctx *gortsplib.ServerHandlerOnSetupCtx,
+	start time.Time,
+	baseURL *base.URL,
+) (*base.Response, *gortsplib.ServerStream, error) {
+	if s.playback == nil {
+		res := s.pathManager.getConfForPath(pathGetConfForPathReq{
+			accessRequest: pathAccessRequest{
+				name:        ctx.Path,
+				query:       ctx.Query,
+				ip:          c.ip(),
+				proto:       authProtocolRTSP,
+				id:          &c.uuid,
+				rtspRequest: ctx.Request,
+				rtspBaseURL: baseURL,
+				rtspNonce:   c.authNonce,
+			},
+		})
+		if res.err != nil {
+			if terr, ok := res.err.(*errAuthentication); ok {
+				res, err := c.handleAuthError(terr)
+				return res, nil, err
+			}
+
+			return &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}, nil, res.err
+		}
+
+		pb, err := newRTSPPlayback(res.conf, ctx.Path, start, s.udpMaxPayloadSize, s)
+		if err != nil {
+			return rtspPlaybackErrorResponse(err), nil, err
+		}
+
+		s.playback = pb
+
+		s.mutex.Lock()
+		s.state = gortsplib.ServerSessionStatePrePlay
+		s.pathName = ctx.Path
+		s.mutex.Unlock()
+	}
+
+	var stream *gortsplib.ServerStream
+	if !s.parent.getISTLS() {
+		stream = s.playback.Stream().RTSPStream(s.parent.getServer())
+	} else {
+		stream = s.playback.Stream().RTSPSStream(s.parent.getServer())
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, stream, nil
+}
+
 // onPlay is called by rtspServer.
-func (s *rtspSession) onPlay(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+func (s *rtspSession) onPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	if s.playback != nil {
+		return s.onPlayPlayback(ctx)
+	}
+
 	h := make(base.Header)
 
 	if s.session.State() == gortsplib.ServerSessionStatePrePlay {
@@ -300,6 +462,10 @@ func (s *rtspSession) onPlay(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Respons
 			s,
 		)
 
+		if s.multicastSender != nil {
+			s.multicastSender.AddSession()
+		}
+
 		s.mutex.Lock()
 		s.state = gortsplib.ServerSessionStatePlay
 		s.transport = s.session.SetuppedTransport()
@@ -312,6 +478,55 @@ func (s *rtspSession) onPlay(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Respons
 	}, nil
 }
 
+// onPlayPlayback starts or resumes reading recordings,
+// from the position and with the speed requested by the Range and Scale headers.
+func (s *rtspSession) onPlayPlayback(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	start, err := rtspPlaybackRange(ctx.Request.Header, s.playback.Start)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	scale, err := rtspPlaybackScale(ctx.Request.Header)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	position := start
+	if position.IsZero() {
+		position = s.playback.Position()
+	}
+
+	if s.session.State() == gortsplib.ServerSessionStatePrePlay {
+		s.Log(logger.Info, "is reading recordings of path '%s' from %s, with %s, %s",
+			s.pathName,
+			position.Format(time.RFC3339),
+			s.session.SetuppedTransport(),
+			mediaInfo(s.session.SetuppedMedias()))
+
+		s.mutex.Lock()
+		s.state = gortsplib.ServerSessionStatePlay
+		s.transport = s.session.SetuppedTransport()
+		s.mutex.Unlock()
+	}
+
+	// the session starts receiving data after the response has been generated
+	ctx.Conn.UserData().(*rtspConn).afterResponse = func() {
+		s.playback.Play(start, scale)
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"Range": headers.Range{Value: &headers.RangeUTC{Start: position}}.Marshal(),
+			"Scale": base.HeaderValue{strconv.FormatFloat(scale, 'f', -1, 64)},
+		},
+	}, nil
+}
+
 // onRecord is called by rtspServer.
 func (s *rtspSession) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
 	res := s.path.startPublisher(pathStartPublisherReq{
@@ -327,6 +542,8 @@ func (s *rtspSession) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Res
 
 	s.stream = res.stream
 
+	absoluteTimeTolerance := time.Duration(s.path.safeConf().AbsoluteTimeTolerance)
+
 	for _, medi := range s.session.AnnouncedDescription().Medias {
 		for _, forma := range medi.Formats {
 			cmedi := medi
@@ -338,7 +555,11 @@ func (s *rtspSession) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Res
 					return
 				}
 
-				res.stream.WriteRTPPacket(cmedi, cforma, pkt, time.Now(), pts)
+				// use the absolute time provided by RTCP sender reports, when available and plausible
+				ntp, ok := s.session.PacketNTP(cmedi, pkt)
+				ntp = stream.AbsoluteTime(time.Now(), ntp, ok, absoluteTimeTolerance)
+
+				res.stream.WriteRTPPacket(cmedi, cforma, pkt, ntp, pts)
 			})
 		}
 	}
@@ -355,10 +576,26 @@ func (s *rtspSession) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Res
 
 // onPause is called by rtspServer.
 func (s *rtspSession) onPause(_ *gortsplib.ServerHandlerOnPauseCtx) (*base.Response, error) {
+	if s.playback != nil {
+		s.playback.Pause()
+
+		s.mutex.Lock()
+		s.state = gortsplib.ServerSessionStatePrePlay
+		s.mutex.Unlock()
+
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, nil
+	}
+
 	switch s.session.State() {
 	case gortsplib.ServerSessionStatePlay:
 		s.onUnreadHook()
 
+		if s.multicastSender != nil {
+			s.multicastSender.RemoveSession()
+		}
+
 		s.mutex.Lock()
 		s.state = gortsplib.ServerSessionStatePrePlay
 		s.mutex.Unlock()
@@ -376,6 +613,48 @@ func (s *rtspSession) onPause(_ *gortsplib.ServerHandlerOnPauseCtx) (*base.Respo
 	}, nil
 }
 
+// onParameter is called by rtspServer.
+// Parameter requests of readers are forwarded to the RTSP source of the path or to a webhook.
+// Requests without body are used as keepalives and are answered directly.
+func (s *rtspSession) onParameter(req *base.Request) (*base.Response, error) {
+	state := s.session.State()
+
+	if len(req.Body) == 0 || s.path == nil ||
+		(state != gortsplib.ServerSessionStatePrePlay && state != gortsplib.ServerSessionStatePlay) {
+		return defaultParameterResponse(req), nil
+	}
+
+	pathConf := s.path.safeConf()
+
+	var res *base.Response
+	var err error
+
+	switch {
+	case pathConf.RTSPParametersToSource:
+		var fw defs.StaticSourceParameterForwarder
+		fw, err = s.path.parameterForwarder()
+		if err == nil {
+			res, err = fw.ForwardParameterRequest(req)
+		}
+
+	case pathConf.RTSPParametersWebhook != "":
+		res, err = doRTSPParametersWebhook(pathConf.RTSPParametersWebhook,
+			s.remoteAddr().(*net.TCPAddr).IP, s.path.name, s.uuid, req)
+
+	default:
+		return defaultParameterResponse(req), nil
+	}
+
+	if err != nil {
+		s.Log(logger.Warn, "unable to forward %s: %v", req.Method, err)
+		return &base.Response{
+			StatusCode: base.StatusBadGateway,
+		}, nil
+	}
+
+	return res, nil
+}
+
 // apiReaderDescribe implements reader.
 func (s *rtspSession) apiReaderDescribe() defs.APIPathSourceOrReader {
 	return defs.APIPathSourceOrReader{
@@ -365,7 +365,11 @@ func (c *srtConn) runRead(req srtNewConnReq, pathName string, user string, pass
 
 	bw := bufio.NewWriterSize(sconn, srtMaxPayloadSize(c.udpMaxPayloadSize))
 
-	err = mpegtsSetupWrite(res.stream, writer, bw, sconn, time.Duration(c.writeTimeout))
+	err = mpegtsSetupWrite(res.stream, writer, bw,
+		func(_ bool, _ bool, _ time.Duration, _ time.Time) (bool, error) {
+			sconn.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+			return false, nil
+		})
 	if err != nil {
 		return true, err
 	}
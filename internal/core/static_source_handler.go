@@ -38,8 +38,13 @@ type staticSourceHandler struct {
 	instance  defs.StaticSource
 	running   bool
 
+	// whether the instance reconnects when receiving on Reconnect,
+	// keeping the stream.
+	canReconnect bool
+
 	// in
 	chReloadConf          chan *conf.Path
+	chReconnect           chan struct{}
 	chInstanceSetReady    chan defs.PathSourceStaticSetReadyReq
 	chInstanceSetNotReady chan defs.PathSourceStaticSetNotReadyReq
 
@@ -58,6 +63,7 @@ func newStaticSourceHandler(
 		conf:                  cnf,
 		parent:                parent,
 		chReloadConf:          make(chan *conf.Path),
+		chReconnect:           make(chan struct{}),
 		chInstanceSetReady:    make(chan defs.PathSourceStaticSetReadyReq),
 		chInstanceSetNotReady: make(chan defs.PathSourceStaticSetNotReadyReq),
 	}
@@ -71,6 +77,7 @@ func newStaticSourceHandler(
 			WriteQueueSize: writeQueueSize,
 			Parent:         s,
 		}
+		s.canReconnect = true
 
 	case strings.HasPrefix(cnf.Source, "rtmp://") ||
 		strings.HasPrefix(cnf.Source, "rtmps://"):
@@ -164,6 +171,7 @@ func (s *staticSourceHandler) run() {
 	var runCtxCancel func()
 	runErr := make(chan error)
 	runReloadConf := make(chan *conf.Path)
+	runReconnect := make(chan struct{})
 
 	recreate := func() {
 		runCtx, runCtxCancel = context.WithCancel(context.Background())
@@ -172,6 +180,7 @@ func (s *staticSourceHandler) run() {
 				Context:    runCtx,
 				Conf:       s.conf,
 				ReloadConf: runReloadConf,
+				Reconnect:  runReconnect,
 			})
 		}()
 	}
@@ -179,12 +188,20 @@ func (s *staticSourceHandler) run() {
 	recreate()
 
 	recreating := false
+	reconnecting := false
 	recreateTimer := newEmptyTimer()
 
 	for {
 		select {
 		case err := <-runErr:
 			runCtxCancel()
+
+			if reconnecting {
+				reconnecting = false
+				recreate()
+				continue
+			}
+
 			s.instance.Log(logger.Error, err.Error())
 			recreating = true
 			recreateTimer = time.NewTimer(staticSourceHandlerRetryPause)
@@ -208,6 +225,24 @@ func (s *staticSourceHandler) run() {
 				}()
 			}
 
+		case <-s.chReconnect:
+			if recreating {
+				continue
+			}
+
+			if s.canReconnect {
+				cInnerCtx := runCtx
+				go func() {
+					select {
+					case runReconnect <- struct{}{}:
+					case <-cInnerCtx.Done():
+					}
+				}()
+			} else if !reconnecting {
+				reconnecting = true
+				runCtxCancel()
+			}
+
 		case <-recreateTimer.C:
 			recreate()
 			recreating = false
@@ -229,11 +264,26 @@ func (s *staticSourceHandler) reloadConf(newConf *conf.Path) {
 	}
 }
 
+// reconnect asks the source to reconnect to the upstream server.
+// Sources that support it keep the stream, while others are recreated.
+func (s *staticSourceHandler) reconnect() {
+	select {
+	case s.chReconnect <- struct{}{}:
+	case <-s.ctx.Done():
+	}
+}
+
 // APISourceDescribe instanceements source.
 func (s *staticSourceHandler) APISourceDescribe() defs.APIPathSourceOrReader {
 	return s.instance.APISourceDescribe()
 }
 
+// parameterForwarder returns the instance, if it can forward parameter requests.
+func (s *staticSourceHandler) parameterForwarder() defs.StaticSourceParameterForwarder {
+	fw, _ := s.instance.(defs.StaticSourceParameterForwarder)
+	return fw
+}
+
 // setReady is called by a staticSource.
 func (s *staticSourceHandler) SetReady(req defs.PathSourceStaticSetReadyReq) defs.PathSourceStaticSetReadyRes {
 	req.Res = make(chan defs.PathSourceStaticSetReadyRes)
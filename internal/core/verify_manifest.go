@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+)
+
+// verifyManifest checks the recordings of a directory against their manifest.
+func verifyManifest(dir string, keyPath string) error {
+	if keyPath == "" {
+		return fmt.Errorf("a key is needed in order to verify the manifest")
+	}
+
+	key, err := record.LoadManifestPublicKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	r, err := record.VerifyManifest(dir, key)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range r.Verified {
+		fmt.Printf("%s: OK\n", seg)
+	}
+	for _, seg := range r.Modified {
+		fmt.Printf("%s: MODIFIED\n", seg)
+	}
+	for _, seg := range r.Missing {
+		fmt.Printf("%s: missing\n", seg)
+	}
+	for _, seg := range r.Unlisted {
+		fmt.Printf("%s: NOT IN MANIFEST\n", seg)
+	}
+
+	if !r.ChainValid {
+		return fmt.Errorf("manifest is not valid: %s", r.ChainError)
+	}
+
+	if !r.Valid() {
+		return fmt.Errorf("%d segments have been modified and %d are not in the manifest",
+			len(r.Modified), len(r.Unlisted))
+	}
+
+	fmt.Printf("manifest is valid: %d entries, %d segments verified, %d missing\n",
+		r.Entries, len(r.Verified), len(r.Missing))
+
+	return nil
+}
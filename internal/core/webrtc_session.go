@@ -472,6 +472,7 @@ func (s *webRTCSession) runPublish() (int, error) {
 	}
 
 	timeDecoder := rtptime.NewGlobalDecoder()
+	absoluteTimeTolerance := time.Duration(res.path.safeConf().AbsoluteTimeTolerance)
 
 	for i, media := range medias {
 		ci := i
@@ -490,7 +491,11 @@ func (s *webRTCSession) runPublish() (int, error) {
 					continue
 				}
 
-				rres.stream.WriteRTPPacket(cmedia, cmedia.Formats[0], pkt, time.Now(), pts)
+				// use the absolute time provided by RTCP sender reports, when available and plausible
+				ntp, ok := tracks[ci].PacketNTP(pkt)
+				ntp = stream.AbsoluteTime(time.Now(), ntp, ok, absoluteTimeTolerance)
+
+				rres.stream.WriteRTPPacket(cmedia, cmedia.Formats[0], pkt, ntp, pts)
 			}
 		}()
 	}
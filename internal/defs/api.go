@@ -28,15 +28,24 @@ type APIPathSourceOrReader struct {
 
 // APIPath is a path.
 type APIPath struct {
-	Name          string                  `json:"name"`
-	ConfName      string                  `json:"confName"`
-	Source        *APIPathSourceOrReader  `json:"source"`
-	Ready         bool                    `json:"ready"`
-	ReadyTime     *time.Time              `json:"readyTime"`
-	Tracks        []string                `json:"tracks"`
-	BytesReceived uint64                  `json:"bytesReceived"`
-	BytesSent     uint64                  `json:"bytesSent"`
-	Readers       []APIPathSourceOrReader `json:"readers"`
+	Name           string                  `json:"name"`
+	ConfName       string                  `json:"confName"`
+	Source         *APIPathSourceOrReader  `json:"source"`
+	Ready          bool                    `json:"ready"`
+	ReadyTime      *time.Time              `json:"readyTime"`
+	Tracks         []string                `json:"tracks"`
+	BytesReceived  uint64                  `json:"bytesReceived"`
+	BytesSent      uint64                  `json:"bytesSent"`
+	Readers        []APIPathSourceOrReader `json:"readers"`
+	Stalled        bool                    `json:"stalled"`
+	Recording      bool                    `json:"recording"`
+	RecordSchedule *APIPathRecordSchedule  `json:"recordSchedule"`
+}
+
+// APIPathRecordSchedule is the state of the recording schedule of a path.
+type APIPathRecordSchedule struct {
+	Active     bool       `json:"active"`
+	NextChange *time.Time `json:"nextChange"`
 }
 
 // APIPathList is a list of paths.
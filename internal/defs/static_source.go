@@ -3,6 +3,8 @@ package defs
 import (
 	"context"
 
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 )
@@ -14,6 +16,12 @@ type StaticSource interface {
 	APISourceDescribe() APIPathSourceOrReader
 }
 
+// StaticSourceParameterForwarder is implemented by static sources
+// that can forward GET_PARAMETER and SET_PARAMETER requests to the upstream server.
+type StaticSourceParameterForwarder interface {
+	ForwardParameterRequest(req *base.Request) (*base.Response, error)
+}
+
 // StaticSourceParent is the parent of a static source.
 type StaticSourceParent interface {
 	logger.Writer
@@ -26,4 +34,7 @@ type StaticSourceRunParams struct {
 	Context    context.Context
 	Conf       *conf.Path
 	ReloadConf chan *conf.Path
+
+	// only for sources that can reconnect while keeping the stream
+	Reconnect chan struct{}
 }
@@ -0,0 +1,196 @@
+// Package multicast contains a component that sends a stream to a static multicast group.
+package multicast
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/rtcpsender"
+	"github.com/pion/rtcp"
+	"golang.org/x/net/ipv4"
+
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// period of RTCP sender reports.
+var senderReportPeriod = 10 * time.Second
+
+// Ports returns the RTP and RTCP ports of the media with the given index,
+// when the first media uses basePort.
+func Ports(basePort int, mediaIndex int) [2]int {
+	port := basePort + mediaIndex*2
+	return [2]int{port, port + 1}
+}
+
+type senderMedia struct {
+	rtpAddr    *net.UDPAddr
+	rtcpAddr   *net.UDPAddr
+	rtcpSender *rtcpsender.RTCPSender
+}
+
+// Sender reads a stream and sends its RTP packets to a multicast group.
+// Each media is sent to a couple of ports, starting from Port.
+// Packets are sent only when the sender is always on or when it is in use by at least one session.
+type Sender struct {
+	Group          net.IP
+	Port           int
+	TTL            int
+	Source         net.IP
+	AlwaysOn       bool
+	WriteQueueSize int
+	Stream         *stream.Stream
+	Parent         logger.Writer
+
+	conn   *net.UDPConn
+	writer *asyncwriter.Writer
+	medias []*senderMedia
+	users  int64
+
+	mutex      sync.Mutex
+	rtspStream *gortsplib.ServerStream
+}
+
+// Initialize initializes Sender.
+func (s *Sender) Initialize() error {
+	// packets are sent from Source, in order to allow receivers to filter them
+	// with source-specific multicast.
+	var err error
+	s.conn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: s.Source})
+	if err != nil {
+		return err
+	}
+
+	err = ipv4.NewPacketConn(s.conn).SetMulticastTTL(s.TTL)
+	if err != nil {
+		s.conn.Close()
+		return err
+	}
+
+	s.writer = asyncwriter.New(s.WriteQueueSize, s)
+
+	for i, medi := range s.Stream.Desc().Medias {
+		s.setupMedia(i, medi)
+	}
+
+	s.writer.Start()
+
+	s.Log(logger.Info, "sending to %v:%d", s.Group, s.Port)
+
+	return nil
+}
+
+// Close closes Sender.
+func (s *Sender) Close() {
+	s.mutex.Lock()
+	if s.rtspStream != nil {
+		s.rtspStream.Close()
+	}
+	s.mutex.Unlock()
+
+	s.Stream.RemoveReader(s.writer)
+	s.writer.Stop()
+
+	for _, sm := range s.medias {
+		sm.rtcpSender.Close()
+	}
+
+	s.conn.Close()
+}
+
+// Log implements logger.Writer.
+func (s *Sender) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[multicast] "+format, args...)
+}
+
+// RTSPStream returns the stream that RTSP sessions that read the multicast group are setupped with.
+// Packets are never written into it, since they are sent by Sender, therefore the
+// multicast group that the RTSP server allocates to the stream doesn't receive any packet.
+func (s *Sender) RTSPStream(server *gortsplib.Server) *gortsplib.ServerStream {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.rtspStream == nil {
+		s.rtspStream = gortsplib.NewServerStream(server, s.Stream.Desc())
+	}
+	return s.rtspStream
+}
+
+// AddSession notifies the sender that a session started reading the multicast group.
+func (s *Sender) AddSession() {
+	atomic.AddInt64(&s.users, 1)
+}
+
+// RemoveSession notifies the sender that a session stopped reading the multicast group.
+func (s *Sender) RemoveSession() {
+	atomic.AddInt64(&s.users, -1)
+}
+
+func (s *Sender) active() bool {
+	return s.AlwaysOn || atomic.LoadInt64(&s.users) > 0
+}
+
+func (s *Sender) setupMedia(i int, medi *description.Media) {
+	ports := Ports(s.Port, i)
+
+	sm := &senderMedia{
+		rtpAddr:  &net.UDPAddr{IP: s.Group, Port: ports[0]},
+		rtcpAddr: &net.UDPAddr{IP: s.Group, Port: ports[1]},
+	}
+
+	sm.rtcpSender = rtcpsender.New(
+		medi.Formats[0].ClockRate(),
+		senderReportPeriod,
+		nil,
+		func(pkt rtcp.Packet) {
+			if !s.active() {
+				return
+			}
+
+			byts, err := pkt.Marshal()
+			if err != nil {
+				return
+			}
+
+			s.conn.WriteTo(byts, sm.rtcpAddr) //nolint:errcheck
+		})
+
+	s.medias = append(s.medias, sm)
+
+	for _, forma := range medi.Formats {
+		cforma := forma
+
+		s.Stream.AddReader(s.writer, medi, forma, func(u unit.Unit) error {
+			return s.writeUnit(sm, cforma, u)
+		})
+	}
+}
+
+func (s *Sender) writeUnit(sm *senderMedia, forma format.Format, u unit.Unit) error {
+	for _, pkt := range u.GetRTPPackets() {
+		sm.rtcpSender.ProcessPacket(pkt, u.GetNTP(), forma.PTSEqualsDTS(pkt))
+
+		if !s.active() {
+			continue
+		}
+
+		byts, err := pkt.Marshal()
+		if err != nil {
+			return err
+		}
+
+		_, err = s.conn.WriteTo(byts, sm.rtpAddr)
+		if err != nil {
+			s.Log(logger.Warn, "%v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,515 @@
+// Package playback contains a component that streams recordings.
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// period of the check for new parts and segments when the end of the recordings is reached.
+var pollPeriod = 1 * time.Second
+
+func durationMp4ToGo(v uint64, timeScale uint32) time.Duration {
+	timeScale64 := uint64(timeScale)
+	secs := v / timeScale64
+	dec := v % timeScale64
+	return time.Duration(secs)*time.Second + time.Duration(dec)*time.Second/time.Duration(timeScale64)
+}
+
+// ErrNoRecordings is returned when there are no recordings at the requested position.
+var ErrNoRecordings = errors.New("no recordings found")
+
+// Playback reads fMP4 recordings of a path and writes them into a stream,
+// starting from a given absolute time.
+type Playback struct {
+	RecordPath        string
+	PathName          string
+	Start             time.Time
+	UDPMaxPayloadSize int
+	Parent            logger.Writer
+
+	tracks   map[int]*track
+	hasVideo bool
+	stream   *stream.Stream
+
+	mutex     sync.Mutex
+	position  time.Time
+	pts       time.Duration
+	ctxCancel func()
+	done      chan struct{}
+}
+
+// readTracks reads the tracks of the segment that contains the given time.
+func readTracks(recordPath string, pathName string, start time.Time) (map[int]*track, *description.Session, error) {
+	segments, err := record.FindSegments(recordPath, pathName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seg := findSegment(segments, start)
+	if seg == nil {
+		return nil, nil, ErrNoRecordings
+	}
+
+	init, err := record.ReadSegmentInit(seg.Fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tracks := make(map[int]*track)
+	desc := &description.Session{}
+	payloadType := uint8(96)
+
+	for _, initTrack := range init.Tracks {
+		t := newTrack(initTrack, payloadType)
+		if t == nil {
+			continue
+		}
+
+		tracks[initTrack.ID] = t
+		desc.Medias = append(desc.Medias, t.media)
+		payloadType++
+	}
+
+	if len(desc.Medias) == 0 {
+		return nil, nil, fmt.Errorf("recordings don't contain any supported track")
+	}
+
+	return tracks, desc, nil
+}
+
+// Describe returns the description of the recordings of a path at the given time,
+// that is the same description of the stream of a Playback with the same parameters.
+func Describe(recordPath string, pathName string, start time.Time) (*description.Session, error) {
+	_, desc, err := readTracks(recordPath, pathName, start)
+	return desc, err
+}
+
+// Initialize initializes Playback.
+func (p *Playback) Initialize() error {
+	var desc *description.Session
+	var err error
+	p.tracks, desc, err = readTracks(p.RecordPath, p.PathName, p.Start)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range p.tracks {
+		if t.media.Type == description.MediaTypeVideo {
+			p.hasVideo = true
+		}
+	}
+
+	p.stream, err = stream.New(
+		p.UDPMaxPayloadSize,
+		desc,
+		true,
+		p,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.position = p.Start
+
+	return nil
+}
+
+// Close closes Playback.
+func (p *Playback) Close() {
+	p.Pause()
+	p.stream.Close()
+}
+
+// Log implements logger.Writer.
+func (p *Playback) Log(level logger.Level, format string, args ...interface{}) {
+	p.Parent.Log(level, "[playback] "+format, args...)
+}
+
+// Stream returns the stream that contains the recordings.
+func (p *Playback) Stream() *stream.Stream {
+	return p.stream
+}
+
+// Position returns the absolute time of the last unit that has been written.
+func (p *Playback) Position() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.position
+}
+
+// Play starts writing recordings into the stream from the given absolute time.
+// If start is zero, playback resumes from the current position.
+// Scale is the speed of playback; when it is not 1, only video keyframes are written.
+func (p *Playback) Play(start time.Time, scale float64) {
+	p.Pause()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !start.IsZero() {
+		p.position = start
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	p.ctxCancel = ctxCancel
+	p.done = make(chan struct{})
+
+	pl := &player{
+		p:        p,
+		ctx:      ctx,
+		scale:    scale,
+		startPTS: p.pts,
+	}
+
+	go pl.run(p.position, p.done)
+}
+
+// Pause stops writing recordings into the stream.
+func (p *Playback) Pause() {
+	p.mutex.Lock()
+	ctxCancel := p.ctxCancel
+	done := p.done
+	p.ctxCancel = nil
+	p.mutex.Unlock()
+
+	if ctxCancel != nil {
+		ctxCancel()
+		<-done
+	}
+}
+
+func (p *Playback) setPosition(ntp time.Time, pts time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.position = ntp
+
+	// next playbacks start slightly after the last written unit,
+	// in order to keep timestamps monotonic.
+	if pts >= p.pts {
+		p.pts = pts + time.Millisecond
+	}
+}
+
+// findSegment returns the segment that contains the given time,
+// or the first segment that starts after it.
+func findSegment(segments []*record.Segment, t time.Time) *record.Segment {
+	var ret *record.Segment
+
+	for _, seg := range segments {
+		if seg.Start.After(t) {
+			if ret == nil {
+				return seg
+			}
+			break
+		}
+		ret = seg
+	}
+
+	return ret
+}
+
+func readSegmentIndex(seg *record.Segment) (record.SegmentIndex, error) {
+	index, err := record.ReadSegmentIndex(seg.Fpath)
+	if err == nil {
+		return index, nil
+	}
+
+	return record.BuildSegmentIndex(seg.Fpath, seg.Start)
+}
+
+type player struct {
+	p        *Playback
+	ctx      context.Context
+	scale    float64
+	startPTS time.Duration
+
+	// time of the first written unit
+	startNTP  time.Time
+	startWall time.Time
+
+	// tracks of the current segment
+	segmentTracks map[int]*fmp4.InitTrack
+	needParams    map[int]bool
+}
+
+func (pl *player) run(position time.Time, done chan struct{}) {
+	defer close(done)
+
+	err := pl.runInner(position)
+	if err != nil && pl.ctx.Err() == nil {
+		pl.p.Log(logger.Warn, "%v", err)
+	}
+}
+
+func (pl *player) runInner(position time.Time) error {
+	segments, err := record.FindSegments(pl.p.RecordPath, pl.p.PathName)
+	if err != nil {
+		return err
+	}
+
+	seg := findSegment(segments, position)
+	if seg == nil {
+		return ErrNoRecordings
+	}
+
+	err = pl.openSegment(seg)
+	if err != nil {
+		return err
+	}
+
+	index, err := readSegmentIndex(seg)
+	if err != nil {
+		return err
+	}
+
+	next := findStartEntry(index, seg, position)
+
+	for {
+		if next < len(index) {
+			err = pl.writeParts(seg, index[next:])
+			if err != nil {
+				return err
+			}
+			next = len(index)
+		} else {
+			segments, err = record.FindSegments(pl.p.RecordPath, pl.p.PathName)
+			if err != nil {
+				return err
+			}
+
+			if nextSeg := findNextSegment(segments, seg); nextSeg != nil {
+				// the last parts of the current segment may have been written
+				// right before the creation of the next segment
+				index, err = readSegmentIndex(seg)
+				if err != nil {
+					return err
+				}
+				if next < len(index) {
+					continue
+				}
+
+				seg = nextSeg
+				next = 0
+
+				err = pl.openSegment(seg)
+				if err != nil {
+					return err
+				}
+			} else {
+				// wait for the segment being recorded to grow
+				select {
+				case <-time.After(pollPeriod):
+				case <-pl.ctx.Done():
+					return nil
+				}
+			}
+		}
+
+		// parts may have been appended to the segment in the meanwhile
+		index, err = readSegmentIndex(seg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func findNextSegment(segments []*record.Segment, cur *record.Segment) *record.Segment {
+	for _, seg := range segments {
+		if seg.Start.After(cur.Start) {
+			return seg
+		}
+	}
+	return nil
+}
+
+// findStartEntry returns the position of the entry that contains the last keyframe before position.
+func findStartEntry(index record.SegmentIndex, seg *record.Segment, position time.Time) int {
+	e := index.FindKeyframeNTP(position)
+	if e == nil && len(index) != 0 && index[0].NTP.IsZero() {
+		e = index.FindKeyframe(position.Sub(seg.Start))
+	}
+
+	for i := range index {
+		if &index[i] == e {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func (pl *player) openSegment(seg *record.Segment) error {
+	init, err := record.ReadSegmentInit(seg.Fpath)
+	if err != nil {
+		return err
+	}
+
+	pl.segmentTracks = make(map[int]*fmp4.InitTrack)
+	pl.needParams = make(map[int]bool)
+
+	for _, initTrack := range init.Tracks {
+		t, ok := pl.p.tracks[initTrack.ID]
+		if !ok {
+			continue
+		}
+
+		if !t.compatible(initTrack) {
+			pl.p.Log(logger.Warn, "skipping track %d of %s since its codec is different",
+				initTrack.ID, seg.Fpath)
+			continue
+		}
+
+		pl.segmentTracks[initTrack.ID] = initTrack
+		pl.needParams[initTrack.ID] = true
+	}
+
+	return nil
+}
+
+type playerSample struct {
+	trackID int
+	dts     time.Duration
+	ptsOff  time.Duration
+	sample  *fmp4.PartSample
+}
+
+func (pl *player) writeParts(seg *record.Segment, entries record.SegmentIndex) error {
+	f, err := os.Open(seg.Fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, e := range entries {
+		buf := make([]byte, e.Size)
+		_, err = f.ReadAt(buf, int64(e.Offset))
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var parts fmp4.Parts
+		err = parts.Unmarshal(buf)
+		if err != nil {
+			return err
+		}
+
+		partNTP := e.NTP
+		if partNTP.IsZero() {
+			partNTP = seg.Start.Add(e.DTS)
+		}
+
+		err = pl.writePart(parts, partNTP.Add(-e.DTS))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePart writes the samples of a part, in decoding order.
+// segmentNTP is the absolute time that corresponds to a DTS of zero.
+func (pl *player) writePart(parts fmp4.Parts, segmentNTP time.Time) error {
+	var samples []*playerSample
+
+	for _, part := range parts {
+		for _, partTrack := range part.Tracks {
+			initTrack, ok := pl.segmentTracks[partTrack.ID]
+			if !ok {
+				continue
+			}
+
+			dts := partTrack.BaseTime
+
+			for _, sampl := range partTrack.Samples {
+				samples = append(samples, &playerSample{
+					trackID: partTrack.ID,
+					dts:     durationMp4ToGo(dts, initTrack.TimeScale),
+					ptsOff: time.Duration(sampl.PTSOffset) * time.Second /
+						time.Duration(initTrack.TimeScale),
+					sample: sampl,
+				})
+				dts += uint64(sampl.Duration)
+			}
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].dts < samples[j].dts
+	})
+
+	for _, s := range samples {
+		err := pl.writeSample(s, segmentNTP.Add(s.dts))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pl *player) writeSample(s *playerSample, ntp time.Time) error {
+	t := pl.p.tracks[s.trackID]
+
+	if pl.scale != 1 && pl.p.hasVideo &&
+		(t.media.Type != description.MediaTypeVideo || s.sample.IsNonSyncSample) {
+		return nil
+	}
+
+	if pl.startNTP.IsZero() {
+		pl.startNTP = ntp
+		pl.startWall = time.Now()
+	}
+
+	elapsed := time.Duration(float64(ntp.Sub(pl.startNTP)) / pl.scale)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	select {
+	case <-time.After(time.Until(pl.startWall.Add(elapsed))):
+	case <-pl.ctx.Done():
+		return pl.ctx.Err()
+	}
+
+	var prms [][]byte
+	if pl.needParams[s.trackID] && !s.sample.IsNonSyncSample {
+		prms = params(pl.segmentTracks[s.trackID].Codec)
+		pl.needParams[s.trackID] = false
+	}
+
+	pts := pl.startPTS + elapsed + time.Duration(float64(s.ptsOff)/pl.scale)
+
+	u, err := t.unit(unit.Base{
+		PTS: pts,
+		NTP: ntp.Add(s.ptsOff),
+	}, s.sample, prms)
+	if err != nil {
+		pl.p.Log(logger.Warn, "unable to decode sample: %v", err)
+		return nil
+	}
+
+	pl.p.stream.WriteUnit(t.media, t.media.Formats[0], u)
+	pl.p.setPosition(ntp, pts)
+
+	return nil
+}
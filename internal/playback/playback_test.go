@@ -0,0 +1,198 @@
+package playback
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aler9/writerseeker"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {
+}
+
+var testSPS = []byte{
+	0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+	0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+	0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+}
+
+var testPPS = []byte{0x08, 0x06, 0x07, 0x08}
+
+// writeTestSegment writes a fMP4 segment with 5 parts of 100ms.
+// Parts 0 and 3 contain a video keyframe.
+func writeTestSegment(t *testing.T, fpath string) {
+	init := &fmp4.Init{
+		Tracks: []*fmp4.InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &fmp4.CodecH264{
+					SPS: testSPS,
+					PPS: testPPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 44100,
+				Codec: &fmp4.CodecMPEG4Audio{
+					Config: mpeg4audio.Config{
+						Type:         2,
+						SampleRate:   44100,
+						ChannelCount: 2,
+					},
+				},
+			},
+		},
+	}
+
+	var ws writerseeker.WriterSeeker
+	err := init.Marshal(&ws)
+	require.NoError(t, err)
+	buf := ws.Bytes()
+
+	for i := 0; i < 5; i++ {
+		keyframe := (i == 0 || i == 3)
+
+		var au [][]byte
+		if keyframe {
+			au = [][]byte{{5, byte(i)}}
+		} else {
+			au = [][]byte{{1, byte(i)}}
+		}
+
+		videoSample, err := fmp4.NewPartSampleH26x(0, keyframe, au)
+		require.NoError(t, err)
+		videoSample.Duration = 9000
+
+		part := &fmp4.Part{
+			SequenceNumber: uint32(i),
+			Tracks: []*fmp4.PartTrack{
+				{
+					ID:       1,
+					BaseTime: uint64(i) * 9000,
+					Samples:  []*fmp4.PartSample{videoSample},
+				},
+				{
+					ID:       2,
+					BaseTime: uint64(i) * 4410,
+					Samples: []*fmp4.PartSample{{
+						Duration: 4410,
+						Payload:  []byte{1, 2, 3, byte(i)},
+					}},
+				},
+			},
+		}
+
+		var ws writerseeker.WriterSeeker
+		err = part.Marshal(&ws)
+		require.NoError(t, err)
+		buf = append(buf, ws.Bytes()...)
+	}
+
+	err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, buf, 0o644)
+	require.NoError(t, err)
+}
+
+func TestPlayback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+	start := time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.Local)
+	writeTestSegment(t, filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"))
+
+	for _, ca := range []string{"seek", "scale"} {
+		t.Run(ca, func(t *testing.T) {
+			p := &Playback{
+				RecordPath:        recordPath,
+				PathName:          "mypath",
+				Start:             start,
+				UDPMaxPayloadSize: 1472,
+				Parent:            &nilLogger{},
+			}
+			err := p.Initialize()
+			require.NoError(t, err)
+			defer p.Close()
+
+			desc := p.Stream().Desc()
+			require.Equal(t, 2, len(desc.Medias))
+
+			received := make(chan *unit.H264, 10)
+
+			w := asyncwriter.New(1024, &nilLogger{})
+			p.Stream().AddReader(w, desc.Medias[0], desc.Medias[0].Formats[0], func(u unit.Unit) error {
+				received <- u.(*unit.H264)
+				return nil
+			})
+			w.Start()
+			defer w.Stop()
+			defer p.Stream().RemoveReader(w)
+
+			var u *unit.H264
+
+			switch ca {
+			case "seek":
+				p.Play(start.Add(350*time.Millisecond), 1)
+
+				u = <-received
+				require.Equal(t, start.Add(300*time.Millisecond), u.NTP)
+				require.Equal(t, [][]byte{testSPS, testPPS, {5, 3}}, u.AU)
+				pts := u.PTS
+
+				u = <-received
+				require.Equal(t, start.Add(400*time.Millisecond), u.NTP)
+				require.Equal(t, [][]byte{{1, 4}}, u.AU)
+				require.Equal(t, 100*time.Millisecond, u.PTS-pts)
+
+			case "scale":
+				p.Play(time.Time{}, 2)
+
+				u = <-received
+				require.Equal(t, start, u.NTP)
+				require.Equal(t, [][]byte{testSPS, testPPS, {5, 0}}, u.AU)
+				pts := u.PTS
+
+				// non-key frames are skipped
+				u = <-received
+				require.Equal(t, start.Add(300*time.Millisecond), u.NTP)
+				require.Equal(t, [][]byte{testSPS, testPPS, {5, 3}}, u.AU)
+				require.Equal(t, 150*time.Millisecond, u.PTS-pts)
+			}
+
+			// the position is the last written unit
+			p.Pause()
+			require.False(t, p.Position().Before(u.NTP))
+		})
+	}
+}
+
+func TestPlaybackNoRecordings(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := &Playback{
+		RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		PathName:          "mypath",
+		Start:             time.Now(),
+		UDPMaxPayloadSize: 1472,
+		Parent:            &nilLogger{},
+	}
+	err = p.Initialize()
+	require.Equal(t, ErrNoRecordings, err)
+}
@@ -0,0 +1,172 @@
+package playback
+
+import (
+	"reflect"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type track struct {
+	media *description.Media
+	codec fmp4.Codec
+}
+
+// newTrack allocates a track that corresponds to a fMP4 track.
+// It returns nil when the codec is not supported.
+func newTrack(initTrack *fmp4.InitTrack, payloadType uint8) *track {
+	var forma format.Format
+	mediaType := description.MediaTypeVideo
+
+	switch codec := initTrack.Codec.(type) {
+	case *fmp4.CodecAV1:
+		forma = &format.AV1{
+			PayloadTyp: payloadType,
+		}
+
+	case *fmp4.CodecVP9:
+		forma = &format.VP9{
+			PayloadTyp: payloadType,
+		}
+
+	case *fmp4.CodecH265:
+		forma = &format.H265{
+			PayloadTyp: payloadType,
+			VPS:        codec.VPS,
+			SPS:        codec.SPS,
+			PPS:        codec.PPS,
+		}
+
+	case *fmp4.CodecH264:
+		forma = &format.H264{
+			PayloadTyp:        payloadType,
+			SPS:               codec.SPS,
+			PPS:               codec.PPS,
+			PacketizationMode: 1,
+		}
+
+	case *fmp4.CodecMPEG4Video:
+		forma = &format.MPEG4Video{
+			PayloadTyp:     payloadType,
+			ProfileLevelID: 1,
+			Config:         codec.Config,
+		}
+
+	case *fmp4.CodecMPEG1Video:
+		forma = &format.MPEG1Video{}
+
+	case *fmp4.CodecMJPEG:
+		forma = &format.MJPEG{}
+
+	case *fmp4.CodecOpus:
+		mediaType = description.MediaTypeAudio
+		forma = &format.Opus{
+			PayloadTyp: payloadType,
+			IsStereo:   (codec.ChannelCount == 2),
+		}
+
+	case *fmp4.CodecMPEG4Audio:
+		mediaType = description.MediaTypeAudio
+		config := codec.Config
+		forma = &format.MPEG4Audio{
+			PayloadTyp:       payloadType,
+			Config:           &config,
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}
+
+	case *fmp4.CodecMPEG1Audio:
+		mediaType = description.MediaTypeAudio
+		forma = &format.MPEG1Audio{}
+
+	case *fmp4.CodecAC3:
+		mediaType = description.MediaTypeAudio
+		forma = &format.AC3{
+			PayloadTyp:   payloadType,
+			SampleRate:   codec.SampleRate,
+			ChannelCount: codec.ChannelCount,
+		}
+
+	default:
+		return nil
+	}
+
+	return &track{
+		media: &description.Media{
+			Type:    mediaType,
+			Formats: []format.Format{forma},
+		},
+		codec: initTrack.Codec,
+	}
+}
+
+// compatible returns whether a track of another segment can be streamed with this track.
+func (t *track) compatible(initTrack *fmp4.InitTrack) bool {
+	return reflect.TypeOf(t.codec) == reflect.TypeOf(initTrack.Codec)
+}
+
+// params returns the parameters of the codec of a segment,
+// that are prepended to the first random access unit of each segment.
+func params(codec fmp4.Codec) [][]byte {
+	switch codec := codec.(type) {
+	case *fmp4.CodecH265:
+		return [][]byte{codec.VPS, codec.SPS, codec.PPS}
+
+	case *fmp4.CodecH264:
+		return [][]byte{codec.SPS, codec.PPS}
+	}
+	return nil
+}
+
+func (t *track) unit(base unit.Base, sampl *fmp4.PartSample, params [][]byte) (unit.Unit, error) {
+	switch t.codec.(type) {
+	case *fmp4.CodecAV1:
+		tu, err := sampl.GetAV1()
+		if err != nil {
+			return nil, err
+		}
+		return &unit.AV1{Base: base, TU: tu}, nil
+
+	case *fmp4.CodecVP9:
+		return &unit.VP9{Base: base, Frame: sampl.Payload}, nil
+
+	case *fmp4.CodecH265:
+		au, err := sampl.GetH26x()
+		if err != nil {
+			return nil, err
+		}
+		return &unit.H265{Base: base, AU: append(params, au...)}, nil
+
+	case *fmp4.CodecH264:
+		au, err := sampl.GetH26x()
+		if err != nil {
+			return nil, err
+		}
+		return &unit.H264{Base: base, AU: append(params, au...)}, nil
+
+	case *fmp4.CodecMPEG4Video:
+		return &unit.MPEG4Video{Base: base, Frame: sampl.Payload}, nil
+
+	case *fmp4.CodecMPEG1Video:
+		return &unit.MPEG1Video{Base: base, Frame: sampl.Payload}, nil
+
+	case *fmp4.CodecMJPEG:
+		return &unit.MJPEG{Base: base, Frame: sampl.Payload}, nil
+
+	case *fmp4.CodecOpus:
+		return &unit.Opus{Base: base, Packets: [][]byte{sampl.Payload}}, nil
+
+	case *fmp4.CodecMPEG4Audio:
+		return &unit.MPEG4Audio{Base: base, AUs: [][]byte{sampl.Payload}}, nil
+
+	case *fmp4.CodecMPEG1Audio:
+		return &unit.MPEG1Audio{Base: base, Frames: [][]byte{sampl.Payload}}, nil
+
+	default: // AC-3
+		return &unit.AC3{Base: base, Frames: [][]byte{sampl.Payload}}, nil
+	}
+}
@@ -1,8 +1,10 @@
 package httpserv
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 
@@ -12,7 +14,7 @@ import (
 type loggerWriter struct {
 	w      http.ResponseWriter
 	status int
-	buf    bytes.Buffer
+	size   int
 }
 
 func (w *loggerWriter) Header() http.Header {
@@ -23,8 +25,9 @@ func (w *loggerWriter) Write(b []byte) (int, error) {
 	if w.status == 0 {
 		w.status = http.StatusOK
 	}
-	w.buf.Write(b)
-	return w.w.Write(b)
+	n, err := w.w.Write(b)
+	w.size += n
+	return n, err
 }
 
 func (w *loggerWriter) WriteHeader(statusCode int) {
@@ -32,27 +35,46 @@ func (w *loggerWriter) WriteHeader(statusCode int) {
 	w.w.WriteHeader(statusCode)
 }
 
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter.
+func (w *loggerWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
+// Hijack implements http.Hijacker.
+func (w *loggerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.w).Hijack()
+}
+
 func (w *loggerWriter) dump() string {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "%s %d %s\n", "HTTP/1.1", w.status, http.StatusText(w.status))
 	w.w.Header().Write(&buf) //nolint:errcheck
 	buf.Write([]byte("\n"))
-	if w.buf.Len() > 0 {
-		fmt.Fprintf(&buf, "(body of %d bytes)", w.buf.Len())
+	if w.size > 0 {
+		fmt.Fprintf(&buf, "(body of %d bytes)", w.size)
 	}
 	return buf.String()
 }
 
+// RequestBodyStreamer is implemented by handlers that read request bodies while they are being received.
+// Bodies of these requests are not logged, since they can't be read in advance.
+type RequestBodyStreamer interface {
+	StreamsRequestBody(r *http.Request) bool
+}
+
 // log requests and responses.
 type handlerLogger struct {
 	http.Handler
-	log logger.Writer
+	log      logger.Writer
+	streamer RequestBodyStreamer
 }
 
 func (h *handlerLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.log.Log(logger.Debug, "[conn %v] %s %s", r.RemoteAddr, r.Method, r.URL.Path)
 
-	byts, _ := httputil.DumpRequest(r, true)
+	dumpBody := h.streamer == nil || !h.streamer.StreamsRequestBody(r)
+
+	byts, _ := httputil.DumpRequest(r, dumpBody)
 	h.log.Log(logger.Debug, "[conn %v] [c->s] %s", r.RemoteAddr, string(byts))
 
 	logw := &loggerWriter{w: w}
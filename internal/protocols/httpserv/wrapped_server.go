@@ -58,11 +58,13 @@ func NewWrappedServer(
 		}
 	}
 
+	streamer, _ := handler.(RequestBodyStreamer)
+
 	h := handler
 	h = &handlerFilterRequests{h}
 	h = &handlerFilterRequests{h}
 	h = &handlerServerHeader{h}
-	h = &handlerLogger{h, parent}
+	h = &handlerLogger{h, parent, streamer}
 	h = &handlerExitOnPanic{h}
 
 	s := &WrappedServer{
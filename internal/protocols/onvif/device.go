@@ -0,0 +1,153 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Time is a time of day.
+type Time struct {
+	Hour   int `xml:"tt:Hour"`
+	Minute int `xml:"tt:Minute"`
+	Second int `xml:"tt:Second"`
+}
+
+// Date is a date.
+type Date struct {
+	Year  int `xml:"tt:Year"`
+	Month int `xml:"tt:Month"`
+	Day   int `xml:"tt:Day"`
+}
+
+// DateTime is a date and a time.
+type DateTime struct {
+	Time Time `xml:"tt:Time"`
+	Date Date `xml:"tt:Date"`
+}
+
+// TimeZone is a time zone in POSIX format.
+type TimeZone struct {
+	TZ string `xml:"tt:TZ"`
+}
+
+// SystemDateAndTime is the date and time of the device.
+type SystemDateAndTime struct {
+	DateTimeType    string   `xml:"tt:DateTimeType"`
+	DaylightSavings bool     `xml:"tt:DaylightSavings"`
+	TimeZone        TimeZone `xml:"tt:TimeZone"`
+	UTCDateTime     DateTime `xml:"tt:UTCDateTime"`
+}
+
+// NewSystemDateAndTime allocates a SystemDateAndTime.
+// Clients use it to compute the timestamps of their credentials.
+func NewSystemDateAndTime(t time.Time) SystemDateAndTime {
+	t = t.UTC()
+
+	return SystemDateAndTime{
+		DateTimeType: "NTP",
+		TimeZone: TimeZone{
+			TZ: "UTC0",
+		},
+		UTCDateTime: DateTime{
+			Time: Time{
+				Hour:   t.Hour(),
+				Minute: t.Minute(),
+				Second: t.Second(),
+			},
+			Date: Date{
+				Year:  t.Year(),
+				Month: int(t.Month()),
+				Day:   t.Day(),
+			},
+		},
+	}
+}
+
+// GetSystemDateAndTimeResponse is the response to GetSystemDateAndTime.
+type GetSystemDateAndTimeResponse struct {
+	XMLName           xml.Name          `xml:"tds:GetSystemDateAndTimeResponse"`
+	SystemDateAndTime SystemDateAndTime `xml:"tds:SystemDateAndTime"`
+}
+
+// GetDeviceInformationResponse is the response to GetDeviceInformation.
+type GetDeviceInformationResponse struct {
+	XMLName         xml.Name `xml:"tds:GetDeviceInformationResponse"`
+	Manufacturer    string   `xml:"tds:Manufacturer"`
+	Model           string   `xml:"tds:Model"`
+	FirmwareVersion string   `xml:"tds:FirmwareVersion"`
+	SerialNumber    string   `xml:"tds:SerialNumber"`
+	HardwareID      string   `xml:"tds:HardwareId"`
+}
+
+// DeviceCapabilities are the capabilities of the device service.
+type DeviceCapabilities struct {
+	XAddr string `xml:"tt:XAddr"`
+}
+
+// StreamingCapabilities are the streaming capabilities of the media service.
+type StreamingCapabilities struct {
+	RTPMulticast bool `xml:"tt:RTPMulticast"`
+	RTPTCP       bool `xml:"tt:RTP_TCP"`
+	RTPRTSPTCP   bool `xml:"tt:RTP_RTSP_TCP"`
+}
+
+// MediaCapabilities are the capabilities of the media service.
+type MediaCapabilities struct {
+	XAddr                 string                `xml:"tt:XAddr"`
+	StreamingCapabilities StreamingCapabilities `xml:"tt:StreamingCapabilities"`
+}
+
+// Capabilities are the capabilities of the device.
+type Capabilities struct {
+	Device DeviceCapabilities `xml:"tt:Device"`
+	Media  MediaCapabilities  `xml:"tt:Media"`
+}
+
+// GetCapabilitiesResponse is the response to GetCapabilities.
+type GetCapabilitiesResponse struct {
+	XMLName      xml.Name     `xml:"tds:GetCapabilitiesResponse"`
+	Capabilities Capabilities `xml:"tds:Capabilities"`
+}
+
+// Version is the version of a service.
+type Version struct {
+	Major int `xml:"tt:Major"`
+	Minor int `xml:"tt:Minor"`
+}
+
+// Service is a service of the device.
+type Service struct {
+	Namespace string  `xml:"tds:Namespace"`
+	XAddr     string  `xml:"tds:XAddr"`
+	Version   Version `xml:"tds:Version"`
+}
+
+// GetServicesResponse is the response to GetServices.
+type GetServicesResponse struct {
+	XMLName  xml.Name  `xml:"tds:GetServicesResponse"`
+	Services []Service `xml:"tds:Service"`
+}
+
+// Scope is a scope of the device.
+type Scope struct {
+	ScopeDef  string `xml:"tt:ScopeDef"`
+	ScopeItem string `xml:"tt:ScopeItem"`
+}
+
+// GetScopesResponse is the response to GetScopes.
+type GetScopesResponse struct {
+	XMLName xml.Name `xml:"tds:GetScopesResponse"`
+	Scopes  []Scope  `xml:"tds:Scopes"`
+}
+
+// NewScopes allocates the scopes of the device.
+func NewScopes(scopes []string) []Scope {
+	ret := make([]Scope, len(scopes))
+	for i, s := range scopes {
+		ret[i] = Scope{
+			ScopeDef:  "Fixed",
+			ScopeItem: s,
+		}
+	}
+	return ret
+}
@@ -0,0 +1,188 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// DiscoveryAddress is the multicast address of WS-Discovery.
+const DiscoveryAddress = "239.255.255.250:3702"
+
+const (
+	discoveryTo          = "urn:schemas-xmlsoap-org:ws:2005:04:discovery"
+	discoveryToAnonymous = "http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous"
+	discoveryActionBase  = "http://schemas.xmlsoap.org/ws/2005/04/discovery/"
+	discoveryTypes       = "dn:NetworkVideoTransmitter tds:Device"
+)
+
+// local names of the types that are advertised.
+var discoveryTypesLocal = []string{"NetworkVideoTransmitter", "Device"}
+
+// Probe is a WS-Discovery probe.
+type Probe struct {
+	MessageID string
+
+	// local names of the requested types.
+	Types []string
+}
+
+type probeEnvelope struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  struct {
+		MessageID string `xml:"http://schemas.xmlsoap.org/ws/2004/08/addressing MessageID"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+	Body struct {
+		Probe *struct {
+			Types string `xml:"Types"`
+		} `xml:"http://schemas.xmlsoap.org/ws/2005/04/discovery Probe"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+}
+
+// Unmarshal decodes a Probe.
+func (p *Probe) Unmarshal(byts []byte) error {
+	var env probeEnvelope
+	err := xml.Unmarshal(byts, &env)
+	if err != nil {
+		return err
+	}
+
+	if env.Body.Probe == nil {
+		return fmt.Errorf("not a probe")
+	}
+
+	p.MessageID = env.Header.MessageID
+	p.Types = nil
+
+	for _, t := range strings.Fields(env.Body.Probe.Types) {
+		if i := strings.IndexByte(t, ':'); i >= 0 {
+			t = t[i+1:]
+		}
+		p.Types = append(p.Types, t)
+	}
+
+	return nil
+}
+
+// Matches returns whether the device is requested by the probe.
+func (p *Probe) Matches() bool {
+	if len(p.Types) == 0 {
+		return true
+	}
+
+	for _, t := range p.Types {
+		for _, lt := range discoveryTypesLocal {
+			if t == lt {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type appSequence struct {
+	InstanceID    uint32 `xml:"InstanceId,attr"`
+	MessageNumber uint32 `xml:"MessageNumber,attr"`
+}
+
+type endpointReference struct {
+	Address string `xml:"wsa:Address"`
+}
+
+type discoveryMatch struct {
+	EndpointReference endpointReference `xml:"wsa:EndpointReference"`
+	Types             string            `xml:"d:Types"`
+	Scopes            string            `xml:"d:Scopes,omitempty"`
+	XAddrs            string            `xml:"d:XAddrs,omitempty"`
+	MetadataVersion   int               `xml:"d:MetadataVersion"`
+}
+
+type probeMatches struct {
+	XMLName    xml.Name       `xml:"d:ProbeMatches"`
+	ProbeMatch discoveryMatch `xml:"d:ProbeMatch"`
+}
+
+type hello struct {
+	XMLName xml.Name `xml:"d:Hello"`
+	discoveryMatch
+}
+
+type bye struct {
+	XMLName           xml.Name          `xml:"d:Bye"`
+	EndpointReference endpointReference `xml:"wsa:EndpointReference"`
+}
+
+// Endpoint is a device that is advertised through WS-Discovery.
+// It is not safe for concurrent use.
+type Endpoint struct {
+	// stable UUID of the device.
+	ID uuid.UUID
+
+	// scopes, in the form onvif://www.onvif.org/...
+	Scopes []string
+
+	// addresses of the device service.
+	XAddrs []string
+
+	// incremented when the metadata of the device change.
+	MetadataVersion int
+
+	// identifies the current run of the device.
+	InstanceID uint32
+
+	messageNumber uint32
+}
+
+func (e *Endpoint) address() string {
+	return "urn:uuid:" + e.ID.String()
+}
+
+func (e *Endpoint) match(xaddrs []string) discoveryMatch {
+	return discoveryMatch{
+		EndpointReference: endpointReference{Address: e.address()},
+		Types:             discoveryTypes,
+		Scopes:            strings.Join(e.Scopes, " "),
+		XAddrs:            strings.Join(xaddrs, " "),
+		MetadataVersion:   e.MetadataVersion,
+	}
+}
+
+func (e *Endpoint) header(action string, to string, relatesTo string) *header {
+	e.messageNumber++
+
+	return &header{
+		MessageID: "urn:uuid:" + uuid.New().String(),
+		RelatesTo: relatesTo,
+		To:        to,
+		Action:    discoveryActionBase + action,
+		AppSequence: &appSequence{
+			InstanceID:    e.InstanceID,
+			MessageNumber: e.messageNumber,
+		},
+	}
+}
+
+// MarshalProbeMatches marshals the response to a probe.
+// xaddrs are the addresses of the device service that can be reached by the sender of the probe.
+func (e *Endpoint) MarshalProbeMatches(p *Probe, xaddrs []string) ([]byte, error) {
+	return marshalEnvelope(
+		e.header("ProbeMatches", discoveryToAnonymous, p.MessageID),
+		probeMatches{ProbeMatch: e.match(xaddrs)})
+}
+
+// MarshalHello marshals the announcement that is sent when the device joins the network.
+func (e *Endpoint) MarshalHello() ([]byte, error) {
+	return marshalEnvelope(
+		e.header("Hello", discoveryTo, ""),
+		hello{discoveryMatch: e.match(e.XAddrs)})
+}
+
+// MarshalBye marshals the announcement that is sent when the device leaves the network.
+func (e *Endpoint) MarshalBye() ([]byte, error) {
+	return marshalEnvelope(
+		e.header("Bye", discoveryTo, ""),
+		bye{EndpointReference: endpointReference{Address: e.address()}})
+}
@@ -0,0 +1,104 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testProbe = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<Header>
+<wsa:MessageID xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">uuid:84ede3de-7dec-11d0-c360-f01234567890</wsa:MessageID>
+<wsa:To xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To>
+<wsa:Action xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>
+</Header>
+<Body>
+<Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<Types>dn:NetworkVideoTransmitter</Types>
+<Scopes/>
+</Probe>
+</Body>
+</Envelope>`
+
+func TestProbeUnmarshal(t *testing.T) {
+	var p Probe
+	err := p.Unmarshal([]byte(testProbe))
+	require.NoError(t, err)
+	require.Equal(t, Probe{
+		MessageID: "uuid:84ede3de-7dec-11d0-c360-f01234567890",
+		Types:     []string{"NetworkVideoTransmitter"},
+	}, p)
+	require.Equal(t, true, p.Matches())
+
+	p.Types = []string{"Printer"}
+	require.Equal(t, false, p.Matches())
+
+	p.Types = nil
+	require.Equal(t, true, p.Matches())
+}
+
+func TestProbeUnmarshalNotProbe(t *testing.T) {
+	e := &Endpoint{ID: uuid.New()}
+
+	byts, err := e.MarshalHello()
+	require.NoError(t, err)
+
+	var p Probe
+	err = p.Unmarshal(byts)
+	require.EqualError(t, err, "not a probe")
+}
+
+func TestMarshalProbeMatches(t *testing.T) {
+	e := &Endpoint{
+		ID:              uuid.MustParse("5a4b3e57-1d77-4c4a-8d2a-3b5b0a0c9f11"),
+		Scopes:          []string{"onvif://www.onvif.org/name/MediaMTX", "onvif://www.onvif.org/Profile/Streaming"},
+		MetadataVersion: 1,
+		InstanceID:      1234,
+	}
+
+	var p Probe
+	err := p.Unmarshal([]byte(testProbe))
+	require.NoError(t, err)
+
+	byts, err := e.MarshalProbeMatches(&p, []string{"http://192.168.2.1:8580/onvif/device_service"})
+	require.NoError(t, err)
+
+	var dec struct {
+		Header struct {
+			RelatesTo   string `xml:"RelatesTo"`
+			Action      string `xml:"Action"`
+			AppSequence struct {
+				InstanceID    uint32 `xml:"InstanceId,attr"`
+				MessageNumber uint32 `xml:"MessageNumber,attr"`
+			} `xml:"AppSequence"`
+		} `xml:"Header"`
+		Body struct {
+			ProbeMatches struct {
+				ProbeMatch struct {
+					Address         string `xml:"EndpointReference>Address"`
+					Types           string `xml:"Types"`
+					Scopes          string `xml:"Scopes"`
+					XAddrs          string `xml:"XAddrs"`
+					MetadataVersion int    `xml:"MetadataVersion"`
+				} `xml:"ProbeMatch"`
+			} `xml:"ProbeMatches"`
+		} `xml:"Body"`
+	}
+	err = xml.Unmarshal(byts, &dec)
+	require.NoError(t, err)
+
+	require.Equal(t, "uuid:84ede3de-7dec-11d0-c360-f01234567890", dec.Header.RelatesTo)
+	require.Equal(t, "http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches", dec.Header.Action)
+	require.Equal(t, uint32(1234), dec.Header.AppSequence.InstanceID)
+	require.Equal(t, uint32(1), dec.Header.AppSequence.MessageNumber)
+
+	pm := dec.Body.ProbeMatches.ProbeMatch
+	require.Equal(t, "urn:uuid:5a4b3e57-1d77-4c4a-8d2a-3b5b0a0c9f11", pm.Address)
+	require.Equal(t, "dn:NetworkVideoTransmitter tds:Device", pm.Types)
+	require.Equal(t, "onvif://www.onvif.org/name/MediaMTX onvif://www.onvif.org/Profile/Streaming", pm.Scopes)
+	require.Equal(t, "http://192.168.2.1:8580/onvif/device_service", pm.XAddrs)
+	require.Equal(t, 1, pm.MetadataVersion)
+}
@@ -0,0 +1,210 @@
+// Package onvif contains messages of the ONVIF device and media services and of WS-Discovery.
+package onvif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// XML namespaces.
+const (
+	NamespaceEnvelope   = "http://www.w3.org/2003/05/soap-envelope"
+	NamespaceDevice     = "http://www.onvif.org/ver10/device/wsdl"
+	NamespaceMedia      = "http://www.onvif.org/ver10/media/wsdl"
+	NamespaceSchema     = "http://www.onvif.org/ver10/schema"
+	NamespaceError      = "http://www.onvif.org/ver10/error"
+	NamespaceNetwork    = "http://www.onvif.org/ver10/network/wsdl"
+	NamespaceAddressing = "http://schemas.xmlsoap.org/ws/2004/08/addressing"
+	NamespaceDiscovery  = "http://schemas.xmlsoap.org/ws/2005/04/discovery"
+)
+
+// elements are marshaled with prefixes, that are declared in the envelope.
+type envelope struct {
+	XMLName      xml.Name `xml:"env:Envelope"`
+	NSEnvelope   string   `xml:"xmlns:env,attr"`
+	NSDevice     string   `xml:"xmlns:tds,attr"`
+	NSMedia      string   `xml:"xmlns:trt,attr"`
+	NSSchema     string   `xml:"xmlns:tt,attr"`
+	NSError      string   `xml:"xmlns:ter,attr"`
+	NSNetwork    string   `xml:"xmlns:dn,attr"`
+	NSAddressing string   `xml:"xmlns:wsa,attr"`
+	NSDiscovery  string   `xml:"xmlns:d,attr"`
+	Header       *header  `xml:"env:Header,omitempty"`
+	Body         body     `xml:"env:Body"`
+}
+
+type header struct {
+	MessageID   string       `xml:"wsa:MessageID"`
+	RelatesTo   string       `xml:"wsa:RelatesTo,omitempty"`
+	To          string       `xml:"wsa:To"`
+	Action      string       `xml:"wsa:Action"`
+	AppSequence *appSequence `xml:"d:AppSequence,omitempty"`
+}
+
+type body struct {
+	Content interface{}
+}
+
+func marshalEnvelope(h *header, content interface{}) ([]byte, error) {
+	byts, err := xml.Marshal(envelope{
+		NSEnvelope:   NamespaceEnvelope,
+		NSDevice:     NamespaceDevice,
+		NSMedia:      NamespaceMedia,
+		NSSchema:     NamespaceSchema,
+		NSError:      NamespaceError,
+		NSNetwork:    NamespaceNetwork,
+		NSAddressing: NamespaceAddressing,
+		NSDiscovery:  NamespaceDiscovery,
+		Header:       h,
+		Body:         body{Content: content},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), byts...), nil
+}
+
+// MarshalResponse marshals a response, or a Fault, into a SOAP envelope.
+func MarshalResponse(content interface{}) ([]byte, error) {
+	return marshalEnvelope(nil, content)
+}
+
+// Request is a SOAP request.
+type Request struct {
+	// namespace of the action.
+	Namespace string
+
+	// name of the action, i.e. the first element of the body.
+	Action string
+
+	byts []byte
+}
+
+// findAction positions the decoder after the start of the first element of the body.
+func findAction(d *xml.Decoder) (*xml.StartElement, error) {
+	depth := 0
+	inBody := false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("action not found")
+			}
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+
+			switch {
+			case depth == 1:
+				if tok.Name.Space != NamespaceEnvelope || tok.Name.Local != "Envelope" {
+					return nil, fmt.Errorf("invalid envelope")
+				}
+
+			case depth == 2 && tok.Name.Space == NamespaceEnvelope && tok.Name.Local == "Body":
+				inBody = true
+
+			case depth == 3 && inBody:
+				return &tok, nil
+			}
+
+		case xml.EndElement:
+			depth--
+			if depth == 1 {
+				inBody = false
+			}
+		}
+	}
+}
+
+// Unmarshal decodes a request.
+func (r *Request) Unmarshal(byts []byte) error {
+	se, err := findAction(xml.NewDecoder(bytes.NewReader(byts)))
+	if err != nil {
+		return err
+	}
+
+	r.Namespace = se.Name.Space
+	r.Action = se.Name.Local
+	r.byts = byts
+
+	return nil
+}
+
+// UnmarshalAction decodes the action into v.
+// Fields of v are matched by their local names.
+func (r *Request) UnmarshalAction(v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(r.byts))
+
+	se, err := findAction(d)
+	if err != nil {
+		return err
+	}
+
+	return d.DecodeElement(v, se)
+}
+
+// FaultCode is the code of a Fault.
+type FaultCode string
+
+// fault codes.
+const (
+	FaultCodeSender   FaultCode = "env:Sender"
+	FaultCodeReceiver FaultCode = "env:Receiver"
+)
+
+type faultCode struct {
+	Value   string     `xml:"env:Value"`
+	Subcode *faultCode `xml:"env:Subcode,omitempty"`
+}
+
+type faultText struct {
+	Lang  string `xml:"xml:lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type faultReason struct {
+	Text faultText `xml:"env:Text"`
+}
+
+// Fault is a SOAP fault.
+type Fault struct {
+	XMLName xml.Name    `xml:"env:Fault"`
+	Code    faultCode   `xml:"env:Code"`
+	Reason  faultReason `xml:"env:Reason"`
+}
+
+// NewFault allocates a Fault.
+// Subcodes are ONVIF error codes, like "ter:ActionNotSupported".
+func NewFault(code FaultCode, reason string, subcodes ...string) *Fault {
+	f := &Fault{
+		Code: faultCode{
+			Value: string(code),
+		},
+		Reason: faultReason{
+			Text: faultText{
+				Lang:  "en",
+				Value: reason,
+			},
+		},
+	}
+
+	cur := &f.Code
+	for _, sc := range subcodes {
+		cur.Subcode = &faultCode{Value: sc}
+		cur = cur.Subcode
+	}
+
+	return f
+}
+
+// IsSender returns whether the fault is caused by the sender.
+func (f *Fault) IsSender() bool {
+	return f.Code.Value == string(FaultCodeSender)
+}
@@ -0,0 +1,94 @@
+package onvif
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGetStreamURIRequest = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+<s:Header>
+<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+<UsernameToken><Username>admin</Username><Password>secret</Password></UsernameToken>
+</Security>
+</s:Header>
+<s:Body xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+<GetStreamUri xmlns="http://www.onvif.org/ver10/media/wsdl">
+<StreamSetup>
+<Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream>
+<Transport xmlns="http://www.onvif.org/ver10/schema"><Protocol>RTSP</Protocol></Transport>
+</StreamSetup>
+<ProfileToken>mypath</ProfileToken>
+</GetStreamUri>
+</s:Body>
+</s:Envelope>`
+
+func TestRequestUnmarshal(t *testing.T) {
+	var req Request
+	err := req.Unmarshal([]byte(testGetStreamURIRequest))
+	require.NoError(t, err)
+	require.Equal(t, NamespaceMedia, req.Namespace)
+	require.Equal(t, "GetStreamUri", req.Action)
+
+	var gsu GetStreamURI
+	err = req.UnmarshalAction(&gsu)
+	require.NoError(t, err)
+	require.Equal(t, GetStreamURI{
+		StreamSetup: StreamSetup{
+			Stream: "RTP-Unicast",
+			Transport: StreamSetupTransport{
+				Protocol: "RTSP",
+			},
+		},
+		ProfileToken: "mypath",
+	}, gsu)
+}
+
+func TestRequestUnmarshalErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts string
+		err  string
+	}{
+		{
+			"invalid envelope",
+			`<Envelope><Body><GetProfiles/></Body></Envelope>`,
+			"invalid envelope",
+		},
+		{
+			"missing action",
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body></s:Body></s:Envelope>`,
+			"action not found",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var req Request
+			err := req.Unmarshal([]byte(ca.byts))
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestMarshalFault(t *testing.T) {
+	f := NewFault(FaultCodeSender, "profile not found", "ter:InvalidArgVal", "ter:NoProfile")
+	require.Equal(t, true, f.IsSender())
+
+	byts, err := MarshalResponse(f)
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"`+
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl"`+
+		` xmlns:trt="http://www.onvif.org/ver10/media/wsdl"`+
+		` xmlns:tt="http://www.onvif.org/ver10/schema"`+
+		` xmlns:ter="http://www.onvif.org/ver10/error"`+
+		` xmlns:dn="http://www.onvif.org/ver10/network/wsdl"`+
+		` xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing"`+
+		` xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">`+
+		`<env:Body><env:Fault>`+
+		`<env:Code><env:Value>env:Sender</env:Value>`+
+		`<env:Subcode><env:Value>ter:InvalidArgVal</env:Value>`+
+		`<env:Subcode><env:Value>ter:NoProfile</env:Value></env:Subcode></env:Subcode></env:Code>`+
+		`<env:Reason><env:Text xml:lang="en">profile not found</env:Text></env:Reason>`+
+		`</env:Fault></env:Body></env:Envelope>`, string(byts))
+}
@@ -0,0 +1,100 @@
+package onvif
+
+import (
+	"encoding/xml"
+)
+
+// GetProfile is a GetProfile request.
+type GetProfile struct {
+	ProfileToken string `xml:"ProfileToken"`
+}
+
+// StreamSetupTransport is the transport of a StreamSetup.
+type StreamSetupTransport struct {
+	Protocol string `xml:"Protocol"`
+}
+
+// StreamSetup is the stream setup of a GetStreamUri request.
+type StreamSetup struct {
+	Stream    string               `xml:"Stream"`
+	Transport StreamSetupTransport `xml:"Transport"`
+}
+
+// GetStreamURI is a GetStreamUri request.
+type GetStreamURI struct {
+	StreamSetup  StreamSetup `xml:"StreamSetup"`
+	ProfileToken string      `xml:"ProfileToken"`
+}
+
+// GetSnapshotURI is a GetSnapshotUri request.
+type GetSnapshotURI struct {
+	ProfileToken string `xml:"ProfileToken"`
+}
+
+// VideoEncoderConfiguration is the configuration of a video encoder.
+type VideoEncoderConfiguration struct {
+	Token    string `xml:"token,attr"`
+	Name     string `xml:"tt:Name"`
+	UseCount int    `xml:"tt:UseCount"`
+	Encoding string `xml:"tt:Encoding"`
+}
+
+// Profile is a media profile.
+type Profile struct {
+	Token                     string                     `xml:"token,attr"`
+	Fixed                     bool                       `xml:"fixed,attr"`
+	Name                      string                     `xml:"tt:Name"`
+	VideoEncoderConfiguration *VideoEncoderConfiguration `xml:"tt:VideoEncoderConfiguration,omitempty"`
+}
+
+// GetProfilesResponse is the response to GetProfiles.
+type GetProfilesResponse struct {
+	XMLName  xml.Name  `xml:"trt:GetProfilesResponse"`
+	Profiles []Profile `xml:"trt:Profiles"`
+}
+
+// GetProfileResponse is the response to GetProfile.
+type GetProfileResponse struct {
+	XMLName xml.Name `xml:"trt:GetProfileResponse"`
+	Profile Profile  `xml:"trt:Profile"`
+}
+
+// MediaURI is the URI of a stream or of a snapshot.
+type MediaURI struct {
+	URI                 string `xml:"tt:Uri"`
+	InvalidAfterConnect bool   `xml:"tt:InvalidAfterConnect"`
+	InvalidAfterReboot  bool   `xml:"tt:InvalidAfterReboot"`
+	Timeout             string `xml:"tt:Timeout"`
+}
+
+// NewMediaURI allocates a MediaURI that never expires.
+func NewMediaURI(u string) MediaURI {
+	return MediaURI{
+		URI:     u,
+		Timeout: "PT0S",
+	}
+}
+
+// GetStreamURIResponse is the response to GetStreamUri.
+type GetStreamURIResponse struct {
+	XMLName  xml.Name `xml:"trt:GetStreamUriResponse"`
+	MediaURI MediaURI `xml:"trt:MediaUri"`
+}
+
+// GetSnapshotURIResponse is the response to GetSnapshotUri.
+type GetSnapshotURIResponse struct {
+	XMLName  xml.Name `xml:"trt:GetSnapshotUriResponse"`
+	MediaURI MediaURI `xml:"trt:MediaUri"`
+}
+
+// VideoSource is a video source.
+type VideoSource struct {
+	Token     string  `xml:"token,attr"`
+	Framerate float64 `xml:"tt:Framerate"`
+}
+
+// GetVideoSourcesResponse is the response to GetVideoSources.
+type GetVideoSourcesResponse struct {
+	XMLName      xml.Name      `xml:"trt:GetVideoSourcesResponse"`
+	VideoSources []VideoSource `xml:"trt:VideoSources"`
+}
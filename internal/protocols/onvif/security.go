@@ -0,0 +1,100 @@
+package onvif
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// maximum difference between the creation time of a digest and the current time.
+const usernameTokenMaxAge = 5 * time.Minute
+
+type securityEnvelope struct {
+	Header struct {
+		Security struct {
+			UsernameToken *struct {
+				Username string `xml:"Username"`
+				Password struct {
+					Type  string `xml:"Type,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"Password"`
+				Nonce   string `xml:"Nonce"`
+				Created string `xml:"Created"`
+			} `xml:"UsernameToken"`
+		} `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+}
+
+// UsernameToken is a WS-Security UsernameToken, used by clients to authenticate requests.
+type UsernameToken struct {
+	Username string
+
+	// password in plain text, or its digest.
+	Password string
+
+	// whether Password is a digest (PasswordDigest) instead of the password (PasswordText).
+	IsDigest bool
+
+	Nonce   []byte
+	Created string
+}
+
+// UsernameToken returns the UsernameToken of the request, or nil if the request doesn't have one.
+func (r *Request) UsernameToken() *UsernameToken {
+	var env securityEnvelope
+	err := xml.NewDecoder(bytes.NewReader(r.byts)).Decode(&env)
+	if err != nil || env.Header.Security.UsernameToken == nil {
+		return nil
+	}
+
+	ut := env.Header.Security.UsernameToken
+
+	t := &UsernameToken{
+		Username: strings.TrimSpace(ut.Username),
+		Password: strings.TrimSpace(ut.Password.Value),
+		IsDigest: strings.HasSuffix(ut.Password.Type, "#PasswordDigest"),
+		Created:  strings.TrimSpace(ut.Created),
+	}
+
+	if ut.Nonce != "" {
+		t.Nonce, err = base64.StdEncoding.DecodeString(strings.TrimSpace(ut.Nonce))
+		if err != nil {
+			return nil
+		}
+	}
+
+	return t
+}
+
+// ValidateDigest checks whether the digest of the token has been generated with the given password.
+// Digests created too far from now are rejected, in order to limit replay attacks.
+func (t *UsernameToken) ValidateDigest(password string, now time.Time) bool {
+	if !t.IsDigest {
+		return false
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, t.Created)
+	if err != nil {
+		return false
+	}
+
+	diff := now.Sub(created)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > usernameTokenMaxAge {
+		return false
+	}
+
+	h := sha1.New() //nolint:gosec
+	h.Write(t.Nonce)
+	h.Write([]byte(t.Created))
+	h.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	return subtle.ConstantTimeCompare([]byte(digest), []byte(t.Password)) == 1
+}
@@ -0,0 +1,65 @@
+package onvif
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// example of the ONVIF Application Programmer's Guide.
+const testDigestRequest = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+<s:Header>
+<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+<UsernameToken>
+<Username>user</Username>
+<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` +
+	`tuOSpGlFlIXsozq4HFNeeGeFLEI=</Password>
+<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` +
+	`LKqI6G/AikKCQrN0zqZFlg==</Nonce>
+<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` +
+	`2010-09-16T07:50:45Z</Created>
+</UsernameToken>
+</Security>
+</s:Header>
+<s:Body><GetProfiles xmlns="http://www.onvif.org/ver10/media/wsdl"/></s:Body>
+</s:Envelope>`
+
+func TestUsernameTokenText(t *testing.T) {
+	var req Request
+	err := req.Unmarshal([]byte(testGetStreamURIRequest))
+	require.NoError(t, err)
+
+	ut := req.UsernameToken()
+	require.Equal(t, &UsernameToken{
+		Username: "admin",
+		Password: "secret",
+	}, ut)
+	require.Equal(t, false, ut.ValidateDigest("secret", time.Now()))
+}
+
+func TestUsernameTokenDigest(t *testing.T) {
+	var req Request
+	err := req.Unmarshal([]byte(testDigestRequest))
+	require.NoError(t, err)
+
+	ut := req.UsernameToken()
+	require.NotNil(t, ut)
+	require.Equal(t, "user", ut.Username)
+	require.Equal(t, true, ut.IsDigest)
+
+	created := time.Date(2010, 9, 16, 7, 50, 45, 0, time.UTC)
+
+	require.Equal(t, true, ut.ValidateDigest("userpassword", created.Add(time.Minute)))
+	require.Equal(t, false, ut.ValidateDigest("wrongpassword", created.Add(time.Minute)))
+	require.Equal(t, false, ut.ValidateDigest("userpassword", created.Add(time.Hour)))
+}
+
+func TestUsernameTokenMissing(t *testing.T) {
+	var req Request
+	err := req.Unmarshal([]byte(`<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">` +
+		`<Body><GetProfiles xmlns="http://www.onvif.org/ver10/media/wsdl"/></Body></Envelope>`))
+	require.NoError(t, err)
+	require.Nil(t, req.UsernameToken())
+}
@@ -0,0 +1,177 @@
+package rtsptunnel
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// decodeBase64Stream decodes a base64 stream made of multiple messages
+// that are encoded independently and that may end with padding.
+// It returns the decoded data and the characters that can't be decoded yet.
+func decodeBase64Stream(src []byte) ([]byte, []byte, error) {
+	var clean []byte
+	for _, b := range src {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			clean = append(clean, b)
+		}
+	}
+
+	n := len(clean) / 4 * 4
+	dec := make([]byte, 0, n/4*3)
+	var quantum [3]byte
+
+	for i := 0; i < n; i += 4 {
+		l, err := base64.StdEncoding.Decode(quantum[:], clean[i:i+4])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid base64 data: %w", err)
+		}
+		dec = append(dec, quantum[:l]...)
+	}
+
+	return dec, clean[n:], nil
+}
+
+// httpConn is a connection tunnelled through a GET and one or more POST requests.
+// The GET connection is hijacked in order to write raw data, without chunked encoding.
+type httpConn struct {
+	nconn net.Conn
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newHTTPConn(w http.ResponseWriter) (*httpConn, error) {
+	nconn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// remove deadlines set by the HTTP server
+	nconn.SetDeadline(time.Time{}) //nolint:errcheck
+
+	_, err = nconn.Write([]byte("HTTP/1.0 200 OK\r\n" +
+		"Content-Type: " + httpTunnelContentType + "\r\n" +
+		"Cache-Control: no-store\r\n" +
+		"Pragma: no-cache\r\n" +
+		"Connection: close\r\n" +
+		"\r\n"))
+	if err != nil {
+		nconn.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+
+	return &httpConn{
+		nconn: nconn,
+		pr:    pr,
+		pw:    pw,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// run waits until the client closes the GET connection, then closes the connection.
+func (c *httpConn) run() {
+	io.Copy(io.Discard, c.nconn) //nolint:errcheck
+	c.Close()
+}
+
+func (c *httpConn) readPost(w http.ResponseWriter, r *http.Request) error {
+	// unblock reads when the connection is closed
+	finished := make(chan struct{})
+	defer close(finished)
+
+	go func() {
+		select {
+		case <-c.done:
+			http.NewResponseController(w).SetReadDeadline(time.Now()) //nolint:errcheck
+		case <-finished:
+		}
+	}()
+
+	buf := make([]byte, 4096)
+	var pending []byte
+
+	for {
+		n, err := r.Body.Read(buf)
+
+		if n > 0 {
+			var dec []byte
+			var err2 error
+			dec, pending, err2 = decodeBase64Stream(append(pending, buf[:n]...))
+			if err2 != nil {
+				return err2
+			}
+
+			if len(dec) > 0 {
+				_, err2 = c.pw.Write(dec)
+				if err2 != nil {
+					return err2
+				}
+			}
+		}
+
+		if err != nil {
+			// the client is allowed to close a POST request and open another one.
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Read implements net.Conn.
+func (c *httpConn) Read(p []byte) (int, error) {
+	return c.pr.Read(p)
+}
+
+// Write implements net.Conn.
+func (c *httpConn) Write(p []byte) (int, error) {
+	return c.nconn.Write(p)
+}
+
+// Close implements net.Conn.
+func (c *httpConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.nconn.Close()
+		c.pr.Close()
+		c.pw.Close()
+	})
+	return nil
+}
+
+// LocalAddr implements net.Conn.
+func (c *httpConn) LocalAddr() net.Addr {
+	return c.nconn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *httpConn) RemoteAddr() net.Addr {
+	return c.nconn.RemoteAddr()
+}
+
+// SetDeadline implements net.Conn.
+func (c *httpConn) SetDeadline(t time.Time) error {
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+// Incoming data is carried by POST requests, whose lifetime is independent from the connection,
+// therefore read deadlines are not supported.
+func (c *httpConn) SetReadDeadline(_ time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *httpConn) SetWriteDeadline(t time.Time) error {
+	return c.nconn.SetWriteDeadline(t)
+}
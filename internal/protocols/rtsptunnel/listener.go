@@ -0,0 +1,221 @@
+// Package rtsptunnel allows to tunnel RTSP connections through HTTP and WebSocket.
+package rtsptunnel
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// content type of Apple-style HTTP tunnels.
+const httpTunnelContentType = "application/x-rtsp-tunnelled"
+
+// WebSocket subprotocol defined by the ONVIF streaming specification.
+const websocketSubprotocol = "rtsp.onvif.org"
+
+// Listener is a net.Listener that returns both connections accepted by an underlying listener
+// and connections tunnelled through HTTP or WebSocket.
+// Tunnelled connections are fed by using Listener as a http.Handler.
+type Listener struct {
+	ln       net.Listener
+	upgrader websocket.Upgrader
+
+	mutex       sync.Mutex
+	httpTunnels map[string]*httpConn
+
+	closeOnce sync.Once
+	conns     chan net.Conn
+	acceptErr chan error
+	done      chan struct{}
+}
+
+// NewListener allocates a Listener.
+// allowOrigin is the origin that browsers are allowed to open WebSocket tunnels from.
+// When empty, only the origin of the listener is allowed. "*" allows any origin.
+// Clients that don't send an Origin header are always allowed, since they are not browsers.
+func NewListener(ln net.Listener, allowOrigin string) *Listener {
+	l := &Listener{
+		ln: ln,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{websocketSubprotocol},
+			CheckOrigin:  checkOrigin(allowOrigin),
+		},
+		httpTunnels: make(map[string]*httpConn),
+		conns:       make(chan net.Conn),
+		acceptErr:   make(chan error, 1),
+		done:        make(chan struct{}),
+	}
+
+	go l.runAccept()
+
+	return l
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case nconn := <-l.conns:
+		return nconn, nil
+
+	case err := <-l.acceptErr:
+		return nil, err
+
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.ln.Close()
+	})
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+func (l *Listener) runAccept() {
+	for {
+		nconn, err := l.ln.Accept()
+		if err != nil {
+			l.acceptErr <- err
+			return
+		}
+
+		if !l.push(nconn) {
+			return
+		}
+	}
+}
+
+func (l *Listener) push(nconn net.Conn) bool {
+	select {
+	case l.conns <- nconn:
+		return true
+
+	case <-l.done:
+		nconn.Close()
+		return false
+	}
+}
+
+func checkOrigin(allowOrigin string) func(r *http.Request) bool {
+	switch allowOrigin {
+	case "":
+		// use the same-origin check of the upgrader
+		return nil
+
+	case "*":
+		return func(_ *http.Request) bool {
+			return true
+		}
+
+	default:
+		return func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || origin == allowOrigin
+		}
+	}
+}
+
+// StreamsRequestBody implements httpserv.RequestBodyStreamer.
+// POST requests of HTTP tunnels are read while they are being received.
+func (l *Listener) StreamsRequestBody(r *http.Request) bool {
+	return r.Header.Get("Content-Type") == httpTunnelContentType
+}
+
+// ServeHTTP implements http.Handler.
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case websocket.IsWebSocketUpgrade(r):
+		l.serveWebSocket(w, r)
+
+	case r.Method == http.MethodGet && r.Header.Get("x-sessioncookie") != "":
+		l.serveHTTPTunnelGet(w, r)
+
+	case r.Method == http.MethodPost && r.Header.Get("x-sessioncookie") != "":
+		l.serveHTTPTunnelPost(w, r)
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (l *Listener) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	wc, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	l.push(newWebSocketConn(wc))
+}
+
+// the GET request of a HTTP tunnel carries data from the server to the client.
+// It stays open until the connection is closed.
+func (l *Listener) serveHTTPTunnelGet(w http.ResponseWriter, r *http.Request) {
+	cookie := r.Header.Get("x-sessioncookie")
+
+	l.mutex.Lock()
+	_, exists := l.httpTunnels[cookie]
+	l.mutex.Unlock()
+
+	if exists {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c, err := newHTTPConn(w)
+	if err != nil {
+		return
+	}
+
+	l.mutex.Lock()
+	_, exists = l.httpTunnels[cookie]
+	if !exists {
+		l.httpTunnels[cookie] = c
+	}
+	l.mutex.Unlock()
+
+	if exists {
+		c.Close()
+		return
+	}
+
+	go func() {
+		c.run()
+
+		l.mutex.Lock()
+		delete(l.httpTunnels, cookie)
+		l.mutex.Unlock()
+	}()
+
+	l.push(c)
+}
+
+// POST requests of a HTTP tunnel carry base64-encoded data from the client to the server.
+// A client can send data with a single, long-lived request, or with multiple requests.
+func (l *Listener) serveHTTPTunnelPost(w http.ResponseWriter, r *http.Request) {
+	cookie := r.Header.Get("x-sessioncookie")
+
+	l.mutex.Lock()
+	c, ok := l.httpTunnels[cookie]
+	l.mutex.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := c.readPost(w, r)
+	if err != nil {
+		c.Close()
+	}
+}
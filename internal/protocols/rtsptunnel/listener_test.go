@@ -0,0 +1,212 @@
+package rtsptunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBase64Stream(t *testing.T) {
+	src := []byte(base64.StdEncoding.EncodeToString([]byte("ab")) +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("cdef"))[:6])
+
+	dec, pending, err := decodeBase64Stream(src)
+	require.NoError(t, err)
+	require.Equal(t, []byte("abcde"), dec)
+	require.Equal(t, []byte("Zg"), pending)
+
+	dec, pending, err = decodeBase64Stream(append(pending, '=', '='))
+	require.NoError(t, err)
+	require.Equal(t, []byte("f"), dec)
+	require.Equal(t, []byte{}, pending)
+}
+
+func newTestListener(t *testing.T, allowOrigin string) (*Listener, string, func()) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	l := NewListener(ln, allowOrigin)
+
+	httpLn, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	s := &http.Server{Handler: l}
+	go s.Serve(httpLn)
+
+	return l, httpLn.Addr().String(), func() {
+		l.Close()
+		s.Shutdown(context.Background())
+	}
+}
+
+func TestListenerHTTPTunnel(t *testing.T) {
+	l, addr, closeFunc := newTestListener(t, "")
+	defer closeFunc()
+
+	getConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer getConn.Close()
+
+	_, err = getConn.Write([]byte("GET /mystream HTTP/1.0\r\n" +
+		"x-sessioncookie: abcdef\r\n" +
+		"Accept: application/x-rtsp-tunnelled\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+
+	br := bufio.NewReader(getConn)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "application/x-rtsp-tunnelled", res.Header.Get("Content-Type"))
+
+	nconn, err := l.Accept()
+	require.NoError(t, err)
+	defer nconn.Close()
+
+	postConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer postConn.Close()
+
+	_, err = postConn.Write([]byte("POST /mystream HTTP/1.0\r\n" +
+		"x-sessioncookie: abcdef\r\n" +
+		"Content-Type: application/x-rtsp-tunnelled\r\n" +
+		"Content-Length: 32767\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("OPTIONS")) +
+		base64.StdEncoding.EncodeToString([]byte(" rtsp://localhost/mystream"))))
+	require.NoError(t, err)
+
+	buf := make([]byte, len("OPTIONS rtsp://localhost/mystream"))
+	_, err = io.ReadFull(nconn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "OPTIONS rtsp://localhost/mystream", string(buf))
+
+	_, err = nconn.Write([]byte("RTSP/1.0 200 OK"))
+	require.NoError(t, err)
+
+	buf = make([]byte, len("RTSP/1.0 200 OK"))
+	_, err = io.ReadFull(br, buf)
+	require.NoError(t, err)
+	require.Equal(t, "RTSP/1.0 200 OK", string(buf))
+
+	// closing the GET request closes the connection
+	getConn.Close()
+	_, err = nconn.Read(buf)
+	require.Error(t, err)
+}
+
+func TestListenerWebSocket(t *testing.T) {
+	l, addr, closeFunc := newTestListener(t, "")
+	defer closeFunc()
+
+	d := websocket.Dialer{
+		Subprotocols: []string{"rtsp.onvif.org"},
+	}
+
+	wc, res, err := d.Dial("ws://"+addr+"/mystream", nil) //nolint:bodyclose
+	require.NoError(t, err)
+	defer wc.Close()
+	require.Equal(t, "rtsp.onvif.org", res.Header.Get("Sec-WebSocket-Protocol"))
+
+	nconn, err := l.Accept()
+	require.NoError(t, err)
+	defer nconn.Close()
+
+	_, ok := nconn.RemoteAddr().(*net.TCPAddr)
+	require.True(t, ok)
+
+	err = wc.WriteMessage(websocket.BinaryMessage, []byte("OPTIONS"))
+	require.NoError(t, err)
+
+	err = wc.WriteMessage(websocket.BinaryMessage, []byte(" rtsp://localhost/mystream"))
+	require.NoError(t, err)
+
+	buf := make([]byte, len("OPTIONS rtsp://localhost/mystream"))
+	_, err = io.ReadFull(nconn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "OPTIONS rtsp://localhost/mystream", string(buf))
+
+	_, err = nconn.Write([]byte("RTSP/1.0 200 OK"))
+	require.NoError(t, err)
+
+	typ, byts, err := wc.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, typ)
+	require.Equal(t, "RTSP/1.0 200 OK", string(byts))
+}
+
+func TestListenerWebSocketOrigin(t *testing.T) {
+	for _, ca := range []struct {
+		name        string
+		allowOrigin string
+		origin      string
+		allowed     bool
+	}{
+		{"default, no origin", "", "", true},
+		{"default, same origin", "", "same", true},
+		{"default, other origin", "", "http://example.com", false},
+		{"any, other origin", "*", "http://example.com", true},
+		{"specific, same origin", "http://example.com", "http://example.com", true},
+		{"specific, other origin", "http://example.com", "http://other.com", false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, addr, closeFunc := newTestListener(t, ca.allowOrigin)
+			defer closeFunc()
+
+			d := websocket.Dialer{
+				Subprotocols: []string{"rtsp.onvif.org"},
+			}
+
+			h := http.Header{}
+			switch ca.origin {
+			case "":
+			case "same":
+				h.Set("Origin", "http://"+addr)
+			default:
+				h.Set("Origin", ca.origin)
+			}
+
+			wc, res, err := d.Dial("ws://"+addr+"/mystream", h)
+			if res != nil {
+				res.Body.Close()
+			}
+
+			if ca.allowed {
+				require.NoError(t, err)
+				wc.Close()
+			} else {
+				require.Error(t, err)
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestListenerTCP(t *testing.T) {
+	l, _, closeFunc := newTestListener(t, "")
+	defer closeFunc()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	nconn, err := l.Accept()
+	require.NoError(t, err)
+	defer nconn.Close()
+
+	_, err = c.Write([]byte("testing"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(nconn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "testing", string(buf))
+}
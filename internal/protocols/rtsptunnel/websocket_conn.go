@@ -0,0 +1,101 @@
+package rtsptunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketConn is a connection tunnelled through WebSocket.
+// Data is carried by binary messages, that do not necessarily match RTSP messages.
+type websocketConn struct {
+	wc *websocket.Conn
+
+	reader     io.Reader
+	writeMutex sync.Mutex
+}
+
+func newWebSocketConn(wc *websocket.Conn) *websocketConn {
+	return &websocketConn{
+		wc: wc,
+	}
+}
+
+// Read implements net.Conn.
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			typ, r, err := c.wc.NextReader()
+			if err != nil {
+				return 0, err
+			}
+
+			if typ != websocket.BinaryMessage && typ != websocket.TextMessage {
+				continue
+			}
+
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+
+		return n, err
+	}
+}
+
+// Write implements net.Conn.
+func (c *websocketConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	err := c.wc.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close implements net.Conn.
+func (c *websocketConn) Close() error {
+	return c.wc.Close()
+}
+
+// LocalAddr implements net.Conn.
+func (c *websocketConn) LocalAddr() net.Addr {
+	return c.wc.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *websocketConn) RemoteAddr() net.Addr {
+	return c.wc.RemoteAddr()
+}
+
+// SetDeadline implements net.Conn.
+func (c *websocketConn) SetDeadline(t time.Time) error {
+	err := c.wc.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return c.wc.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *websocketConn) SetReadDeadline(t time.Time) error {
+	return c.wc.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *websocketConn) SetWriteDeadline(t time.Time) error {
+	return c.wc.SetWriteDeadline(t)
+}
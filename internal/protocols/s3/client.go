@@ -0,0 +1,310 @@
+// Package s3 contains a minimal client for S3-compatible object storages.
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes a string as required by AWS Signature Version 4.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~':
+			b.WriteByte(c)
+
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Object is an object stored in a bucket.
+type Object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Client is a client for S3-compatible object storages.
+// Requests are signed with AWS Signature Version 4 and use path-style URLs.
+type Client struct {
+	// URL of the storage, in format http(s)://host:port.
+	Endpoint string
+	// Region of the bucket.
+	Region string
+	// Name of the bucket.
+	Bucket string
+	// Access key ID.
+	AccessKeyID string
+	// Secret access key.
+	SecretAccessKey string
+	// HTTP client.
+	// It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient allocates a Client.
+// Requests that take longer than timeout are aborted.
+func NewClient(
+	endpoint string,
+	region string,
+	bucket string,
+	accessKeyID string,
+	secretAccessKey string,
+	timeout time.Duration,
+) *Client {
+	return &Client{
+		Endpoint:        endpoint,
+		Region:          region,
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		HTTPClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) newRequest(
+	ctx context.Context,
+	method string,
+	key string,
+	query url.Values,
+	body io.Reader,
+	payloadHash string,
+) (*http.Request, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sign(req, payloadHash, time.Now().UTC())
+
+	return req, nil
+}
+
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := req.Method + "\n" +
+		req.URL.EscapedPath() + "\n" +
+		req.URL.RawQuery + "\n" +
+		canonicalHeaders + "\n" +
+		signedHeaders + "\n" +
+		payloadHash
+
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+
+	h := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" +
+		amzDate + "\n" +
+		scope + "\n" +
+		hex.EncodeToString(h[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 "+
+		"Credential="+c.AccessKeyID+"/"+scope+", "+
+		"SignedHeaders="+signedHeaders+", "+
+		"Signature="+signature)
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// PutObject uploads an object.
+func (c *Client) PutObject(ctx context.Context, key string, contentType string, body io.ReadSeeker) error {
+	h := sha256.New()
+	size, err := io.Copy(h, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = body.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, key, nil, io.NopCloser(body), hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// DeleteObject deletes an object.
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, key, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// ListObjects lists the objects whose key starts with the given prefix.
+func (c *Client) ListObjects(ctx context.Context, prefix string) ([]*Object, error) {
+	var ret []*Object
+	continuationToken := ""
+
+	for {
+		q := url.Values{
+			"list-type": []string{"2"},
+			"prefix":    []string{prefix},
+		}
+		if continuationToken != "" {
+			q.Set("continuation-token", continuationToken)
+		}
+
+		req, err := c.newRequest(ctx, http.MethodGet, "", q, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var lbr listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&lbr)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range lbr.Contents {
+			ret = append(ret, &Object{
+				Key:          content.Key,
+				LastModified: content.LastModified,
+				Size:         content.Size,
+			})
+		}
+
+		if !lbr.IsTruncated || lbr.NextContinuationToken == "" {
+			return ret, nil
+		}
+
+		continuationToken = lbr.NextContinuationToken
+	}
+}
@@ -0,0 +1,265 @@
+package savp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+const (
+	defaultRTSPSPort = "322"
+)
+
+var errSetupRejected = errors.New("the server didn't accept the RTP/SAVP profile")
+
+func newClientListenerPair(writeTimeout time.Duration) (*udpListener, *udpListener, error) {
+	// choose a random even RTP port, as gortsplib does.
+	for {
+		v, err := rand.Int(rand.Reader, big.NewInt((65535-10000)/2))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rtpPort := int(v.Int64())*2 + 10000
+
+		rtpListener, err := newUDPListener(net.JoinHostPort("", strconv.FormatInt(int64(rtpPort), 10)),
+			false, writeTimeout)
+		if err != nil {
+			continue
+		}
+
+		rtcpListener, err := newUDPListener(net.JoinHostPort("", strconv.FormatInt(int64(rtpPort+1), 10)),
+			true, writeTimeout)
+		if err != nil {
+			rtpListener.close()
+			continue
+		}
+
+		return rtpListener, rtcpListener, nil
+	}
+}
+
+type clientSetup struct {
+	channels     [2]int
+	key          *Key
+	rtpListener  *udpListener
+	rtcpListener *udpListener
+}
+
+func (s *clientSetup) close() {
+	s.rtpListener.close()
+	s.rtcpListener.close()
+}
+
+// Client allows a gortsplib.Client to exchange UDP media with SRTP through a RTSPS connection.
+// When reading, keys are requested to the server in the DESCRIBE request and are provided
+// in the DESCRIBE response.
+// When publishing, keys are generated and sent to the server in the ANNOUNCE request.
+// Keys are exchanged in clear, therefore the control channel is protected by TLS.
+//
+// Medias whose keys are not provided by the server are exchanged through the control channel.
+type Client struct {
+	mutex   sync.Mutex
+	conn    *Conn
+	keys    map[string]*Key
+	pending *clientSetup
+}
+
+// Attach attaches Client to a gortsplib.Client.
+// It must be called before the gortsplib.Client is started, and the gortsplib.Client
+// must be started with Start.
+func (c *Client) Attach(gc *gortsplib.Client) {
+	dialContext := gc.DialContext
+	if dialContext == nil {
+		dialContext = (&net.Dialer{}).DialContext
+	}
+	onRequest := gc.OnRequest
+	onResponse := gc.OnResponse
+
+	// TLS is handled here since Conn must be placed after it.
+	gc.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		nconn, err := dialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		var tlsConfig *tls.Config
+		if gc.TLSConfig != nil {
+			tlsConfig = gc.TLSConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+
+		conn := NewConn(tls.Client(nconn, tlsConfig))
+
+		c.mutex.Lock()
+		c.conn = conn
+		c.mutex.Unlock()
+
+		return conn, nil
+	}
+
+	// UDP media is exchanged by Client; gortsplib exchanges it through interleaved frames.
+	transport := gortsplib.TransportTCP
+	gc.Transport = &transport
+
+	gc.OnRequest = func(req *base.Request) {
+		c.onRequest(req, gc.WriteTimeout)
+		if onRequest != nil {
+			onRequest(req)
+		}
+	}
+
+	gc.OnResponse = func(res *base.Response) {
+		if onResponse != nil {
+			onResponse(res)
+		}
+		c.onResponse(res)
+	}
+}
+
+// Start starts a gortsplib.Client that has been attached to Client.
+// host is the host of a rtsps URL.
+func (c *Client) Start(gc *gortsplib.Client, host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, defaultRTSPSPort)
+	}
+
+	// the rtsp scheme is used since TLS is handled by Client.
+	return gc.Start("rtsp", host)
+}
+
+func (c *Client) onRequest(req *base.Request, writeTimeout time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch req.Method {
+	case base.Describe:
+		RequestKeys(req)
+
+	case base.Announce:
+		byts, keys, err := AddKeysToSDP(req.Body)
+		if err != nil {
+			return
+		}
+
+		req.Body = byts
+		c.keys = keys
+
+	case base.Setup:
+		if c.pending != nil {
+			c.pending.close()
+			c.pending = nil
+		}
+
+		key := FindKey(c.keys, req.URL)
+		if key == nil {
+			return
+		}
+
+		var th headers.Transport
+		err := th.Unmarshal(req.Header["Transport"])
+		if err != nil || th.Protocol != headers.TransportProtocolTCP || th.InterleavedIDs == nil {
+			return
+		}
+
+		rtpListener, rtcpListener, err := newClientListenerPair(writeTimeout)
+		if err != nil {
+			return
+		}
+
+		c.pending = &clientSetup{
+			channels:     *th.InterleavedIDs,
+			key:          key,
+			rtpListener:  rtpListener,
+			rtcpListener: rtcpListener,
+		}
+
+		th.Protocol = headers.TransportProtocolUDP
+		th.InterleavedIDs = nil
+		th.ClientPorts = &[2]int{rtpListener.port(), rtcpListener.port()}
+		req.Header["Transport"] = EncodeTransport(th.Marshal())
+	}
+}
+
+func (c *Client) onResponse(res *base.Response) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// DESCRIBE response
+	if ct, ok := res.Header["Content-Type"]; ok && len(ct) == 1 && ct[0] == "application/sdp" &&
+		res.StatusCode == base.StatusOK {
+		keys, err := KeysFromSDP(res.Body)
+		if err == nil && len(keys) != 0 {
+			c.keys = keys
+		}
+	}
+
+	// SETUP response
+	if c.pending != nil {
+		setup := c.pending
+		c.pending = nil
+
+		err := c.setup(setup, res)
+		if err != nil {
+			setup.close()
+		}
+	}
+}
+
+func (c *Client) setup(setup *clientSetup, res *base.Response) error {
+	if res.StatusCode != base.StatusOK {
+		return errSetupRejected
+	}
+
+	v, ok := DecodeTransport(res.Header["Transport"])
+	if !ok {
+		return errSetupRejected
+	}
+
+	var th headers.Transport
+	err := th.Unmarshal(v)
+	if err != nil {
+		return err
+	}
+
+	if th.ServerPorts == nil {
+		return errSetupRejected
+	}
+
+	ip := c.conn.remoteIP()
+
+	err = c.conn.addChannel(setup.channels[0], setup.rtpListener,
+		&net.UDPAddr{IP: ip, Port: th.ServerPorts[0]}, setup.key)
+	if err != nil {
+		return err
+	}
+
+	err = c.conn.addChannel(setup.channels[1], setup.rtcpListener,
+		&net.UDPAddr{IP: ip, Port: th.ServerPorts[1]}, setup.key)
+	if err != nil {
+		return err
+	}
+
+	c.conn.addOwnedListener(setup.rtpListener)
+	c.conn.addOwnedListener(setup.rtcpListener)
+
+	th.Protocol = headers.TransportProtocolTCP
+	th.InterleavedIDs = &setup.channels
+	th.ClientPorts = nil
+	th.ServerPorts = nil
+	res.Header["Transport"] = th.Marshal()
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package savp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/conn"
+)
+
+var errConnClosed = errors.New("connection closed")
+
+type connChannel struct {
+	l    *udpListener
+	addr *net.UDPAddr
+}
+
+// Conn is a RTSP connection that exchanges interleaved frames of some channels
+// with SRTP or SRTCP packets sent and received through UDP.
+//
+// gortsplib doesn't support the RTP/SAVP profile, therefore media is set up with
+// the TCP transport protocol and the resulting interleaved frames are converted
+// into UDP packets, and vice versa.
+// This requires the connection to be the innermost one, i.e. after TLS.
+type Conn struct {
+	net.Conn
+
+	mutex          sync.Mutex
+	channels       map[int]*connChannel
+	ownedListeners []*udpListener
+	nextChannel    int
+	readDeadline   time.Time
+	readBuf        []byte
+	readErr        error
+
+	messages        chan []byte
+	frames          chan []byte
+	deadlineChanged chan struct{}
+	readerDone      chan struct{}
+	done            chan struct{}
+	closeOnce       sync.Once
+}
+
+// NewConn allocates a Conn.
+func NewConn(nconn net.Conn) *Conn {
+	c := &Conn{
+		Conn:            nconn,
+		channels:        make(map[int]*connChannel),
+		messages:        make(chan []byte),
+		frames:          make(chan []byte, 64),
+		deadlineChanged: make(chan struct{}, 1),
+		readerDone:      make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+
+	go c.runReader()
+
+	return c
+}
+
+// Close implements net.Conn.
+func (c *Conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.Conn.Close()
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		for _, ch := range c.channels {
+			ch.l.removePeer(ch.addr, c)
+		}
+		c.channels = nil
+
+		for _, l := range c.ownedListeners {
+			l.close()
+		}
+		c.ownedListeners = nil
+	})
+
+	return err
+}
+
+// runReader reads messages from the underlying connection,
+// in order to insert frames between them.
+func (c *Conn) runReader() {
+	defer close(c.readerDone)
+
+	rc := conn.NewConn(c.Conn)
+
+	for {
+		what, err := rc.Read()
+		if err != nil {
+			c.mutex.Lock()
+			c.readErr = err
+			c.mutex.Unlock()
+			return
+		}
+
+		var buf []byte
+
+		switch what := what.(type) {
+		case *base.Request:
+			buf, err = what.Marshal()
+		case *base.Response:
+			buf, err = what.Marshal()
+		case *base.InterleavedFrame:
+			buf, err = what.Marshal()
+		}
+		if err != nil {
+			c.mutex.Lock()
+			c.readErr = err
+			c.mutex.Unlock()
+			return
+		}
+
+		select {
+		case c.messages <- buf:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mutex.Lock()
+	if len(c.readBuf) != 0 {
+		n := copy(p, c.readBuf)
+		c.readBuf = c.readBuf[n:]
+		c.mutex.Unlock()
+		return n, nil
+	}
+	c.mutex.Unlock()
+
+	for {
+		buf, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+
+		if buf == nil {
+			continue
+		}
+
+		n := copy(p, buf)
+
+		c.mutex.Lock()
+		c.readBuf = buf[n:]
+		c.mutex.Unlock()
+
+		return n, nil
+	}
+}
+
+// readMessage returns the next message or frame.
+// It returns nil when the read deadline has been changed.
+func (c *Conn) readMessage() ([]byte, error) {
+	c.mutex.Lock()
+	deadline := c.readDeadline
+	c.mutex.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case buf := <-c.messages:
+		return buf, nil
+
+	case buf := <-c.frames:
+		return buf, nil
+
+	case <-c.readerDone:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return nil, c.readErr
+
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+
+	case <-c.deadlineChanged:
+		return nil, nil
+
+	case <-c.done:
+		return nil, errConnClosed
+	}
+}
+
+// Write implements net.Conn.
+// gortsplib writes every message with a single call.
+func (c *Conn) Write(p []byte) (int, error) {
+	if len(p) >= 4 && p[0] == base.InterleavedFrameMagicByte {
+		c.mutex.Lock()
+		ch, ok := c.channels[int(p[1])]
+		c.mutex.Unlock()
+
+		if ok {
+			err := ch.l.write(p[4:], ch.addr)
+			if err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+
+	return c.Conn.Write(p)
+}
+
+// SetDeadline implements net.Conn.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t) //nolint:errcheck
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+
+	select {
+	case c.deadlineChanged <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// nextChannels returns a pair of interleaved channels that are not in use.
+func (c *Conn) nextChannels() [2]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for {
+		ret := [2]int{c.nextChannel, c.nextChannel + 1}
+		c.nextChannel = (c.nextChannel + 2) % 256
+
+		if _, ok := c.channels[ret[0]]; !ok {
+			return ret
+		}
+	}
+}
+
+// addChannel routes the frames of a channel to a peer, and vice versa.
+func (c *Conn) addChannel(channel int, l *udpListener, addr *net.UDPAddr, key *Key) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.channels == nil {
+		return errConnClosed
+	}
+
+	if prev, ok := c.channels[channel]; ok {
+		prev.l.removePeer(prev.addr, c)
+		delete(c.channels, channel)
+	}
+
+	err := l.addPeer(addr, key, c, func(payload []byte) {
+		buf, err := base.InterleavedFrame{
+			Channel: channel,
+			Payload: payload,
+		}.Marshal()
+		if err != nil {
+			return
+		}
+
+		// packets are discarded when the reader can't keep up, as in UDP.
+		select {
+		case c.frames <- buf:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	c.channels[channel] = &connChannel{
+		l:    l,
+		addr: addr,
+	}
+
+	return nil
+}
+
+// addOwnedListener adds a listener that is closed together with the connection.
+func (c *Conn) addOwnedListener(l *udpListener) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ownedListeners = append(c.ownedListeners, l)
+}
+
+func (c *Conn) remoteIP() net.IP {
+	return c.RemoteAddr().(*net.TCPAddr).IP
+}
@@ -0,0 +1,94 @@
+// Package savp contains utilities to exchange media with the secure RTP profile (RTP/SAVP),
+// with keys exchanged through SDP security descriptions (SDES).
+package savp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CryptoSuite is the only supported crypto suite.
+	CryptoSuite = "AES_CM_128_HMAC_SHA1_80"
+
+	// FeatureTag is the feature tag used by clients to request the RTP/SAVP profile.
+	FeatureTag = "setup.rtp.savp"
+
+	masterKeyLen  = 16
+	masterSaltLen = 14
+)
+
+// Key is a SRTP master key and salt, exchanged through the "crypto" SDP attribute (RFC 4568).
+// As in other RTSP implementations of SDES, a single key is exchanged for each media and
+// it protects packets sent in both directions, including RTCP receiver reports.
+// This is safe since packets of different directions have different SSRCs,
+// that are part of the SRTP keystream.
+type Key struct {
+	Tag        int
+	MasterKey  []byte
+	MasterSalt []byte
+}
+
+// NewKey generates a random Key.
+func NewKey() (*Key, error) {
+	buf := make([]byte, masterKeyLen+masterSaltLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Tag:        1,
+		MasterKey:  buf[:masterKeyLen],
+		MasterSalt: buf[masterKeyLen:],
+	}, nil
+}
+
+// Unmarshal decodes the value of a "crypto" SDP attribute.
+func (k *Key) Unmarshal(v string) error {
+	parts := strings.Fields(v)
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid crypto attribute: %v", v)
+	}
+
+	tag, err := strconv.ParseUint(parts[0], 10, 31)
+	if err != nil {
+		return fmt.Errorf("invalid crypto tag: %v", parts[0])
+	}
+
+	if parts[1] != CryptoSuite {
+		return fmt.Errorf("unsupported crypto suite: %v", parts[1])
+	}
+
+	// key parameters are "inline:<key||salt>[|lifetime][|MKI:length]".
+	// only the first key is used.
+	params := strings.Split(parts[2], ";")[0]
+
+	if !strings.HasPrefix(params, "inline:") {
+		return fmt.Errorf("unsupported key method: %v", params)
+	}
+
+	keySalt, err := base64.StdEncoding.DecodeString(strings.Split(params[len("inline:"):], "|")[0])
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	if len(keySalt) != masterKeyLen+masterSaltLen {
+		return fmt.Errorf("invalid key length: %d", len(keySalt))
+	}
+
+	k.Tag = int(tag)
+	k.MasterKey = keySalt[:masterKeyLen]
+	k.MasterSalt = keySalt[masterKeyLen:]
+
+	return nil
+}
+
+// Marshal encodes the value of a "crypto" SDP attribute.
+func (k Key) Marshal() string {
+	return strconv.FormatInt(int64(k.Tag), 10) + " " + CryptoSuite + " inline:" +
+		base64.StdEncoding.EncodeToString(append(append([]byte(nil), k.MasterKey...), k.MasterSalt...))
+}
@@ -0,0 +1,50 @@
+package savp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyUnmarshal(t *testing.T) {
+	var k Key
+	err := k.Unmarshal("1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20|1:32")
+	require.NoError(t, err)
+	require.Equal(t, Key{
+		Tag:        1,
+		MasterKey:  []byte("YS___semctl () {"),
+		MasterSalt: []byte("\t220;}\n}\nunles"),
+	}, k)
+
+	require.Equal(t, "1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz", k.Marshal())
+}
+
+func TestKeyUnmarshalErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		v    string
+		err  string
+	}{
+		{
+			"missing parts",
+			"1 AES_CM_128_HMAC_SHA1_80",
+			"invalid crypto attribute: 1 AES_CM_128_HMAC_SHA1_80",
+		},
+		{
+			"unsupported suite",
+			"1 AES_CM_128_HMAC_SHA1_32 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz",
+			"unsupported crypto suite: AES_CM_128_HMAC_SHA1_32",
+		},
+		{
+			"invalid length",
+			"1 AES_CM_128_HMAC_SHA1_80 inline:AQID",
+			"invalid key length: 3",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var k Key
+			err := k.Unmarshal(ca.v)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package savp
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pion/srtp/v2"
+)
+
+// size of the window used to detect replayed packets.
+const replayProtectionWindow = 64
+
+type peer struct {
+	encryptMutex sync.Mutex
+	encrypt      *srtp.Context
+	decryptMutex sync.Mutex
+	decrypt      *srtp.Context
+}
+
+// newPeer allocates a peer.
+// key is the key of the media, that is used in both directions.
+func newPeer(key *Key) (*peer, error) {
+	encrypt, err := srtp.CreateContext(key.MasterKey, key.MasterSalt,
+		srtp.ProtectionProfileAes128CmHmacSha1_80)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypt, err := srtp.CreateContext(key.MasterKey, key.MasterSalt,
+		srtp.ProtectionProfileAes128CmHmacSha1_80,
+		srtp.SRTPReplayProtection(replayProtectionWindow),
+		srtp.SRTCPReplayProtection(replayProtectionWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	return &peer{
+		encrypt: encrypt,
+		decrypt: decrypt,
+	}, nil
+}
+
+// PacketConn is a net.PacketConn that encrypts and decrypts packets with SRTP or SRTCP.
+// Each peer can use a different key. Packets exchanged with peers without a key are left untouched.
+type PacketConn struct {
+	net.PacketConn
+	isRTCP bool
+
+	mutex       sync.RWMutex
+	peers       map[string]*peer
+	defaultPeer *peer
+}
+
+// NewPacketConn allocates a PacketConn.
+// isRTCP specifies whether the connection carries RTCP packets instead of RTP packets.
+func NewPacketConn(pc net.PacketConn, isRTCP bool) *PacketConn {
+	return &PacketConn{
+		PacketConn: pc,
+		isRTCP:     isRTCP,
+		peers:      make(map[string]*peer),
+	}
+}
+
+// AddPeer sets the key used to exchange packets with a peer.
+func (c *PacketConn) AddPeer(addr *net.UDPAddr, key *Key) error {
+	p, err := newPeer(key)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.peers[addr.String()] = p
+
+	return nil
+}
+
+// RemovePeer removes a peer.
+func (c *PacketConn) RemovePeer(addr *net.UDPAddr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.peers, addr.String())
+}
+
+// SetKey sets the key used to exchange packets with peers that were not added with AddPeer.
+func (c *PacketConn) SetKey(key *Key) error {
+	p, err := newPeer(key)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.defaultPeer = p
+
+	return nil
+}
+
+func (c *PacketConn) findPeer(addr net.Addr) *peer {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if p, ok := c.peers[addr.String()]; ok {
+		return p
+	}
+	return c.defaultPeer
+}
+
+// ReadFrom implements net.PacketConn.
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		pe := c.findPeer(addr)
+		if pe == nil {
+			return n, addr, nil
+		}
+
+		pe.decryptMutex.Lock()
+		var dec []byte
+		if c.isRTCP {
+			dec, err = pe.decrypt.DecryptRTCP(nil, p[:n], nil)
+		} else {
+			dec, err = pe.decrypt.DecryptRTP(nil, p[:n], nil)
+		}
+		pe.decryptMutex.Unlock()
+
+		// discard packets that can't be authenticated or that have been replayed
+		if err != nil {
+			continue
+		}
+
+		return copy(p, dec), addr, nil
+	}
+}
+
+// WriteTo implements net.PacketConn.
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	pe := c.findPeer(addr)
+	if pe == nil {
+		return c.PacketConn.WriteTo(p, addr)
+	}
+
+	pe.encryptMutex.Lock()
+	var enc []byte
+	var err error
+	if c.isRTCP {
+		enc, err = pe.encrypt.EncryptRTCP(nil, p, nil)
+	} else {
+		enc, err = pe.encrypt.EncryptRTP(nil, p, nil)
+	}
+	pe.encryptMutex.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.PacketConn.WriteTo(enc, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
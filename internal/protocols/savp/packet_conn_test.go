@@ -0,0 +1,155 @@
+package savp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/srtp/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketConn(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	pc1, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	c1 := NewPacketConn(pc1, false)
+	defer c1.Close()
+
+	pc2, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc2.Close()
+	c2 := NewPacketConn(pc2, false)
+
+	err = c1.AddPeer(pc2.LocalAddr().(*net.UDPAddr), key)
+	require.NoError(t, err)
+
+	err = c2.SetKey(key)
+	require.NoError(t, err)
+
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 946,
+			Timestamp:      1287987768,
+			SSRC:           0x38F27A2F,
+		},
+		Payload: []byte{1, 2, 3, 4},
+	}
+	byts, err := pkt.Marshal()
+	require.NoError(t, err)
+
+	_, err = c1.WriteTo(byts, pc2.LocalAddr())
+	require.NoError(t, err)
+
+	// packet is encrypted on the wire
+	buf := make([]byte, 1500)
+	n, _, err := pc2.ReadFrom(buf)
+	require.NoError(t, err)
+	require.NotEqual(t, byts, buf[:n])
+	wire := append([]byte(nil), buf[:n]...)
+
+	_, err = c1.WriteTo(byts, pc2.LocalAddr())
+	require.NoError(t, err)
+
+	n, _, err = c2.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, byts, buf[:n])
+
+	// replayed packets are discarded
+	enc := append([]byte(nil), wire...)
+	_, err = pc1.WriteTo(enc, pc2.LocalAddr())
+	require.NoError(t, err)
+
+	pkt.SequenceNumber++
+	byts2, err := pkt.Marshal()
+	require.NoError(t, err)
+
+	_, err = c1.WriteTo(byts2, pc2.LocalAddr())
+	require.NoError(t, err)
+
+	n, _, err = c2.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, byts2, buf[:n])
+
+	// packets in the opposite direction are sent with another SSRC
+	// and are protected with the same key
+	pkt.SSRC = 0x12345678
+	byts3, err := pkt.Marshal()
+	require.NoError(t, err)
+
+	_, err = c2.WriteTo(byts3, pc1.LocalAddr())
+	require.NoError(t, err)
+
+	n, _, err = c1.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, byts3, buf[:n])
+}
+
+// a peer that implements SDES as described by RFC 4568, with a single key for both directions.
+func TestPacketConnStandardPeer(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := NewPacketConn(pc, true)
+	defer c.Close()
+
+	peerConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peerConn.Close()
+
+	err = c.AddPeer(peerConn.LocalAddr().(*net.UDPAddr), key)
+	require.NoError(t, err)
+
+	peerCtx, err := srtp.CreateContext(key.MasterKey, key.MasterSalt, srtp.ProtectionProfileAes128CmHmacSha1_80)
+	require.NoError(t, err)
+
+	// receiver report sent by the peer
+	rr := &rtcp.ReceiverReport{
+		SSRC: 0x12345678,
+		Reports: []rtcp.ReceptionReport{{
+			SSRC:               0x38F27A2F,
+			LastSequenceNumber: 946,
+		}},
+	}
+	byts, err := rr.Marshal()
+	require.NoError(t, err)
+
+	enc, err := peerCtx.EncryptRTCP(nil, byts, nil)
+	require.NoError(t, err)
+
+	_, err = peerConn.WriteTo(enc, pc.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	n, _, err := c.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, byts, buf[:n])
+
+	// sender report received by the peer
+	sr := &rtcp.SenderReport{
+		SSRC:        0x38F27A2F,
+		NTPTime:     0xe4a1c5c1a0000000,
+		RTPTime:     1287987768,
+		PacketCount: 1,
+		OctetCount:  4,
+	}
+	byts, err = sr.Marshal()
+	require.NoError(t, err)
+
+	_, err = c.WriteTo(byts, peerConn.LocalAddr())
+	require.NoError(t, err)
+
+	n, _, err = peerConn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	dec, err := peerCtx.DecryptRTCP(nil, buf[:n], nil)
+	require.NoError(t, err)
+	require.Equal(t, byts, dec)
+}
@@ -0,0 +1,153 @@
+package savp
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+	psdp "github.com/pion/sdp/v3"
+)
+
+func mediaControl(md *psdp.MediaDescription) string {
+	for _, attr := range md.Attributes {
+		if attr.Key == "control" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// RequestKeys asks the server to provide keys in the response to a DESCRIBE request,
+// by adding the feature tag to the Supported header.
+func RequestKeys(req *base.Request) {
+	if req.Header == nil {
+		req.Header = make(base.Header)
+	}
+	req.Header["Supported"] = append(req.Header["Supported"], FeatureTag)
+}
+
+// KeysRequested returns whether a DESCRIBE request asks for medias with the RTP/SAVP profile and keys.
+// Keys can be requested with the feature tag in the Supported header or,
+// by clients that don't allow to set headers, with the "srtp" query parameter.
+func KeysRequested(req *base.Request) bool {
+	for _, v := range req.Header["Supported"] {
+		for _, tag := range strings.Split(v, ",") {
+			if strings.TrimSpace(tag) == FeatureTag {
+				return true
+			}
+		}
+	}
+
+	if req.URL != nil {
+		q, err := url.ParseQuery(req.URL.RawQuery)
+		if err == nil {
+			if _, ok := q["srtp"]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// KeysFromSDP returns the keys contained in a session description, indexed by media control.
+func KeysFromSDP(byts []byte) (map[string]*Key, error) {
+	var sd sdp.SessionDescription
+	err := sd.Unmarshal(byts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*Key)
+
+	for _, md := range sd.MediaDescriptions {
+		for _, attr := range md.Attributes {
+			if attr.Key == "crypto" {
+				var key Key
+				err := key.Unmarshal(attr.Value)
+				if err != nil {
+					continue
+				}
+
+				keys[mediaControl(md)] = &key
+				break
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// AddKeysToSDP adds a random key to each media of a session description
+// and switches medias to the RTP/SAVP profile.
+// It returns the new session description and its keys, indexed by media control.
+func AddKeysToSDP(byts []byte) ([]byte, map[string]*Key, error) {
+	var sd sdp.SessionDescription
+	err := sd.Unmarshal(byts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]*Key)
+
+	for _, md := range sd.MediaDescriptions {
+		key, err := NewKey()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		md.MediaName.Protos = []string{"RTP", "SAVP"}
+		md.Attributes = append(md.Attributes, psdp.Attribute{
+			Key:   "crypto",
+			Value: key.Marshal(),
+		})
+
+		keys[mediaControl(md)] = key
+	}
+
+	byts, err = sd.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return byts, keys, nil
+}
+
+// FindKey returns the key of the media that a SETUP request refers to.
+func FindKey(keys map[string]*Key, u *base.URL) *Key {
+	ur := u.String()
+
+	var found *Key
+	foundLen := -1
+
+	for control, key := range keys {
+		var match string
+
+		switch {
+		// an empty control refers to the whole session
+		case control == "" || control == "*":
+			match = ""
+
+		case strings.HasPrefix(control, "rtsp://") || strings.HasPrefix(control, "rtsps://"):
+			cu, err := base.ParseURL(control)
+			if err != nil {
+				continue
+			}
+			match = cu.Path
+			if cu.RawQuery != "" {
+				match += "?" + cu.RawQuery
+			}
+
+		default:
+			match = "/" + control
+		}
+
+		if strings.HasSuffix(ur, match) && len(match) > foundLen {
+			found = key
+			foundLen = len(match)
+		}
+	}
+
+	return found
+}
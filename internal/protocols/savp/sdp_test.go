@@ -0,0 +1,114 @@
+package savp
+
+import (
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddKeysToSDP(t *testing.T) {
+	byts := []byte("v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=Stream\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"t=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\n" +
+		"a=control:trackID=0\r\n" +
+		"a=rtpmap:96 H264/90000\r\n" +
+		"m=audio 0 RTP/AVP 97\r\n" +
+		"a=control:trackID=1\r\n" +
+		"a=rtpmap:97 opus/48000/2\r\n")
+
+	byts, keys, err := AddKeysToSDP(byts)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(keys))
+	require.Contains(t, string(byts), "m=video 0 RTP/SAVP 96\r\n")
+	require.Contains(t, string(byts), "a=crypto:"+keys["trackID=1"].Marshal()+"\r\n")
+
+	keys2, err := KeysFromSDP(byts)
+	require.NoError(t, err)
+	require.Equal(t, keys, keys2)
+}
+
+func TestFindKey(t *testing.T) {
+	k1 := &Key{Tag: 1}
+	k2 := &Key{Tag: 2}
+
+	keys := map[string]*Key{
+		"trackID=1": k1,
+		"rtsp://myhost:8554/mypath?key=val/stream2": k2,
+	}
+
+	for _, ca := range []struct {
+		url string
+		key *Key
+	}{
+		{"rtsp://localhost:8322/mypath/trackID=1", k1},
+		{"rtsps://localhost:8322/mypath?key=val/stream2", k2},
+		{"rtsps://localhost:8322/mypath/trackID=2", nil},
+	} {
+		t.Run(ca.url, func(t *testing.T) {
+			u, err := base.ParseURL(ca.url)
+			require.NoError(t, err)
+			require.Equal(t, ca.key, FindKey(keys, u))
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	v, ok := DecodeTransport(base.HeaderValue{"RTP/SAVP;unicast;client_port=35466-35467,RTP/AVP/TCP;interleaved=0-1"})
+	require.True(t, ok)
+	require.Equal(t, base.HeaderValue{"RTP/AVP;unicast;client_port=35466-35467,RTP/AVP/TCP;interleaved=0-1"}, v)
+
+	_, ok = DecodeTransport(base.HeaderValue{"RTP/AVP;unicast;client_port=35466-35467"})
+	require.False(t, ok)
+
+	v = EncodeTransport(base.HeaderValue{"RTP/AVP/UDP;unicast;client_port=35466-35467;server_port=8004-8005"})
+	require.Equal(t, base.HeaderValue{"RTP/SAVP;unicast;client_port=35466-35467;server_port=8004-8005"}, v)
+}
+
+func TestKeysRequested(t *testing.T) {
+	for _, ca := range []struct {
+		name      string
+		url       string
+		header    base.Header
+		requested bool
+	}{
+		{
+			"none",
+			"rtsps://localhost:8322/mypath",
+			base.Header{},
+			false,
+		},
+		{
+			"supported header",
+			"rtsps://localhost:8322/mypath",
+			base.Header{"Supported": base.HeaderValue{"play.basic, setup.rtp.savp"}},
+			true,
+		},
+		{
+			"query",
+			"rtsps://localhost:8322/mypath?key=val&srtp",
+			base.Header{},
+			true,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			u, err := base.ParseURL(ca.url)
+			require.NoError(t, err)
+
+			req := &base.Request{
+				Method: base.Describe,
+				URL:    u,
+				Header: ca.header,
+			}
+			require.Equal(t, ca.requested, KeysRequested(req))
+
+			if !ca.requested {
+				RequestKeys(req)
+				require.Equal(t, true, KeysRequested(req))
+			}
+		})
+	}
+}
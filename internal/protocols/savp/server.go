@@ -0,0 +1,123 @@
+package savp
+
+import (
+	"net"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+type listener struct {
+	net.Listener
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	nconn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConn(nconn), nil
+}
+
+// ServerSetup is a SETUP request with the RTP/SAVP profile.
+type ServerSetup struct {
+	Channels    [2]int
+	ClientPorts [2]int
+}
+
+// Server exchanges SRTP and SRTCP packets on behalf of the connections of a gortsplib.Server.
+type Server struct {
+	RTPAddress   string
+	RTCPAddress  string
+	WriteTimeout time.Duration
+
+	rtpListener  *udpListener
+	rtcpListener *udpListener
+}
+
+// Initialize initializes Server.
+func (s *Server) Initialize() error {
+	var err error
+	s.rtpListener, err = newUDPListener(s.RTPAddress, false, s.WriteTimeout)
+	if err != nil {
+		return err
+	}
+
+	s.rtcpListener, err = newUDPListener(s.RTCPAddress, true, s.WriteTimeout)
+	if err != nil {
+		s.rtpListener.close()
+		return err
+	}
+
+	return nil
+}
+
+// Close closes Server.
+func (s *Server) Close() {
+	s.rtpListener.close()
+	s.rtcpListener.close()
+}
+
+// WrapListener wraps a listener in order to make it return Conns.
+func (s *Server) WrapListener(ln net.Listener) net.Listener {
+	return &listener{Listener: ln}
+}
+
+// DecodeSetup converts a SETUP request with the RTP/SAVP profile into a SETUP request
+// with the TCP transport protocol, that is supported by gortsplib.
+// It returns nil if the request doesn't use the RTP/SAVP profile.
+func (s *Server) DecodeSetup(c *Conn, req *base.Request) *ServerSetup {
+	v, ok := DecodeTransport(req.Header["Transport"])
+	if !ok {
+		return nil
+	}
+
+	var th headers.Transport
+	err := th.Unmarshal(v)
+	if err != nil || th.Protocol != headers.TransportProtocolUDP || th.ClientPorts == nil {
+		return nil
+	}
+
+	setup := &ServerSetup{
+		Channels:    c.nextChannels(),
+		ClientPorts: *th.ClientPorts,
+	}
+
+	th.Protocol = headers.TransportProtocolTCP
+	th.ClientPorts = nil
+	th.InterleavedIDs = &setup.Channels
+	req.Header["Transport"] = th.Marshal()
+
+	return setup
+}
+
+// Setup routes the interleaved frames of a SETUP request to the UDP ports of the client, and vice versa.
+func (s *Server) Setup(c *Conn, setup *ServerSetup, key *Key) error {
+	ip := c.remoteIP()
+
+	err := c.addChannel(setup.Channels[0], s.rtpListener,
+		&net.UDPAddr{IP: ip, Port: setup.ClientPorts[0]}, key)
+	if err != nil {
+		return err
+	}
+
+	return c.addChannel(setup.Channels[1], s.rtcpListener,
+		&net.UDPAddr{IP: ip, Port: setup.ClientPorts[1]}, key)
+}
+
+// EncodeSetupResponse converts the response to a SETUP request decoded with DecodeSetup.
+func (s *Server) EncodeSetupResponse(setup *ServerSetup, res *base.Response) {
+	var th headers.Transport
+	err := th.Unmarshal(res.Header["Transport"])
+	if err != nil {
+		return
+	}
+
+	th.Protocol = headers.TransportProtocolUDP
+	th.InterleavedIDs = nil
+	th.ClientPorts = &setup.ClientPorts
+	th.ServerPorts = &[2]int{s.rtpListener.port(), s.rtcpListener.port()}
+	res.Header["Transport"] = EncodeTransport(th.Marshal())
+}
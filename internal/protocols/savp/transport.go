@@ -0,0 +1,46 @@
+package savp
+
+import (
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func replaceProfile(v base.HeaderValue, from []string, to string) (base.HeaderValue, bool) {
+	ret := make(base.HeaderValue, len(v))
+	replaced := false
+
+	for i, entry := range v {
+		var out []string
+
+		for _, tr := range strings.Split(entry, ",") {
+			profile, params, _ := strings.Cut(tr, ";")
+
+			for _, f := range from {
+				if profile == f {
+					tr = to + ";" + params
+					replaced = true
+					break
+				}
+			}
+
+			out = append(out, tr)
+		}
+
+		ret[i] = strings.Join(out, ",")
+	}
+
+	return ret, replaced
+}
+
+// DecodeTransport replaces the RTP/SAVP profile of a UDP Transport header with the RTP/AVP profile.
+// It returns whether the profile was found.
+func DecodeTransport(v base.HeaderValue) (base.HeaderValue, bool) {
+	return replaceProfile(v, []string{"RTP/SAVP", "RTP/SAVP/UDP"}, "RTP/AVP")
+}
+
+// EncodeTransport replaces the RTP/AVP profile of a UDP Transport header with the RTP/SAVP profile.
+func EncodeTransport(v base.HeaderValue) base.HeaderValue {
+	ret, _ := replaceProfile(v, []string{"RTP/AVP", "RTP/AVP/UDP"}, "RTP/SAVP")
+	return ret
+}
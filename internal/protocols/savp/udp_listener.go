@@ -0,0 +1,116 @@
+package savp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	udpKernelReadBufferSize = 0x80000
+
+	// maximum UDP payload size plus the SRTP authentication tag
+	udpReadBufferSize = 1472 + 10
+)
+
+type udpPeer struct {
+	owner *Conn
+	cb    func([]byte)
+}
+
+// udpListener exchanges SRTP or SRTCP packets with multiple peers.
+type udpListener struct {
+	pc           *PacketConn
+	writeTimeout time.Duration
+
+	mutex sync.RWMutex
+	peers map[string]*udpPeer
+
+	done chan struct{}
+}
+
+func newUDPListener(address string, isRTCP bool, writeTimeout time.Duration) (*udpListener, error) {
+	tmp, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmp.(*net.UDPConn).SetReadBuffer(udpKernelReadBufferSize)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	l := &udpListener{
+		pc:           NewPacketConn(tmp, isRTCP),
+		writeTimeout: writeTimeout,
+		peers:        make(map[string]*udpPeer),
+		done:         make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+func (l *udpListener) close() {
+	l.pc.Close()
+	<-l.done
+}
+
+func (l *udpListener) port() int {
+	return l.pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (l *udpListener) run() {
+	defer close(l.done)
+
+	for {
+		buf := make([]byte, udpReadBufferSize)
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		l.mutex.RLock()
+		pe, ok := l.peers[addr.String()]
+		l.mutex.RUnlock()
+
+		if ok {
+			pe.cb(buf[:n])
+		}
+	}
+}
+
+func (l *udpListener) addPeer(addr *net.UDPAddr, key *Key, owner *Conn, cb func([]byte)) error {
+	err := l.pc.AddPeer(addr, key)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.peers[addr.String()] = &udpPeer{
+		owner: owner,
+		cb:    cb,
+	}
+
+	return nil
+}
+
+// removePeer removes a peer, unless it has been replaced by the one of another connection.
+func (l *udpListener) removePeer(addr *net.UDPAddr, owner *Conn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if pe, ok := l.peers[addr.String()]; ok && pe.owner == owner {
+		delete(l.peers, addr.String())
+		l.pc.RemovePeer(addr)
+	}
+}
+
+func (l *udpListener) write(buf []byte, addr *net.UDPAddr) error {
+	l.pc.SetWriteDeadline(time.Now().Add(l.writeTimeout))
+	_, err := l.pc.WriteTo(buf, addr)
+	return err
+}
@@ -3,6 +3,7 @@ package webrtc
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
@@ -27,6 +28,18 @@ type IncomingTrack struct {
 	format    format.Format
 	reorderer *rtpreorderer.Reorderer
 	pkts      []*rtp.Packet
+
+	srMutex    sync.Mutex
+	srReceived bool
+	srNTP      time.Time
+	srRTPTime  uint32
+}
+
+// NTP timestamps start from 1900-01-01.
+func ntpTimeRTCPToGo(v uint64) time.Time {
+	secs := int64(v>>32) - 2208988800
+	nanos := int64((v & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nanos)
 }
 
 func newIncomingTrack(
@@ -92,13 +105,23 @@ func newIncomingTrack(
 	}
 
 	// read incoming RTCP packets to make interceptors work
+	// and to extract sender reports
 	go func() {
-		buf := make([]byte, 1500)
 		for {
-			_, _, err := receiver.Read(buf)
+			pkts, _, err := receiver.ReadRTCP()
 			if err != nil {
 				return
 			}
+
+			for _, pkt := range pkts {
+				if sr, ok := pkt.(*rtcp.SenderReport); ok && sr.SSRC == uint32(track.SSRC()) {
+					t.srMutex.Lock()
+					t.srReceived = true
+					t.srNTP = ntpTimeRTCPToGo(sr.NTPTime)
+					t.srRTPTime = sr.RTPTime
+					t.srMutex.Unlock()
+				}
+			}
 		}
 	}()
 
@@ -129,6 +152,22 @@ func (t *IncomingTrack) Format() format.Format {
 	return t.format
 }
 
+// PacketNTP returns the NTP timestamp of a RTP packet.
+// The NTP timestamp is computed from sender reports.
+func (t *IncomingTrack) PacketNTP(pkt *rtp.Packet) (time.Time, bool) {
+	t.srMutex.Lock()
+	defer t.srMutex.Unlock()
+
+	if !t.srReceived {
+		return time.Time{}, false
+	}
+
+	timeDiff := int32(pkt.Timestamp - t.srRTPTime)
+	timeDiffGo := (time.Duration(timeDiff) * time.Second) / time.Duration(t.format.ClockRate())
+
+	return t.srNTP.Add(timeDiffGo), true
+}
+
 // ReadRTP reads a RTP packet.
 func (t *IncomingTrack) ReadRTP() (*rtp.Packet, error) {
 	for {
@@ -1,10 +1,19 @@
 package record
 
 import (
+	"crypto/ed25519"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -15,15 +24,44 @@ type Agent struct {
 	Format            conf.RecordFormat
 	PartDuration      time.Duration
 	SegmentDuration   time.Duration
+	SegmentAlign      bool
+	Tracks            []string
+	KeyframesOnly     bool
 	PathName          string
 	Stream            *stream.Stream
 	OnSegmentCreate   OnSegmentFunc
 	OnSegmentComplete OnSegmentFunc
 	Parent            logger.Writer
 
-	restartPause time.Duration
+	// in event mode, recording starts when StartEvent() is called
+	// and includes the last PreEventDuration of the stream.
+	Mode              conf.RecordMode
+	PreEventDuration  time.Duration
+	PostEventDuration time.Duration
+
+	// if set, completed segments are uploaded to a S3-compatible
+	// object storage and deleted from disk.
+	S3Client       *s3.Client
+	S3Prefix       string
+	S3SpoolMaxSize uint64
+
+	// if set, the latest still image provided by Snapshotter
+	// is saved next to recordings with this period.
+	ThumbnailPeriod time.Duration
+	Snapshotter     *snapshot.Snapshotter
+
+	// if set, completed segments are hashed and added to a
+	// hash-chained manifest signed with this key.
+	ManifestKey ed25519.PrivateKey
+
+	restartPause     time.Duration
+	uploadRetryPause time.Duration
 
 	currentInstance *agentInstance
+	event           *agentEvent
+	uploader        *uploader
+	thumbnailer     *thumbnailer
+	manifest        *manifestWriter
 
 	terminate chan struct{}
 	done      chan struct{}
@@ -35,9 +73,56 @@ func (w *Agent) Initialize() {
 		w.restartPause = 2 * time.Second
 	}
 
+	if w.uploadRetryPause == 0 {
+		w.uploadRetryPause = 5 * time.Second
+	}
+
 	w.terminate = make(chan struct{})
 	w.done = make(chan struct{})
 
+	if w.S3Client != nil {
+		w.uploader = &uploader{
+			client:       w.S3Client,
+			prefix:       w.S3Prefix,
+			spoolMaxSize: w.S3SpoolMaxSize,
+			retryPause:   w.uploadRetryPause,
+			parent:       w,
+		}
+		w.uploader.initialize()
+		w.uploader.pushExisting(w.resolvedPath())
+	}
+
+	if w.ManifestKey != nil {
+		fpath := ManifestPath(w.RecordPath, w.PathName)
+
+		w.manifest = &manifestWriter{
+			fpath:      fpath,
+			pattern:    manifestPattern(fpath, w.resolvedPath()),
+			key:        w.ManifestKey,
+			onComplete: w.upload,
+			parent:     w,
+		}
+		w.manifest.initialize()
+	}
+
+	if w.ThumbnailPeriod != 0 && w.Snapshotter != nil {
+		w.thumbnailer = &thumbnailer{
+			period:      w.ThumbnailPeriod,
+			snapshotter: w.Snapshotter,
+			recordPath:  strings.ReplaceAll(w.RecordPath, "%path", w.PathName),
+			parent:      w,
+		}
+		w.thumbnailer.initialize()
+	}
+
+	if w.Mode == conf.RecordModeEvent {
+		w.event = &agentEvent{
+			wrapper: w,
+		}
+		w.event.initialize()
+		return
+	}
+
 	w.currentInstance = &agentInstance{
 		wrapper: w,
 	}
@@ -54,8 +139,138 @@ func (w *Agent) Log(level logger.Level, format string, args ...interface{}) {
 // Close closes the agent.
 func (w *Agent) Close() {
 	w.Log(logger.Info, "recording stopped")
-	close(w.terminate)
-	<-w.done
+
+	if w.event != nil {
+		w.event.close()
+	} else {
+		close(w.terminate)
+		<-w.done
+	}
+
+	if w.thumbnailer != nil {
+		w.thumbnailer.close()
+	}
+
+	if w.manifest != nil {
+		w.manifest.close()
+	}
+
+	if w.uploader != nil {
+		w.uploader.close()
+	}
+}
+
+// StartEvent starts an event, or extends the current one.
+// It can be called in event mode only.
+func (w *Agent) StartEvent() error {
+	return w.event.start()
+}
+
+// StopEvent stops the current event.
+// It can be called in event mode only.
+func (w *Agent) StopEvent() error {
+	return w.event.stop()
+}
+
+// segmentExtension returns the extension of segments with the given format.
+func segmentExtension(format conf.RecordFormat) string {
+	switch format {
+	case conf.RecordFormatMPEGTS:
+		return ".ts"
+
+	case conf.RecordFormatMKV:
+		return ".mkv"
+
+	case conf.RecordFormatWebM:
+		return ".webm"
+
+	default:
+		return ".mp4"
+	}
+}
+
+func (w *Agent) resolvedPath() string {
+	return strings.ReplaceAll(w.RecordPath, "%path", w.PathName) + segmentExtension(w.Format)
+}
+
+// recordsFormat returns whether a format is selected by Tracks.
+// Selectors are media indexes, media types or codec names.
+// When there are no selectors, all formats are recorded.
+func (w *Agent) recordsFormat(mediaIndex int, media *description.Media, forma format.Format) bool {
+	if len(w.Tracks) == 0 {
+		return true
+	}
+
+	for _, sel := range w.Tracks {
+		if i, err := strconv.Atoi(sel); err == nil {
+			if i == mediaIndex {
+				return true
+			}
+			continue
+		}
+
+		if strings.EqualFold(sel, string(media.Type)) || strings.EqualFold(sel, forma.Codec()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// alignedSegmentEnd returns the first wall-clock multiple of segmentDuration after t,
+// in the time zone of t.
+func alignedSegmentEnd(t time.Time, segmentDuration time.Duration) time.Time {
+	_, offset := t.Zone()
+	zoneOffset := time.Duration(offset) * time.Second
+	return t.Add(zoneOffset).Truncate(segmentDuration).Add(segmentDuration).Add(-zoneOffset)
+}
+
+// segmentEndDTS returns the DTS after which a segment that starts at startDTS
+// is closed, on the first random access sample.
+// When segments are aligned, the wall-clock time of the segment start is the
+// absolute time of its first sample, or the current time when it's not available.
+func (w *Agent) segmentEndDTS(startDTS time.Duration, startNTP time.Time) time.Duration {
+	if !w.SegmentAlign {
+		return startDTS + w.SegmentDuration
+	}
+
+	if startNTP.IsZero() {
+		startNTP = timeNow()
+	}
+
+	return startDTS + alignedSegmentEnd(startNTP, w.SegmentDuration).Sub(startNTP)
+}
+
+// segmentCreationTime returns the time used to name a segment:
+// the absolute time of its first sample, or the current time when it's not available.
+// Record paths are in local time.
+func segmentCreationTime(startNTP time.Time) time.Time {
+	if startNTP.IsZero() {
+		return timeNow()
+	}
+	return startNTP.Local()
+}
+
+func (w *Agent) segmentComplete(fpath string) {
+	w.OnSegmentComplete(fpath)
+
+	// segments are uploaded after they are added to the manifest,
+	// since they are deleted from disk once uploaded.
+	if w.manifest != nil {
+		w.manifest.push(fpath)
+	} else {
+		w.upload(fpath)
+	}
+}
+
+func (w *Agent) upload(fpath string) {
+	if w.uploader != nil {
+		w.uploader.push(fpath)
+
+		if _, err := os.Stat(SegmentIndexPath(fpath)); err == nil {
+			w.uploader.push(SegmentIndexPath(fpath))
+		}
+	}
 }
 
 func (w *Agent) run() {
@@ -0,0 +1,288 @@
+package record
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/av1"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/vp9"
+
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// period after which closing the event is retried when the write queue is full.
+const agentEventCloseRetryPeriod = 100 * time.Millisecond
+
+func newEmptyTimer() *time.Timer {
+	t := time.NewTimer(0)
+	<-t.C
+	return t
+}
+
+// unitIsRandomAccess returns whether a video unit can be decoded
+// without the units that precede it.
+func unitIsRandomAccess(u unit.Unit) bool {
+	switch tunit := u.(type) {
+	case *unit.H264:
+		return h264.IDRPresent(tunit.AU)
+
+	case *unit.H265:
+		return h265.IsRandomAccess(tunit.AU)
+
+	case *unit.AV1:
+		ok, _ := av1.ContainsKeyFrame(tunit.TU)
+		return ok
+
+	case *unit.VP9:
+		var h vp9.Header
+		err := h.Unmarshal(tunit.Frame)
+		return err == nil && h.FrameType == vp9.FrameTypeKeyFrame
+
+	case *unit.VP8:
+		return len(tunit.Frame) != 0 && (tunit.Frame[0]&0x01) == 0
+
+	case *unit.MPEG4Video:
+		return tunit.IsRandomAccess()
+
+	case *unit.MPEG1Video:
+		return bytes.Contains(tunit.Frame, []byte{0, 0, 1, 0xB8})
+
+	default:
+		// M-JPEG and formats without inter-frame dependencies
+		return true
+	}
+}
+
+type eventUnit struct {
+	forma        format.Format
+	u            unit.Unit
+	randomAccess bool
+}
+
+// agentEvent implements event-triggered recording.
+// The last units of the stream are kept in memory and are
+// written to a new segment when an event is triggered.
+type agentEvent struct {
+	wrapper *Agent
+
+	writer *asyncwriter.Writer
+
+	hasVideo bool
+
+	// accessed by the writer routine only
+	buffer   []eventUnit
+	instance *agentInstance
+
+	// in
+	chStart   chan struct{}
+	chStop    chan struct{}
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func (e *agentEvent) initialize() {
+	e.writer = asyncwriter.New(e.wrapper.WriteQueueSize, e.wrapper)
+	e.chStart = make(chan struct{})
+	e.chStop = make(chan struct{})
+	e.terminate = make(chan struct{})
+	e.done = make(chan struct{})
+
+	for i, media := range e.wrapper.Stream.Desc().Medias {
+		for _, forma := range media.Formats {
+			if !e.wrapper.recordsFormat(i, media, forma) {
+				continue
+			}
+
+			cforma := forma
+			isVideo := (media.Type == description.MediaTypeVideo)
+			e.hasVideo = e.hasVideo || isVideo
+
+			e.wrapper.Stream.AddReader(e.writer, media, forma, func(u unit.Unit) error {
+				e.onUnit(cforma, u, isVideo)
+				return nil
+			})
+		}
+	}
+
+	go e.run()
+}
+
+func (e *agentEvent) close() {
+	close(e.terminate)
+	<-e.done
+}
+
+func (e *agentEvent) start() error {
+	// push from the caller routine, in order to keep ordering with units
+	ok := e.writer.Push(func() error {
+		e.startInstance()
+		return nil
+	})
+	if !ok {
+		return fmt.Errorf("unable to start event: write queue is full")
+	}
+
+	select {
+	case e.chStart <- struct{}{}:
+	case <-e.done:
+	}
+
+	return nil
+}
+
+func (e *agentEvent) stop() error {
+	ok := e.writer.Push(func() error {
+		e.closeInstance()
+		return nil
+	})
+	if !ok {
+		return fmt.Errorf("unable to stop event: write queue is full")
+	}
+
+	select {
+	case e.chStop <- struct{}{}:
+	case <-e.done:
+	}
+
+	return nil
+}
+
+func (e *agentEvent) run() {
+	defer close(e.done)
+
+	e.writer.Start()
+
+	postEventTimer := newEmptyTimer()
+	defer postEventTimer.Stop()
+
+	for {
+		select {
+		case <-e.chStart:
+			postEventTimer.Stop()
+			postEventTimer = time.NewTimer(e.wrapper.PostEventDuration)
+
+		case <-e.chStop:
+			postEventTimer.Stop()
+
+		case <-postEventTimer.C:
+			ok := e.writer.Push(func() error {
+				e.closeInstance()
+				return nil
+			})
+			if !ok {
+				postEventTimer = time.NewTimer(agentEventCloseRetryPeriod)
+			}
+
+		case <-e.terminate:
+			e.wrapper.Stream.RemoveReader(e.writer)
+			e.writer.Stop()
+			e.closeInstance()
+			return
+		}
+	}
+}
+
+func (e *agentEvent) onUnit(forma format.Format, u unit.Unit, isVideo bool) {
+	if e.instance != nil {
+		e.write(eventUnit{forma: forma, u: u})
+		return
+	}
+
+	e.buffer = append(e.buffer, eventUnit{
+		forma:        forma,
+		u:            u,
+		randomAccess: isVideo && unitIsRandomAccess(u),
+	})
+
+	e.trimBuffer(u.GetPTS())
+}
+
+// trimBuffer removes units older than the pre-event duration.
+// When the stream contains video, the buffer starts from the last random access point
+// that precedes the pre-event duration, since the units that follow it can't be
+// decoded without it.
+func (e *agentEvent) trimBuffer(pts time.Duration) {
+	start := 0
+	for start < len(e.buffer) && (pts-e.buffer[start].u.GetPTS()) > e.wrapper.PreEventDuration {
+		start++
+	}
+
+	if e.hasVideo {
+		i := start
+		if i == len(e.buffer) {
+			i--
+		}
+
+		for i >= 0 && !e.buffer[i].randomAccess {
+			i--
+		}
+
+		if i >= 0 {
+			start = i
+		} else {
+			// no random access points have been received yet
+			for start < len(e.buffer) && !e.buffer[start].randomAccess {
+				start++
+			}
+		}
+	}
+
+	e.buffer = e.buffer[start:]
+}
+
+func (e *agentEvent) write(eu eventUnit) {
+	cb, ok := e.instance.readers[eu.forma]
+	if !ok {
+		return
+	}
+
+	err := cb(eu.u)
+	if err != nil {
+		e.wrapper.Log(logger.Error, err.Error())
+		e.closeInstance()
+	}
+}
+
+func (e *agentEvent) startInstance() {
+	if e.instance != nil {
+		return
+	}
+
+	e.wrapper.Log(logger.Info, "event recording started")
+
+	e.instance = &agentInstance{
+		wrapper: e.wrapper,
+		readers: make(map[format.Format]func(unit.Unit) error),
+	}
+	e.instance.initialize()
+
+	buffer := e.buffer
+	e.buffer = nil
+
+	for _, eu := range buffer {
+		e.write(eu)
+		if e.instance == nil {
+			return
+		}
+	}
+}
+
+func (e *agentEvent) closeInstance() {
+	if e.instance == nil {
+		return
+	}
+
+	e.wrapper.Log(logger.Info, "event recording stopped")
+
+	e.instance.format.close()
+	e.instance = nil
+}
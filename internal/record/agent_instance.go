@@ -1,14 +1,16 @@
 package record
 
 import (
-	"strings"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
 
 	"github.com/bluenviron/mediamtx/internal/asyncwriter"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/unit"
 )
 
 // OnSegmentFunc is the prototype of the function passed as runOnSegmentStart / runOnSegmentComplete
@@ -17,11 +19,16 @@ type OnSegmentFunc = func(string)
 type sample struct {
 	*fmp4.PartSample
 	dts time.Duration
+	ntp time.Time
 }
 
 type agentInstance struct {
 	wrapper *Agent
 
+	// if set, units are not read from the stream
+	// but are passed to these callbacks by agentEvent.
+	readers map[format.Format]func(unit.Unit) error
+
 	resolvedPath string
 	writer       *asyncwriter.Writer
 	format       recFormat
@@ -31,20 +38,14 @@ type agentInstance struct {
 }
 
 func (a *agentInstance) initialize() {
-	a.resolvedPath = strings.ReplaceAll(a.wrapper.RecordPath, "%path", a.wrapper.PathName)
-
-	switch a.wrapper.Format {
-	case conf.RecordFormatMPEGTS:
-		a.resolvedPath += ".ts"
-
-	default:
-		a.resolvedPath += ".mp4"
-	}
+	a.resolvedPath = a.wrapper.resolvedPath()
 
 	a.terminate = make(chan struct{})
 	a.done = make(chan struct{})
 
-	a.writer = asyncwriter.New(a.wrapper.WriteQueueSize, a.wrapper)
+	if a.readers == nil {
+		a.writer = asyncwriter.New(a.wrapper.WriteQueueSize, a.wrapper)
+	}
 
 	switch a.wrapper.Format {
 	case conf.RecordFormatMPEGTS:
@@ -53,6 +54,13 @@ func (a *agentInstance) initialize() {
 		}
 		a.format.initialize()
 
+	case conf.RecordFormatMKV, conf.RecordFormatWebM:
+		a.format = &recFormatMKV{
+			a:    a,
+			webm: a.wrapper.Format == conf.RecordFormatWebM,
+		}
+		a.format.initialize()
+
 	default:
 		a.format = &recFormatFMP4{
 			a: a,
@@ -60,7 +68,18 @@ func (a *agentInstance) initialize() {
 		a.format.initialize()
 	}
 
-	go a.run()
+	if a.readers == nil {
+		go a.run()
+	}
+}
+
+func (a *agentInstance) addReader(media *description.Media, forma format.Format, cb func(unit.Unit) error) {
+	if a.readers != nil {
+		a.readers[forma] = cb
+		return
+	}
+
+	a.wrapper.Stream.AddReader(a.writer, media, forma, cb)
 }
 
 func (a *agentInstance) close() {
@@ -1,18 +1,24 @@
 package record
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/asticode/go-astits"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
 	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
 	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/require"
 
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/unit"
@@ -109,7 +115,7 @@ func TestAgent(t *testing.T) {
 		}
 	}
 
-	for _, ca := range []string{"fmp4", "mpegts"} {
+	for _, ca := range []string{"fmp4", "mpegts", "mkv"} {
 		t.Run(ca, func(t *testing.T) {
 			n := 0
 			timeNow = func() time.Time {
@@ -148,10 +154,13 @@ func TestAgent(t *testing.T) {
 			segDone := make(chan struct{}, 4)
 
 			var f conf.RecordFormat
-			if ca == "fmp4" {
+			switch ca {
+			case "fmp4":
 				f = conf.RecordFormatFMP4
-			} else {
+			case "mpegts":
 				f = conf.RecordFormatMPEGTS
+			default:
+				f = conf.RecordFormatMKV
 			}
 
 			w := &Agent{
@@ -190,12 +199,7 @@ func TestAgent(t *testing.T) {
 				<-segDone
 			}
 
-			var ext string
-			if ca == "fmp4" {
-				ext = "mp4"
-			} else {
-				ext = "ts"
-			}
+			ext := segmentExtension(f)[1:]
 
 			_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext))
 			require.NoError(t, err)
@@ -224,3 +228,898 @@ func TestAgent(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentEvent(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	writeToStream := func(stream *stream.Stream, start int, count int) {
+		for i := start; i < (start + count); i++ {
+			stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+				Base: unit.Base{
+					PTS: time.Duration(i) * time.Second,
+				},
+				AU: [][]byte{
+					{ // SPS
+						0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+						0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+						0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+					},
+					{ // PPS
+						0x08, 0x06, 0x07, 0x08,
+					},
+					{5}, // IDR
+				},
+			})
+		}
+	}
+
+	n := 0
+	timeNow = func() time.Time {
+		n++
+		return time.Date(2008, 0o5, 20, 22, 15, n, 0, time.UTC)
+	}
+
+	stream, err := stream.New(
+		1460,
+		desc,
+		true,
+		&nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+	segCreated := make(chan string, 4)
+	segDone := make(chan string, 4)
+
+	w := &Agent{
+		WriteQueueSize:  1024,
+		RecordPath:      recordPath,
+		Format:          conf.RecordFormatFMP4,
+		PartDuration:    100 * time.Millisecond,
+		SegmentDuration: 1 * time.Hour,
+		PathName:        "mypath",
+		Stream:          stream,
+		OnSegmentCreate: func(fpath string) {
+			segCreated <- fpath
+		},
+		OnSegmentComplete: func(fpath string) {
+			segDone <- fpath
+		},
+		Parent:            &nilLogger{},
+		Mode:              conf.RecordModeEvent,
+		PreEventDuration:  2 * time.Second,
+		PostEventDuration: 200 * time.Millisecond,
+	}
+	w.Initialize()
+	defer w.Close()
+
+	writeToStream(stream, 0, 10)
+
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case <-segCreated:
+		t.Errorf("should not happen")
+	default:
+	}
+
+	w.StartEvent()
+
+	writeToStream(stream, 10, 2)
+
+	w.StopEvent()
+
+	<-segCreated
+	fpath := <-segDone
+
+	// the segment contains units from 7s to 10s
+	byts, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts[bytes.Index(byts, []byte("moof"))-4:])
+	require.NoError(t, err)
+
+	samples := 0
+	for _, part := range parts {
+		for _, track := range part.Tracks {
+			samples += len(track.Samples)
+		}
+	}
+	require.Equal(t, 4, samples)
+
+	// the post-event duration stops recording automatically
+	writeToStream(stream, 12, 3)
+
+	w.StartEvent()
+
+	<-segCreated
+	<-segDone
+}
+
+func TestAgentEventQueueFull(t *testing.T) {
+	e := &agentEvent{
+		writer: asyncwriter.New(2, nilLogger{}),
+		done:   make(chan struct{}),
+	}
+
+	// the writer routine is not running, therefore the queue is never emptied
+	for i := 0; i < 2; i++ {
+		e.writer.Push(func() error { return nil })
+	}
+
+	err := e.start()
+	require.EqualError(t, err, "unable to start event: write queue is full")
+
+	err = e.stop()
+	require.EqualError(t, err, "unable to stop event: write queue is full")
+}
+
+func TestAgentEventGOP(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	writeToStream := func(stream *stream.Stream, start int, count int) {
+		for i := start; i < (start + count); i++ {
+			au := [][]byte{{1}} // non-IDR
+
+			// a GOP lasts 5 seconds, more than the pre-event duration
+			if (i % 5) == 0 {
+				au = [][]byte{
+					{ // SPS
+						0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+						0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+						0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+					},
+					{ // PPS
+						0x08, 0x06, 0x07, 0x08,
+					},
+					{5}, // IDR
+				}
+			}
+
+			stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+				Base: unit.Base{
+					PTS: time.Duration(i) * time.Second,
+				},
+				AU: au,
+			})
+		}
+	}
+
+	n := 0
+	timeNow = func() time.Time {
+		n++
+		return time.Date(2008, 0o5, 20, 22, 15, n, 0, time.UTC)
+	}
+
+	stream, err := stream.New(
+		1460,
+		desc,
+		true,
+		&nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	segDone := make(chan string, 4)
+
+	w := &Agent{
+		WriteQueueSize:  1024,
+		RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		Format:          conf.RecordFormatFMP4,
+		PartDuration:    100 * time.Millisecond,
+		SegmentDuration: 1 * time.Hour,
+		PathName:        "mypath",
+		Stream:          stream,
+		OnSegmentCreate: func(_ string) {
+		},
+		OnSegmentComplete: func(fpath string) {
+			segDone <- fpath
+		},
+		Parent:            &nilLogger{},
+		Mode:              conf.RecordModeEvent,
+		PreEventDuration:  2 * time.Second,
+		PostEventDuration: 1 * time.Hour,
+	}
+	w.Initialize()
+	defer w.Close()
+
+	writeToStream(stream, 0, 10)
+
+	time.Sleep(100 * time.Millisecond)
+
+	w.StartEvent()
+
+	writeToStream(stream, 10, 2)
+
+	w.StopEvent()
+
+	fpath := <-segDone
+
+	// the segment starts from the IDR at 5s, that precedes the pre-event duration
+	byts, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts[bytes.Index(byts, []byte("moof"))-4:])
+	require.NoError(t, err)
+
+	samples := 0
+	for _, part := range parts {
+		for _, track := range part.Tracks {
+			samples += len(track.Samples)
+		}
+	}
+	require.Equal(t, 6, samples)
+}
+
+func TestAgentMetadata(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+		{
+			Type: description.MediaTypeApplication,
+			Formats: []format.Format{&format.Generic{
+				PayloadTyp: 97,
+				RTPMa:      "smpte336m/90000",
+				ClockRat:   90000,
+			}},
+		},
+	}}
+
+	klv := bytes.Repeat([]byte{0x06, 0x0e, 0x2b, 0x34}, 100)
+
+	writeToStream := func(stream *stream.Stream) {
+		for i := 0; i < 3; i++ {
+			for j, nalu := range [][]byte{
+				{ // SPS
+					0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+					0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+					0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+				},
+				{ // PPS
+					0x08, 0x06, 0x07, 0x08,
+				},
+				{5}, // IDR
+			} {
+				stream.WriteRTPPacket(desc.Medias[0], desc.Medias[0].Formats[0], &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						Marker:         (j == 2),
+						PayloadType:    96,
+						SequenceNumber: uint16(i*3 + j),
+						Timestamp:      uint32(i * 90000),
+					},
+					Payload: nalu,
+				}, time.Time{}, time.Duration(i)*time.Second)
+			}
+
+			// a KLV unit split into two RTP packets
+			for j := 0; j < 2; j++ {
+				stream.WriteRTPPacket(desc.Medias[1], desc.Medias[1].Formats[0], &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						Marker:         (j == 1),
+						PayloadType:    97,
+						SequenceNumber: uint16(i*2 + j),
+						Timestamp:      uint32(i * 90000),
+					},
+					Payload: klv[j*200 : (j+1)*200],
+				}, time.Time{}, time.Duration(i)*time.Second)
+			}
+		}
+	}
+
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			timeNow = func() time.Time {
+				return time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.UTC)
+			}
+
+			stream, err := stream.New(
+				1460,
+				desc,
+				false,
+				&nilLogger{},
+			)
+			require.NoError(t, err)
+			defer stream.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			segDone := make(chan string, 1)
+
+			var f conf.RecordFormat
+			if ca == "fmp4" {
+				f = conf.RecordFormatFMP4
+			} else {
+				f = conf.RecordFormatMPEGTS
+			}
+
+			w := &Agent{
+				WriteQueueSize:    1024,
+				RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:            f,
+				PartDuration:      100 * time.Millisecond,
+				SegmentDuration:   1 * time.Hour,
+				PathName:          "mypath",
+				Stream:            stream,
+				OnSegmentCreate:   func(_ string) {},
+				OnSegmentComplete: func(fpath string) { segDone <- fpath },
+				Parent:            &nilLogger{},
+			}
+			w.Initialize()
+
+			writeToStream(stream)
+
+			time.Sleep(50 * time.Millisecond)
+
+			w.Close()
+
+			byts, err := os.ReadFile(<-segDone)
+			require.NoError(t, err)
+
+			if ca == "fmp4" {
+				moovPos, moovSize, err := findMP4Box(byts, "moov")
+				require.NoError(t, err)
+
+				tracks, err := readSegmentIndexTracks(byts[moovPos : moovPos+moovSize])
+				require.NoError(t, err)
+				require.Equal(t, 2, len(tracks))
+				require.Equal(t, uint32(90000), tracks[2].timeScale)
+				require.Equal(t, true, bytes.Contains(byts[moovPos:moovPos+moovSize],
+					append([]byte("mett"), mettPayload("application/smpte336m")...)))
+
+				var parts fmp4.Parts
+				err = parts.Unmarshal(byts[moovPos+moovSize:])
+				require.NoError(t, err)
+
+				var samples [][]byte
+				for _, part := range parts {
+					for _, track := range part.Tracks {
+						if track.ID == 2 {
+							for _, sample := range track.Samples {
+								samples = append(samples, sample.Payload)
+							}
+						}
+					}
+				}
+				require.Equal(t, [][]byte{klv, klv}, samples)
+			} else {
+				dem := astits.NewDemuxer(context.Background(), bytes.NewReader(byts))
+
+				var pmt *astits.PMTData
+				var samples [][]byte
+
+				for {
+					data, err := dem.NextData()
+					if err == astits.ErrNoMorePackets {
+						break
+					}
+					require.NoError(t, err)
+
+					if data.PMT != nil {
+						pmt = data.PMT
+					} else if data.PES != nil && data.PID == 257 {
+						require.Equal(t, uint8(0xBD), data.PES.Header.StreamID)
+						samples = append(samples, data.PES.Data)
+					}
+				}
+
+				require.NotNil(t, pmt)
+				require.Equal(t, 2, len(pmt.ElementaryStreams))
+				require.Equal(t, astits.StreamTypePrivateData, pmt.ElementaryStreams[1].StreamType)
+				require.Equal(t, uint16(257), pmt.ElementaryStreams[1].ElementaryPID)
+				require.Equal(t, 1, len(pmt.ElementaryStreams[1].ElementaryStreamDescriptors))
+				require.Equal(t, [][]byte{klv, klv, klv}, samples)
+			}
+		})
+	}
+}
+
+type mkvTestElement struct {
+	id       uint32
+	payload  []byte
+	children []*mkvTestElement
+}
+
+func mkvTestReadVint(buf []byte, keepMarker bool) (uint64, int) {
+	l := 1
+	for l <= 8 && (buf[0]&(0x80>>(l-1))) == 0 {
+		l++
+	}
+
+	v := uint64(buf[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> l)
+	}
+	for i := 1; i < l; i++ {
+		v = v<<8 | uint64(buf[i])
+	}
+	return v, l
+}
+
+func mkvTestParse(t *testing.T, buf []byte) []*mkvTestElement {
+	var ret []*mkvTestElement
+
+	for len(buf) > 0 {
+		id, n := mkvTestReadVint(buf, true)
+		buf = buf[n:]
+		size, n := mkvTestReadVint(buf, false)
+		buf = buf[n:]
+		require.LessOrEqual(t, size, uint64(len(buf)))
+
+		e := &mkvTestElement{id: uint32(id), payload: buf[:size]}
+		buf = buf[size:]
+
+		switch e.id {
+		case mkvIDEBML, mkvIDSegment, mkvIDSeekHead, mkvIDSeek, mkvIDInfo, mkvIDTracks,
+			mkvIDTrackEntry, mkvIDCluster, mkvIDCues, mkvIDCuePoint:
+			e.children = mkvTestParse(t, e.payload)
+		}
+
+		ret = append(ret, e)
+	}
+
+	return ret
+}
+
+func mkvTestFind(elems []*mkvTestElement, id uint32) []*mkvTestElement {
+	var ret []*mkvTestElement
+	for _, e := range elems {
+		if e.id == id {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func TestAgentWebM(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.VP8{
+				PayloadTyp: 96,
+			}},
+		},
+		{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.Opus{
+				PayloadTyp: 97,
+				IsStereo:   true,
+			}},
+		},
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        98,
+				PacketizationMode: 1,
+			}},
+		},
+	}}
+
+	timeNow = func() time.Time {
+		return time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.UTC)
+	}
+
+	stream, err := stream.New(
+		1460,
+		desc,
+		true,
+		&nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	segDone := make(chan string, 1)
+
+	w := &Agent{
+		WriteQueueSize:    1024,
+		RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		Format:            conf.RecordFormatWebM,
+		PartDuration:      100 * time.Millisecond,
+		SegmentDuration:   1 * time.Hour,
+		PathName:          "mypath",
+		Stream:            stream,
+		OnSegmentCreate:   func(_ string) {},
+		OnSegmentComplete: func(fpath string) { segDone <- fpath },
+		Parent:            &nilLogger{},
+	}
+	w.Initialize()
+
+	for i := 0; i < 3; i++ {
+		stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.VP8{
+			Base: unit.Base{
+				PTS: time.Duration(i) * time.Second,
+			},
+			Frame: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01, 1, 2, 3, 4},
+		})
+
+		stream.WriteUnit(desc.Medias[1], desc.Medias[1].Formats[0], &unit.Opus{
+			Base: unit.Base{
+				PTS: time.Duration(i) * time.Second,
+			},
+			Packets: [][]byte{{0xf8, 1, 2, 3}},
+		})
+
+		stream.WriteUnit(desc.Medias[2], desc.Medias[2].Formats[0], &unit.H264{
+			Base: unit.Base{
+				PTS: time.Duration(i) * time.Second,
+			},
+			AU: [][]byte{{5}},
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	w.Close()
+
+	fpath := <-segDone
+	require.Equal(t, ".webm", filepath.Ext(fpath))
+
+	byts, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+
+	elems := mkvTestParse(t, byts)
+	require.Equal(t, 2, len(elems))
+	require.Equal(t, []byte("webm"), mkvTestFind(elems[0].children, mkvIDDocType)[0].payload)
+
+	segment := elems[1]
+	require.Equal(t, uint32(mkvIDSegment), segment.id)
+
+	tracks := mkvTestFind(segment.children, mkvIDTracks)[0]
+	var codecIDs []string
+	for _, entry := range tracks.children {
+		codecIDs = append(codecIDs, string(mkvTestFind(entry.children, mkvIDCodecID)[0].payload))
+	}
+	require.Equal(t, []string{"A_OPUS", "V_VP8"}, codecIDs)
+
+	clusters := mkvTestFind(segment.children, mkvIDCluster)
+	require.Equal(t, 3, len(clusters))
+
+	blocks := 0
+	for _, cluster := range clusters {
+		blocks += len(mkvTestFind(cluster.children, mkvIDSimpleBlock))
+	}
+	require.Equal(t, 6, blocks)
+
+	cues := mkvTestFind(segment.children, mkvIDCues)
+	require.Equal(t, 1, len(cues))
+	require.Equal(t, 3, len(mkvTestFind(cues[0].children, mkvIDCuePoint)))
+
+	seeks := mkvTestFind(mkvTestFind(segment.children, mkvIDSeekHead)[0].children, mkvIDSeek)
+	require.Equal(t, 3, len(seeks))
+}
+
+func TestAlignedSegmentEnd(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		t        time.Time
+		duration time.Duration
+		end      time.Time
+	}{
+		{
+			"hour",
+			time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC),
+			time.Hour,
+			time.Date(2008, 5, 20, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			"15 minutes",
+			time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC),
+			15 * time.Minute,
+			time.Date(2008, 5, 20, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			"on boundary",
+			time.Date(2008, 5, 20, 22, 0, 0, 0, time.UTC),
+			time.Hour,
+			time.Date(2008, 5, 20, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			"time zone",
+			time.Date(2008, 5, 20, 22, 15, 25, 0, time.FixedZone("", 5*3600+30*60)),
+			time.Hour,
+			time.Date(2008, 5, 20, 23, 0, 0, 0, time.FixedZone("", 5*3600+30*60)),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.True(t, ca.end.Equal(alignedSegmentEnd(ca.t, ca.duration)))
+		})
+	}
+}
+
+func TestAgentSegmentAlign(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	for _, ca := range []string{"fmp4", "mpegts", "mkv"} {
+		t.Run(ca, func(t *testing.T) {
+			n := 0
+			timeNow = func() time.Time {
+				n++
+				return time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.UTC).Add(time.Duration(n) * time.Hour)
+			}
+
+			stream, err := stream.New(
+				1460,
+				desc,
+				true,
+				&nilLogger{},
+			)
+			require.NoError(t, err)
+			defer stream.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			var f conf.RecordFormat
+			switch ca {
+			case "fmp4":
+				f = conf.RecordFormatFMP4
+			case "mpegts":
+				f = conf.RecordFormatMPEGTS
+			default:
+				f = conf.RecordFormatMKV
+			}
+
+			segDone := make(chan struct{}, 10)
+
+			w := &Agent{
+				WriteQueueSize:    1024,
+				RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:            f,
+				PartDuration:      100 * time.Millisecond,
+				SegmentDuration:   1 * time.Second,
+				SegmentAlign:      true,
+				PathName:          "mypath",
+				Stream:            stream,
+				OnSegmentCreate:   func(_ string) {},
+				OnSegmentComplete: func(_ string) { segDone <- struct{}{} },
+				Parent:            &nilLogger{},
+			}
+			w.Initialize()
+
+			for i := 0; i <= 7; i++ {
+				stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+					Base: unit.Base{
+						PTS: time.Duration(i) * 250 * time.Millisecond,
+						// the recording starts half a second before a boundary
+						NTP: time.Date(2008, 0o5, 20, 22, 15, 25, 500000000, time.UTC).
+							Add(time.Duration(i) * 250 * time.Millisecond),
+					},
+					AU: [][]byte{
+						{ // SPS
+							0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+							0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+							0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+						},
+						{ // PPS
+							0x08, 0x06, 0x07, 0x08,
+						},
+						{5}, // IDR
+					},
+				})
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			w.Close()
+
+			// segments are cut at 0.5s and 1.5s,
+			// while they would be cut at 1s without alignment.
+			require.Equal(t, 3, len(segDone))
+		})
+	}
+}
+
+func TestAgentRecordsFormat(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+		{
+			Type:    description.MediaTypeAudio,
+			Formats: []format.Format{&format.Opus{PayloadTyp: 97}},
+		},
+	}}
+
+	for _, ca := range []struct {
+		name   string
+		tracks []string
+		out    []bool
+	}{
+		{"all", nil, []bool{true, true}},
+		{"type", []string{"audio"}, []bool{false, true}},
+		{"codec", []string{"h264"}, []bool{true, false}},
+		{"index", []string{"1"}, []bool{false, true}},
+		{"multiple", []string{"0", "opus"}, []bool{true, true}},
+		{"none", []string{"application"}, []bool{false, false}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			w := &Agent{Tracks: ca.tracks}
+			for i, media := range desc.Medias {
+				require.Equal(t, ca.out[i], w.recordsFormat(i, media, media.Formats[0]))
+			}
+		})
+	}
+}
+
+func TestAgentTrackSelection(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+		{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.MPEG4Audio{
+				PayloadTyp: 97,
+				Config: &mpeg4audio.Config{
+					Type:         2,
+					SampleRate:   44100,
+					ChannelCount: 2,
+				},
+				SizeLength:       13,
+				IndexLength:      3,
+				IndexDeltaLength: 3,
+			}},
+		},
+	}}
+
+	for _, ca := range []string{"audio only", "keyframes only"} {
+		t.Run(ca, func(t *testing.T) {
+			timeNow = func() time.Time {
+				return time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.UTC)
+			}
+
+			stream, err := stream.New(
+				1460,
+				desc,
+				true,
+				&nilLogger{},
+			)
+			require.NoError(t, err)
+			defer stream.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			segDone := make(chan string, 1)
+
+			w := &Agent{
+				WriteQueueSize:    1024,
+				RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:            conf.RecordFormatFMP4,
+				PartDuration:      100 * time.Millisecond,
+				SegmentDuration:   1 * time.Hour,
+				PathName:          "mypath",
+				Stream:            stream,
+				OnSegmentCreate:   func(_ string) {},
+				OnSegmentComplete: func(fpath string) { segDone <- fpath },
+				Parent:            &nilLogger{},
+			}
+
+			if ca == "audio only" {
+				w.Tracks = []string{"audio"}
+			} else {
+				w.KeyframesOnly = true
+			}
+
+			w.Initialize()
+
+			for i := 0; i < 8; i++ {
+				au := [][]byte{{1}} // non-IDR
+				if (i % 4) == 0 {
+					au = [][]byte{
+						{ // SPS
+							0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+							0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+							0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+						},
+						{ // PPS
+							0x08, 0x06, 0x07, 0x08,
+						},
+						{5}, // IDR
+					}
+				}
+
+				stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+					Base: unit.Base{
+						PTS: time.Duration(i) * 100 * time.Millisecond,
+					},
+					AU: au,
+				})
+
+				stream.WriteUnit(desc.Medias[1], desc.Medias[1].Formats[0], &unit.MPEG4Audio{
+					Base: unit.Base{
+						PTS: time.Duration(i) * 100 * time.Millisecond,
+					},
+					AUs: [][]byte{{1, 2, 3, 4}},
+				})
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			w.Close()
+
+			byts, err := os.ReadFile(<-segDone)
+			require.NoError(t, err)
+
+			moovPos, moovSize, err := findMP4Box(byts, "moov")
+			require.NoError(t, err)
+
+			var init fmp4.Init
+			err = init.Unmarshal(byts[:moovPos+moovSize])
+			require.NoError(t, err)
+
+			var parts fmp4.Parts
+			err = parts.Unmarshal(byts[moovPos+moovSize:])
+			require.NoError(t, err)
+
+			counts := make(map[int]int)
+			for _, part := range parts {
+				for _, track := range part.Tracks {
+					counts[track.ID] += len(track.Samples)
+				}
+			}
+
+			if ca == "audio only" {
+				require.Equal(t, 1, len(init.Tracks))
+				require.Equal(t, false, init.Tracks[0].Codec.IsVideo())
+			} else {
+				require.Equal(t, 2, len(init.Tracks))
+				// the last sample of each track is never written,
+				// since its duration is unknown.
+				require.Equal(t, map[int]int{1: 1, 2: 7}, counts)
+			}
+		})
+	}
+}
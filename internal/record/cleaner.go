@@ -2,14 +2,18 @@ package record
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 )
 
 func commonPath(v string) string {
@@ -39,19 +43,59 @@ func commonPath(v string) string {
 	return common
 }
 
+const (
+	cleanerQuotaCheckPeriod = 10 * time.Second
+)
+
 // CleanerEntry is a cleaner entry.
 type CleanerEntry struct {
-	RecordPath        string
-	RecordFormat      conf.RecordFormat
-	RecordDeleteAfter time.Duration
+	RecordPath              string
+	RecordFormat            conf.RecordFormat
+	RecordDeleteAfter       time.Duration
+	RecordMaxSize           uint64
+	RecordS3Endpoint        string
+	RecordS3Region          string
+	RecordS3Bucket          string
+	RecordS3AccessKeyID     string
+	RecordS3SecretAccessKey string
+	RecordS3Prefix          string
+
+	// timeout of requests to the S3 storage.
+	WriteTimeout time.Duration
+}
+
+// CleanerPathStats are the statistics of the recordings of a path.
+type CleanerPathStats struct {
+	Bytes           uint64
+	Segments        uint64
+	EvictedBytes    uint64
+	EvictedSegments uint64
 }
 
-// Cleaner removes expired recording segments from disk.
+type cleanerSegment struct {
+	fpath    string
+	pathName string
+	time     time.Time
+	size     uint64
+	entry    *CleanerEntry
+	root     string
+	newest   bool
+}
+
+// Cleaner removes expired recording segments from disk
+// and from S3-compatible object storages.
+// Segments are removed when they are older than RecordDeleteAfter,
+// or, oldest first, when a quota is exceeded.
 type Cleaner struct {
-	ctx       context.Context
-	ctxCancel func()
-	entries   []CleanerEntry
-	parent    logger.Writer
+	ctx          context.Context
+	ctxCancel    func()
+	entries      []CleanerEntry
+	totalMaxSize uint64
+	minFreeSpace float64
+	parent       logger.Writer
+
+	mutex sync.Mutex
+	stats map[string]*CleanerPathStats
 
 	done chan struct{}
 }
@@ -59,16 +103,21 @@ type Cleaner struct {
 // NewCleaner allocates a Cleaner.
 func NewCleaner(
 	entries []CleanerEntry,
+	totalMaxSize uint64,
+	minFreeSpace float64,
 	parent logger.Writer,
 ) *Cleaner {
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
 	c := &Cleaner{
-		ctx:       ctx,
-		ctxCancel: ctxCancel,
-		entries:   entries,
-		parent:    parent,
-		done:      make(chan struct{}),
+		ctx:          ctx,
+		ctxCancel:    ctxCancel,
+		entries:      entries,
+		totalMaxSize: totalMaxSize,
+		minFreeSpace: minFreeSpace,
+		parent:       parent,
+		stats:        make(map[string]*CleanerPathStats),
+		done:         make(chan struct{}),
 	}
 
 	go c.run()
@@ -87,17 +136,47 @@ func (c *Cleaner) Log(level logger.Level, format string, args ...interface{}) {
 	c.parent.Log(level, "[record cleaner]"+format, args...)
 }
 
+// Stats returns the statistics of the recordings of each path.
+func (c *Cleaner) Stats() map[string]CleanerPathStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ret := make(map[string]CleanerPathStats, len(c.stats))
+	for k, v := range c.stats {
+		ret[k] = *v
+	}
+	return ret
+}
+
+func (c *Cleaner) quotasEnabled() bool {
+	if c.totalMaxSize != 0 || c.minFreeSpace != 0 {
+		return true
+	}
+
+	for _, e := range c.entries {
+		if e.RecordMaxSize != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Cleaner) run() {
 	defer close(c.done)
 
 	interval := 30 * 60 * time.Second
 	for _, e := range c.entries {
-		if interval > (e.RecordDeleteAfter / 2) {
+		if e.RecordDeleteAfter != 0 && interval > (e.RecordDeleteAfter/2) {
 			interval = e.RecordDeleteAfter / 2
 		}
 	}
 
-	c.doRun() //nolint:errcheck
+	if c.quotasEnabled() && interval > cleanerQuotaCheckPeriod {
+		interval = cleanerQuotaCheckPeriod
+	}
+
+	c.doRun()
 
 	for {
 		select {
@@ -111,40 +190,115 @@ func (c *Cleaner) run() {
 }
 
 func (c *Cleaner) doRun() {
-	for _, e := range c.entries {
-		c.doRunEntry(&e) //nolint:errcheck
+	var segments []*cleanerSegment
+
+	for i := range c.entries {
+		segments = append(segments, c.doRunEntry(&c.entries[i])...)
+	}
+
+	segments = c.applyQuotas(segments)
+
+	for i := range c.entries {
+		c.removeEmptyDirs(&c.entries[i])
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, st := range c.stats {
+		st.Bytes = 0
+		st.Segments = 0
+	}
+
+	for _, seg := range segments {
+		st := c.pathStats(seg.pathName)
+		st.Bytes += seg.size
+		st.Segments++
 	}
 }
 
-func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
+func (c *Cleaner) pathStats(pathName string) *CleanerPathStats {
+	st, ok := c.stats[pathName]
+	if !ok {
+		st = &CleanerPathStats{}
+		c.stats[pathName] = st
+	}
+	return st
+}
+
+func entryLocalPath(e *CleanerEntry) string {
 	recordPath := e.RecordPath
 
 	// we have to convert to absolute paths
 	// otherwise, commonPath and fpath inside Walk() won't have common elements
 	recordPath, _ = filepath.Abs(recordPath)
 
-	switch e.RecordFormat {
-	case conf.RecordFormatMPEGTS:
-		recordPath += ".ts"
+	return recordPath + segmentExtension(e.RecordFormat)
+}
 
-	default:
-		recordPath += ".mp4"
+// doRunEntry removes expired segments and returns remaining ones.
+func (c *Cleaner) doRunEntry(e *CleanerEntry) []*cleanerSegment {
+	if e.RecordS3Endpoint != "" && e.RecordDeleteAfter != 0 {
+		err := c.doRunEntryS3(e)
+		if err != nil {
+			c.Log(logger.Warn, "%v", err)
+		}
 	}
 
+	recordPath := entryLocalPath(e)
 	commonPath := commonPath(recordPath)
 	now := timeNow()
 
+	var segments []*cleanerSegment
+	newest := make(map[string]*cleanerSegment)
+
 	filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
 		if err != nil {
 			return err
 		}
 
 		if !info.IsDir() {
+			// remove expired thumbnails
+			if base, ok := thumbnailBase(fpath); ok {
+				params := decodeRecordPath(recordPath, base+segmentExtension(e.RecordFormat))
+				if params != nil && e.RecordDeleteAfter != 0 && now.Sub(params.time) > e.RecordDeleteAfter {
+					c.Log(logger.Debug, "removing %s", fpath)
+					os.Remove(fpath)
+				}
+				return nil
+			}
+
+			// remove indexes whose segment doesn't exist anymore
+			if segmentPath := strings.TrimSuffix(fpath, ".idx"); segmentPath != fpath {
+				if decodeRecordPath(recordPath, segmentPath) != nil {
+					if _, err := os.Stat(segmentPath); os.IsNotExist(err) {
+						os.Remove(fpath)
+					}
+				}
+				return nil
+			}
+
 			params := decodeRecordPath(recordPath, fpath)
 			if params != nil {
-				if now.Sub(params.time) > e.RecordDeleteAfter {
+				if e.RecordDeleteAfter != 0 && now.Sub(params.time) > e.RecordDeleteAfter {
 					c.Log(logger.Debug, "removing %s", fpath)
 					os.Remove(fpath)
+					os.Remove(SegmentIndexPath(fpath))
+					return nil
+				}
+
+				seg := &cleanerSegment{
+					fpath:    fpath,
+					pathName: params.path,
+					time:     params.time,
+					size:     uint64(info.Size()),
+					entry:    e,
+					root:     commonPath,
+				}
+				segments = append(segments, seg)
+
+				if cur, ok := newest[seg.pathName]; !ok || seg.time.After(cur.time) {
+					newest[seg.pathName] = seg
 				}
 			}
 		}
@@ -152,7 +306,17 @@ func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
 		return nil
 	})
 
-	filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+	// the newest segment of each path may be still being written,
+	// therefore it is never removed by quotas.
+	for _, seg := range newest {
+		seg.newest = true
+	}
+
+	return segments
+}
+
+func (c *Cleaner) removeEmptyDirs(e *CleanerEntry) {
+	filepath.Walk(commonPath(entryLocalPath(e)), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
 		if err != nil {
 			return err
 		}
@@ -163,6 +327,156 @@ func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
 
 		return nil
 	})
+}
+
+func (c *Cleaner) evict(seg *cleanerSegment, reason string) bool {
+	c.Log(logger.Info, "removing %s before expiration, %s", seg.fpath, reason)
+
+	err := os.Remove(seg.fpath)
+	if err != nil {
+		c.Log(logger.Warn, "%v", err)
+		return false
+	}
+
+	os.Remove(SegmentIndexPath(seg.fpath))
+
+	c.mutex.Lock()
+	st := c.pathStats(seg.pathName)
+	st.EvictedBytes += seg.size
+	st.EvictedSegments++
+	c.mutex.Unlock()
+
+	return true
+}
+
+// applyQuotas removes the oldest segments until quotas are satisfied,
+// and returns remaining segments.
+func (c *Cleaner) applyQuotas(segments []*cleanerSegment) []*cleanerSegment {
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].time.Before(segments[j].time)
+	})
+
+	removed := make(map[*cleanerSegment]struct{})
+
+	// per-path quota
+	pathSizes := make(map[string]uint64)
+	for _, seg := range segments {
+		pathSizes[seg.pathName] += seg.size
+	}
+
+	for _, seg := range segments {
+		if seg.newest || seg.entry.RecordMaxSize == 0 ||
+			pathSizes[seg.pathName] <= seg.entry.RecordMaxSize {
+			continue
+		}
+
+		if c.evict(seg, fmt.Sprintf("path quota of %d bytes exceeded", seg.entry.RecordMaxSize)) {
+			pathSizes[seg.pathName] -= seg.size
+			removed[seg] = struct{}{}
+		}
+	}
+
+	// total quota and free space
+	var totalSize uint64
+	for _, size := range pathSizes {
+		totalSize += size
+	}
+
+	lowSpace := make(map[string]bool)
+	if c.minFreeSpace != 0 {
+		for _, seg := range segments {
+			if _, ok := lowSpace[seg.root]; !ok {
+				lowSpace[seg.root] = c.isSpaceLow(seg.root)
+			}
+		}
+	}
+
+	for _, seg := range segments {
+		if _, ok := removed[seg]; ok || seg.newest {
+			continue
+		}
+
+		var reason string
+
+		switch {
+		case c.totalMaxSize != 0 && totalSize > c.totalMaxSize:
+			reason = fmt.Sprintf("total quota of %d bytes exceeded", c.totalMaxSize)
+
+		case lowSpace[seg.root]:
+			reason = fmt.Sprintf("free space is below %.1f%%", c.minFreeSpace)
+
+		default:
+			continue
+		}
+
+		if c.evict(seg, reason) {
+			totalSize -= seg.size
+			removed[seg] = struct{}{}
+
+			if lowSpace[seg.root] {
+				lowSpace[seg.root] = c.isSpaceLow(seg.root)
+			}
+		}
+	}
+
+	var ret []*cleanerSegment
+	for _, seg := range segments {
+		if _, ok := removed[seg]; !ok {
+			ret = append(ret, seg)
+		}
+	}
+	return ret
+}
+
+func (c *Cleaner) isSpaceLow(dir string) bool {
+	free, err := freeSpacePercent(dir)
+	if err != nil {
+		c.Log(logger.Warn, "unable to get free space of %s: %v", dir, err)
+		return false
+	}
+	return free < c.minFreeSpace
+}
+
+func (c *Cleaner) doRunEntryS3(e *CleanerEntry) error {
+	client := s3.NewClient(
+		e.RecordS3Endpoint,
+		e.RecordS3Region,
+		e.RecordS3Bucket,
+		e.RecordS3AccessKeyID,
+		e.RecordS3SecretAccessKey,
+		e.WriteTimeout,
+	)
+
+	recordPath := e.RecordPath + segmentExtension(e.RecordFormat)
+
+	keyFormat := s3Key(e.RecordS3Prefix, recordPath)
+
+	listPrefix := commonPath(keyFormat)
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+
+	objects, err := client.ListObjects(c.ctx, listPrefix)
+	if err != nil {
+		return fmt.Errorf("unable to list objects: %v", err)
+	}
+
+	now := timeNow()
+
+	for _, obj := range objects {
+		// indexes are removed together with their segment
+		params := decodeRecordPath(keyFormat, strings.TrimSuffix(obj.Key, ".idx"))
+		if params != nil {
+			if now.Sub(params.time) > e.RecordDeleteAfter {
+				c.Log(logger.Debug, "removing object %s", obj.Key)
+
+				err := client.DeleteObject(c.ctx, obj.Key)
+				if err != nil {
+					return fmt.Errorf("unable to delete object %s: %v", obj.Key, err)
+				}
+			}
+		}
+	}
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package record
 
 import (
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -28,15 +29,23 @@ func TestCleaner(t *testing.T) {
 	err = os.WriteFile(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2008-05-20_22-15-25-000125.mp4"), []byte{1}, 0o644)
 	require.NoError(t, err)
 
+	err = os.WriteFile(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2008-05-20_22-15-25-000125.mp4.idx"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
 	err = os.WriteFile(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2009-05-20_22-15-25-000427.mp4"), []byte{1}, 0o644)
 	require.NoError(t, err)
 
+	err = os.WriteFile(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2009-05-20_22-15-25-000427.mp4.idx"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
 	c := NewCleaner(
 		[]CleanerEntry{{
 			RecordPath:        recordPath,
 			RecordFormat:      conf.RecordFormatFMP4,
 			RecordDeleteAfter: 10 * time.Second,
 		}},
+		0,
+		0,
 		nilLogger{},
 	)
 	defer c.Close()
@@ -46,6 +55,143 @@ func TestCleaner(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2008-05-20_22-15-25-000125.mp4"))
 	require.Error(t, err)
 
+	_, err = os.Stat(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2008-05-20_22-15-25-000125.mp4.idx"))
+	require.Error(t, err)
+
 	_, err = os.Stat(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2009-05-20_22-15-25-000427.mp4"))
 	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "_-+*?^$()[]{}|_mypath", "2009-05-20_22-15-25-000427.mp4.idx"))
+	require.NoError(t, err)
+}
+
+func TestCleanerS3(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	storage := &testStorage{
+		objects: map[string][]byte{
+			"rec/recordings/mypath/2008-05-20_22-15-25-000125.mp4": {1},
+			"rec/recordings/mypath/2009-05-20_22-15-25-000427.mp4": {1},
+			"rec/other/2008-05-20_22-15-25-000125.mp4":             {1},
+		},
+	}
+
+	srv := httptest.NewServer(storage)
+	defer srv.Close()
+
+	c := NewCleaner(
+		[]CleanerEntry{{
+			RecordPath:        "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f",
+			RecordFormat:      conf.RecordFormatFMP4,
+			RecordDeleteAfter: 10 * time.Second,
+			RecordS3Endpoint:  srv.URL,
+			RecordS3Region:    "us-east-1",
+			RecordS3Bucket:    "mybucket",
+			RecordS3Prefix:    "rec/",
+		}},
+		0,
+		0,
+		nilLogger{},
+	)
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	require.Equal(t, []string{
+		"rec/other/2008-05-20_22-15-25-000125.mp4",
+		"rec/recordings/mypath/2009-05-20_22-15-25-000427.mp4",
+	}, storage.keys())
+}
+
+func TestCleanerQuota(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 0, time.Local)
+	}
+
+	for _, ca := range []string{"path", "total", "free space"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+			files := []string{
+				filepath.Join("mypath", "2009-05-20_22-15-20-000000.mp4"),
+				filepath.Join("mypath", "2009-05-20_22-15-21-000000.mp4"),
+				filepath.Join("mypath", "2009-05-20_22-15-22-000000.mp4"),
+				filepath.Join("otherpath", "2009-05-20_22-15-19-000000.mp4"),
+				filepath.Join("otherpath", "2009-05-20_22-15-23-000000.mp4"),
+			}
+
+			for _, f := range files {
+				err = os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0o755)
+				require.NoError(t, err)
+
+				err = os.WriteFile(filepath.Join(dir, f), []byte{1, 2, 3, 4}, 0o644)
+				require.NoError(t, err)
+			}
+
+			entry := CleanerEntry{
+				RecordPath:   recordPath,
+				RecordFormat: conf.RecordFormatFMP4,
+			}
+			var totalMaxSize uint64
+			var minFreeSpace float64
+
+			switch ca {
+			case "path":
+				entry.RecordMaxSize = 8
+
+			case "total":
+				totalMaxSize = 12
+
+			case "free space":
+				minFreeSpace = 100
+			}
+
+			c := NewCleaner(
+				[]CleanerEntry{entry},
+				totalMaxSize,
+				minFreeSpace,
+				nilLogger{},
+			)
+			defer c.Close()
+
+			time.Sleep(500 * time.Millisecond)
+
+			var remaining []string
+			for _, f := range files {
+				if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+					remaining = append(remaining, f)
+				}
+			}
+
+			switch ca {
+			case "path":
+				require.Equal(t, []string{files[1], files[2], files[3], files[4]}, remaining)
+				require.Equal(t, map[string]CleanerPathStats{
+					"mypath": {
+						Bytes:           8,
+						Segments:        2,
+						EvictedBytes:    4,
+						EvictedSegments: 1,
+					},
+					"otherpath": {
+						Bytes:    8,
+						Segments: 2,
+					},
+				}, c.Stats())
+
+			case "total":
+				require.Equal(t, []string{files[1], files[2], files[4]}, remaining)
+
+			case "free space":
+				// the newest segment of each path is never deleted
+				require.Equal(t, []string{files[2], files[4]}, remaining)
+			}
+		})
+	}
 }
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package record
+
+import (
+	"syscall"
+)
+
+// freeSpacePercent returns the percentage of free space
+// of the file system that contains the given path.
+func freeSpacePercent(path string) (float64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, err
+	}
+
+	if st.Blocks == 0 {
+		return 100, nil
+	}
+
+	return float64(st.Bavail) * 100 / float64(st.Blocks), nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package record
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeSpacePercent returns the percentage of free space
+// of the file system that contains the given path.
+func freeSpacePercent(path string) (float64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	err = windows.GetDiskFreeSpaceEx(pathPtr, &freeBytesAvailable, &totalBytes, &totalFreeBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	if totalBytes == 0 {
+		return 100, nil
+	}
+
+	return float64(freeBytesAvailable) * 100 / float64(totalBytes), nil
+}
@@ -0,0 +1,524 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// ManifestFileName is the name of manifests.
+const ManifestFileName = "manifest.jsonl"
+
+// ManifestPath returns the path of the manifest of a path.
+// The manifest is placed in the deepest directory of the record path that doesn't contain variables,
+// that is specific to each path since the record path is validated by conf.
+func ManifestPath(recordPath string, pathName string) string {
+	return filepath.Join(commonPath(strings.ReplaceAll(recordPath, "%path", pathName)), ManifestFileName)
+}
+
+// manifestPattern returns the pattern of segment paths, relative to the manifest.
+func manifestPattern(manifestPath string, resolvedPath string) string {
+	rel, err := filepath.Rel(filepath.Dir(manifestPath), resolvedPath)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// LoadManifestPrivateKey loads a Ed25519 private key from a PEM file in PKCS #8 format.
+func LoadManifestPrivateKey(fpath string) (ed25519.PrivateKey, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(byts)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s doesn't contain a PKCS #8 private key", fpath)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	tkey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't contain a Ed25519 key", fpath)
+	}
+
+	return tkey, nil
+}
+
+// LoadManifestPublicKey loads a Ed25519 public key from a PEM file,
+// that can contain either a public key or a PKCS #8 private key.
+func LoadManifestPublicKey(fpath string) (ed25519.PublicKey, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(byts)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		priv, err := LoadManifestPrivateKey(fpath)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	tkey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't contain a Ed25519 key", fpath)
+	}
+
+	return tkey, nil
+}
+
+// AddToManifest adds a segment that has not been recorded by an Agent,
+// like a recovered one, to the manifest of a path.
+func AddToManifest(
+	recordPath string,
+	format conf.RecordFormat,
+	pathName string,
+	key ed25519.PrivateKey,
+	segmentPath string,
+	parent logger.Writer,
+) {
+	// segmentPath is absolute
+	recordPath, _ = filepath.Abs(recordPath)
+	fpath := ManifestPath(recordPath, pathName)
+
+	m := &manifestWriter{
+		fpath:      fpath,
+		pattern:    manifestPattern(fpath, strings.ReplaceAll(recordPath, "%path", pathName)+segmentExtension(format)),
+		key:        key,
+		onComplete: func(_ string) {},
+		parent:     parent,
+	}
+	m.initialize()
+	m.push(segmentPath)
+	m.close()
+}
+
+// manifestEntry is an entry of a manifest.
+// Each entry contains the hash of a segment, the pattern of segment paths,
+// the hash of the previous entry and a signature of all other fields.
+type manifestEntry struct {
+	Seq       uint64 `json:"seq"`
+	Segment   string `json:"segment"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Time      string `json:"time"`
+	Pattern   string `json:"pattern,omitempty"`
+	Prev      string `json:"prev"`
+	Signature string `json:"signature,omitempty"`
+}
+
+func (e manifestEntry) signedPayload() ([]byte, error) {
+	e.Signature = ""
+	return json.Marshal(e)
+}
+
+func hashFile(fpath string) (string, int64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// manifestWriter appends completed segments to a signed, hash-chained manifest.
+// Segments are hashed in a dedicated routine, in order to not block recording.
+type manifestWriter struct {
+	fpath      string
+	pattern    string
+	key        ed25519.PrivateKey
+	onComplete func(string)
+	parent     logger.Writer
+
+	mutex sync.Mutex
+	queue []string
+
+	seq  uint64
+	prev string
+
+	chNew     chan struct{}
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+func (m *manifestWriter) initialize() {
+	m.chNew = make(chan struct{}, 1)
+	m.terminate = make(chan struct{})
+	m.done = make(chan struct{})
+
+	err := m.loadLast()
+	if err != nil {
+		m.parent.Log(logger.Error, "unable to read manifest %s: %v", m.fpath, err)
+	}
+
+	go m.run()
+}
+
+// close waits for all pending segments to be added to the manifest.
+func (m *manifestWriter) close() {
+	close(m.terminate)
+	<-m.done
+}
+
+// loadLast reads the last entry of an existing manifest, in order to continue the chain.
+// An incomplete trailing entry, left by a crash, is removed.
+func (m *manifestWriter) loadLast() error {
+	byts, err := os.ReadFile(m.fpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if len(byts) != 0 && byts[len(byts)-1] != '\n' {
+		i := bytes.LastIndexByte(byts, '\n')
+		byts = byts[:i+1]
+
+		m.parent.Log(logger.Warn, "removing incomplete entry from manifest %s", m.fpath)
+
+		err = os.Truncate(m.fpath, int64(len(byts)))
+		if err != nil {
+			return err
+		}
+	}
+
+	byts = bytes.TrimSuffix(byts, []byte("\n"))
+	if len(byts) == 0 {
+		return nil
+	}
+
+	line := byts[bytes.LastIndexByte(byts, '\n')+1:]
+
+	var e manifestEntry
+	err = json.Unmarshal(line, &e)
+	if err != nil {
+		return err
+	}
+
+	m.seq = e.Seq + 1
+	m.prev = hashLine(line)
+
+	return nil
+}
+
+func (m *manifestWriter) push(fpath string) {
+	m.mutex.Lock()
+	m.queue = append(m.queue, fpath)
+	m.mutex.Unlock()
+
+	select {
+	case m.chNew <- struct{}{}:
+	default:
+	}
+}
+
+func (m *manifestWriter) pop() (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.queue) == 0 {
+		return "", false
+	}
+
+	fpath := m.queue[0]
+	m.queue = m.queue[1:]
+	return fpath, true
+}
+
+func (m *manifestWriter) run() {
+	defer close(m.done)
+
+	for {
+		select {
+		case <-m.chNew:
+			m.processQueue()
+
+		case <-m.terminate:
+			// segments completed before termination have already been pushed
+			m.processQueue()
+			return
+		}
+	}
+}
+
+func (m *manifestWriter) processQueue() {
+	for {
+		fpath, ok := m.pop()
+		if !ok {
+			return
+		}
+
+		err := m.add(fpath)
+		if err != nil {
+			m.parent.Log(logger.Error, "unable to add %s to manifest: %v", fpath, err)
+		}
+
+		m.onComplete(fpath)
+	}
+}
+
+func (m *manifestWriter) add(fpath string) error {
+	sum, size, err := hashFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(m.fpath), fpath)
+	if err != nil {
+		return err
+	}
+
+	e := manifestEntry{
+		Seq:     m.seq,
+		Segment: filepath.ToSlash(rel),
+		Size:    size,
+		SHA256:  sum,
+		Time:    timeNow().UTC().Format(time.RFC3339Nano),
+		Pattern: m.pattern,
+		Prev:    m.prev,
+	}
+
+	payload, err := e.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	e.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(m.key, payload))
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(m.fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(m.fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	m.seq++
+	m.prev = hashLine(line)
+
+	m.parent.Log(logger.Debug, "added %s to manifest", fpath)
+
+	return nil
+}
+
+// ManifestReport is the result of the verification of a manifest.
+type ManifestReport struct {
+	// number of entries in the manifest.
+	Entries int `json:"entries"`
+
+	// whether all entries are correctly signed and chained.
+	ChainValid bool   `json:"chainValid"`
+	ChainError string `json:"chainError"`
+
+	// segments whose content matches the manifest.
+	Verified []string `json:"verified"`
+
+	// segments whose content doesn't match the manifest.
+	Modified []string `json:"modified"`
+
+	// segments that are in the manifest but not on disk,
+	// because they have been deleted or uploaded.
+	Missing []string `json:"missing"`
+
+	// segments that are on disk but not in the manifest.
+	Unlisted []string `json:"unlisted"`
+}
+
+// Valid returns whether the chain is valid and no segment has been modified or added.
+func (r *ManifestReport) Valid() bool {
+	return r.ChainValid && len(r.Modified) == 0 && len(r.Unlisted) == 0
+}
+
+// VerifyManifest checks the recordings of a directory against its manifest.
+// Only files that match the pattern of segment paths stored in the manifest are checked.
+func VerifyManifest(dir string, publicKey ed25519.PublicKey) (*ManifestReport, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &ManifestReport{
+		ChainValid: true,
+		Verified:   []string{},
+		Modified:   []string{},
+		Missing:    []string{},
+		Unlisted:   []string{},
+	}
+
+	listed := make(map[string]struct{})
+	prev := ""
+	pattern := ""
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var e manifestEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %d: %v", r.Entries, err)
+		}
+
+		if r.ChainValid {
+			err = verifyManifestEntry(&e, uint64(r.Entries), prev, publicKey)
+			if err != nil {
+				r.ChainValid = false
+				r.ChainError = fmt.Sprintf("entry %d: %v", r.Entries, err)
+			}
+		}
+
+		prev = hashLine(line)
+		pattern = e.Pattern
+		r.Entries++
+
+		listed[e.Segment] = struct{}{}
+		fpath := filepath.Join(dir, filepath.FromSlash(e.Segment))
+
+		sum, size, err := hashFile(fpath)
+		switch {
+		case os.IsNotExist(err):
+			r.Missing = append(r.Missing, e.Segment)
+
+		case err != nil:
+			return nil, err
+
+		case sum != e.SHA256 || size != e.Size:
+			r.Modified = append(r.Modified, e.Segment)
+
+		default:
+			r.Verified = append(r.Verified, e.Segment)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(dir, func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Base(fpath) == ManifestFileName ||
+			strings.HasSuffix(fpath, ".idx") || IsThumbnailPath(fpath) {
+			return nil
+		}
+
+		// files of other paths, that are stored in subdirectories, are skipped.
+		if pattern != "" && decodeRecordPath(filepath.Join(dir, filepath.FromSlash(pattern)), fpath) == nil {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if _, ok := listed[rel]; !ok {
+			r.Unlisted = append(r.Unlisted, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(r.Unlisted)
+
+	return r, nil
+}
+
+func verifyManifestEntry(e *manifestEntry, seq uint64, prev string, publicKey ed25519.PublicKey) error {
+	if e.Seq != seq {
+		return fmt.Errorf("sequence number is %d, expected %d", e.Seq, seq)
+	}
+
+	if e.Prev != prev {
+		return fmt.Errorf("previous entry hash doesn't match")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	payload, err := e.signedPayload()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, payload, sig) {
+		return fmt.Errorf("signature is not valid")
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package record
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestManifestPath(t *testing.T) {
+	require.Equal(t, filepath.Join("recordings", "mypath", ManifestFileName),
+		ManifestPath("./recordings/%path/%Y-%m-%d_%H-%M-%S-%f", "mypath"))
+}
+
+func TestLoadManifestKeys(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	privByts, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	privPath := filepath.Join(dir, "key.pem")
+	err = os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privByts}), 0o644)
+	require.NoError(t, err)
+
+	pubByts, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	pubPath := filepath.Join(dir, "key.pub")
+	err = os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubByts}), 0o644)
+	require.NoError(t, err)
+
+	priv2, err := LoadManifestPrivateKey(privPath)
+	require.NoError(t, err)
+	require.Equal(t, priv, priv2)
+
+	pub2, err := LoadManifestPublicKey(pubPath)
+	require.NoError(t, err)
+	require.Equal(t, pub, pub2)
+
+	pub2, err = LoadManifestPublicKey(privPath)
+	require.NoError(t, err)
+	require.Equal(t, pub, pub2)
+
+	_, err = LoadManifestPrivateKey(pubPath)
+	require.Error(t, err)
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	writeSegments := func(names ...string) {
+		var completed []string
+
+		m := &manifestWriter{
+			fpath:      filepath.Join(dir, ManifestFileName),
+			key:        priv,
+			onComplete: func(fpath string) { completed = append(completed, fpath) },
+			parent:     nilLogger{},
+		}
+		m.initialize()
+
+		for _, name := range names {
+			fpath := filepath.Join(dir, name)
+			err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+			require.NoError(t, err)
+			err = os.WriteFile(fpath, []byte(name), 0o644)
+			require.NoError(t, err)
+			m.push(fpath)
+		}
+
+		m.close()
+		require.Equal(t, len(names), len(completed))
+	}
+
+	writeSegments("2008-05-20_22-15-25-000000.mp4", "2008-05-20_22-16-25-000000.mp4")
+
+	// entries are appended to the chain after a restart
+	writeSegments("sub/2008-05-20_22-17-25-000000.mp4")
+
+	r, err := VerifyManifest(dir, pub)
+	require.NoError(t, err)
+	require.Equal(t, &ManifestReport{
+		Entries:    3,
+		ChainValid: true,
+		Verified: []string{
+			"2008-05-20_22-15-25-000000.mp4",
+			"2008-05-20_22-16-25-000000.mp4",
+			"sub/2008-05-20_22-17-25-000000.mp4",
+		},
+		Modified: []string{},
+		Missing:  []string{},
+		Unlisted: []string{},
+	}, r)
+	require.True(t, r.Valid())
+
+	err = os.WriteFile(filepath.Join(dir, "2008-05-20_22-15-25-000000.mp4"), []byte("tampered"), 0o644)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, "2008-05-20_22-16-25-000000.mp4"))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "2008-05-20_22-18-25-000000.mp4"), []byte("added"), 0o644)
+	require.NoError(t, err)
+
+	r, err = VerifyManifest(dir, pub)
+	require.NoError(t, err)
+	require.True(t, r.ChainValid)
+	require.Equal(t, []string{"sub/2008-05-20_22-17-25-000000.mp4"}, r.Verified)
+	require.Equal(t, []string{"2008-05-20_22-15-25-000000.mp4"}, r.Modified)
+	require.Equal(t, []string{"2008-05-20_22-16-25-000000.mp4"}, r.Missing)
+	require.Equal(t, []string{"2008-05-20_22-18-25-000000.mp4"}, r.Unlisted)
+	require.False(t, r.Valid())
+
+	// removing an entry breaks the chain
+	byts, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(byts, []byte("\n"))
+	err = os.WriteFile(filepath.Join(dir, ManifestFileName), append(lines[0], lines[2]...), 0o644)
+	require.NoError(t, err)
+
+	r, err = VerifyManifest(dir, pub)
+	require.NoError(t, err)
+	require.False(t, r.ChainValid)
+	require.Equal(t, "entry 1: sequence number is 2, expected 1", r.ChainError)
+
+	// a different key doesn't match signatures
+	pub2, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	r, err = VerifyManifest(dir, pub2)
+	require.NoError(t, err)
+	require.False(t, r.ChainValid)
+	require.Equal(t, "entry 0: signature is not valid", r.ChainError)
+}
+
+func TestManifestPattern(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(dir, "mypath", ManifestFileName)
+	pattern := manifestPattern(fpath, filepath.Join(dir, "mypath", "%Y-%m-%d_%H-%M-%S-%f.mp4"))
+	require.Equal(t, "%Y-%m-%d_%H-%M-%S-%f.mp4", pattern)
+
+	m := &manifestWriter{
+		fpath:      fpath,
+		pattern:    pattern,
+		key:        priv,
+		onComplete: func(_ string) {},
+		parent:     nilLogger{},
+	}
+	m.initialize()
+
+	for _, name := range []string{
+		"mypath/2008-05-20_22-15-25-000000.mp4",
+		"mypath/2008-05-20_22-16-25-000000.mp4",
+		"mypath/sub/2008-05-20_22-15-25-000000.mp4", // segment of path mypath/sub
+		"mypath/notes.txt",
+	} {
+		segPath := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(segPath), 0o755)
+		require.NoError(t, err)
+		err = os.WriteFile(segPath, []byte(name), 0o644)
+		require.NoError(t, err)
+	}
+
+	m.push(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"))
+	m.close()
+
+	r, err := VerifyManifest(filepath.Join(dir, "mypath"), pub)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2008-05-20_22-15-25-000000.mp4"}, r.Verified)
+	require.Equal(t, []string{"2008-05-20_22-16-25-000000.mp4"}, r.Unlisted)
+}
+
+func TestAddToManifest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	segPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+	err = os.MkdirAll(filepath.Dir(segPath), 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(segPath, []byte("recovered"), 0o644)
+	require.NoError(t, err)
+
+	AddToManifest(filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"), conf.RecordFormatFMP4,
+		"mypath", priv, segPath, nilLogger{})
+
+	r, err := VerifyManifest(filepath.Join(dir, "mypath"), pub)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2008-05-20_22-15-25-000000.mp4"}, r.Verified)
+	require.True(t, r.Valid())
+}
@@ -29,6 +29,14 @@ func durationGoToMp4(v time.Duration, timeScale uint32) uint64 {
 	return uint64(secs)*timeScale64 + uint64(dec)*timeScale64/uint64(time.Second)
 }
 
+// ntpAdd adds a duration to a NTP timestamp, preserving zero (unknown) timestamps.
+func ntpAdd(ntp time.Time, d time.Duration) time.Time {
+	if ntp.IsZero() {
+		return ntp
+	}
+	return ntp.Add(d)
+}
+
 func mpeg1audioChannelCount(cm mpeg1audio.ChannelMode) int {
 	switch cm {
 	case mpeg1audio.ChannelModeStereo,
@@ -132,8 +140,81 @@ func (f *recFormatFMP4) initialize() {
 		}
 	}
 
-	for _, media := range f.a.wrapper.Stream.Desc().Medias {
+	setupFMP4Tracks(
+		f.a,
+		nil,
+		func(codec fmp4.Codec) fmp4TrackRecorder {
+			return addTrack(codec)
+		},
+		func(mimeFormat string) fmp4TrackRecorder {
+			track := addTrack(nil)
+			track.mimeFormat = mimeFormat
+			return track
+		},
+		updateCodecs,
+	)
+
+	f.a.wrapper.Log(logger.Info, "recording %d %s",
+		len(f.tracks),
+		func() string {
+			if len(f.tracks) == 1 {
+				return "track"
+			}
+			return "tracks"
+		}())
+}
+
+func (f *recFormatFMP4) close() {
+	if f.currentSegment != nil {
+		f.currentSegment.close() //nolint:errcheck
+	}
+}
+
+// fmp4TrackRecorder is a track that records fMP4 samples.
+type fmp4TrackRecorder interface {
+	record(sample *sample) error
+}
+
+// keyframesOnlyTrack drops video samples that are not key frames.
+type keyframesOnlyTrack struct {
+	fmp4TrackRecorder
+}
+
+func (t *keyframesOnlyTrack) record(sample *sample) error {
+	if sample.IsNonSyncSample {
+		return nil
+	}
+	return t.fmp4TrackRecorder.record(sample)
+}
+
+// setupFMP4Tracks adds a reader for each supported format of the stream.
+// Readers convert units into fMP4 samples and pass them to tracks created with addTrack.
+// It is shared by formats that use fMP4 samples and codec parameters.
+// filter and addMetadataTrack are optional.
+func setupFMP4Tracks(
+	a *agentInstance,
+	filter func(forma format.Format) bool,
+	addTrack func(codec fmp4.Codec) fmp4TrackRecorder,
+	addMetadataTrack func(mimeFormat string) fmp4TrackRecorder,
+	updateCodecs func(),
+) {
+	if a.wrapper.KeyframesOnly {
+		addTrackAll := addTrack
+		addTrack = func(codec fmp4.Codec) fmp4TrackRecorder {
+			track := addTrackAll(codec)
+			if codec.IsVideo() {
+				return &keyframesOnlyTrack{track}
+			}
+			return track
+		}
+	}
+
+	for i, media := range a.wrapper.Stream.Desc().Medias {
 		for _, forma := range media.Formats {
+			if !a.wrapper.recordsFormat(i, media, forma) || (filter != nil && !filter(forma)) {
+				continue
+			}
+
 			switch forma := forma.(type) {
 			case *format.AV1:
 				codec := &fmp4.CodecAV1{
@@ -145,7 +226,7 @@ func (f *recFormatFMP4) initialize() {
 
 				firstReceived := false
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.AV1)
 					if tunit.TU == nil {
 						return nil
@@ -186,6 +267,7 @@ func (f *recFormatFMP4) initialize() {
 					return track.record(&sample{
 						PartSample: sampl,
 						dts:        tunit.PTS,
+						ntp:        tunit.NTP,
 					})
 				})
 
@@ -202,7 +284,7 @@ func (f *recFormatFMP4) initialize() {
 
 				firstReceived := false
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.VP9)
 					if tunit.Frame == nil {
 						return nil
@@ -258,6 +340,7 @@ func (f *recFormatFMP4) initialize() {
 							Payload:         tunit.Frame,
 						},
 						dts: tunit.PTS,
+						ntp: tunit.NTP,
 					})
 				})
 
@@ -299,7 +382,7 @@ func (f *recFormatFMP4) initialize() {
 
 				var dtsExtractor *h265.DTSExtractor
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.H265)
 					if tunit.AU == nil {
 						return nil
@@ -357,6 +440,7 @@ func (f *recFormatFMP4) initialize() {
 					return track.record(&sample{
 						PartSample: sampl,
 						dts:        dts,
+						ntp:        tunit.NTP,
 					})
 				})
 
@@ -384,7 +468,7 @@ func (f *recFormatFMP4) initialize() {
 
 				var dtsExtractor *h264.DTSExtractor
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.H264)
 					if tunit.AU == nil {
 						return nil
@@ -435,6 +519,7 @@ func (f *recFormatFMP4) initialize() {
 					return track.record(&sample{
 						PartSample: sampl,
 						dts:        dts,
+						ntp:        tunit.NTP,
 					})
 				})
 
@@ -460,7 +545,7 @@ func (f *recFormatFMP4) initialize() {
 				firstReceived := false
 				var lastPTS time.Duration
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG4Video)
 					if tunit.Frame == nil {
 						return nil
@@ -496,6 +581,7 @@ func (f *recFormatFMP4) initialize() {
 							IsNonSyncSample: !randomAccess,
 						},
 						dts: tunit.PTS,
+						ntp: tunit.NTP,
 					})
 				})
 
@@ -512,7 +598,7 @@ func (f *recFormatFMP4) initialize() {
 				firstReceived := false
 				var lastPTS time.Duration
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG1Video)
 					if tunit.Frame == nil {
 						return nil
@@ -548,6 +634,7 @@ func (f *recFormatFMP4) initialize() {
 							IsNonSyncSample: !randomAccess,
 						},
 						dts: tunit.PTS,
+						ntp: tunit.NTP,
 					})
 				})
 
@@ -560,7 +647,7 @@ func (f *recFormatFMP4) initialize() {
 
 				parsed := false
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MJPEG)
 					if tunit.Frame == nil {
 						return nil
@@ -582,6 +669,7 @@ func (f *recFormatFMP4) initialize() {
 							Payload: tunit.Frame,
 						},
 						dts: tunit.PTS,
+						ntp: tunit.NTP,
 					})
 				})
 
@@ -596,7 +684,7 @@ func (f *recFormatFMP4) initialize() {
 				}
 				track := addTrack(codec)
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.Opus)
 					if tunit.Packets == nil {
 						return nil
@@ -610,6 +698,7 @@ func (f *recFormatFMP4) initialize() {
 								Payload: packet,
 							},
 							dts: pts,
+							ntp: ntpAdd(tunit.NTP, pts-tunit.PTS),
 						})
 						if err != nil {
 							return err
@@ -629,7 +718,7 @@ func (f *recFormatFMP4) initialize() {
 
 				sampleRate := time.Duration(forma.ClockRate())
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG4Audio)
 					if tunit.AUs == nil {
 						return nil
@@ -644,6 +733,7 @@ func (f *recFormatFMP4) initialize() {
 								Payload: au,
 							},
 							dts: auPTS,
+							ntp: ntpAdd(tunit.NTP, auPTS-tunit.PTS),
 						})
 						if err != nil {
 							return err
@@ -662,7 +752,7 @@ func (f *recFormatFMP4) initialize() {
 
 				parsed := false
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG1Audio)
 					if tunit.Frames == nil {
 						return nil
@@ -689,6 +779,7 @@ func (f *recFormatFMP4) initialize() {
 								Payload: frame,
 							},
 							dts: pts,
+							ntp: ntpAdd(tunit.NTP, pts-tunit.PTS),
 						})
 						if err != nil {
 							return err
@@ -716,7 +807,7 @@ func (f *recFormatFMP4) initialize() {
 
 				parsed := false
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.AC3)
 					if tunit.Frames == nil {
 						return nil
@@ -755,6 +846,7 @@ func (f *recFormatFMP4) initialize() {
 								Payload: frame,
 							},
 							dts: pts,
+							ntp: ntpAdd(tunit.NTP, pts-tunit.PTS),
 						})
 						if err != nil {
 							return err
@@ -782,7 +874,7 @@ func (f *recFormatFMP4) initialize() {
 				}
 				track := addTrack(codec)
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.LPCM)
 					if tunit.Samples == nil {
 						return nil
@@ -793,24 +885,41 @@ func (f *recFormatFMP4) initialize() {
 							Payload: tunit.Samples,
 						},
 						dts: tunit.PTS,
+						ntp: tunit.NTP,
 					})
 				})
-			}
-		}
-	}
 
-	f.a.wrapper.Log(logger.Info, "recording %d %s",
-		len(f.tracks),
-		func() string {
-			if len(f.tracks) == 1 {
-				return "track"
-			}
-			return "tracks"
-		}())
-}
+			case *format.Generic:
+				if addMetadataTrack == nil || !isMetadataFormat(media, forma) {
+					continue
+				}
 
-func (f *recFormatFMP4) close() {
-	if f.currentSegment != nil {
-		f.currentSegment.close() //nolint:errcheck
+				track := addMetadataTrack(metadataMIMEFormat(media, forma))
+
+				var dec metadataDecoder
+
+				a.addReader(media, forma, func(u unit.Unit) error {
+					units, err := dec.decode(u.(*unit.Generic))
+					if err != nil {
+						return err
+					}
+
+					for _, mu := range units {
+						err = track.record(&sample{
+							PartSample: &fmp4.PartSample{
+								Payload: mu.payload,
+							},
+							dts: mu.pts,
+							ntp: mu.ntp,
+						})
+						if err != nil {
+							return err
+						}
+					}
+
+					return nil
+				})
+			}
+		}
 	}
 }
@@ -0,0 +1,200 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/abema/go-mp4"
+	"github.com/aler9/writerseeker"
+)
+
+// mp4Box is a box with children.
+// Boxes unknown to go-mp4 are written with a raw payload.
+type mp4Box struct {
+	box      mp4.IImmutableBox
+	typ      string
+	payload  []byte
+	children []*mp4Box
+}
+
+func (b *mp4Box) marshal(w *mp4.Writer) error {
+	var typ mp4.BoxType
+	if b.box != nil {
+		typ = b.box.GetType()
+	} else {
+		typ = mp4.StrToBoxType(b.typ)
+	}
+
+	_, err := w.StartBox(&mp4.BoxInfo{Type: typ})
+	if err != nil {
+		return err
+	}
+
+	if b.box != nil {
+		_, err = mp4.Marshal(w, b.box, mp4.Context{})
+	} else {
+		_, err = w.Write(b.payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, child := range b.children {
+		err = child.marshal(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.EndBox()
+	return err
+}
+
+// mettPayload returns the payload of a TextMetaDataSampleEntry (ISO 14496-12, 12.3.3.2).
+func mettPayload(mimeFormat string) []byte {
+	buf := make([]byte, 8, 8+1+len(mimeFormat)+1)
+	binary.BigEndian.PutUint16(buf[6:], 1) // data_reference_index
+	buf = append(buf, 0)                   // content_encoding
+	buf = append(buf, mimeFormat...)       // mime_format
+	buf = append(buf, 0)
+	return buf
+}
+
+func metadataTrak(track *recFormatFMP4Track) *mp4Box {
+	/*
+		trak
+		- tkhd
+		- mdia
+		  - mdhd
+		  - hdlr
+		  - minf
+		    - nmhd
+		    - dinf
+		      - dref
+		        - url
+		    - stbl
+		      - stsd
+		        - mett
+		      - stts
+		      - stsc
+		      - stsz
+		      - stco
+	*/
+	return &mp4Box{box: &mp4.Trak{}, children: []*mp4Box{
+		{box: &mp4.Tkhd{
+			FullBox: mp4.FullBox{
+				Flags: [3]byte{0, 0, 3},
+			},
+			TrackID: uint32(track.initTrack.ID),
+			Matrix:  [9]int32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000},
+		}},
+		{box: &mp4.Mdia{}, children: []*mp4Box{
+			{box: &mp4.Mdhd{
+				Timescale: track.initTrack.TimeScale,
+				Language:  [3]byte{'u', 'n', 'd'},
+			}},
+			{box: &mp4.Hdlr{
+				HandlerType: [4]byte{'m', 'e', 't', 'a'},
+				Name:        "MetadataHandler",
+			}},
+			{box: &mp4.Minf{}, children: []*mp4Box{
+				{typ: "nmhd", payload: []byte{0, 0, 0, 0}},
+				{box: &mp4.Dinf{}, children: []*mp4Box{
+					{box: &mp4.Dref{EntryCount: 1}, children: []*mp4Box{
+						{box: &mp4.Url{
+							FullBox: mp4.FullBox{
+								Flags: [3]byte{0, 0, 1},
+							},
+						}},
+					}},
+				}},
+				{box: &mp4.Stbl{}, children: []*mp4Box{
+					{box: &mp4.Stsd{EntryCount: 1}, children: []*mp4Box{
+						{typ: "mett", payload: mettPayload(track.mimeFormat)},
+					}},
+					{box: &mp4.Stts{}},
+					{box: &mp4.Stsc{}},
+					{box: &mp4.Stsz{}},
+					{box: &mp4.Stco{}},
+				}},
+			}},
+		}},
+	}}
+}
+
+func findMP4Box(buf []byte, typ string) (int, int, error) {
+	pos := 0
+
+	for pos < len(buf) {
+		size, styp, _, err := readBoxHeader(bytes.NewReader(buf[pos:]))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if uint64(len(buf)-pos) < size {
+			return 0, 0, fmt.Errorf("invalid size of box '%s'", styp)
+		}
+
+		if styp == typ {
+			return pos, int(size), nil
+		}
+
+		pos += int(size)
+	}
+
+	return 0, 0, fmt.Errorf("box '%s' not found", typ)
+}
+
+// addMetadataTracks adds timed metadata tracks to an initialization segment
+// generated by fmp4.Init, by inserting a trak box for each track into moov
+// and a trex box for each track into mvex.
+func addMetadataTracks(init []byte, tracks []*recFormatFMP4Track) ([]byte, error) {
+	moovPos, moovSize, err := findMP4Box(init, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	mvexPos, mvexSize, err := findMP4Box(init[moovPos+8:moovPos+moovSize], "mvex")
+	if err != nil {
+		return nil, err
+	}
+	mvexPos += moovPos + 8
+
+	if (mvexPos+mvexSize) != (moovPos+moovSize) || (moovPos+moovSize) != len(init) {
+		return nil, fmt.Errorf("unexpected layout of initialization segment")
+	}
+
+	var traks writerseeker.WriterSeeker
+	var trexs writerseeker.WriterSeeker
+
+	for _, track := range tracks {
+		err = metadataTrak(track).marshal(mp4.NewWriter(&traks))
+		if err != nil {
+			return nil, err
+		}
+
+		trex := &mp4Box{box: &mp4.Trex{
+			TrackID:                       uint32(track.initTrack.ID),
+			DefaultSampleDescriptionIndex: 1,
+		}}
+		err = trex.marshal(mp4.NewWriter(&trexs))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trakBytes := traks.Bytes()
+	trexBytes := trexs.Bytes()
+
+	out := make([]byte, 0, len(init)+len(trakBytes)+len(trexBytes))
+	out = append(out, init[:mvexPos]...)
+	out = append(out, trakBytes...)
+	out = append(out, init[mvexPos:]...)
+	out = append(out, trexBytes...)
+
+	binary.BigEndian.PutUint32(out[moovPos:], uint32(moovSize+len(trakBytes)+len(trexBytes)))
+	binary.BigEndian.PutUint32(out[mvexPos+len(trakBytes):], uint32(mvexSize+len(trexBytes)))
+
+	return out, nil
+}
@@ -1,6 +1,7 @@
 package record
 
 import (
+	"encoding/binary"
 	"io"
 	"os"
 	"path/filepath"
@@ -39,6 +40,35 @@ func writePart(
 	return err
 }
 
+// NTP timestamps start from 1900-01-01.
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ntpTimeGoToMp4(v time.Time) uint64 {
+	d := v.Sub(ntpEpoch)
+	secs := uint64(d / time.Second)
+	frac := uint64(d%time.Second) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+func ntpTimeMp4ToGo(v uint64) time.Time {
+	secs := v >> 32
+	frac := (v & 0xFFFFFFFF) * uint64(time.Second) >> 32
+	return ntpEpoch.Add(time.Duration(secs)*time.Second + time.Duration(frac))
+}
+
+// marshalPrft returns a Producer Reference Time box (ISO 14496-12, section 8.16.5),
+// that associates the media time of a track with an absolute time.
+func marshalPrft(trackID int, ntp time.Time, mediaTime uint64) []byte {
+	buf := make([]byte, 32)
+	binary.BigEndian.PutUint32(buf[0:], 32)
+	copy(buf[4:], "prft")
+	buf[8] = 1 // version
+	binary.BigEndian.PutUint32(buf[12:], uint32(trackID))
+	binary.BigEndian.PutUint64(buf[16:], ntpTimeGoToMp4(ntp))
+	binary.BigEndian.PutUint64(buf[24:], mediaTime)
+	return buf
+}
+
 type recFormatFMP4Part struct {
 	s              *recFormatFMP4Segment
 	sequenceNumber uint32
@@ -47,6 +77,10 @@ type recFormatFMP4Part struct {
 	created    time.Time
 	partTracks map[*recFormatFMP4Track]*fmp4.PartTrack
 	endDTS     time.Duration
+	endTime    time.Duration
+	ntp        time.Time
+	ntpTrack   *recFormatFMP4Track
+	keyframe   bool
 }
 
 func newRecFormatFMP4Part(
@@ -65,7 +99,13 @@ func newRecFormatFMP4Part(
 
 func (p *recFormatFMP4Part) close() error {
 	if p.s.fi == nil {
-		p.s.fpath = encodeRecordPath(&recordPathParams{time: p.created}, p.s.f.a.resolvedPath)
+		// segments are named after the absolute time of their first sample, when available
+		created := p.created
+		if !p.ntp.IsZero() {
+			created = p.ntp.Local()
+		}
+
+		p.s.fpath = encodeRecordPath(&recordPathParams{time: created}, p.s.f.a.resolvedPath)
 		p.s.f.a.wrapper.Log(logger.Debug, "creating segment %s", p.s.fpath)
 
 		err := os.MkdirAll(filepath.Dir(p.s.fpath), 0o755)
@@ -86,10 +126,45 @@ func (p *recFormatFMP4Part) close() error {
 			return err
 		}
 
+		err = p.s.index.open(p.s.fpath)
+		if err != nil {
+			fi.Close()
+			return err
+		}
+
 		p.s.fi = fi
 	}
 
-	return writePart(p.s.fi, p.sequenceNumber, p.partTracks)
+	if p.ntpTrack != nil {
+		_, err := p.s.fi.Write(marshalPrft(p.ntpTrack.initTrack.ID, p.ntp, p.partTracks[p.ntpTrack].BaseTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	offset, err := p.s.fi.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	err = writePart(p.s.fi, p.sequenceNumber, p.partTracks)
+	if err != nil {
+		return err
+	}
+
+	end, err := p.s.fi.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	return p.s.index.write(SegmentIndexEntry{
+		Offset:   uint64(offset),
+		Size:     uint64(end - offset),
+		DTS:      p.startDTS - p.s.startDTS,
+		Duration: p.endTime - p.startDTS,
+		NTP:      p.ntp,
+		Keyframe: p.keyframe || !p.s.f.hasVideo,
+	})
 }
 
 func (p *recFormatFMP4Part) record(track *recFormatFMP4Track, sample *sample) error {
@@ -103,8 +178,22 @@ func (p *recFormatFMP4Part) record(track *recFormatFMP4Track, sample *sample) er
 	}
 
 	partTrack.Samples = append(partTrack.Samples, sample.PartSample)
+
 	p.endDTS = sample.dts
 
+	if end := sample.dts + durationMp4ToGo(uint64(sample.Duration), track.initTrack.TimeScale); end > p.endTime {
+		p.endTime = end
+	}
+
+	if p.ntp.IsZero() && !sample.ntp.IsZero() {
+		p.ntp = sample.ntp
+		p.ntpTrack = track
+	}
+
+	if track.isVideo() && !sample.IsNonSyncSample {
+		p.keyframe = true
+	}
+
 	return nil
 }
 
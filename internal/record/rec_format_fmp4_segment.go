@@ -14,9 +14,15 @@ import (
 var timeNow = time.Now
 
 func writeInit(f io.Writer, tracks []*recFormatFMP4Track) error {
-	fmp4Tracks := make([]*fmp4.InitTrack, len(tracks))
-	for i, track := range tracks {
-		fmp4Tracks[i] = track.initTrack
+	var fmp4Tracks []*fmp4.InitTrack
+	var metadataTracks []*recFormatFMP4Track
+
+	for _, track := range tracks {
+		if track.initTrack.Codec != nil {
+			fmp4Tracks = append(fmp4Tracks, track.initTrack)
+		} else {
+			metadataTracks = append(metadataTracks, track)
+		}
 	}
 
 	init := fmp4.Init{
@@ -29,26 +35,39 @@ func writeInit(f io.Writer, tracks []*recFormatFMP4Track) error {
 		return err
 	}
 
-	_, err = f.Write(ws.Bytes())
+	byts := ws.Bytes()
+
+	if len(metadataTracks) != 0 {
+		byts, err = addMetadataTracks(byts, metadataTracks)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = f.Write(byts)
 	return err
 }
 
 type recFormatFMP4Segment struct {
 	f        *recFormatFMP4
 	startDTS time.Duration
+	endDTS   time.Duration
 
 	fpath   string
 	fi      *os.File
+	index   segmentIndexWriter
 	curPart *recFormatFMP4Part
 }
 
 func newRecFormatFMP4Segment(
 	f *recFormatFMP4,
 	startDTS time.Duration,
+	startNTP time.Time,
 ) *recFormatFMP4Segment {
 	return &recFormatFMP4Segment{
 		f:        f,
 		startDTS: startDTS,
+		endDTS:   f.a.wrapper.segmentEndDTS(startDTS, startNTP),
 	}
 }
 
@@ -66,8 +85,13 @@ func (s *recFormatFMP4Segment) close() error {
 			err = err2
 		}
 
+		err3 := s.index.close()
+		if err == nil {
+			err = err3
+		}
+
 		if err2 == nil {
-			s.f.a.wrapper.OnSegmentComplete(s.fpath)
+			s.f.a.wrapper.segmentComplete(s.fpath)
 		}
 	}
 
@@ -8,6 +8,10 @@ type recFormatFMP4Track struct {
 	f         *recFormatFMP4
 	initTrack *fmp4.InitTrack
 
+	// MIME type of timed metadata tracks, that are not supported by fmp4.Init
+	// and have a nil codec.
+	mimeFormat string
+
 	nextSample *sample
 }
 
@@ -21,14 +25,18 @@ func newRecFormatFMP4Track(
 	}
 }
 
+func (t *recFormatFMP4Track) isVideo() bool {
+	return t.initTrack.Codec != nil && t.initTrack.Codec.IsVideo()
+}
+
 func (t *recFormatFMP4Track) record(sample *sample) error {
 	// wait the first video sample before setting hasVideo
-	if t.initTrack.Codec.IsVideo() {
+	if t.isVideo() {
 		t.f.hasVideo = true
 	}
 
 	if t.f.currentSegment == nil {
-		t.f.currentSegment = newRecFormatFMP4Segment(t.f, sample.dts)
+		t.f.currentSegment = newRecFormatFMP4Segment(t.f, sample.dts, sample.ntp)
 	}
 
 	sample, t.nextSample = t.nextSample, sample
@@ -42,15 +50,15 @@ func (t *recFormatFMP4Track) record(sample *sample) error {
 		return err
 	}
 
-	if (!t.f.hasVideo || t.initTrack.Codec.IsVideo()) &&
+	if (!t.f.hasVideo || t.isVideo()) &&
 		!t.nextSample.IsNonSyncSample &&
-		(t.nextSample.dts-t.f.currentSegment.startDTS) >= t.f.a.wrapper.SegmentDuration {
+		t.nextSample.dts >= t.f.currentSegment.endDTS {
 		err := t.f.currentSegment.close()
 		if err != nil {
 			return err
 		}
 
-		t.f.currentSegment = newRecFormatFMP4Segment(t.f, t.nextSample.dts)
+		t.f.currentSegment = newRecFormatFMP4Segment(t.f, t.nextSample.dts, t.nextSample.ntp)
 	}
 
 	return nil
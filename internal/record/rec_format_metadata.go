@@ -0,0 +1,94 @@
+package record
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	metadataMaxUnitSize = 1 * 1024 * 1024
+)
+
+// isMetadataFormat returns whether a format is a metadata format that can be recorded,
+// like ONVIF metadata or KLV.
+func isMetadataFormat(media *description.Media, forma format.Format) bool {
+	_, ok := forma.(*format.Generic)
+	return ok && media.Type == description.MediaTypeApplication
+}
+
+func metadataEncoding(forma *format.Generic) string {
+	return strings.ToLower(strings.Split(forma.RTPMap(), "/")[0])
+}
+
+// metadataMIMEFormat returns the MIME type of a metadata format.
+func metadataMIMEFormat(media *description.Media, forma *format.Generic) string {
+	enc := metadataEncoding(forma)
+	if enc == "" {
+		return "application/octet-stream"
+	}
+	return string(media.Type) + "/" + enc
+}
+
+// metadataIsKLV returns whether a metadata format contains KLV (RFC6597).
+func metadataIsKLV(forma *format.Generic) bool {
+	return metadataEncoding(forma) == "smpte336m"
+}
+
+type metadataUnit struct {
+	pts     time.Duration
+	ntp     time.Time
+	payload []byte
+}
+
+// metadataDecoder reassembles RTP payloads into metadata units.
+// A unit ends when the marker bit is set or when the RTP timestamp changes.
+type metadataDecoder struct {
+	started   bool
+	timestamp uint32
+	cur       metadataUnit
+}
+
+func (d *metadataDecoder) decode(tunit *unit.Generic) ([]*metadataUnit, error) {
+	var ret []*metadataUnit
+
+	for _, pkt := range tunit.RTPPackets {
+		if d.started && pkt.Timestamp != d.timestamp {
+			ret = append(ret, d.flush())
+		}
+
+		if !d.started {
+			d.started = true
+			d.timestamp = pkt.Timestamp
+			d.cur = metadataUnit{
+				pts: tunit.PTS,
+				ntp: tunit.NTP,
+			}
+		}
+
+		if (len(d.cur.payload) + len(pkt.Payload)) > metadataMaxUnitSize {
+			d.started = false
+			return nil, fmt.Errorf("metadata unit size exceeds maximum allowed (%d)", metadataMaxUnitSize)
+		}
+
+		d.cur.payload = append(d.cur.payload, pkt.Payload...)
+
+		if pkt.Marker {
+			ret = append(ret, d.flush())
+		}
+	}
+
+	return ret, nil
+}
+
+func (d *metadataDecoder) flush() *metadataUnit {
+	u := d.cur
+	d.started = false
+	d.cur = metadataUnit{}
+	return &u
+}
@@ -0,0 +1,149 @@
+package record
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// webmSupportsFormat returns whether a format can be stored into WebM files.
+func webmSupportsFormat(forma format.Format) bool {
+	switch forma.(type) {
+	case *format.AV1, *format.VP9, *format.VP8, *format.Opus:
+		return true
+	}
+	return false
+}
+
+type recFormatMKV struct {
+	a    *agentInstance
+	webm bool
+
+	tracks         []*recFormatMKVTrack
+	hasVideo       bool
+	currentSegment *recFormatMKVSegment
+}
+
+func (f *recFormatMKV) initialize() {
+	addTrack := func(codec mkvCodec) *recFormatMKVTrack {
+		track := &recFormatMKVTrack{
+			f:      f,
+			number: len(f.tracks) + 1,
+			codec:  codec,
+		}
+		f.tracks = append(f.tracks, track)
+		return track
+	}
+
+	updateCodecs := func() {
+		// if codec parameters have been updated,
+		// and current segment has already written codec parameters on disk,
+		// close current segment.
+		if f.currentSegment != nil && f.currentSegment.fi != nil {
+			f.currentSegment.close() //nolint:errcheck
+			f.currentSegment = nil
+		}
+	}
+
+	var filter func(forma format.Format) bool
+	if f.webm {
+		filter = webmSupportsFormat
+	}
+
+	setupFMP4Tracks(
+		f.a,
+		filter,
+		func(codec fmp4.Codec) fmp4TrackRecorder {
+			return addTrack(codec)
+		},
+		nil,
+		updateCodecs,
+	)
+
+	for i, media := range f.a.wrapper.Stream.Desc().Medias {
+		for _, forma := range media.Formats {
+			if !f.a.wrapper.recordsFormat(i, media, forma) {
+				continue
+			}
+
+			if forma, ok := forma.(*format.VP8); ok {
+				codec := &mkvCodecVP8{
+					Width:  1280,
+					Height: 720,
+				}
+				track := addTrack(codec)
+
+				firstReceived := false
+
+				f.a.addReader(media, forma, func(u unit.Unit) error {
+					tunit := u.(*unit.VP8)
+					if tunit.Frame == nil {
+						return nil
+					}
+
+					if len(tunit.Frame) < 3 {
+						return fmt.Errorf("invalid VP8 frame")
+					}
+
+					randomAccess := (tunit.Frame[0] & 0x01) == 0
+
+					if randomAccess {
+						// key frame header (RFC6386, section 9.1)
+						if len(tunit.Frame) < 10 {
+							return fmt.Errorf("invalid VP8 frame")
+						}
+
+						w := int(binary.LittleEndian.Uint16(tunit.Frame[6:]) & 0x3FFF)
+						h := int(binary.LittleEndian.Uint16(tunit.Frame[8:]) & 0x3FFF)
+
+						if codec.Width != w || codec.Height != h {
+							codec.Width = w
+							codec.Height = h
+							updateCodecs()
+						}
+					}
+
+					if !firstReceived {
+						if !randomAccess {
+							return nil
+						}
+						firstReceived = true
+					}
+
+					if f.a.wrapper.KeyframesOnly && !randomAccess {
+						return nil
+					}
+
+					return track.record(&sample{
+						PartSample: &fmp4.PartSample{
+							IsNonSyncSample: !randomAccess,
+							Payload:         tunit.Frame,
+						},
+						dts: tunit.PTS,
+						ntp: tunit.NTP,
+					})
+				})
+			}
+		}
+	}
+
+	f.a.wrapper.Log(logger.Info, "recording %d %s",
+		len(f.tracks),
+		func() string {
+			if len(f.tracks) == 1 {
+				return "track"
+			}
+			return "tracks"
+		}())
+}
+
+func (f *recFormatMKV) close() {
+	if f.currentSegment != nil {
+		f.currentSegment.close() //nolint:errcheck
+	}
+}
@@ -0,0 +1,106 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// maximum duration of a cluster, that is limited by the
+// 16-bit relative timestamp of blocks.
+const mkvMaxClusterDuration = 30 * time.Second
+
+func durationGoToMKV(v time.Duration) int64 {
+	return int64(v / time.Millisecond)
+}
+
+type recFormatMKVCluster struct {
+	s        *recFormatMKVSegment
+	startDTS time.Duration
+
+	timestamp      int64
+	timestampElem  []byte
+	blocks         []byte
+	hasCue         bool
+	cueTime        int64
+	cueTrack       int
+	cueRelativePos int
+}
+
+func newRecFormatMKVCluster(s *recFormatMKVSegment, startDTS time.Duration) *recFormatMKVCluster {
+	timestamp := durationGoToMKV(startDTS - s.startDTS)
+
+	return &recFormatMKVCluster{
+		s:             s,
+		startDTS:      startDTS,
+		timestamp:     timestamp,
+		timestampElem: ebmlUint(mkvIDTimestamp, uint64(timestamp)),
+	}
+}
+
+func (c *recFormatMKVCluster) record(track *recFormatMKVTrack, sample *sample) error {
+	pts := sample.dts + time.Duration(sample.PTSOffset)*time.Second/90000
+	ts := durationGoToMKV(pts-c.s.startDTS) - c.timestamp
+
+	if ts < math.MinInt16 || ts > math.MaxInt16 {
+		return fmt.Errorf("block timestamp is out of range")
+	}
+
+	keyframe := !sample.IsNonSyncSample
+
+	if !c.hasCue && keyframe && (track.codec.IsVideo() || !c.s.f.hasVideo) {
+		c.hasCue = true
+		c.cueTime = c.timestamp + ts
+		c.cueTrack = track.number
+		c.cueRelativePos = len(c.timestampElem) + len(c.blocks)
+	}
+
+	payload := make([]byte, 0, 8+4+len(sample.Payload))
+	payload = ebmlAppendSize(payload, uint64(track.number))
+	payload = append(payload, byte(uint16(ts)>>8), byte(uint16(ts)))
+	if keyframe {
+		payload = append(payload, 0x80)
+	} else {
+		payload = append(payload, 0)
+	}
+	payload = append(payload, sample.Payload...)
+
+	c.blocks = append(c.blocks, ebmlElement(mkvIDSimpleBlock, payload)...)
+
+	if end := c.timestamp + ts; end > c.s.endTime {
+		c.s.endTime = end
+	}
+
+	return nil
+}
+
+func (c *recFormatMKVCluster) close() error {
+	if c.s.fi == nil {
+		err := c.s.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	pos, err := c.s.fi.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.s.fi.Write(ebmlMaster(mkvIDCluster, c.timestampElem, c.blocks))
+	if err != nil {
+		return err
+	}
+
+	if c.hasCue {
+		c.s.cues = append(c.s.cues, ebmlMaster(mkvIDCuePoint,
+			ebmlUint(mkvIDCueTime, uint64(c.cueTime)),
+			ebmlMaster(mkvIDCueTrackPositions,
+				ebmlUint(mkvIDCueTrack, uint64(c.cueTrack)),
+				ebmlUint(mkvIDCueClusterPosition, uint64(pos-c.s.dataPos)),
+				ebmlUint(mkvIDCueRelativePosition, uint64(c.cueRelativePos))))...)
+	}
+
+	return nil
+}
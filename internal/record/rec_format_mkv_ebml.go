@@ -0,0 +1,147 @@
+package record
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Matroska element IDs.
+// https://www.matroska.org/technical/elements.html
+const (
+	mkvIDEBML                = 0x1A45DFA3
+	mkvIDEBMLVersion         = 0x4286
+	mkvIDEBMLReadVersion     = 0x42F7
+	mkvIDEBMLMaxIDLength     = 0x42F2
+	mkvIDEBMLMaxSizeLength   = 0x42F3
+	mkvIDDocType             = 0x4282
+	mkvIDDocTypeVersion      = 0x4287
+	mkvIDDocTypeReadVersion  = 0x4285
+	mkvIDSegment             = 0x18538067
+	mkvIDSeekHead            = 0x114D9B74
+	mkvIDSeek                = 0x4DBB
+	mkvIDSeekID              = 0x53AB
+	mkvIDSeekPosition        = 0x53AC
+	mkvIDInfo                = 0x1549A966
+	mkvIDTimestampScale      = 0x2AD7B1
+	mkvIDDuration            = 0x4489
+	mkvIDDateUTC             = 0x4461
+	mkvIDMuxingApp           = 0x4D80
+	mkvIDWritingApp          = 0x5741
+	mkvIDTracks              = 0x1654AE6B
+	mkvIDTrackEntry          = 0xAE
+	mkvIDTrackNumber         = 0xD7
+	mkvIDTrackUID            = 0x73C5
+	mkvIDTrackType           = 0x83
+	mkvIDFlagLacing          = 0x9C
+	mkvIDCodecID             = 0x86
+	mkvIDCodecPrivate        = 0x63A2
+	mkvIDSeekPreRoll         = 0x56BB
+	mkvIDVideo               = 0xE0
+	mkvIDPixelWidth          = 0xB0
+	mkvIDPixelHeight         = 0xBA
+	mkvIDAudio               = 0xE1
+	mkvIDSamplingFrequency   = 0xB5
+	mkvIDChannels            = 0x9F
+	mkvIDBitDepth            = 0x6264
+	mkvIDCluster             = 0x1F43B675
+	mkvIDTimestamp           = 0xE7
+	mkvIDSimpleBlock         = 0xA3
+	mkvIDCues                = 0x1C53BB6B
+	mkvIDCuePoint            = 0xBB
+	mkvIDCueTime             = 0xB3
+	mkvIDCueTrackPositions   = 0xB7
+	mkvIDCueTrack            = 0xF7
+	mkvIDCueClusterPosition  = 0xF1
+	mkvIDCueRelativePosition = 0xF0
+	mkvIDVoid                = 0xEC
+)
+
+func ebmlAppendID(buf []byte, id uint32) []byte {
+	switch {
+	case id >= 1<<24:
+		return append(buf, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+
+	case id >= 1<<16:
+		return append(buf, byte(id>>16), byte(id>>8), byte(id))
+
+	case id >= 1<<8:
+		return append(buf, byte(id>>8), byte(id))
+
+	default:
+		return append(buf, byte(id))
+	}
+}
+
+// ebmlAppendSizeLen appends a variable-size integer with the given length.
+func ebmlAppendSizeLen(buf []byte, size uint64, l int) []byte {
+	size |= 1 << (7 * l)
+	for i := l - 1; i >= 0; i-- {
+		buf = append(buf, byte(size>>(8*i)))
+	}
+	return buf
+}
+
+// ebmlAppendSize appends a variable-size integer with the minimum length.
+func ebmlAppendSize(buf []byte, size uint64) []byte {
+	l := 1
+	// a value with all bits set means "unknown size"
+	for l < 8 && size >= (1<<(7*l))-1 {
+		l++
+	}
+	return ebmlAppendSizeLen(buf, size, l)
+}
+
+func ebmlElement(id uint32, payload []byte) []byte {
+	buf := make([]byte, 0, 4+8+len(payload))
+	buf = ebmlAppendID(buf, id)
+	buf = ebmlAppendSize(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+func ebmlMaster(id uint32, children ...[]byte) []byte {
+	var payload []byte
+	for _, child := range children {
+		payload = append(payload, child...)
+	}
+	return ebmlElement(id, payload)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	l := 1
+	for l < 8 && v >= (1<<(8*l)) {
+		l++
+	}
+	return ebmlUintLen(id, v, l)
+}
+
+// ebmlUintLen encodes an unsigned integer with a fixed length,
+// in order to allow overwriting it.
+func ebmlUintLen(id uint32, v uint64, l int) []byte {
+	payload := make([]byte, l)
+	for i := 0; i < l; i++ {
+		payload[i] = byte(v >> (8 * (l - 1 - i)))
+	}
+	return ebmlElement(id, payload)
+}
+
+func ebmlInt(id uint32, v int64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(v))
+	return ebmlElement(id, payload)
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, math.Float64bits(v))
+	return ebmlElement(id, payload)
+}
+
+func ebmlString(id uint32, v string) []byte {
+	return ebmlElement(id, []byte(v))
+}
+
+// ebmlVoid returns a Void element with the given total length,
+// that is used to reserve space for elements that are written later.
+func ebmlVoid(l int) []byte {
+	return ebmlElement(mkvIDVoid, make([]byte, l-2))
+}
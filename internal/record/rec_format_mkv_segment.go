@@ -0,0 +1,210 @@
+package record
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	mkvSeekLen     = 21
+	mkvDurationLen = 11
+)
+
+// Matroska timestamps are relative to 2001-01-01.
+var mkvDateEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func mkvSeek(id uint32, pos int64) []byte {
+	return ebmlMaster(mkvIDSeek,
+		ebmlElement(mkvIDSeekID, ebmlAppendID(nil, id)),
+		ebmlUintLen(mkvIDSeekPosition, uint64(pos), 8))
+}
+
+type recFormatMKVSegment struct {
+	f        *recFormatMKV
+	startDTS time.Duration
+	endDTS   time.Duration
+
+	created     time.Time
+	fpath       string
+	fi          *os.File
+	dataPos     int64
+	cuesSeekPos int64
+	durationPos int64
+	curCluster  *recFormatMKVCluster
+	cues        []byte
+	endTime     int64
+}
+
+func newRecFormatMKVSegment(f *recFormatMKV, startDTS time.Duration, startNTP time.Time) *recFormatMKVSegment {
+	return &recFormatMKVSegment{
+		f:        f,
+		startDTS: startDTS,
+		endDTS:   f.a.wrapper.segmentEndDTS(startDTS, startNTP),
+		created:  segmentCreationTime(startNTP),
+	}
+}
+
+func (s *recFormatMKVSegment) close() error {
+	var err error
+
+	if s.curCluster != nil {
+		err = s.curCluster.close()
+	}
+
+	if s.fi != nil {
+		s.f.a.wrapper.Log(logger.Debug, "closing segment %s", s.fpath)
+
+		if err == nil {
+			err = s.finalize()
+		}
+
+		err2 := s.fi.Close()
+		if err == nil {
+			err = err2
+		}
+
+		if err2 == nil {
+			s.f.a.wrapper.segmentComplete(s.fpath)
+		}
+	}
+
+	return err
+}
+
+func (s *recFormatMKVSegment) record(track *recFormatMKVTrack, sample *sample) error {
+	if s.curCluster == nil {
+		s.curCluster = newRecFormatMKVCluster(s, sample.dts)
+	} else if d := sample.dts - s.curCluster.startDTS; d >= s.f.a.wrapper.PartDuration || d >= mkvMaxClusterDuration {
+		err := s.curCluster.close()
+		s.curCluster = nil
+
+		if err != nil {
+			return err
+		}
+
+		s.curCluster = newRecFormatMKVCluster(s, sample.dts)
+	}
+
+	return s.curCluster.record(track, sample)
+}
+
+func (s *recFormatMKVSegment) open() error {
+	s.fpath = encodeRecordPath(&recordPathParams{time: s.created}, s.f.a.resolvedPath)
+	s.f.a.wrapper.Log(logger.Debug, "creating segment %s", s.fpath)
+
+	err := os.MkdirAll(filepath.Dir(s.fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Create(s.fpath)
+	if err != nil {
+		return err
+	}
+
+	s.f.a.wrapper.OnSegmentCreate(s.fpath)
+
+	s.fi = fi
+
+	header, err := s.marshalHeader()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.fi.Write(header)
+	return err
+}
+
+// marshalHeader returns the EBML header and the beginning of the Segment element.
+// The Segment size, the position of Cues and the Duration are unknown
+// and are written when the segment is closed.
+func (s *recFormatMKVSegment) marshalHeader() ([]byte, error) {
+	docType := "matroska"
+	docTypeVersion := uint64(4)
+	if s.f.webm {
+		docType = "webm"
+		docTypeVersion = 2
+	}
+
+	buf := ebmlMaster(mkvIDEBML,
+		ebmlUint(mkvIDEBMLVersion, 1),
+		ebmlUint(mkvIDEBMLReadVersion, 1),
+		ebmlUint(mkvIDEBMLMaxIDLength, 4),
+		ebmlUint(mkvIDEBMLMaxSizeLength, 8),
+		ebmlString(mkvIDDocType, docType),
+		ebmlUint(mkvIDDocTypeVersion, docTypeVersion),
+		ebmlUint(mkvIDDocTypeReadVersion, 2))
+
+	// Segment with unknown size
+	buf = ebmlAppendID(buf, mkvIDSegment)
+	buf = append(buf, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	s.dataPos = int64(len(buf))
+
+	info := ebmlMaster(mkvIDInfo,
+		ebmlUint(mkvIDTimestampScale, uint64(time.Millisecond)),
+		ebmlString(mkvIDMuxingApp, "mediamtx"),
+		ebmlString(mkvIDWritingApp, "mediamtx"),
+		ebmlInt(mkvIDDateUTC, int64(s.created.Sub(mkvDateEpoch))),
+		ebmlVoid(mkvDurationLen))
+
+	var tracks [][]byte
+	for _, track := range s.f.tracks {
+		entry, err := track.marshalEntry()
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, entry)
+	}
+
+	// the SeekHead has a fixed size: 3 entries of 21 bytes, plus ID and size.
+	seekHeadLen := int64(4 + 1 + 3*mkvSeekLen)
+
+	buf = append(buf, ebmlMaster(mkvIDSeekHead,
+		mkvSeek(mkvIDInfo, seekHeadLen),
+		mkvSeek(mkvIDTracks, seekHeadLen+int64(len(info))),
+		ebmlVoid(mkvSeekLen))...)
+	s.cuesSeekPos = int64(len(buf)) - mkvSeekLen
+
+	buf = append(buf, info...)
+	s.durationPos = int64(len(buf)) - mkvDurationLen
+
+	buf = append(buf, ebmlMaster(mkvIDTracks, tracks...)...)
+
+	return buf, nil
+}
+
+// finalize writes Cues and fills the fields that are unknown when the segment is created.
+func (s *recFormatMKVSegment) finalize() error {
+	pos, err := s.fi.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if s.cues != nil {
+		cues := ebmlElement(mkvIDCues, s.cues)
+
+		_, err = s.fi.Write(cues)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.fi.WriteAt(mkvSeek(mkvIDCues, pos-s.dataPos), s.cuesSeekPos)
+		if err != nil {
+			return err
+		}
+
+		pos += int64(len(cues))
+	}
+
+	_, err = s.fi.WriteAt(ebmlAppendSizeLen(nil, uint64(pos-s.dataPos), 8), s.dataPos-8)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.fi.WriteAt(ebmlFloat(mkvIDDuration, float64(s.endTime)), s.durationPos)
+	return err
+}
@@ -0,0 +1,338 @@
+package record
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/abema/go-mp4"
+	"github.com/aler9/writerseeker"
+	"github.com/bluenviron/mediacommon/pkg/codecs/av1"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg1audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+const (
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+)
+
+// mkvCodec is the codec of a Matroska track.
+// It's either a fmp4.Codec or a codec that is not supported by fMP4.
+type mkvCodec interface {
+	IsVideo() bool
+}
+
+// mkvCodecVP8 is a VP8 codec.
+type mkvCodecVP8 struct {
+	Width  int
+	Height int
+}
+
+// IsVideo implements mkvCodec.
+func (*mkvCodecVP8) IsVideo() bool {
+	return true
+}
+
+func boolToUint8(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// mp4BoxPayload returns the payload of a box, without header.
+func mp4BoxPayload(box mp4.IImmutableBox) ([]byte, error) {
+	var ws writerseeker.WriterSeeker
+	_, err := mp4.Marshal(&ws, box, mp4.Context{})
+	if err != nil {
+		return nil, err
+	}
+	return ws.Bytes(), nil
+}
+
+// opusHead returns an Opus identification header (RFC7845, 5.1).
+func opusHead(channelCount int) []byte {
+	buf := make([]byte, 19)
+	copy(buf, "OpusHead")
+	buf[8] = 1 // version
+	buf[9] = byte(channelCount)
+	binary.LittleEndian.PutUint32(buf[12:], 48000)
+	return buf
+}
+
+type recFormatMKVTrack struct {
+	f      *recFormatMKV
+	number int
+	codec  mkvCodec
+
+	mpeg1AudioLayer uint8
+}
+
+func (t *recFormatMKVTrack) record(sample *sample) error {
+	if t.codec.IsVideo() {
+		t.f.hasVideo = true
+	}
+
+	if _, ok := t.codec.(*fmp4.CodecMPEG1Audio); ok && t.mpeg1AudioLayer == 0 {
+		var h mpeg1audio.FrameHeader
+		err := h.Unmarshal(sample.Payload)
+		if err != nil {
+			return err
+		}
+		t.mpeg1AudioLayer = h.Layer
+	}
+
+	if t.f.currentSegment == nil {
+		t.f.currentSegment = newRecFormatMKVSegment(t.f, sample.dts, sample.ntp)
+	} else if (!t.f.hasVideo || t.codec.IsVideo()) &&
+		!sample.IsNonSyncSample &&
+		sample.dts >= t.f.currentSegment.endDTS {
+		err := t.f.currentSegment.close()
+		if err != nil {
+			return err
+		}
+
+		t.f.currentSegment = newRecFormatMKVSegment(t.f, sample.dts, sample.ntp)
+	}
+
+	return t.f.currentSegment.record(t, sample)
+}
+
+func (t *recFormatMKVTrack) marshalEntry() ([]byte, error) {
+	var codecID string
+	var codecPrivate []byte
+	var width int
+	var height int
+	var sampleRate int
+	var channelCount int
+	var bitDepth int
+	var seekPreRoll uint64
+
+	switch codec := t.codec.(type) {
+	case *fmp4.CodecAV1:
+		var sh av1.SequenceHeader
+		err := sh.Unmarshal(codec.SequenceHeader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse AV1 sequence header: %v", err)
+		}
+
+		bs, err := av1.BitstreamMarshal([][]byte{codec.SequenceHeader})
+		if err != nil {
+			return nil, err
+		}
+
+		codecPrivate, err = mp4BoxPayload(&mp4.Av1C{
+			Marker:               1,
+			Version:              1,
+			SeqProfile:           sh.SeqProfile,
+			SeqLevelIdx0:         sh.SeqLevelIdx[0],
+			SeqTier0:             boolToUint8(sh.SeqTier[0]),
+			HighBitdepth:         boolToUint8(sh.ColorConfig.HighBitDepth),
+			TwelveBit:            boolToUint8(sh.ColorConfig.TwelveBit),
+			Monochrome:           boolToUint8(sh.ColorConfig.MonoChrome),
+			ChromaSubsamplingX:   boolToUint8(sh.ColorConfig.SubsamplingX),
+			ChromaSubsamplingY:   boolToUint8(sh.ColorConfig.SubsamplingY),
+			ChromaSamplePosition: uint8(sh.ColorConfig.ChromaSamplePosition),
+			ConfigOBUs:           bs,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		codecID = "V_AV1"
+		width = sh.Width()
+		height = sh.Height()
+
+	case *fmp4.CodecVP9:
+		codecID = "V_VP9"
+		width = codec.Width
+		height = codec.Height
+
+	case *mkvCodecVP8:
+		codecID = "V_VP8"
+		width = codec.Width
+		height = codec.Height
+
+	case *fmp4.CodecH265:
+		var sps h265.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H265 SPS: %v", err)
+		}
+
+		codecPrivate, err = mp4BoxPayload(&mp4.HvcC{
+			ConfigurationVersion:        1,
+			GeneralProfileIdc:           sps.ProfileTierLevel.GeneralProfileIdc,
+			GeneralProfileCompatibility: sps.ProfileTierLevel.GeneralProfileCompatibilityFlag,
+			GeneralConstraintIndicator: [6]uint8{
+				codec.SPS[7], codec.SPS[8], codec.SPS[9],
+				codec.SPS[10], codec.SPS[11], codec.SPS[12],
+			},
+			GeneralLevelIdc:      sps.ProfileTierLevel.GeneralLevelIdc,
+			ChromaFormatIdc:      uint8(sps.ChromaFormatIdc),
+			BitDepthLumaMinus8:   uint8(sps.BitDepthLumaMinus8),
+			BitDepthChromaMinus8: uint8(sps.BitDepthChromaMinus8),
+			NumTemporalLayers:    1,
+			LengthSizeMinusOne:   3,
+			NumOfNaluArrays:      3,
+			NaluArrays: []mp4.HEVCNaluArray{
+				{
+					NaluType: byte(h265.NALUType_VPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.VPS)), NALUnit: codec.VPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_SPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_PPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS}},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		codecID = "V_MPEGH/ISO/HEVC"
+		width = sps.Width()
+		height = sps.Height()
+
+	case *fmp4.CodecH264:
+		var sps h264.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H264 SPS: %v", err)
+		}
+
+		codecPrivate, err = mp4BoxPayload(&mp4.AVCDecoderConfiguration{
+			AnyTypeBox: mp4.AnyTypeBox{
+				Type: mp4.BoxTypeAvcC(),
+			},
+			ConfigurationVersion:       1,
+			Profile:                    sps.ProfileIdc,
+			ProfileCompatibility:       codec.SPS[2],
+			Level:                      sps.LevelIdc,
+			LengthSizeMinusOne:         3,
+			NumOfSequenceParameterSets: 1,
+			SequenceParameterSets: []mp4.AVCParameterSet{
+				{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS},
+			},
+			NumOfPictureParameterSets: 1,
+			PictureParameterSets: []mp4.AVCParameterSet{
+				{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		codecID = "V_MPEG4/ISO/AVC"
+		width = sps.Width()
+		height = sps.Height()
+
+	case *fmp4.CodecMPEG4Video:
+		codecID = "V_MPEG4/ISO/ASP"
+		codecPrivate = codec.Config
+		width = 800 // TODO: parse config and use real values
+		height = 600
+
+	case *fmp4.CodecMPEG1Video:
+		codecID = "V_MPEG2"
+		codecPrivate = codec.Config
+		width = 800 // TODO: parse config and use real values
+		height = 600
+
+	case *fmp4.CodecMJPEG:
+		codecID = "V_MJPEG"
+		width = codec.Width
+		height = codec.Height
+
+	case *fmp4.CodecOpus:
+		codecID = "A_OPUS"
+		codecPrivate = opusHead(codec.ChannelCount)
+		sampleRate = 48000
+		channelCount = codec.ChannelCount
+		seekPreRoll = 80000000
+
+	case *fmp4.CodecMPEG4Audio:
+		var err error
+		codecPrivate, err = codec.Config.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		codecID = "A_AAC"
+		sampleRate = codec.SampleRate
+		channelCount = codec.ChannelCount
+
+	case *fmp4.CodecMPEG1Audio:
+		if t.mpeg1AudioLayer == 2 {
+			codecID = "A_MPEG/L2"
+		} else {
+			codecID = "A_MPEG/L3"
+		}
+		sampleRate = codec.SampleRate
+		channelCount = codec.ChannelCount
+
+	case *fmp4.CodecAC3:
+		codecID = "A_AC3"
+		sampleRate = codec.SampleRate
+		channelCount = codec.ChannelCount
+
+	case *fmp4.CodecLPCM:
+		if codec.LittleEndian {
+			codecID = "A_PCM/INT/LIT"
+		} else {
+			codecID = "A_PCM/INT/BIG"
+		}
+		sampleRate = codec.SampleRate
+		channelCount = codec.ChannelCount
+		bitDepth = codec.BitDepth
+
+	default:
+		return nil, fmt.Errorf("unsupported codec: %T", t.codec)
+	}
+
+	children := [][]byte{
+		ebmlUint(mkvIDTrackNumber, uint64(t.number)),
+		ebmlUint(mkvIDTrackUID, uint64(t.number)),
+		ebmlUint(mkvIDFlagLacing, 0),
+		ebmlString(mkvIDCodecID, codecID),
+	}
+
+	if codecPrivate != nil {
+		children = append(children, ebmlElement(mkvIDCodecPrivate, codecPrivate))
+	}
+
+	if seekPreRoll != 0 {
+		children = append(children, ebmlUint(mkvIDSeekPreRoll, seekPreRoll))
+	}
+
+	if t.codec.IsVideo() {
+		children = append(children,
+			ebmlUint(mkvIDTrackType, mkvTrackTypeVideo),
+			ebmlMaster(mkvIDVideo,
+				ebmlUint(mkvIDPixelWidth, uint64(width)),
+				ebmlUint(mkvIDPixelHeight, uint64(height))))
+	} else {
+		audio := [][]byte{
+			ebmlFloat(mkvIDSamplingFrequency, float64(sampleRate)),
+			ebmlUint(mkvIDChannels, uint64(channelCount)),
+		}
+		if bitDepth != 0 {
+			audio = append(audio, ebmlUint(mkvIDBitDepth, uint64(bitDepth)))
+		}
+
+		children = append(children,
+			ebmlUint(mkvIDTrackType, mkvTrackTypeAudio),
+			ebmlMaster(mkvIDAudio, audio...))
+	}
+
+	return ebmlMaster(mkvIDTrackEntry, children...), nil
+}
@@ -43,6 +43,7 @@ type recFormatMPEGTS struct {
 
 	dw             *dynamicWriter
 	bw             *bufio.Writer
+	pw             io.Writer
 	mw             *mpegts.Writer
 	hasVideo       bool
 	currentSegment *recFormatMPEGTSSegment
@@ -50,6 +51,7 @@ type recFormatMPEGTS struct {
 
 func (f *recFormatMPEGTS) initialize() {
 	var tracks []*mpegts.Track
+	var metadataTracks []*recFormatMPEGTSMetadataTrack
 
 	addTrack := func(codec mpegts.Codec) *mpegts.Track {
 		track := &mpegts.Track{
@@ -59,15 +61,19 @@ func (f *recFormatMPEGTS) initialize() {
 		return track
 	}
 
-	for _, media := range f.a.wrapper.Stream.Desc().Medias {
+	for i, media := range f.a.wrapper.Stream.Desc().Medias {
 		for _, forma := range media.Formats {
+			if !f.a.wrapper.recordsFormat(i, media, forma) {
+				continue
+			}
+
 			switch forma := forma.(type) {
 			case *format.H265:
 				track := addTrack(&mpegts.CodecH265{})
 
 				var dtsExtractor *h265.DTSExtractor
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.H265)
 					if tunit.AU == nil {
 						return nil
@@ -87,7 +93,8 @@ func (f *recFormatMPEGTS) initialize() {
 						return err
 					}
 
-					return f.recordH26x(track, dts, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
+					return f.recordH26x(track, dts, tunit.NTP,
+						durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
 				})
 
 			case *format.H264:
@@ -95,7 +102,7 @@ func (f *recFormatMPEGTS) initialize() {
 
 				var dtsExtractor *h264.DTSExtractor
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.H264)
 					if tunit.AU == nil {
 						return nil
@@ -115,7 +122,8 @@ func (f *recFormatMPEGTS) initialize() {
 						return err
 					}
 
-					return f.recordH26x(track, dts, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), idrPresent, tunit.AU)
+					return f.recordH26x(track, dts, tunit.NTP,
+						durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), idrPresent, tunit.AU)
 				})
 
 			case *format.MPEG4Video:
@@ -124,7 +132,7 @@ func (f *recFormatMPEGTS) initialize() {
 				firstReceived := false
 				var lastPTS time.Duration
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG4Video)
 					if tunit.Frame == nil {
 						return nil
@@ -140,7 +148,11 @@ func (f *recFormatMPEGTS) initialize() {
 					f.hasVideo = true
 					randomAccess := bytes.Contains(tunit.Frame, []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)})
 
-					err := f.setupSegment(tunit.PTS, true, randomAccess)
+					if f.a.wrapper.KeyframesOnly && !randomAccess {
+						return nil
+					}
+
+					err := f.setupSegment(tunit.PTS, tunit.NTP, true, randomAccess)
 					if err != nil {
 						return err
 					}
@@ -154,7 +166,7 @@ func (f *recFormatMPEGTS) initialize() {
 				firstReceived := false
 				var lastPTS time.Duration
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG1Video)
 					if tunit.Frame == nil {
 						return nil
@@ -170,7 +182,11 @@ func (f *recFormatMPEGTS) initialize() {
 					f.hasVideo = true
 					randomAccess := bytes.Contains(tunit.Frame, []byte{0, 0, 1, 0xB8})
 
-					err := f.setupSegment(tunit.PTS, true, randomAccess)
+					if f.a.wrapper.KeyframesOnly && !randomAccess {
+						return nil
+					}
+
+					err := f.setupSegment(tunit.PTS, tunit.NTP, true, randomAccess)
 					if err != nil {
 						return err
 					}
@@ -188,13 +204,13 @@ func (f *recFormatMPEGTS) initialize() {
 					}(),
 				})
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.Opus)
 					if tunit.Packets == nil {
 						return nil
 					}
 
-					err := f.setupSegment(tunit.PTS, false, true)
+					err := f.setupSegment(tunit.PTS, tunit.NTP, false, true)
 					if err != nil {
 						return err
 					}
@@ -207,13 +223,13 @@ func (f *recFormatMPEGTS) initialize() {
 					Config: *forma.GetConfig(),
 				})
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG4Audio)
 					if tunit.AUs == nil {
 						return nil
 					}
 
-					err := f.setupSegment(tunit.PTS, false, true)
+					err := f.setupSegment(tunit.PTS, tunit.NTP, false, true)
 					if err != nil {
 						return err
 					}
@@ -224,13 +240,13 @@ func (f *recFormatMPEGTS) initialize() {
 			case *format.MPEG1Audio:
 				track := addTrack(&mpegts.CodecMPEG1Audio{})
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.MPEG1Audio)
 					if tunit.Frames == nil {
 						return nil
 					}
 
-					err := f.setupSegment(tunit.PTS, false, true)
+					err := f.setupSegment(tunit.PTS, tunit.NTP, false, true)
 					if err != nil {
 						return err
 					}
@@ -243,7 +259,7 @@ func (f *recFormatMPEGTS) initialize() {
 
 				sampleRate := time.Duration(forma.SampleRate)
 
-				f.a.wrapper.Stream.AddReader(f.a.writer, media, forma, func(u unit.Unit) error {
+				f.a.addReader(media, forma, func(u unit.Unit) error {
 					tunit := u.(*unit.AC3)
 					if tunit.Frames == nil {
 						return nil
@@ -259,6 +275,39 @@ func (f *recFormatMPEGTS) initialize() {
 						}
 					}
 
+					return nil
+				})
+
+			case *format.Generic:
+				if !isMetadataFormat(media, forma) {
+					continue
+				}
+
+				track := &recFormatMPEGTSMetadataTrack{
+					klv: metadataIsKLV(forma),
+				}
+				metadataTracks = append(metadataTracks, track)
+
+				var dec metadataDecoder
+
+				f.a.addReader(media, forma, func(u unit.Unit) error {
+					units, err := dec.decode(u.(*unit.Generic))
+					if err != nil {
+						return err
+					}
+
+					// metadata is written into segments created by audio and video tracks
+					if f.currentSegment == nil {
+						return nil
+					}
+
+					for _, mu := range units {
+						err = track.write(f.pw, durationGoToMPEGTS(mu.pts), mu.payload)
+						if err != nil {
+							return err
+						}
+					}
+
 					return nil
 				})
 			}
@@ -267,12 +316,28 @@ func (f *recFormatMPEGTS) initialize() {
 
 	f.dw = &dynamicWriter{}
 	f.bw = bufio.NewWriterSize(f.dw, mpegtsMaxBufferSize)
-	f.mw = mpegts.NewWriter(f.bw, tracks)
+	f.pw = f.bw
+
+	if len(metadataTracks) != 0 {
+		// mpegts.Writer assigns PIDs sequentially, starting from 256
+		for i, track := range metadataTracks {
+			track.pid = uint16(256 + len(tracks) + i)
+		}
+
+		f.pw = &mpegtsPMTPatcher{
+			w:      f.bw,
+			tracks: metadataTracks,
+		}
+	}
+
+	f.mw = mpegts.NewWriter(f.pw, tracks)
+
+	trackCount := len(tracks) + len(metadataTracks)
 
 	f.a.wrapper.Log(logger.Info, "recording %d %s",
-		len(tracks),
+		trackCount,
 		func() string {
-			if len(tracks) == 1 {
+			if trackCount == 1 {
 				return "track"
 			}
 			return "tracks"
@@ -285,20 +350,20 @@ func (f *recFormatMPEGTS) close() {
 	}
 }
 
-func (f *recFormatMPEGTS) setupSegment(dts time.Duration, isVideo bool, randomAccess bool) error {
+func (f *recFormatMPEGTS) setupSegment(dts time.Duration, ntp time.Time, isVideo bool, randomAccess bool) error {
 	switch {
 	case f.currentSegment == nil:
-		f.currentSegment = newRecFormatMPEGTSSegment(f, dts)
+		f.currentSegment = newRecFormatMPEGTSSegment(f, dts, ntp)
 
 	case (!f.hasVideo || isVideo) &&
 		randomAccess &&
-		(dts-f.currentSegment.startDTS) >= f.a.wrapper.SegmentDuration:
+		dts >= f.currentSegment.endDTS:
 		err := f.currentSegment.close()
 		if err != nil {
 			return err
 		}
 
-		f.currentSegment = newRecFormatMPEGTSSegment(f, dts)
+		f.currentSegment = newRecFormatMPEGTSSegment(f, dts, ntp)
 
 	case (dts - f.currentSegment.lastFlush) >= f.a.wrapper.PartDuration:
 		err := f.bw.Flush()
@@ -312,12 +377,16 @@ func (f *recFormatMPEGTS) setupSegment(dts time.Duration, isVideo bool, randomAc
 	return nil
 }
 
-func (f *recFormatMPEGTS) recordH26x(track *mpegts.Track, goDTS time.Duration,
+func (f *recFormatMPEGTS) recordH26x(track *mpegts.Track, goDTS time.Duration, ntp time.Time,
 	pts int64, dts int64, randomAccess bool, au [][]byte,
 ) error {
 	f.hasVideo = true
 
-	err := f.setupSegment(goDTS, true, randomAccess)
+	if f.a.wrapper.KeyframesOnly && !randomAccess {
+		return nil
+	}
+
+	err := f.setupSegment(goDTS, ntp, true, randomAccess)
 	if err != nil {
 		return err
 	}
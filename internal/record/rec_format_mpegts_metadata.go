@@ -0,0 +1,201 @@
+package record
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	mpegtsPacketSize = 188
+
+	// PID of the PMT written by astits, that is used by mpegts.Writer
+	mpegtsPMTPID = 0x1000
+
+	mpegtsStreamTypePrivateData  = 0x06
+	mpegtsStreamIDPrivateStream1 = 0xBD
+)
+
+func mpegtsCRC32(byts []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range byts {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if (crc & 0x80000000) != 0 {
+				crc = (crc << 1) ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// recFormatMPEGTSMetadataTrack is a metadata track,
+// written as a private data stream since it's not supported by mpegts.Writer.
+type recFormatMPEGTSMetadataTrack struct {
+	pid uint16
+	klv bool
+
+	cc uint8
+}
+
+// pmtEntry returns the entry of the track in the elementary stream loop of the PMT.
+func (t *recFormatMPEGTSMetadataTrack) pmtEntry() []byte {
+	var descriptors []byte
+	if t.klv {
+		// registration descriptor (MISB ST 1402)
+		descriptors = []byte{0x05, 4, 'K', 'L', 'V', 'A'}
+	}
+
+	return append([]byte{
+		mpegtsStreamTypePrivateData,
+		0xE0 | byte(t.pid>>8), byte(t.pid),
+		0xF0 | byte(len(descriptors)>>8), byte(len(descriptors)),
+	}, descriptors...)
+}
+
+// write writes a metadata unit as a PES packet, split into TS packets.
+func (t *recFormatMPEGTSMetadataTrack) write(w io.Writer, pts int64, data []byte) error {
+	pesLen := 8 + len(data)
+	if pesLen > 0xFFFF {
+		pesLen = 0
+	}
+
+	payload := make([]byte, 14+len(data))
+	payload[2] = 1
+	payload[3] = mpegtsStreamIDPrivateStream1
+	payload[4] = byte(pesLen >> 8)
+	payload[5] = byte(pesLen)
+	payload[6] = 0x84 // marker bits, data alignment indicator
+	payload[7] = 0x80 // PTS only
+	payload[8] = 5
+	payload[9] = 0x21 | byte((pts>>29)&0x0E)
+	payload[10] = byte(pts >> 22)
+	payload[11] = byte((pts>>14)&0xFE) | 1
+	payload[12] = byte(pts >> 7)
+	payload[13] = byte(pts<<1) | 1
+	copy(payload[14:], data)
+
+	start := true
+
+	for len(payload) > 0 {
+		var pkt [mpegtsPacketSize]byte
+		pkt[0] = 0x47
+		pkt[1] = byte(t.pid>>8) & 0x1F
+		if start {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(t.pid)
+
+		if len(payload) >= (mpegtsPacketSize - 4) {
+			pkt[3] = 0x10 | t.cc
+			payload = payload[copy(pkt[4:], payload):]
+		} else {
+			// fill the packet with an adaptation field
+			pkt[3] = 0x30 | t.cc
+			afLen := mpegtsPacketSize - 4 - 1 - len(payload)
+			pkt[4] = byte(afLen)
+			for i := 6; i < (5 + afLen); i++ {
+				pkt[i] = 0xFF
+			}
+			copy(pkt[5+afLen:], payload)
+			payload = nil
+		}
+
+		t.cc = (t.cc + 1) & 0x0F
+		start = false
+
+		_, err := w.Write(pkt[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mpegtsPMTPatcher is placed after mpegts.Writer
+// and adds metadata tracks to the PMT.
+type mpegtsPMTPatcher struct {
+	w      io.Writer
+	tracks []*recFormatMPEGTSMetadataTrack
+
+	buf [mpegtsPacketSize]byte
+	n   int
+}
+
+func (p *mpegtsPMTPatcher) Write(byts []byte) (int, error) {
+	written := 0
+
+	for len(byts) > 0 {
+		c := copy(p.buf[p.n:], byts)
+		p.n += c
+		byts = byts[c:]
+
+		if p.n == mpegtsPacketSize {
+			p.n = 0
+
+			err := p.patch(p.buf[:])
+			if err != nil {
+				return written, err
+			}
+
+			_, err = p.w.Write(p.buf[:])
+			if err != nil {
+				return written, err
+			}
+		}
+
+		written += c
+	}
+
+	return written, nil
+}
+
+func (p *mpegtsPMTPatcher) patch(pkt []byte) error {
+	pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+	if pid != mpegtsPMTPID || (pkt[1]&0x40) == 0 {
+		return nil
+	}
+
+	pos := 4
+	if (pkt[3] & 0x20) != 0 {
+		pos += 1 + int(pkt[4])
+	}
+	pos += 1 + int(pkt[pos]) // pointer field
+
+	if (pos+3) > mpegtsPacketSize || pkt[pos] != 0x02 {
+		return fmt.Errorf("invalid PMT")
+	}
+
+	sectionLen := int(pkt[pos+1]&0x0F)<<8 | int(pkt[pos+2])
+	crcPos := pos + 3 + sectionLen - 4
+
+	var entries []byte
+	for _, track := range p.tracks {
+		entries = append(entries, track.pmtEntry()...)
+	}
+
+	if (crcPos + len(entries) + 4) > mpegtsPacketSize {
+		return fmt.Errorf("PMT is too big")
+	}
+
+	copy(pkt[crcPos:], entries)
+	crcPos += len(entries)
+	sectionLen += len(entries)
+
+	pkt[pos+1] = (pkt[pos+1] & 0xF0) | byte(sectionLen>>8)
+	pkt[pos+2] = byte(sectionLen)
+
+	crc := mpegtsCRC32(pkt[pos:crcPos])
+	pkt[crcPos] = byte(crc >> 24)
+	pkt[crcPos+1] = byte(crc >> 16)
+	pkt[crcPos+2] = byte(crc >> 8)
+	pkt[crcPos+3] = byte(crc)
+
+	for i := crcPos + 4; i < mpegtsPacketSize; i++ {
+		pkt[i] = 0xFF
+	}
+
+	return nil
+}
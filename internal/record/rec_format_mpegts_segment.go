@@ -11,6 +11,7 @@ import (
 type recFormatMPEGTSSegment struct {
 	f         *recFormatMPEGTS
 	startDTS  time.Duration
+	endDTS    time.Duration
 	lastFlush time.Duration
 
 	created time.Time
@@ -18,12 +19,13 @@ type recFormatMPEGTSSegment struct {
 	fi      *os.File
 }
 
-func newRecFormatMPEGTSSegment(f *recFormatMPEGTS, startDTS time.Duration) *recFormatMPEGTSSegment {
+func newRecFormatMPEGTSSegment(f *recFormatMPEGTS, startDTS time.Duration, startNTP time.Time) *recFormatMPEGTSSegment {
 	s := &recFormatMPEGTSSegment{
 		f:         f,
 		startDTS:  startDTS,
+		endDTS:    f.a.wrapper.segmentEndDTS(startDTS, startNTP),
 		lastFlush: startDTS,
-		created:   timeNow(),
+		created:   segmentCreationTime(startNTP),
 	}
 
 	f.dw.setTarget(s)
@@ -42,7 +44,7 @@ func (s *recFormatMPEGTSSegment) close() error {
 		}
 
 		if err2 == nil {
-			s.f.a.wrapper.OnSegmentComplete(s.fpath)
+			s.f.a.wrapper.segmentComplete(s.fpath)
 		}
 	}
 
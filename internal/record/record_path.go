@@ -56,7 +56,7 @@ func decodeRecordPath(format string, v string) *recordPathParams {
 	re = strings.ReplaceAll(re, "%M", "([0-9]{2})")
 	re = strings.ReplaceAll(re, "%S", "([0-9]{2})")
 	re = strings.ReplaceAll(re, "%f", "([0-9]{6})")
-	r := regexp.MustCompile(re)
+	r := regexp.MustCompile(re + "$")
 
 	var groupMapping []string
 	cur := format
@@ -0,0 +1,127 @@
+package record
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// OnRecoveredSegmentFunc is the prototype of the function passed to RecoverSegments.
+type OnRecoveredSegmentFunc = func(pathName string, segmentPath string)
+
+// RecoverSegments finds fMP4 segments that have not been completed,
+// because the process has been killed while writing them.
+// Segments are truncated to the last complete part, their index is rebuilt
+// and onRecovered is called for each of them.
+// Indexes of completed segments that don't have one are rebuilt too.
+func RecoverSegments(
+	recordPath string,
+	parent logger.Writer,
+	onRecovered OnRecoveredSegmentFunc,
+) {
+	recordPath, _ = filepath.Abs(recordPath)
+	recordPath += ".mp4"
+
+	filepath.Walk(commonPath(recordPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+		if err != nil {
+			// indexes of removed segments are listed but don't exist anymore
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		params := decodeRecordPath(recordPath, fpath)
+		if params == nil {
+			return nil
+		}
+
+		// segments recorded before indexes were introduced, or left by a crash that
+		// happened before the index was created, don't have an index, that is rebuilt.
+		var old SegmentIndex
+		hasIndex := false
+
+		byts, err := os.ReadFile(SegmentIndexPath(fpath))
+		if err == nil {
+			var complete bool
+			complete, err = old.unmarshal(byts)
+			if err == nil && complete {
+				return nil
+			}
+			hasIndex = true
+		}
+
+		index, truncated, err := recoverSegment(fpath, params, old)
+		if err != nil {
+			parent.Log(logger.Warn, "unable to recover segment %s: %v", fpath, err)
+			return nil
+		}
+
+		if index == nil {
+			parent.Log(logger.Warn, "removed incomplete segment %s, since it contains no parts", fpath)
+			return nil
+		}
+
+		// a segment without index that ends with a complete part has been completed.
+		if !hasIndex && !truncated {
+			parent.Log(logger.Info, "rebuilt index of segment %s", fpath)
+			return nil
+		}
+
+		parent.Log(logger.Info, "recovered incomplete segment %s (%d parts)", fpath, len(index))
+		onRecovered(params.path, fpath)
+
+		return nil
+	})
+}
+
+// recoverSegment truncates a segment to its last complete part and writes its index.
+// It returns the index and whether the segment has been truncated.
+func recoverSegment(fpath string, params *recordPathParams, old SegmentIndex) (SegmentIndex, bool, error) {
+	index, err := BuildSegmentIndex(fpath, params.time)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(index) == 0 {
+		os.Remove(fpath)
+		os.Remove(SegmentIndexPath(fpath))
+		return nil, false, nil
+	}
+
+	// keep absolute times written by the recorder
+	for i := range index {
+		if i < len(old) && old[i].Offset == index[i].Offset {
+			index[i].NTP = old[i].NTP
+		}
+	}
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	last := index[len(index)-1]
+	size := int64(last.Offset + last.Size)
+	truncated := (fi.Size() != size)
+
+	if truncated {
+		err = os.Truncate(fpath, size)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = os.WriteFile(SegmentIndexPath(fpath), index.Marshal(), 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return index, truncated, nil
+}
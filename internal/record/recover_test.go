@@ -0,0 +1,115 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverSegments(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recover")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+	ntp := time.Date(2010, 0o5, 20, 22, 15, 25, 0, time.UTC)
+
+	completePath := recordTestSegment(t, recordPath, ntp)
+
+	byts, err := os.ReadFile(completePath)
+	require.NoError(t, err)
+
+	index, err := ReadSegmentIndex(completePath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(index))
+
+	// segment whose last part has been partially written
+	crashedPath := filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000000.mp4")
+
+	err = os.WriteFile(crashedPath, byts[:index[2].Offset+index[2].Size/2], 0o644)
+	require.NoError(t, err)
+
+	idx := SegmentIndex(index[:2]).Marshal()
+	err = os.WriteFile(SegmentIndexPath(crashedPath), idx[:len(idx)-segmentIndexEntryLen], 0o644)
+	require.NoError(t, err)
+
+	// segment without parts
+	emptyPath := filepath.Join(dir, "mypath", "2009-05-21_22-15-25-000000.mp4")
+
+	err = os.WriteFile(emptyPath, byts[:index[0].Offset], 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(SegmentIndexPath(emptyPath), idx[:segmentIndexHeaderLen], 0o644)
+	require.NoError(t, err)
+
+	// segment without index, whose last part has been partially written
+	crashedNoIndexPath := filepath.Join(dir, "mypath", "2009-05-22_22-15-25-000000.mp4")
+
+	err = os.WriteFile(crashedNoIndexPath, byts[:index[2].Offset+index[2].Size/2], 0o644)
+	require.NoError(t, err)
+
+	// complete segment without index
+	noIndexPath := filepath.Join(dir, "mypath", "2009-05-23_22-15-25-000000.mp4")
+
+	err = os.WriteFile(noIndexPath, byts, 0o644)
+	require.NoError(t, err)
+	noIndexSize := int64(len(byts))
+
+	type recovered struct {
+		pathName    string
+		segmentPath string
+	}
+
+	var calls []recovered
+
+	RecoverSegments(recordPath, nilLogger{}, func(pathName string, segmentPath string) {
+		calls = append(calls, recovered{pathName, segmentPath})
+	})
+
+	require.Equal(t, []recovered{{"mypath", crashedPath}, {"mypath", crashedNoIndexPath}}, calls)
+
+	fi, err := os.Stat(crashedPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(index[1].Offset+index[1].Size), fi.Size())
+
+	byts, err = os.ReadFile(SegmentIndexPath(crashedPath))
+	require.NoError(t, err)
+
+	var recoveredIndex SegmentIndex
+	complete, err := recoveredIndex.unmarshal(byts)
+	require.NoError(t, err)
+	require.Equal(t, true, complete)
+	require.Equal(t, SegmentIndex(index[:2]).Marshal(), recoveredIndex.Marshal())
+
+	fi, err = os.Stat(crashedNoIndexPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(index[1].Offset+index[1].Size), fi.Size())
+
+	recoveredIndex, err = ReadSegmentIndex(crashedNoIndexPath)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(recoveredIndex))
+
+	fi, err = os.Stat(noIndexPath)
+	require.NoError(t, err)
+	require.Equal(t, noIndexSize, fi.Size())
+
+	recoveredIndex, err = ReadSegmentIndex(noIndexPath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(recoveredIndex))
+
+	_, err = os.Stat(emptyPath)
+	require.Error(t, err)
+
+	_, err = os.Stat(SegmentIndexPath(emptyPath))
+	require.Error(t, err)
+
+	// segments are recovered once
+	calls = nil
+	RecoverSegments(recordPath, nilLogger{}, func(pathName string, segmentPath string) {
+		calls = append(calls, recovered{pathName, segmentPath})
+	})
+	require.Equal(t, []recovered(nil), calls)
+}
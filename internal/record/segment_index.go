@@ -0,0 +1,505 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+const (
+	segmentIndexMagic     = "MTXI"
+	segmentIndexVersion   = 1
+	segmentIndexHeaderLen = 5
+	segmentIndexEntryLen  = 37
+)
+
+// the end marker is written when a segment is closed,
+// and allows to detect segments that have not been completed.
+var segmentIndexEndMarker = bytes.Repeat([]byte{0xFF}, segmentIndexEntryLen)
+
+func durationMp4ToGo(v uint64, timeScale uint32) time.Duration {
+	timeScale64 := uint64(timeScale)
+	secs := v / timeScale64
+	dec := v % timeScale64
+	return time.Duration(secs)*time.Second + time.Duration(dec)*time.Second/time.Duration(timeScale64)
+}
+
+// SegmentIndexPath returns the path of the index of a segment.
+func SegmentIndexPath(segmentPath string) string {
+	return segmentPath + ".idx"
+}
+
+// SegmentIndexEntry is an entry of a segment index.
+// Each entry describes a part of a fMP4 segment.
+type SegmentIndexEntry struct {
+	// position of the part inside the segment.
+	Offset uint64
+	Size   uint64
+
+	// DTS of the part, relative to the start of the segment.
+	DTS      time.Duration
+	Duration time.Duration
+
+	// absolute time of the part. It is zero when unknown.
+	NTP time.Time
+
+	// whether the part contains a keyframe.
+	// It is always true when the segment doesn't contain video.
+	Keyframe bool
+}
+
+func (e SegmentIndexEntry) marshal() []byte {
+	buf := make([]byte, segmentIndexEntryLen)
+	binary.BigEndian.PutUint64(buf[0:], e.Offset)
+	binary.BigEndian.PutUint32(buf[8:], uint32(e.Size))
+	binary.BigEndian.PutUint64(buf[12:], uint64(e.DTS))
+	binary.BigEndian.PutUint64(buf[20:], uint64(e.Duration))
+
+	if !e.NTP.IsZero() {
+		binary.BigEndian.PutUint64(buf[28:], uint64(e.NTP.UnixNano()))
+	}
+
+	if e.Keyframe {
+		buf[36] = 1
+	}
+
+	return buf
+}
+
+func (e *SegmentIndexEntry) unmarshal(buf []byte) {
+	e.Offset = binary.BigEndian.Uint64(buf[0:])
+	e.Size = uint64(binary.BigEndian.Uint32(buf[8:]))
+	e.DTS = time.Duration(binary.BigEndian.Uint64(buf[12:]))
+	e.Duration = time.Duration(binary.BigEndian.Uint64(buf[20:]))
+
+	if ntp := int64(binary.BigEndian.Uint64(buf[28:])); ntp != 0 {
+		e.NTP = time.Unix(0, ntp)
+	}
+
+	e.Keyframe = (buf[36] & 0x01) != 0
+}
+
+// SegmentIndex is the index of a fMP4 segment.
+// It allows to find parts without parsing the whole segment.
+type SegmentIndex []SegmentIndexEntry
+
+// Unmarshal decodes a SegmentIndex.
+// A truncated entry at the end, left by a crash, is ignored.
+func (i *SegmentIndex) Unmarshal(byts []byte) error {
+	_, err := i.unmarshal(byts)
+	return err
+}
+
+// unmarshal decodes a SegmentIndex and returns whether the segment has been completed.
+func (i *SegmentIndex) unmarshal(byts []byte) (bool, error) {
+	if len(byts) < segmentIndexHeaderLen || string(byts[:4]) != segmentIndexMagic {
+		return false, fmt.Errorf("invalid segment index")
+	}
+
+	if byts[4] != segmentIndexVersion {
+		return false, fmt.Errorf("unsupported segment index version: %d", byts[4])
+	}
+
+	byts = byts[segmentIndexHeaderLen:]
+	*i = nil
+
+	for len(byts) >= segmentIndexEntryLen {
+		if bytes.Equal(byts[:segmentIndexEntryLen], segmentIndexEndMarker) {
+			return true, nil
+		}
+
+		var e SegmentIndexEntry
+		e.unmarshal(byts[:segmentIndexEntryLen])
+		*i = append(*i, e)
+		byts = byts[segmentIndexEntryLen:]
+	}
+
+	return false, nil
+}
+
+// Marshal encodes the index of a completed segment.
+func (i SegmentIndex) Marshal() []byte {
+	buf := make([]byte, 0, segmentIndexHeaderLen+(len(i)+1)*segmentIndexEntryLen)
+	buf = append(buf, segmentIndexMagic...)
+	buf = append(buf, segmentIndexVersion)
+
+	for _, e := range i {
+		buf = append(buf, e.marshal()...)
+	}
+
+	buf = append(buf, segmentIndexEndMarker...)
+
+	return buf
+}
+
+// FindKeyframe returns the last entry that contains a keyframe and starts at or before dts.
+func (i SegmentIndex) FindKeyframe(dts time.Duration) *SegmentIndexEntry {
+	var ret *SegmentIndexEntry
+
+	for j := range i {
+		if i[j].DTS > dts {
+			break
+		}
+		if i[j].Keyframe {
+			ret = &i[j]
+		}
+	}
+
+	return ret
+}
+
+// FindKeyframeNTP returns the last entry that contains a keyframe and starts at or before ntp.
+func (i SegmentIndex) FindKeyframeNTP(ntp time.Time) *SegmentIndexEntry {
+	var ret *SegmentIndexEntry
+
+	for j := range i {
+		if i[j].NTP.IsZero() || i[j].NTP.After(ntp) {
+			break
+		}
+		if i[j].Keyframe {
+			ret = &i[j]
+		}
+	}
+
+	return ret
+}
+
+// ReadSegmentIndex reads the index of a segment.
+func ReadSegmentIndex(segmentPath string) (SegmentIndex, error) {
+	byts, err := os.ReadFile(SegmentIndexPath(segmentPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var i SegmentIndex
+	err = i.Unmarshal(byts)
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+type segmentIndexWriter struct {
+	fi *os.File
+}
+
+func (w *segmentIndexWriter) open(segmentPath string) error {
+	var err error
+	w.fi, err = os.Create(SegmentIndexPath(segmentPath))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.fi.Write(append([]byte(segmentIndexMagic), segmentIndexVersion))
+	if err != nil {
+		w.fi.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (w *segmentIndexWriter) write(e SegmentIndexEntry) error {
+	_, err := w.fi.Write(e.marshal())
+	return err
+}
+
+func (w *segmentIndexWriter) close() error {
+	_, err := w.fi.Write(segmentIndexEndMarker)
+	err2 := w.fi.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+type segmentIndexTrack struct {
+	timeScale uint32
+	isVideo   bool
+}
+
+func readBoxHeader(r io.Reader) (uint64, string, int, error) {
+	var buf [16]byte
+	_, err := io.ReadFull(r, buf[:8])
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	size := uint64(binary.BigEndian.Uint32(buf[:4]))
+	typ := string(buf[4:8])
+	headerLen := 8
+
+	if size == 1 {
+		_, err = io.ReadFull(r, buf[8:16])
+		if err != nil {
+			return 0, "", 0, err
+		}
+		size = binary.BigEndian.Uint64(buf[8:16])
+		headerLen = 16
+	}
+
+	if size < uint64(headerLen) {
+		return 0, "", 0, fmt.Errorf("invalid size of box '%s'", typ)
+	}
+
+	return size, typ, headerLen, nil
+}
+
+// readBox reads the payload of a box whose header has already been read,
+// and returns the whole box.
+func readBox(r io.Reader, size uint64, typ string, headerLen int) ([]byte, error) {
+	buf := make([]byte, size)
+
+	if headerLen == 16 {
+		binary.BigEndian.PutUint32(buf, 1)
+		binary.BigEndian.PutUint64(buf[8:], size)
+	} else {
+		binary.BigEndian.PutUint32(buf, uint32(size))
+	}
+	copy(buf[4:], typ)
+
+	_, err := io.ReadFull(r, buf[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readSegmentIndexTracks(moov []byte) (map[uint32]*segmentIndexTrack, error) {
+	tracks := make(map[uint32]*segmentIndexTrack)
+	var cur *segmentIndexTrack
+
+	_, err := mp4.ReadBoxStructure(bytes.NewReader(moov), func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov", "trak", "mdia":
+			return h.Expand()
+
+		case "tkhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			cur = &segmentIndexTrack{}
+			tracks[box.(*mp4.Tkhd).TrackID] = cur
+
+		case "mdhd":
+			if cur != nil {
+				box, _, err := h.ReadPayload()
+				if err != nil {
+					return nil, err
+				}
+				cur.timeScale = box.(*mp4.Mdhd).Timescale
+			}
+
+		case "hdlr":
+			if cur != nil {
+				box, _, err := h.ReadPayload()
+				if err != nil {
+					return nil, err
+				}
+				cur.isVideo = (string(box.(*mp4.Hdlr).HandlerType[:]) == "vide")
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id, track := range tracks {
+		if track.timeScale == 0 {
+			return nil, fmt.Errorf("timescale of track %d not found", id)
+		}
+	}
+
+	return tracks, nil
+}
+
+func segmentIndexEntryFromPart(
+	tracks map[uint32]*segmentIndexTrack,
+	byts []byte,
+	offset uint64,
+	start time.Time,
+) (SegmentIndexEntry, error) {
+	var parts fmp4.Parts
+	err := parts.Unmarshal(byts)
+	if err != nil {
+		return SegmentIndexEntry{}, err
+	}
+
+	e := SegmentIndexEntry{
+		Offset:   offset,
+		Size:     uint64(len(byts)),
+		DTS:      -1,
+		Keyframe: true,
+	}
+
+	hasVideo := false
+	for _, track := range tracks {
+		if track.isVideo {
+			hasVideo = true
+			e.Keyframe = false
+		}
+	}
+
+	for _, part := range parts {
+		for _, partTrack := range part.Tracks {
+			track, ok := tracks[uint32(partTrack.ID)]
+			if !ok {
+				return SegmentIndexEntry{}, fmt.Errorf("track %d not found", partTrack.ID)
+			}
+
+			dts := durationMp4ToGo(partTrack.BaseTime, track.timeScale)
+			if e.DTS < 0 || dts < e.DTS {
+				e.DTS = dts
+			}
+
+			var duration uint64
+			for _, sample := range partTrack.Samples {
+				duration += uint64(sample.Duration)
+
+				if hasVideo && track.isVideo && !sample.IsNonSyncSample {
+					e.Keyframe = true
+				}
+			}
+
+			if end := dts + durationMp4ToGo(duration, track.timeScale); end-e.DTS > e.Duration {
+				e.Duration = end - e.DTS
+			}
+		}
+	}
+
+	if e.DTS < 0 {
+		e.DTS = 0
+	}
+
+	if !start.IsZero() {
+		e.NTP = start.Add(e.DTS)
+	}
+
+	return e, nil
+}
+
+// BuildSegmentIndex builds the index of a fMP4 segment by parsing the segment.
+// Parsing stops at the first truncated or damaged part.
+// If start is not zero, it is used as the absolute time of the beginning of the segment.
+func BuildSegmentIndex(segmentPath string, start time.Time) (SegmentIndex, error) {
+	f, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tracks map[uint32]*segmentIndexTrack
+	var index SegmentIndex
+	var offset uint64
+	var prftNTP time.Time
+
+	for {
+		size, typ, headerLen, err := readBoxHeader(f)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF || tracks != nil {
+				break
+			}
+			return nil, err
+		}
+
+		switch typ {
+		case "moov":
+			moov, err := readBox(f, size, typ, headerLen)
+			if err != nil {
+				return nil, err
+			}
+
+			tracks, err = readSegmentIndexTracks(moov)
+			if err != nil {
+				return nil, err
+			}
+
+		case "prft":
+			prft, err := readBox(f, size, typ, headerLen)
+			if err != nil {
+				return index, nil //nolint:nilerr
+			}
+
+			if len(prft) >= 24 {
+				prftNTP = ntpTimeMp4ToGo(binary.BigEndian.Uint64(prft[16:]))
+			}
+
+		case "moof":
+			if tracks == nil {
+				return nil, fmt.Errorf("moof found before moov")
+			}
+
+			moof, err := readBox(f, size, typ, headerLen)
+			if err != nil {
+				return index, nil //nolint:nilerr
+			}
+
+			mdatSize, mdatType, mdatHeaderLen, err := readBoxHeader(f)
+			if err != nil || mdatType != "mdat" {
+				return index, nil //nolint:nilerr
+			}
+
+			mdat, err := readBox(f, mdatSize, mdatType, mdatHeaderLen)
+			if err != nil {
+				return index, nil //nolint:nilerr
+			}
+
+			e, err := segmentIndexEntryFromPart(tracks, append(moof, mdat...), offset, start)
+			if err != nil {
+				return index, nil //nolint:nilerr
+			}
+
+			// the Producer Reference Time box contains the absolute time of the part
+			if !prftNTP.IsZero() {
+				e.NTP = prftNTP
+				prftNTP = time.Time{}
+			}
+
+			index = append(index, e)
+
+			size += mdatSize
+
+		default:
+			_, err := f.Seek(int64(size)-int64(headerLen), io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		offset += size
+	}
+
+	return index, nil
+}
+
+// RepairSegmentIndex rebuilds the index of a fMP4 segment and writes it on disk.
+// The absolute time of parts is recovered from the file name, when it
+// follows the default record path.
+func RepairSegmentIndex(segmentPath string) (SegmentIndex, error) {
+	var start time.Time
+	if params := decodeRecordPath("%Y-%m-%d_%H-%M-%S-%f.mp4", filepath.Base(segmentPath)); params != nil {
+		start = params.time
+	}
+
+	index, err := BuildSegmentIndex(segmentPath, start)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(SegmentIndexPath(segmentPath), index.Marshal(), 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
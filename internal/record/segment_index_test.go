@@ -0,0 +1,136 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// recordTestSegment records a fMP4 segment with 3 parts.
+func recordTestSegment(t *testing.T, recordPath string, ntp time.Time) string {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+	}}
+
+	timeNow = func() time.Time {
+		return time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.Local)
+	}
+
+	stream, err := stream.New(
+		1460,
+		desc,
+		true,
+		&nilLogger{},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	segDone := make(chan string, 1)
+
+	w := &Agent{
+		WriteQueueSize:    1024,
+		RecordPath:        recordPath,
+		Format:            conf.RecordFormatFMP4,
+		PartDuration:      100 * time.Millisecond,
+		SegmentDuration:   1 * time.Hour,
+		PathName:          "mypath",
+		Stream:            stream,
+		OnSegmentCreate:   func(_ string) {},
+		OnSegmentComplete: func(fpath string) { segDone <- fpath },
+		Parent:            &nilLogger{},
+	}
+	w.Initialize()
+
+	for i := 0; i < 6; i++ {
+		stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+			Base: unit.Base{
+				PTS: time.Duration(i) * time.Second,
+				NTP: ntp.Add(time.Duration(i) * time.Second),
+			},
+			AU: [][]byte{
+				{ // SPS
+					0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+					0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+					0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+				},
+				{ // PPS
+					0x08, 0x06, 0x07, 0x08,
+				},
+				{5}, // IDR
+			},
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	w.Close()
+
+	return <-segDone
+}
+
+func TestSegmentIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ntp := time.Date(2010, 0o5, 20, 22, 15, 25, 0, time.UTC)
+
+	fpath := recordTestSegment(t, filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"), ntp)
+
+	// segments are named after the absolute time of their first sample
+	require.Equal(t, encodeRecordPath(&recordPathParams{time: ntp.Local()}, "%Y-%m-%d_%H-%M-%S-%f")+".mp4", filepath.Base(fpath))
+
+	index, err := ReadSegmentIndex(fpath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(index))
+
+	for i, e := range index {
+		require.Equal(t, time.Duration(i)*2*time.Second, e.DTS)
+		require.Equal(t, true, e.NTP.Equal(ntp.Add(time.Duration(i)*2*time.Second)))
+		require.Equal(t, true, e.Keyframe)
+	}
+	require.Equal(t, 2*time.Second, index[0].Duration)
+	require.Equal(t, 1*time.Second, index[2].Duration)
+
+	fi, err := os.Stat(fpath)
+	require.NoError(t, err)
+	require.Equal(t, uint64(fi.Size()), index[2].Offset+index[2].Size)
+
+	require.Equal(t, &index[1], index.FindKeyframe(3*time.Second))
+	require.Equal(t, &index[2], index.FindKeyframeNTP(ntp.Add(10*time.Second)))
+
+	rebuilt, err := BuildSegmentIndex(fpath, ntp)
+	require.NoError(t, err)
+	require.Equal(t, index.Marshal(), rebuilt.Marshal())
+
+	err = os.Remove(SegmentIndexPath(fpath))
+	require.NoError(t, err)
+
+	repaired, err := RepairSegmentIndex(fpath)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(repaired))
+
+	// absolute time of parts is read from Producer Reference Time boxes
+	for i, e := range repaired {
+		require.Equal(t, true, e.NTP.Equal(ntp.Add(time.Duration(i)*2*time.Second)))
+	}
+
+	index, err = ReadSegmentIndex(fpath)
+	require.NoError(t, err)
+	require.Equal(t, repaired.Marshal(), index.Marshal())
+}
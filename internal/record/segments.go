@@ -0,0 +1,99 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// Segment is a fMP4 recording segment.
+type Segment struct {
+	Fpath string
+	Start time.Time
+}
+
+// FindSegments returns the fMP4 segments of a path, sorted by start time.
+func FindSegments(recordPath string, pathName string) ([]*Segment, error) {
+	resolvedPath := filepath.Clean(strings.ReplaceAll(recordPath, "%path", pathName) + ".mp4")
+
+	var segments []*Segment
+
+	err := filepath.Walk(commonPath(resolvedPath), func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			params := decodeRecordPath(resolvedPath, fpath)
+			if params != nil {
+				segments = append(segments, &Segment{
+					Fpath: fpath,
+					Start: params.time,
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+
+	return segments, nil
+}
+
+// ReadSegmentInit reads the initialization section of a fMP4 segment.
+func ReadSegmentInit(segmentPath string) (*fmp4.Init, error) {
+	f, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf []byte
+
+	for {
+		size, typ, headerLen, err := readBoxHeader(f)
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("moov not found")
+			}
+			return nil, err
+		}
+
+		switch typ {
+		case "ftyp", "moov":
+			box, err := readBox(f, size, typ, headerLen)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, box...)
+
+			if typ == "moov" {
+				var init fmp4.Init
+				err = init.Unmarshal(buf)
+				if err != nil {
+					return nil, err
+				}
+				return &init, nil
+			}
+
+		default:
+			_, err := f.Seek(int64(size)-int64(headerLen), io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
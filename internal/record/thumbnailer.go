@@ -0,0 +1,97 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/snapshot"
+)
+
+const thumbnailSuffix = ".thumb"
+
+// thumbnailBase returns the path of a thumbnail without suffix and extension.
+func thumbnailBase(fpath string) (string, bool) {
+	ext := filepath.Ext(fpath)
+	if ext != ".jpg" && ext != ".mp4" {
+		return "", false
+	}
+
+	base := strings.TrimSuffix(fpath, ext)
+	if !strings.HasSuffix(base, thumbnailSuffix) {
+		return "", false
+	}
+
+	return strings.TrimSuffix(base, thumbnailSuffix), true
+}
+
+// IsThumbnailPath returns whether a file is a thumbnail.
+func IsThumbnailPath(fpath string) bool {
+	_, ok := thumbnailBase(fpath)
+	return ok
+}
+
+// thumbnailer periodically saves the latest still image of a stream next to recordings.
+type thumbnailer struct {
+	period      time.Duration
+	snapshotter *snapshot.Snapshotter
+	recordPath  string
+	parent      logger.Writer
+
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+func (t *thumbnailer) initialize() {
+	t.terminate = make(chan struct{})
+	t.done = make(chan struct{})
+
+	go t.run()
+}
+
+func (t *thumbnailer) close() {
+	close(t.terminate)
+	<-t.done
+}
+
+func (t *thumbnailer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := t.save()
+			if err != nil {
+				t.parent.Log(logger.Warn, "unable to save thumbnail: %v", err)
+			}
+
+		case <-t.terminate:
+			return
+		}
+	}
+}
+
+func (t *thumbnailer) save() error {
+	snap, err := t.snapshotter.Get()
+	if err != nil {
+		// stream has no frames yet
+		return nil //nolint:nilerr
+	}
+
+	fpath := encodeRecordPath(&recordPathParams{time: timeNow()}, t.recordPath) +
+		thumbnailSuffix + snap.Extension
+
+	err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	t.parent.Log(logger.Debug, "saving thumbnail %s", fpath)
+
+	return os.WriteFile(fpath, snap.Data, 0o644)
+}
@@ -0,0 +1,225 @@
+package record
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+// s3Key returns the key of the object that corresponds to a segment path.
+func s3Key(prefix string, fpath string) string {
+	return prefix + strings.TrimPrefix(filepath.ToSlash(filepath.Clean(fpath)), "/")
+}
+
+func segmentContentType(fpath string) string {
+	switch {
+	case strings.HasSuffix(fpath, ".idx"):
+		return "application/octet-stream"
+
+	case strings.HasSuffix(fpath, ".ts"):
+		return "video/MP2T"
+
+	case strings.HasSuffix(fpath, ".mkv"):
+		return "video/x-matroska"
+
+	case strings.HasSuffix(fpath, ".webm"):
+		return "video/webm"
+
+	default:
+		return "video/mp4"
+	}
+}
+
+type uploaderEntry struct {
+	fpath string
+	size  uint64
+}
+
+// uploader uploads completed segments to a S3-compatible object storage.
+// Segments are kept on disk until they are uploaded.
+type uploader struct {
+	client       *s3.Client
+	prefix       string
+	spoolMaxSize uint64
+	retryPause   time.Duration
+	parent       logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	mutex     sync.Mutex
+	queue     []*uploaderEntry
+	queueSize uint64
+
+	chNew chan struct{}
+	done  chan struct{}
+}
+
+func (u *uploader) initialize() {
+	u.ctx, u.ctxCancel = context.WithCancel(context.Background())
+	u.chNew = make(chan struct{}, 1)
+	u.done = make(chan struct{})
+
+	go u.run()
+}
+
+func (u *uploader) close() {
+	u.ctxCancel()
+	<-u.done
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if len(u.queue) != 0 {
+		u.parent.Log(logger.Warn, "%d segments have not been uploaded and are left on disk", len(u.queue))
+	}
+}
+
+// pushExisting enqueues segments left on disk by a previous run.
+func (u *uploader) pushExisting(resolvedPath string) {
+	resolvedPath = filepath.Clean(resolvedPath)
+
+	var paths []string
+
+	filepath.Walk(commonPath(resolvedPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && decodeRecordPath(resolvedPath, fpath) != nil {
+			paths = append(paths, fpath)
+		}
+
+		return nil
+	})
+
+	sort.Strings(paths)
+
+	for _, fpath := range paths {
+		u.push(fpath)
+
+		if _, err := os.Stat(SegmentIndexPath(fpath)); err == nil {
+			u.push(SegmentIndexPath(fpath))
+		}
+	}
+}
+
+func (u *uploader) push(fpath string) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		u.parent.Log(logger.Warn, "unable to upload %s: %v", fpath, err)
+		return
+	}
+
+	e := &uploaderEntry{
+		fpath: fpath,
+		size:  uint64(fi.Size()),
+	}
+
+	func() {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+
+		u.queue = append(u.queue, e)
+		u.queueSize += e.size
+
+		for u.queueSize > u.spoolMaxSize && len(u.queue) > 1 {
+			discarded := u.queue[0]
+			u.queue = u.queue[1:]
+			u.queueSize -= discarded.size
+
+			u.parent.Log(logger.Warn, "spool size exceeded, discarding %s", discarded.fpath)
+			os.Remove(discarded.fpath)
+		}
+	}()
+
+	select {
+	case u.chNew <- struct{}{}:
+	default:
+	}
+}
+
+func (u *uploader) next() *uploaderEntry {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if len(u.queue) == 0 {
+		return nil
+	}
+	return u.queue[0]
+}
+
+func (u *uploader) remove(e *uploaderEntry) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	for i, cur := range u.queue {
+		if cur == e {
+			u.queue = append(u.queue[:i], u.queue[i+1:]...)
+			u.queueSize -= e.size
+			return
+		}
+	}
+}
+
+func (u *uploader) run() {
+	defer close(u.done)
+
+	for {
+		e := u.next()
+
+		if e == nil {
+			select {
+			case <-u.chNew:
+				continue
+
+			case <-u.ctx.Done():
+				return
+			}
+		}
+
+		err := u.upload(e)
+		if os.IsNotExist(err) {
+			// segment has been discarded
+			u.remove(e)
+			continue
+		}
+		if err != nil {
+			if u.ctx.Err() != nil {
+				return
+			}
+
+			u.parent.Log(logger.Warn, "unable to upload %s: %v, retrying in %v", e.fpath, err, u.retryPause)
+
+			select {
+			case <-time.After(u.retryPause):
+				continue
+
+			case <-u.ctx.Done():
+				return
+			}
+		}
+
+		u.parent.Log(logger.Debug, "uploaded %s", e.fpath)
+		u.remove(e)
+		os.Remove(e.fpath)
+	}
+}
+
+func (u *uploader) upload(e *uploaderEntry) error {
+	f, err := os.Open(e.fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return u.client.PutObject(u.ctx, s3Key(u.prefix, e.fpath), segmentContentType(e.fpath), f)
+}
@@ -0,0 +1,150 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+type testStorage struct {
+	mutex   sync.Mutex
+	failing bool
+	objects map[string][]byte
+}
+
+func (s *testStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/mybucket/")
+
+	switch r.Method {
+	case http.MethodPut:
+		byts, _ := io.ReadAll(r.Body)
+		s.objects[key] = byts
+
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodGet:
+		prefix := r.URL.Query().Get("prefix")
+
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		out := `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`
+		for _, k := range keys {
+			out += fmt.Sprintf("<Contents><Key>%s</Key><Size>%d</Size></Contents>", k, len(s.objects[k]))
+		}
+		out += `<IsTruncated>false</IsTruncated></ListBucketResult>`
+		w.Write([]byte(out))
+	}
+}
+
+func (s *testStorage) keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUploader(t *testing.T) {
+	storage := &testStorage{
+		failing: true,
+		objects: make(map[string][]byte),
+	}
+
+	srv := httptest.NewServer(storage)
+	defer srv.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-uploader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "mypath", "%Y-%m-%d_%H-%M-%S-%f.mp4")
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2008-05-20_22-15-25-000000.mp4",
+		"2009-05-20_22-15-25-000000.mp4",
+		"2010-05-20_22-15-25-000000.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), []byte{1, 2, 3, 4}, 0o644)
+		require.NoError(t, err)
+	}
+
+	u := &uploader{
+		client: &s3.Client{
+			Endpoint: srv.URL,
+			Region:   "us-east-1",
+			Bucket:   "mybucket",
+		},
+		prefix:       "rec/",
+		spoolMaxSize: 8,
+		retryPause:   10 * time.Millisecond,
+		parent:       nilLogger{},
+	}
+	u.initialize()
+	defer u.close()
+
+	// the oldest segment exceeds the spool size and is discarded
+	u.pushExisting(recordPath)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"))
+	require.Error(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	storage.mutex.Lock()
+	storage.failing = false
+	storage.mutex.Unlock()
+
+	for i := 0; i < 50 && len(storage.keys()) != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	base := strings.TrimPrefix(filepath.ToSlash(dir), "/")
+
+	require.Equal(t, []string{
+		"rec/" + base + "/mypath/2009-05-20_22-15-25-000000.mp4",
+		"rec/" + base + "/mypath/2010-05-20_22-15-25-000000.mp4",
+	}, storage.keys())
+
+	for i := 0; i < 50; i++ {
+		if _, err = os.Stat(filepath.Join(dir, "mypath", "2010-05-20_22-15-25-000000.mp4")); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Error(t, err)
+}
@@ -0,0 +1,262 @@
+// Package snapshot contains a component that keeps the latest still image of a stream.
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aler9/writerseeker"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// Snapshot is a still image.
+type Snapshot struct {
+	// MIME type of Data.
+	ContentType string
+
+	// File extension that corresponds to ContentType.
+	Extension string
+
+	// Absolute time of the image. It is zero when unknown.
+	NTP time.Time
+
+	Data []byte
+}
+
+// Snapshotter reads a stream and keeps its latest still image:
+// the latest frame of M-JPEG streams or the latest key frame of H265 and H264 streams.
+type Snapshotter struct {
+	WriteQueueSize int
+	Stream         *stream.Stream
+	Parent         logger.Writer
+
+	writer *asyncwriter.Writer
+
+	mutex    sync.Mutex
+	codec    fmp4.Codec
+	frame    [][]byte
+	frameNTP time.Time
+}
+
+// Initialize initializes Snapshotter.
+func (s *Snapshotter) Initialize() {
+	s.writer = asyncwriter.New(s.WriteQueueSize, s)
+
+	if !s.setupReader() {
+		s.Log(logger.Debug, "no supported tracks")
+	}
+
+	s.writer.Start()
+}
+
+// Close closes Snapshotter.
+func (s *Snapshotter) Close() {
+	s.Stream.RemoveReader(s.writer)
+	s.writer.Stop()
+}
+
+// Log implements logger.Writer.
+func (s *Snapshotter) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[snapshot] "+format, args...)
+}
+
+func (s *Snapshotter) setupReader() bool {
+	for _, media := range s.Stream.Desc().Medias {
+		for _, forma := range media.Formats {
+			if s.setupFormat(media, forma) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Snapshotter) setupFormat(media *description.Media, forma format.Format) bool {
+	switch forma := forma.(type) {
+	case *format.MJPEG:
+		s.Stream.AddReader(s.writer, media, forma, func(u unit.Unit) error {
+			tunit := u.(*unit.MJPEG)
+			if tunit.Frame == nil {
+				return nil
+			}
+
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			s.frame = [][]byte{tunit.Frame}
+			s.frameNTP = tunit.NTP
+			return nil
+		})
+		return true
+
+	case *format.H265:
+		vps, sps, pps := forma.SafeParams()
+
+		s.Stream.AddReader(s.writer, media, forma, func(u unit.Unit) error {
+			tunit := u.(*unit.H265)
+			if tunit.AU == nil {
+				return nil
+			}
+
+			randomAccess := false
+
+			for _, nalu := range tunit.AU {
+				switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+				case h265.NALUType_VPS_NUT:
+					vps = nalu
+
+				case h265.NALUType_SPS_NUT:
+					sps = nalu
+
+				case h265.NALUType_PPS_NUT:
+					pps = nalu
+
+				case h265.NALUType_IDR_W_RADL, h265.NALUType_IDR_N_LP, h265.NALUType_CRA_NUT:
+					randomAccess = true
+				}
+			}
+
+			if !randomAccess || vps == nil || sps == nil || pps == nil {
+				return nil
+			}
+
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			s.codec = &fmp4.CodecH265{VPS: vps, SPS: sps, PPS: pps}
+			s.frame = tunit.AU
+			s.frameNTP = tunit.NTP
+			return nil
+		})
+		return true
+
+	case *format.H264:
+		sps, pps := forma.SafeParams()
+
+		s.Stream.AddReader(s.writer, media, forma, func(u unit.Unit) error {
+			tunit := u.(*unit.H264)
+			if tunit.AU == nil {
+				return nil
+			}
+
+			randomAccess := false
+
+			for _, nalu := range tunit.AU {
+				switch h264.NALUType(nalu[0] & 0x1F) {
+				case h264.NALUTypeSPS:
+					sps = nalu
+
+				case h264.NALUTypePPS:
+					pps = nalu
+
+				case h264.NALUTypeIDR:
+					randomAccess = true
+				}
+			}
+
+			if !randomAccess || sps == nil || pps == nil {
+				return nil
+			}
+
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			s.codec = &fmp4.CodecH264{SPS: sps, PPS: pps}
+			s.frame = tunit.AU
+			s.frameNTP = tunit.NTP
+			return nil
+		})
+		return true
+	}
+
+	return false
+}
+
+// Get returns the latest still image.
+// M-JPEG frames are returned as they are, while H265 and H264 key frames
+// are returned as single-frame MP4 files.
+func (s *Snapshotter) Get() (*Snapshot, error) {
+	s.mutex.Lock()
+	codec := s.codec
+	frame := s.frame
+	ntp := s.frameNTP
+	s.mutex.Unlock()
+
+	if frame == nil {
+		return nil, fmt.Errorf("no frames received yet")
+	}
+
+	if codec == nil {
+		return &Snapshot{
+			ContentType: "image/jpeg",
+			Extension:   ".jpg",
+			NTP:         ntp,
+			Data:        frame[0],
+		}, nil
+	}
+
+	byts, err := marshalMP4(codec, frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		ContentType: "video/mp4",
+		Extension:   ".mp4",
+		NTP:         ntp,
+		Data:        byts,
+	}, nil
+}
+
+func marshalMP4(codec fmp4.Codec, au [][]byte) ([]byte, error) {
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec:     codec,
+		}},
+	}
+
+	var buf bytes.Buffer
+
+	var ws writerseeker.WriterSeeker
+	err := init.Marshal(&ws)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(ws.Bytes())
+
+	sampl, err := fmp4.NewPartSampleH26x(0, true, au)
+	if err != nil {
+		return nil, err
+	}
+	sampl.Duration = 90000 / 25
+
+	part := fmp4.Part{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID:      1,
+			Samples: []*fmp4.PartSample{sampl},
+		}},
+	}
+
+	ws = writerseeker.WriterSeeker{}
+	err = part.Marshal(&ws)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(ws.Bytes())
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {
+}
+
+var testSPS = []byte{
+	0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02,
+	0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04,
+	0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20,
+}
+
+func testJPEG(t *testing.T, v uint8) []byte {
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = v
+	}
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	require.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func TestSnapshotterMJPEG(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type:    description.MediaTypeVideo,
+		Formats: []format.Format{&format.MJPEG{}},
+	}}}
+
+	strm, err := stream.New(1460, desc, true, &nilLogger{})
+	require.NoError(t, err)
+	defer strm.Close()
+
+	s := &Snapshotter{
+		WriteQueueSize: 1024,
+		Stream:         strm,
+		Parent:         &nilLogger{},
+	}
+	s.Initialize()
+	defer s.Close()
+
+	_, err = s.Get()
+	require.EqualError(t, err, "no frames received yet")
+
+	ntp := time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.MJPEG{
+			Base: unit.Base{
+				PTS: time.Duration(i) * time.Second,
+				NTP: ntp.Add(time.Duration(i) * time.Second),
+			},
+			Frame: testJPEG(t, uint8(i*100)),
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	snap, err := s.Get()
+	require.NoError(t, err)
+	require.Equal(t, &Snapshot{
+		ContentType: "image/jpeg",
+		Extension:   ".jpg",
+		NTP:         ntp.Add(time.Second),
+		Data:        testJPEG(t, 100),
+	}, snap)
+}
+
+func TestSnapshotterH264(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	strm, err := stream.New(1460, desc, true, &nilLogger{})
+	require.NoError(t, err)
+	defer strm.Close()
+
+	s := &Snapshotter{
+		WriteQueueSize: 1024,
+		Stream:         strm,
+		Parent:         &nilLogger{},
+	}
+	s.Initialize()
+	defer s.Close()
+
+	// non-IDR frames are ignored
+	strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+		AU: [][]byte{testSPS, {0x08, 0x06, 0x07, 0x08}, {1}},
+	})
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = s.Get()
+	require.EqualError(t, err, "no frames received yet")
+
+	strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+		Base: unit.Base{
+			PTS: time.Second,
+		},
+		AU: [][]byte{testSPS, {0x08, 0x06, 0x07, 0x08}, {5}},
+	})
+
+	time.Sleep(50 * time.Millisecond)
+
+	snap, err := s.Get()
+	require.NoError(t, err)
+	require.Equal(t, "video/mp4", snap.ContentType)
+	require.Equal(t, ".mp4", snap.Extension)
+
+	var init fmp4.Init
+	err = init.Unmarshal(snap.Data)
+	require.NoError(t, err)
+	require.Equal(t, []*fmp4.InitTrack{{
+		ID:        1,
+		TimeScale: 90000,
+		Codec: &fmp4.CodecH264{
+			SPS: testSPS,
+			PPS: []byte{0x08, 0x06, 0x07, 0x08},
+		},
+	}}, init.Tracks)
+}
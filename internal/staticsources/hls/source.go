@@ -2,7 +2,9 @@
 package hls
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/bluenviron/gohlslib"
@@ -22,6 +24,10 @@ import (
 type Source struct {
 	ReadTimeout conf.StringDuration
 	Parent      defs.StaticSourceParent
+
+	urlIndex         int
+	excludedVariants map[string]struct{}
+	failures         int
 }
 
 // Log implements StaticSource.
@@ -41,19 +47,47 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 
 	decodeErrLogger := logger.NewLimitedLogger(s)
 
+	urls := append([]string{params.Conf.Source}, params.Conf.HLSSourceFallbacks...)
+	if s.urlIndex >= len(urls) {
+		s.urlIndex = 0
+	}
+
+	if s.urlIndex != 0 {
+		s.Log(logger.Info, "using fallback playlist %v", urls[s.urlIndex])
+	}
+
+	u, err := url.Parse(urls[s.urlIndex])
+	if err != nil {
+		return err
+	}
+
+	tr := &selectingTransport{
+		wrapped: &http.Transport{
+			TLSClientConfig: tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
+		},
+		playlistURL:      u.String(),
+		selector:         newVariantSelector(params.Conf, s.excludedVariants),
+		failoverAttempts: params.Conf.HLSSourceFailoverAttempts,
+		failures:         s.failures,
+		failover:         make(chan struct{}),
+	}
+
+	defer func() {
+		s.updateFailover(params.Conf, len(urls), tr)
+	}()
+
 	var c *gohlslib.Client
 	c = &gohlslib.Client{
-		URI: params.Conf.Source,
+		URI: urls[s.urlIndex],
 		HTTPClient: &http.Client{
-			Timeout: time.Duration(s.ReadTimeout),
-			Transport: &http.Transport{
-				TLSClientConfig: tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
-			},
+			Timeout:   time.Duration(s.ReadTimeout),
+			Transport: tr,
 		},
 		OnDownloadPrimaryPlaylist: func(u string) {
 			s.Log(logger.Debug, "downloading primary playlist %v", u)
 		},
 		OnDownloadStreamPlaylist: func(u string) {
+			tr.onDownloadStreamPlaylist(u)
 			s.Log(logger.Debug, "downloading stream playlist %v", u)
 		},
 		OnDownloadSegment: func(u string) {
@@ -63,6 +97,14 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 			decodeErrLogger.Log(logger.Warn, err.Error())
 		},
 		OnTracks: func(tracks []*gohlslib.Track) error {
+			if sel := tr.getSelection(); sel != nil {
+				s.Log(logger.Info, "selected variant %v (bandwidth %d)", sel.variant.URI, sel.variant.Bandwidth)
+
+				if sel.audio != nil {
+					s.Log(logger.Info, "selected audio rendition %v (language %v)", sel.audio.URI, sel.audio.Language)
+				}
+			}
+
 			var medias []*description.Media
 
 			for _, track := range tracks {
@@ -206,7 +248,7 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 		},
 	}
 
-	err := c.Start()
+	err = c.Start()
 	if err != nil {
 		return err
 	}
@@ -217,6 +259,11 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 			c.Close()
 			return err
 
+		case <-tr.failover:
+			c.Close()
+			<-c.Wait()
+			return fmt.Errorf("%d consecutive segment downloads failed", tr.failoverAttempts)
+
 		case <-params.ReloadConf:
 
 		case <-params.Context.Done():
@@ -227,6 +274,39 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 	}
 }
 
+// updateFailover switches to another variant or to a fallback playlist
+// when segment downloads fail repeatedly.
+func (s *Source) updateFailover(pathConf *conf.Path, urlsLen int, tr *selectingTransport) {
+	// failures are counted across runs, since a failed segment download stops the client.
+	s.failures = tr.consecutiveFailures()
+
+	if pathConf.HLSSourceFailoverAttempts == 0 || s.failures < pathConf.HLSSourceFailoverAttempts {
+		return
+	}
+
+	s.failures = 0
+
+	// switch to another variant of the same playlist
+	if sel := tr.getSelection(); sel != nil && sel.candidatesLen > 1 {
+		s.Log(logger.Warn, "segment downloads of variant %v failed repeatedly, switching to another variant",
+			sel.variant.URI)
+
+		if s.excludedVariants == nil {
+			s.excludedVariants = make(map[string]struct{})
+		}
+		s.excludedVariants[sel.variant.URI] = struct{}{}
+		return
+	}
+
+	// switch to the next playlist
+	s.excludedVariants = nil
+
+	if urlsLen > 1 {
+		s.Log(logger.Warn, "segment downloads failed repeatedly, switching to the next playlist")
+		s.urlIndex = (s.urlIndex + 1) % urlsLen
+	}
+}
+
 // APISourceDescribe implements StaticSource.
 func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
 	return defs.APIPathSourceOrReader{
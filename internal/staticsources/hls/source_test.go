@@ -3,11 +3,15 @@ package hls
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/bluenviron/gohlslib/pkg/playlist"
 	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
 	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
 	"github.com/gin-gonic/gin"
@@ -15,6 +19,7 @@ import (
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/staticsources/tester"
 )
 
@@ -115,3 +120,205 @@ func TestSource(t *testing.T) {
 
 	<-te.Unit
 }
+
+func TestSourceVariantSelection(t *testing.T) {
+	multivariant := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+
+#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=640x360,AUDIO="aud"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1280x720,AUDIO="aud"
+mid.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,CODECS="hvc1.1.6.L120.90,mp4a.40.2",RESOLUTION=1920x1080,AUDIO="aud"
+high.m3u8
+
+#EXT-X-MEDIA:TYPE="AUDIO",GROUP-ID="aud",LANGUAGE="en",NAME="English",AUTOSELECT=YES,DEFAULT=YES,URI="en.m3u8"
+#EXT-X-MEDIA:TYPE="AUDIO",GROUP-ID="aud",LANGUAGE="it-IT",NAME="Italiano",AUTOSELECT=YES,URI="it.m3u8"
+`
+
+	for _, ca := range []struct {
+		name     string
+		conf     conf.Path
+		excluded map[string]struct{}
+		variant  string
+		audio    string
+	}{
+		{
+			"default",
+			conf.Path{},
+			nil,
+			"high.m3u8",
+			"",
+		},
+		{
+			"max bandwidth",
+			conf.Path{HLSSourceMaxBandwidth: 3000000},
+			nil,
+			"mid.m3u8",
+			"",
+		},
+		{
+			"max bandwidth too low",
+			conf.Path{HLSSourceMaxBandwidth: 1000},
+			nil,
+			"low.m3u8",
+			"",
+		},
+		{
+			"max resolution",
+			conf.Path{HLSSourceMaxResolution: "1000x1000"},
+			nil,
+			"low.m3u8",
+			"",
+		},
+		{
+			"codec",
+			conf.Path{HLSSourceCodec: "avc1"},
+			nil,
+			"mid.m3u8",
+			"",
+		},
+		{
+			"audio language",
+			conf.Path{HLSSourceAudioLanguage: "it"},
+			nil,
+			"high.m3u8",
+			"it.m3u8",
+		},
+		{
+			"excluded",
+			conf.Path{},
+			map[string]struct{}{"high.m3u8": {}},
+			"mid.m3u8",
+			"",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			tr := &selectingTransport{
+				selector: newVariantSelector(&ca.conf, ca.excluded),
+			}
+
+			byts, err := tr.filterPlaylist([]byte(multivariant))
+			require.NoError(t, err)
+
+			sel := tr.getSelection()
+			require.Equal(t, ca.variant, sel.variant.URI)
+
+			if ca.audio != "" {
+				require.Equal(t, ca.audio, sel.audio.URI)
+			} else {
+				require.Nil(t, sel.audio)
+			}
+
+			pl, err := playlist.Unmarshal(byts)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(pl.(*playlist.Multivariant).Variants))
+		})
+	}
+}
+
+type testParent struct{}
+
+func (testParent) Log(_ logger.Level, _ string, _ ...interface{}) {}
+
+func (testParent) SetReady(_ defs.PathSourceStaticSetReadyReq) defs.PathSourceStaticSetReadyRes {
+	return defs.PathSourceStaticSetReadyRes{Err: fmt.Errorf("unexpected")}
+}
+
+func (testParent) SetNotReady(_ defs.PathSourceStaticSetNotReadyReq) {}
+
+func TestSourceFailover(t *testing.T) {
+	var mutex sync.Mutex
+	var requested []string
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.GET("/main.m3u8", func(ctx *gin.Context) {
+		ctx.Writer.Header().Set("Content-Type", `application/vnd.apple.mpegurl`)
+		ctx.Writer.Write([]byte("#EXTM3U\n" + //nolint:errcheck
+			"#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS=\"avc1.64001f\"\n" +
+			"low.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2500000,CODECS=\"avc1.64001f\"\n" +
+			"high.m3u8\n"))
+	})
+
+	for _, name := range []string{"low", "high", "fallback"} {
+		name := name
+		router.GET("/"+name+".m3u8", func(ctx *gin.Context) {
+			ctx.Writer.Header().Set("Content-Type", `application/vnd.apple.mpegurl`)
+			ctx.Writer.Write([]byte("#EXTM3U\n" + //nolint:errcheck
+				"#EXT-X-VERSION:3\n" +
+				"#EXT-X-TARGETDURATION:2\n" +
+				"#EXT-X-MEDIA-SEQUENCE:0\n" +
+				"#EXTINF:2,\n" +
+				name + ".ts\n" +
+				"#EXT-X-ENDLIST\n"))
+		})
+	}
+
+	// segments are never available
+	router.GET("/:segment", func(ctx *gin.Context) {
+		mutex.Lock()
+		requested = append(requested, ctx.Param("segment"))
+		mutex.Unlock()
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	})
+
+	ln, err := net.Listen("tcp", "localhost:5781")
+	require.NoError(t, err)
+
+	s := &http.Server{Handler: router}
+	go s.Serve(ln)
+	defer s.Shutdown(context.Background())
+
+	so := &Source{
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		Parent:      testParent{},
+	}
+
+	pathConf := &conf.Path{
+		Source:                    "http://localhost:5781/main.m3u8",
+		HLSSourceFallbacks:        []string{"http://localhost:5781/fallback.m3u8"},
+		HLSSourceFailoverAttempts: 2,
+	}
+
+	for i := 0; i < 8; i++ {
+		err = so.Run(defs.StaticSourceRunParams{
+			Context: context.Background(),
+			Conf:    pathConf,
+		})
+		require.Error(t, err)
+	}
+
+	// every variant is tried, then the fallback playlist, then the main playlist again.
+	require.Equal(t, []string{
+		"high.ts", "high.ts",
+		"low.ts", "low.ts",
+		"fallback.ts", "fallback.ts",
+		"high.ts", "high.ts",
+	}, requested)
+}
+
+func TestSourceFailoverReset(t *testing.T) {
+	tr := &selectingTransport{
+		failoverAttempts: 2,
+		failover:         make(chan struct{}),
+	}
+
+	tr.setSegmentResult(false)
+	tr.setSegmentResult(true)
+	tr.setSegmentResult(false)
+	require.Equal(t, 1, tr.consecutiveFailures())
+
+	select {
+	case <-tr.failover:
+		t.Errorf("should not happen")
+	default:
+	}
+
+	tr.setSegmentResult(false)
+	require.Equal(t, 2, tr.consecutiveFailures())
+	<-tr.failover
+}
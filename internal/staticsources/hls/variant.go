@@ -0,0 +1,303 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gohlslib/pkg/playlist"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// codecs that can be decoded by gohlslib.
+func variantIsSupported(v *playlist.MultivariantVariant) bool {
+	for _, codec := range v.Codecs {
+		if !strings.HasPrefix(codec, "avc1.") &&
+			!strings.HasPrefix(codec, "hvc1.") &&
+			!strings.HasPrefix(codec, "hev1.") &&
+			!strings.HasPrefix(codec, "mp4a.") &&
+			codec != "opus" {
+			return false
+		}
+	}
+	return true
+}
+
+func variantHasCodec(v *playlist.MultivariantVariant, codec string) bool {
+	for _, c := range v.Codecs {
+		if strings.HasPrefix(c, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+func variantFitsResolution(v *playlist.MultivariantVariant, maxWidth int, maxHeight int) bool {
+	if v.Resolution == "" {
+		return true
+	}
+
+	width, height, err := conf.ParseResolution(v.Resolution)
+	if err != nil {
+		return true
+	}
+
+	return width <= maxWidth && height <= maxHeight
+}
+
+func languageMatches(lang string, wanted string) bool {
+	lang = strings.ToLower(lang)
+	wanted = strings.ToLower(wanted)
+	return lang == wanted || strings.HasPrefix(lang, wanted+"-")
+}
+
+// variantSelector picks a variant and an audio rendition from a multivariant playlist.
+type variantSelector struct {
+	maxBandwidth  int
+	maxWidth      int
+	maxHeight     int
+	codec         string
+	audioLanguage string
+	excluded      map[string]struct{}
+}
+
+func newVariantSelector(pathConf *conf.Path, excluded map[string]struct{}) *variantSelector {
+	vs := &variantSelector{
+		maxBandwidth:  pathConf.HLSSourceMaxBandwidth,
+		codec:         pathConf.HLSSourceCodec,
+		audioLanguage: pathConf.HLSSourceAudioLanguage,
+		excluded:      excluded,
+	}
+
+	if pathConf.HLSSourceMaxResolution != "" {
+		vs.maxWidth, vs.maxHeight, _ = conf.ParseResolution(pathConf.HLSSourceMaxResolution)
+	}
+
+	return vs
+}
+
+func (vs *variantSelector) candidates(pl *playlist.Multivariant) []*playlist.MultivariantVariant {
+	var ret []*playlist.MultivariantVariant
+
+	for _, v := range pl.Variants {
+		if !variantIsSupported(v) {
+			continue
+		}
+
+		if vs.codec != "" && !variantHasCodec(v, vs.codec) {
+			continue
+		}
+
+		if _, ok := vs.excluded[v.URI]; ok {
+			continue
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret
+}
+
+// pickVariant returns the variant with the greatest bandwidth that fits the limits.
+// If no variant fits the limits, the one with the lowest bandwidth is returned.
+func (vs *variantSelector) pickVariant(candidates []*playlist.MultivariantVariant) *playlist.MultivariantVariant {
+	var best *playlist.MultivariantVariant
+	var lowest *playlist.MultivariantVariant
+
+	for _, v := range candidates {
+		if lowest == nil || v.Bandwidth < lowest.Bandwidth {
+			lowest = v
+		}
+
+		if vs.maxBandwidth != 0 && v.Bandwidth > vs.maxBandwidth {
+			continue
+		}
+
+		if vs.maxWidth != 0 && !variantFitsResolution(v, vs.maxWidth, vs.maxHeight) {
+			continue
+		}
+
+		if best == nil || v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+
+	if best == nil {
+		return lowest
+	}
+	return best
+}
+
+// pickAudio marks as default the audio rendition with the wanted language.
+func (vs *variantSelector) pickAudio(pl *playlist.Multivariant, v *playlist.MultivariantVariant) *playlist.MultivariantRendition {
+	if v.Audio == "" || vs.audioLanguage == "" {
+		return nil
+	}
+
+	var picked *playlist.MultivariantRendition
+
+	for _, r := range pl.Renditions {
+		if r.Type == playlist.MultivariantRenditionTypeAudio && r.GroupID == v.Audio &&
+			languageMatches(r.Language, vs.audioLanguage) {
+			picked = r
+			break
+		}
+	}
+
+	if picked == nil {
+		return nil
+	}
+
+	for _, r := range pl.Renditions {
+		if r.GroupID == v.Audio {
+			r.Default = (r == picked)
+		}
+	}
+
+	return picked
+}
+
+// variantSelection is the result of a variant selection.
+type variantSelection struct {
+	variant       *playlist.MultivariantVariant
+	audio         *playlist.MultivariantRendition
+	candidatesLen int
+}
+
+// selectingTransport is a http.RoundTripper that replaces the multivariant playlist
+// with one that contains only the selected variant.
+// It also counts consecutive segment download failures, and closes failover
+// when they reach failoverAttempts.
+type selectingTransport struct {
+	wrapped          http.RoundTripper
+	playlistURL      string
+	selector         *variantSelector
+	failoverAttempts int
+	failover         chan struct{}
+
+	mutex              sync.Mutex
+	selection          *variantSelection
+	streamPlaylistURLs map[string]struct{}
+	failures           int
+}
+
+func (t *selectingTransport) onDownloadStreamPlaylist(u string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.streamPlaylistURLs == nil {
+		t.streamPlaylistURLs = make(map[string]struct{})
+	}
+	t.streamPlaylistURLs[u] = struct{}{}
+}
+
+func (t *selectingTransport) isSegment(u string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if u == t.playlistURL {
+		return false
+	}
+
+	_, ok := t.streamPlaylistURLs[u]
+	return !ok
+}
+
+func (t *selectingTransport) setSegmentResult(ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if ok {
+		t.failures = 0
+		return
+	}
+
+	t.failures++
+
+	if t.failoverAttempts != 0 && t.failures == t.failoverAttempts {
+		close(t.failover)
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *selectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := req.URL.String()
+
+	res, err := t.wrapped.RoundTrip(req)
+
+	if t.isSegment(u) {
+		t.setSegmentResult(err == nil && res.StatusCode == http.StatusOK)
+		return res, err
+	}
+
+	if err != nil || u != t.playlistURL || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	byts, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	byts, err = t.filterPlaylist(byts)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(byts))
+	res.ContentLength = int64(len(byts))
+	res.Header.Set("Content-Length", strconv.FormatInt(int64(len(byts)), 10))
+
+	return res, nil
+}
+
+func (t *selectingTransport) filterPlaylist(byts []byte) ([]byte, error) {
+	pl, err := playlist.Unmarshal(byts)
+	if err != nil {
+		// let gohlslib report the error
+		return byts, nil //nolint:nilerr
+	}
+
+	mpl, ok := pl.(*playlist.Multivariant)
+	if !ok {
+		return byts, nil
+	}
+
+	candidates := t.selector.candidates(mpl)
+	if candidates == nil {
+		return nil, fmt.Errorf("no variants matching the selection criteria found")
+	}
+
+	sel := &variantSelection{
+		variant:       t.selector.pickVariant(candidates),
+		candidatesLen: len(candidates),
+	}
+	sel.audio = t.selector.pickAudio(mpl, sel.variant)
+
+	t.mutex.Lock()
+	t.selection = sel
+	t.mutex.Unlock()
+
+	mpl.Variants = []*playlist.MultivariantVariant{sel.variant}
+
+	return mpl.Marshal()
+}
+
+func (t *selectingTransport) getSelection() *variantSelection {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.selection
+}
+
+// consecutiveFailures returns the number of consecutive segment download failures.
+func (t *selectingTransport) consecutiveFailures() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.failures
+}
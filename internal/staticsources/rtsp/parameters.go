@@ -0,0 +1,167 @@
+package rtsp
+
+import (
+	"context"
+	gotls "crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/auth"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/conn"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
+)
+
+// upstreamSession is the session of the client that is reading the source.
+type upstreamSession struct {
+	u           *base.URL
+	fingerprint string
+	session     string
+}
+
+func (s *Source) setUpstreamSession(us *upstreamSession) {
+	s.upstreamMutex.Lock()
+	defer s.upstreamMutex.Unlock()
+	s.upstream = us
+}
+
+// onUpstreamResponse collects the session of the client.
+func (s *Source) onUpstreamResponse(u *base.URL, fingerprint string, res *base.Response) {
+	v, ok := res.Header["Session"]
+	if !ok {
+		return
+	}
+
+	var sx headers.Session
+	err := sx.Unmarshal(v)
+	if err != nil {
+		return
+	}
+
+	s.setUpstreamSession(&upstreamSession{
+		u:           u,
+		fingerprint: fingerprint,
+		session:     sx.Session,
+	})
+}
+
+func canonicalAddr(u *base.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	if u.Scheme == "rtsps" {
+		return net.JoinHostPort(u.Hostname(), "322")
+	}
+	return net.JoinHostPort(u.Hostname(), "554")
+}
+
+// ForwardParameterRequest implements defs.StaticSourceParameterForwarder.
+//
+// The control connection of the client is used by gortsplib only,
+// therefore requests are sent through another connection, within the session of the client.
+func (s *Source) ForwardParameterRequest(req *base.Request) (*base.Response, error) {
+	s.upstreamMutex.Lock()
+	us := s.upstream
+	s.upstreamMutex.Unlock()
+
+	if us == nil {
+		return nil, fmt.Errorf("source is not connected")
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), time.Duration(s.ReadTimeout))
+	defer ctxCancel()
+
+	nconn, err := (&net.Dialer{}).DialContext(ctx, "tcp", canonicalAddr(us.u))
+	if err != nil {
+		return nil, err
+	}
+	defer nconn.Close()
+
+	if us.u.Scheme == "rtsps" {
+		tlsConfig := tls.ConfigForFingerprint(us.fingerprint)
+		if tlsConfig == nil {
+			tlsConfig = &gotls.Config{}
+		}
+		tlsConfig.ServerName = us.u.Hostname()
+
+		nconn = gotls.Client(nconn, tlsConfig)
+	}
+
+	rconn := conn.NewConn(nconn)
+
+	ureq := &base.Request{
+		Method: req.Method,
+		URL:    us.u,
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"1"},
+			"Session": base.HeaderValue{us.session},
+		},
+		Body: req.Body,
+	}
+
+	if v, ok := req.Header["Content-Type"]; ok {
+		ureq.Header["Content-Type"] = v
+	}
+
+	res, err := s.doParameterRequest(nconn, rconn, ureq)
+	if err != nil {
+		return nil, err
+	}
+
+	// send request again with authentication
+	if res.StatusCode == base.StatusUnauthorized && us.u.User != nil {
+		pass, _ := us.u.User.Password()
+		user := us.u.User.Username()
+
+		sender, err := auth.NewSender(res.Header["WWW-Authenticate"], user, pass)
+		if err != nil {
+			return nil, err
+		}
+
+		ureq.Header["CSeq"] = base.HeaderValue{"2"}
+		sender.AddAuthorization(ureq)
+
+		res, err = s.doParameterRequest(nconn, rconn, ureq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &base.Response{
+		StatusCode:    res.StatusCode,
+		StatusMessage: res.StatusMessage,
+		Header:        base.Header{},
+		Body:          res.Body,
+	}
+
+	if v, ok := res.Header["Content-Type"]; ok {
+		ret.Header["Content-Type"] = v
+	}
+
+	return ret, nil
+}
+
+func (s *Source) doParameterRequest(nconn net.Conn, rconn *conn.Conn, req *base.Request) (*base.Response, error) {
+	s.Log(logger.Debug, "[c->s] %v", req)
+
+	nconn.SetWriteDeadline(time.Now().Add(time.Duration(s.WriteTimeout)))
+	err := rconn.WriteRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	nconn.SetReadDeadline(time.Now().Add(time.Duration(s.ReadTimeout)))
+	res, err := rconn.ReadResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log(logger.Debug, "[s->c] %v", res)
+
+	return res, nil
+}
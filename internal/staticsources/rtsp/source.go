@@ -2,17 +2,27 @@
 package rtsp
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/headers"
 	"github.com/pion/rtp"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/savp"
 	"github.com/bluenviron/mediamtx/internal/protocols/tls"
+	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
 func createRangeHeader(cnf *conf.Path) (*headers.Range, error) {
@@ -60,12 +70,33 @@ func createRangeHeader(cnf *conf.Path) (*headers.Range, error) {
 	}
 }
 
+// period of the check for stalled sources.
+var stallCheckPeriod = 1 * time.Second
+
+var errPrimaryAvailable = errors.New("primary source is available")
+
+var errReconnectRequested = errors.New("reconnection requested")
+
 // Source is a RTSP static source.
 type Source struct {
 	ReadTimeout    conf.StringDuration
 	WriteTimeout   conf.StringDuration
 	WriteQueueSize int
 	Parent         defs.StaticSourceParent
+
+	urlIndex int
+	failures int
+
+	// stream shared by connections to the primary source and to fallbacks
+	desc      *description.Session
+	stream    *stream.Stream
+	ptsOffset time.Duration
+	mutex     sync.Mutex
+	lastPTS   time.Duration
+
+	// session of the running client, used to forward parameter requests
+	upstreamMutex sync.Mutex
+	upstream      *upstreamSession
 }
 
 // Log implements StaticSource.
@@ -73,19 +104,171 @@ func (s *Source) Log(level logger.Level, format string, args ...interface{}) {
 	s.Parent.Log(level, "[RTSP source] "+format, args...)
 }
 
+// mediaSelected returns whether a media is selected by the RTSPMedias parameter.
+// Selectors are media types, codec names or control attributes.
+// Since control attributes can be absolute URLs, a selector also matches their last part.
+// When there are no selectors, all medias are selected.
+func mediaSelected(medi *description.Media, selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+
+	for _, sel := range selectors {
+		if strings.EqualFold(sel, string(medi.Type)) ||
+			sel == medi.Control || strings.HasSuffix(medi.Control, "/"+sel) {
+			return true
+		}
+
+		for _, forma := range medi.Formats {
+			if strings.EqualFold(sel, forma.Codec()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func selectMedias(medias []*description.Media, selectors []string) []*description.Media {
+	var ret []*description.Media
+
+	for _, medi := range medias {
+		if mediaSelected(medi, selectors) {
+			ret = append(ret, medi)
+		}
+	}
+
+	return ret
+}
+
+// descCompatible returns whether packets of a session can be routed into a stream created with another session.
+// Payload types are not compared since they are rewritten.
+func descCompatible(a *description.Session, b *description.Session) bool {
+	if len(a.Medias) != len(b.Medias) {
+		return false
+	}
+
+	for i, medi := range a.Medias {
+		if medi.Type != b.Medias[i].Type || len(medi.Formats) != len(b.Medias[i].Formats) {
+			return false
+		}
+
+		for j, forma := range medi.Formats {
+			if forma.Codec() != b.Medias[i].Formats[j].Codec() ||
+				forma.ClockRate() != b.Medias[i].Formats[j].ClockRate() {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 // Run implements StaticSource.
 func (s *Source) Run(params defs.StaticSourceRunParams) error {
-	s.Log(logger.Debug, "connecting")
+	defer s.setNotReady()
 
-	decodeErrLogger := logger.NewLimitedLogger(s)
+	cnf := params.Conf
+
+	for {
+		urls := append([]string{cnf.Source}, cnf.RTSPSourceFallbacks...)
+		if s.urlIndex >= len(urls) {
+			s.urlIndex = 0
+		}
+
+		if s.urlIndex != 0 {
+			s.Log(logger.Info, "using fallback source %v", urls[s.urlIndex])
+		}
+
+		newConf, err := s.runInner(params.Context, cnf, urls[s.urlIndex], params.ReloadConf, params.Reconnect)
+
+		switch {
+		case newConf != nil:
+			// medias can't be added or removed after PLAY, therefore the connection is restarted
+			s.Log(logger.Info, "media selection has changed, reconnecting")
+			cnf = newConf
+
+		case errors.Is(err, errPrimaryAvailable):
+			s.Log(logger.Info, "primary source is available again, switching back")
+			s.urlIndex = 0
+			s.failures = 0
+
+		case errors.Is(err, errReconnectRequested):
+			// the path detected a stall (stallTimeout): switch to the next source
+			// as if rtspSourceStallTimeout was reached, keeping the stream.
+			s.Log(logger.Warn, "stream is stalled, reconnecting")
+			s.urlIndex = (s.urlIndex + 1) % len(urls)
+
+		case err == nil:
+			return nil
+
+		default:
+			s.failures++
+			s.urlIndex = (s.urlIndex + 1) % len(urls)
+
+			// all sources failed, wait before retrying
+			if s.failures >= len(urls) {
+				s.failures = 0
+				return err
+			}
+
+			s.Log(logger.Warn, "%v, switching to the next source", err)
+		}
+	}
+}
+
+// setReady makes the path ready.
+// When the path is already ready and medias are compatible with the existing stream,
+// the stream is kept, in order to allow readers to continue reading without reconnecting.
+func (s *Source) setReady(desc *description.Session) error {
+	if s.stream != nil {
+		if descCompatible(s.desc, desc) {
+			// timestamps of the new connection start after the last written packet,
+			// in order to keep them monotonic.
+			s.mutex.Lock()
+			s.ptsOffset = s.lastPTS + time.Millisecond
+			s.mutex.Unlock()
+			return nil
+		}
+
+		s.Log(logger.Info, "medias of the source have changed, recreating the stream")
+		s.setNotReady()
+	}
+
+	res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
+		Desc:               desc,
+		GenerateRTPPackets: false,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	s.desc = desc
+	s.stream = res.Stream
+	s.ptsOffset = 0
+	s.mutex.Lock()
+	s.lastPTS = 0
+	s.mutex.Unlock()
 
-	c := &gortsplib.Client{
-		Transport:      params.Conf.RTSPTransport.Transport,
-		TLSConfig:      tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
+	return nil
+}
+
+func (s *Source) setNotReady() {
+	if s.stream != nil {
+		s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+		s.desc = nil
+		s.stream = nil
+	}
+}
+
+func (s *Source) createClient(cnf *conf.Path, decodeErrLogger logger.Writer) *gortsplib.Client {
+	return &gortsplib.Client{
+		Transport:      cnf.RTSPTransport.Transport,
+		TLSConfig:      tls.ConfigForFingerprint(cnf.SourceFingerprint),
 		ReadTimeout:    time.Duration(s.ReadTimeout),
 		WriteTimeout:   time.Duration(s.WriteTimeout),
 		WriteQueueSize: s.WriteQueueSize,
-		AnyPortEnable:  params.Conf.RTSPAnyPort,
+		AnyPortEnable:  cnf.RTSPAnyPort,
 		OnRequest: func(req *base.Request) {
 			s.Log(logger.Debug, "[c->s] %v", req)
 		},
@@ -102,18 +285,76 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 			decodeErrLogger.Log(logger.Warn, err.Error())
 		},
 	}
+}
+
+// startClient starts a client.
+// When a rtsps source is read with the UDP transport protocol, media is encrypted with SRTP.
+func startClient(c *gortsplib.Client, cnf *conf.Path, u *base.URL) error {
+	if u.Scheme == "rtsps" && cnf.RTSPTransport.Transport != nil &&
+		*cnf.RTSPTransport.Transport == gortsplib.TransportUDP {
+		sc := &savp.Client{}
+		sc.Attach(c)
+		return sc.Start(c, u.Host)
+	}
+
+	return c.Start(u.Scheme, u.Host)
+}
+
+// checkPrimary returns whether the primary source answers to a DESCRIBE request.
+func (s *Source) checkPrimary(cnf *conf.Path) bool {
+	u, err := base.ParseURL(cnf.Source)
+	if err != nil {
+		return false
+	}
+
+	c := s.createClient(cnf, logger.NewLimitedLogger(s))
+
+	err = startClient(c, cnf, u)
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+
+	_, _, err = c.Describe(u)
+	return err == nil
+}
+
+// runInner reads a source until an error occurs or the context is canceled.
+// It returns a configuration when the source must be restarted with it.
+func (s *Source) runInner(
+	ctx context.Context,
+	cnf *conf.Path,
+	source string,
+	reloadConf chan *conf.Path,
+	reconnect chan struct{},
+) (*conf.Path, error) {
+	s.Log(logger.Debug, "connecting")
 
-	u, err := base.ParseURL(params.Conf.Source)
+	decodeErrLogger := logger.NewLimitedLogger(s)
+
+	c := s.createClient(cnf, decodeErrLogger)
+
+	u, err := base.ParseURL(source)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	onResponse := c.OnResponse
+	c.OnResponse = func(res *base.Response) {
+		onResponse(res)
+		s.onUpstreamResponse(u, cnf.SourceFingerprint, res)
 	}
+	defer s.setUpstreamSession(nil)
 
-	err = c.Start(u.Scheme, u.Host)
+	err = startClient(c, cnf, u)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer c.Close()
 
+	var lastPacket int64
+	atomic.StoreInt64(&lastPacket, time.Now().UnixNano())
+
 	readErr := make(chan error)
 	go func() {
 		readErr <- func() error {
@@ -122,38 +363,58 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 				return err
 			}
 
-			err = c.SetupAll(desc.BaseURL, desc.Medias)
-			if err != nil {
-				return err
+			medias := selectMedias(desc.Medias, cnf.RTSPMedias)
+			if medias == nil {
+				return fmt.Errorf("none of the medias of the source matches 'rtspMedias'")
 			}
 
-			res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
-				Desc:               desc,
-				GenerateRTPPackets: false,
-			})
-			if res.Err != nil {
-				return res.Err
+			for _, medi := range medias {
+				_, err = c.Setup(desc.BaseURL, medi, 0, 0)
+				if err != nil {
+					return err
+				}
+			}
+
+			desc.Medias = medias
+
+			err = s.setReady(desc)
+			if err != nil {
+				return err
 			}
 
-			defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+			absoluteTimeTolerance := time.Duration(cnf.AbsoluteTimeTolerance)
 
-			for _, medi := range desc.Medias {
-				for _, forma := range medi.Formats {
+			for i, medi := range desc.Medias {
+				for j, forma := range medi.Formats {
 					cmedi := medi
 					cforma := forma
+					smedi := s.desc.Medias[i]
+					sforma := smedi.Formats[j]
+					strm := s.stream
+					ptsOffset := s.ptsOffset
 
 					c.OnPacketRTP(cmedi, cforma, func(pkt *rtp.Packet) {
+						atomic.StoreInt64(&lastPacket, time.Now().UnixNano())
+
 						pts, ok := c.PacketPTS(cmedi, pkt)
 						if !ok {
 							return
 						}
+						pts += ptsOffset
+
+						// use the absolute time provided by RTCP sender reports, when available and plausible
+						ntp, ok := c.PacketNTP(cmedi, pkt)
+						ntp = stream.AbsoluteTime(time.Now(), ntp, ok, absoluteTimeTolerance)
 
-						res.Stream.WriteRTPPacket(cmedi, cforma, pkt, time.Now(), pts)
+						pkt.PayloadType = sforma.PayloadType()
+						strm.WriteRTPPacket(smedi, sforma, pkt, ntp, pts)
+
+						s.updateLastPTS(pts)
 					})
 				}
 			}
 
-			rangeHeader, err := createRangeHeader(params.Conf)
+			rangeHeader, err := createRangeHeader(cnf)
 			if err != nil {
 				return err
 			}
@@ -163,25 +424,85 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 				return err
 			}
 
+			s.failures = 0
+
 			return c.Wait()
 		}()
 	}()
 
+	stallTicker := time.NewTicker(stallCheckPeriod)
+	defer stallTicker.Stop()
+
+	// when a fallback is in use, check periodically whether the primary source is available again
+	var primaryCheck <-chan time.Time
+	if source != cnf.Source && cnf.RTSPSourcePrimaryCheckPeriod != 0 {
+		primaryCheckTicker := time.NewTicker(time.Duration(cnf.RTSPSourcePrimaryCheckPeriod))
+		defer primaryCheckTicker.Stop()
+		primaryCheck = primaryCheckTicker.C
+	}
+
+	primaryAvailable := make(chan bool, 1)
+	checkingPrimary := false
+
 	for {
 		select {
 		case err := <-readErr:
-			return err
+			return nil, err
 
-		case <-params.ReloadConf:
+		case <-stallTicker.C:
+			if cnf.RTSPSourceStallTimeout != 0 &&
+				time.Since(time.Unix(0, atomic.LoadInt64(&lastPacket))) >= time.Duration(cnf.RTSPSourceStallTimeout) {
+				c.Close()
+				<-readErr
+				return nil, fmt.Errorf("source is stalled")
+			}
 
-		case <-params.Context.Done():
+		case <-reconnect:
 			c.Close()
 			<-readErr
-			return nil
+			return nil, errReconnectRequested
+
+		case <-primaryCheck:
+			if !checkingPrimary {
+				checkingPrimary = true
+				go func() {
+					primaryAvailable <- s.checkPrimary(cnf)
+				}()
+			}
+
+		case ok := <-primaryAvailable:
+			checkingPrimary = false
+			if ok {
+				c.Close()
+				<-readErr
+				return nil, errPrimaryAvailable
+			}
+
+		case newConf := <-reloadConf:
+			if !reflect.DeepEqual(newConf.RTSPMedias, cnf.RTSPMedias) {
+				c.Close()
+				<-readErr
+				return newConf, nil
+			}
+			cnf = newConf
+
+		case <-ctx.Done():
+			c.Close()
+			<-readErr
+			return nil, nil
 		}
 	}
 }
 
+func (s *Source) updateLastPTS(pts time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if pts > s.lastPTS {
+		s.lastPTS = pts
+	}
+}
+
 // APISourceDescribe implements StaticSource.
 func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
 	return defs.APIPathSourceOrReader{
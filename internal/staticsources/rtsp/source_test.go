@@ -3,6 +3,7 @@ package rtsp
 import (
 	"crypto/tls"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/staticsources/tester"
+	"github.com/bluenviron/mediamtx/internal/unit"
 )
 
 var serverCert = []byte(`-----BEGIN CERTIFICATE-----
@@ -90,6 +92,8 @@ type testServer struct {
 	onDescribe func(*gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error)
 	onSetup    func(*gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error)
 	onPlay     func(*gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error)
+
+	onSetParameter func(*gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error)
 }
 
 func (sh *testServer) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
@@ -105,6 +109,15 @@ func (sh *testServer) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Respo
 	return sh.onPlay(ctx)
 }
 
+func (sh *testServer) OnSetParameter(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+	if sh.onSetParameter == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}, nil
+	}
+	return sh.onSetParameter(ctx)
+}
+
 var testMediaH264 = &description.Media{
 	Type: description.MediaTypeVideo,
 	Formats: []format.Format{&format.H264{
@@ -430,3 +443,346 @@ func TestRTSPSourceRange(t *testing.T) {
 		})
 	}
 }
+
+func TestRTSPSourceMediaSelection(t *testing.T) {
+	testMediaAudio := &description.Media{
+		Type: description.MediaTypeAudio,
+		Formats: []format.Format{&format.Opus{
+			PayloadTyp: 97,
+			IsStereo:   false,
+		}},
+	}
+
+	for _, ca := range []string{"type", "codec", "control"} {
+		t.Run(ca, func(t *testing.T) {
+			var stream *gortsplib.ServerStream
+			var setupPaths []string
+
+			s := gortsplib.Server{
+				Handler: &testServer{
+					onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+						setupPaths = append(setupPaths, ctx.Request.URL.Path)
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+						go func() {
+							time.Sleep(100 * time.Millisecond)
+							err := stream.WritePacketRTP(testMediaAudio, &rtp.Packet{
+								Header: rtp.Header{
+									Version:        0x02,
+									PayloadType:    97,
+									SequenceNumber: 57899,
+									Timestamp:      345234345,
+									SSRC:           978651231,
+									Marker:         true,
+								},
+								Payload: []byte{1, 2, 3, 4},
+							})
+							require.NoError(t, err)
+						}()
+
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "127.0.0.1:8555",
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Wait() //nolint:errcheck
+			defer s.Close()
+
+			stream = gortsplib.NewServerStream(&s, &description.Session{Medias: []*description.Media{
+				testMediaH264,
+				testMediaAudio,
+			}})
+			defer stream.Close()
+
+			cnf := &conf.Path{
+				Source: "rtsp://127.0.0.1:8555/teststream",
+			}
+
+			switch ca {
+			case "type":
+				cnf.RTSPMedias = []string{"audio"}
+
+			case "codec":
+				cnf.RTSPMedias = []string{"opus"}
+
+			case "control":
+				cnf.RTSPMedias = []string{"trackID=1"}
+			}
+
+			te := tester.New(
+				func(p defs.StaticSourceParent) defs.StaticSource {
+					return &Source{
+						ReadTimeout:    conf.StringDuration(10 * time.Second),
+						WriteTimeout:   conf.StringDuration(10 * time.Second),
+						WriteQueueSize: 2048,
+						Parent:         p,
+					}
+				},
+				cnf,
+			)
+			defer te.Close()
+
+			u := <-te.Unit
+			require.Equal(t, [][]byte{{1, 2, 3, 4}}, u.(*unit.Opus).Packets)
+			require.Equal(t, []string{"/teststream/trackID=1"}, setupPaths)
+		})
+	}
+}
+
+func TestRTSPSourceFailover(t *testing.T) {
+	played := make(chan string, 10)
+
+	newServer := func(address string) (*gortsplib.Server, *gortsplib.ServerStream) {
+		var mutex sync.Mutex
+		var stream *gortsplib.ServerStream
+
+		s := &gortsplib.Server{
+			Handler: &testServer{
+				onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					if stream == nil {
+						return &base.Response{
+							StatusCode: base.StatusNotFound,
+						}, nil, nil
+					}
+
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, stream, nil
+				},
+				onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, stream, nil
+				},
+				onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+					played <- address
+
+					mutex.Lock()
+					stream := stream
+					mutex.Unlock()
+
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						stream.WritePacketRTP(testMediaH264, &rtp.Packet{ //nolint:errcheck
+							Header: rtp.Header{
+								Version:        0x02,
+								PayloadType:    96,
+								SequenceNumber: 57899,
+								Timestamp:      345234345,
+								SSRC:           978651231,
+								Marker:         true,
+							},
+							Payload: []byte{5, 1, 2, 3, 4},
+						})
+					}()
+
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, nil
+				},
+			},
+			RTSPAddress: address,
+		}
+
+		err := s.Start()
+		require.NoError(t, err)
+
+		// the source may connect at any time
+		mutex.Lock()
+		stream = gortsplib.NewServerStream(s, &description.Session{Medias: []*description.Media{testMediaH264}})
+		mutex.Unlock()
+
+		return s, stream
+	}
+
+	// the primary source is not available
+	fallback, fallbackStream := newServer("127.0.0.1:8556")
+	defer fallback.Wait() //nolint:errcheck
+	defer fallback.Close()
+	defer fallbackStream.Close()
+
+	te := tester.New(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			return &Source{
+				ReadTimeout:    conf.StringDuration(10 * time.Second),
+				WriteTimeout:   conf.StringDuration(10 * time.Second),
+				WriteQueueSize: 2048,
+				Parent:         p,
+			}
+		},
+		&conf.Path{
+			Source:                       "rtsp://127.0.0.1:8555/teststream",
+			RTSPSourceFallbacks:          []string{"rtsp://127.0.0.1:8556/teststream"},
+			RTSPSourcePrimaryCheckPeriod: conf.StringDuration(200 * time.Millisecond),
+		},
+	)
+	defer te.Close()
+
+	require.Equal(t, "127.0.0.1:8556", <-played)
+
+	u := <-te.Unit
+	require.Equal(t, []byte{5, 1, 2, 3, 4}, u.(*unit.H264).AU[len(u.(*unit.H264).AU)-1])
+
+	// the primary source recovers and the existing stream is kept
+	primary, primaryStream := newServer("127.0.0.1:8555")
+	defer primary.Wait() //nolint:errcheck
+	defer primary.Close()
+	defer primaryStream.Close()
+
+	require.Equal(t, "127.0.0.1:8555", <-played)
+}
+
+func TestRTSPSourceForwardParameter(t *testing.T) {
+	var stream *gortsplib.ServerStream
+	var playSession *gortsplib.ServerSession
+
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				playSession = ctx.Session
+
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					err := stream.WritePacketRTP(testMediaH264, &rtp.Packet{
+						Header: rtp.Header{
+							Version:        0x02,
+							PayloadType:    96,
+							SequenceNumber: 57899,
+							Timestamp:      345234345,
+							SSRC:           978651231,
+							Marker:         true,
+						},
+						Payload: []byte{5, 1, 2, 3, 4},
+					})
+					require.NoError(t, err)
+				}()
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onSetParameter: func(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+				require.Equal(t, playSession, ctx.Session)
+				require.Equal(t, base.HeaderValue{"text/parameters"}, ctx.Request.Header["Content-Type"])
+				require.Equal(t, []byte("ptz: left\r\n"), ctx.Request.Body)
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Content-Type": base.HeaderValue{"text/parameters"},
+					},
+					Body: []byte("ptz: ok\r\n"),
+				}, nil
+			},
+		},
+		RTSPAddress:    "127.0.0.1:8555",
+		UDPRTPAddress:  "127.0.0.1:8002",
+		UDPRTCPAddress: "127.0.0.1:8003",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Wait() //nolint:errcheck
+	defer s.Close()
+
+	stream = gortsplib.NewServerStream(&s, &description.Session{Medias: []*description.Media{testMediaH264}})
+	defer stream.Close()
+
+	// with the TCP transport protocol, gortsplib links sessions to connections,
+	// therefore requests coming from other connections are rejected.
+	udp := gortsplib.TransportUDP
+
+	var source *Source
+
+	te := tester.New(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			source = &Source{
+				ReadTimeout:    conf.StringDuration(10 * time.Second),
+				WriteTimeout:   conf.StringDuration(10 * time.Second),
+				WriteQueueSize: 2048,
+				Parent:         p,
+			}
+			return source
+		},
+		&conf.Path{
+			Source:        "rtsp://127.0.0.1:8555/teststream",
+			RTSPTransport: conf.RTSPTransport{Transport: &udp},
+		},
+	)
+	defer te.Close()
+
+	<-te.Unit
+
+	res, err := source.ForwardParameterRequest(&base.Request{
+		Method: base.SetParameter,
+		Header: base.Header{
+			"Content-Type": base.HeaderValue{"text/parameters"},
+		},
+		Body: []byte("ptz: left\r\n"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	require.Equal(t, base.HeaderValue{"text/parameters"}, res.Header["Content-Type"])
+	require.Equal(t, []byte("ptz: ok\r\n"), res.Body)
+}
+
+func TestDescCompatible(t *testing.T) {
+	testMediaH264PT97 := &description.Media{
+		Type: description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{
+			PayloadTyp:        97,
+			PacketizationMode: 1,
+		}},
+	}
+
+	testMediaOpus := &description.Media{
+		Type: description.MediaTypeAudio,
+		Formats: []format.Format{&format.Opus{
+			PayloadTyp: 96,
+		}},
+	}
+
+	require.True(t, descCompatible(
+		&description.Session{Medias: []*description.Media{testMediaH264}},
+		&description.Session{Medias: []*description.Media{testMediaH264PT97}},
+	))
+
+	require.False(t, descCompatible(
+		&description.Session{Medias: []*description.Media{testMediaH264}},
+		&description.Session{Medias: []*description.Media{testMediaOpus}},
+	))
+
+	require.False(t, descCompatible(
+		&description.Session{Medias: []*description.Media{testMediaH264}},
+		&description.Session{Medias: []*description.Media{testMediaH264, testMediaOpus}},
+	))
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 	"github.com/bluenviron/mediamtx/internal/protocols/webrtc"
+	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
 // Source is a WebRTC static source.
@@ -69,6 +70,7 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 	defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
 
 	timeDecoder := rtptime.NewGlobalDecoder()
+	absoluteTimeTolerance := time.Duration(params.Conf.AbsoluteTimeTolerance)
 
 	for i, media := range medias {
 		ci := i
@@ -87,7 +89,11 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 					continue
 				}
 
-				rres.Stream.WriteRTPPacket(cmedia, cmedia.Formats[0], pkt, time.Now(), pts)
+				// use the absolute time provided by RTCP sender reports, when available and plausible
+				ntp, ok := tracks[ci].PacketNTP(pkt)
+				ntp = stream.AbsoluteTime(time.Now(), ntp, ok, absoluteTimeTolerance)
+
+				rres.Stream.WriteRTPPacket(cmedia, cmedia.Formats[0], pkt, ntp, pts)
 			}
 		}()
 	}
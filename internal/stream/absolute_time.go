@@ -0,0 +1,27 @@
+package stream
+
+import (
+	"time"
+)
+
+// AbsoluteTime returns the absolute time of a received packet.
+// ntp is the capture time provided by the sender (i.e. through RTCP sender reports)
+// and is used only when it differs from the reception time by less than tolerance,
+// since the clock of the sender may not be synchronized.
+// Otherwise, the reception time is returned.
+func AbsoluteTime(received time.Time, ntp time.Time, ntpAvailable bool, tolerance time.Duration) time.Time {
+	if !ntpAvailable {
+		return received
+	}
+
+	diff := ntp.Sub(received)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	if diff >= tolerance {
+		return received
+	}
+
+	return ntp
+}
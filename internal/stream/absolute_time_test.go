@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbsoluteTime(t *testing.T) {
+	received := time.Date(2010, 11, 12, 13, 14, 15, 0, time.UTC)
+
+	for _, ca := range []struct {
+		name         string
+		ntp          time.Time
+		ntpAvailable bool
+		tolerance    time.Duration
+		res          time.Time
+	}{
+		{
+			"not available",
+			time.Time{},
+			false,
+			10 * time.Second,
+			received,
+		},
+		{
+			"before",
+			received.Add(-5 * time.Second),
+			true,
+			10 * time.Second,
+			received.Add(-5 * time.Second),
+		},
+		{
+			"after",
+			received.Add(5 * time.Second),
+			true,
+			10 * time.Second,
+			received.Add(5 * time.Second),
+		},
+		{
+			"out of tolerance",
+			received.Add(-time.Hour),
+			true,
+			10 * time.Second,
+			received,
+		},
+		{
+			"disabled",
+			received.Add(-time.Second),
+			true,
+			0,
+			received,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			res := AbsoluteTime(received, ca.ntp, ca.ntpAvailable, ca.tolerance)
+			require.Equal(t, ca.res, res)
+		})
+	}
+}
@@ -92,6 +92,20 @@ func (s *Stream) BytesSent() uint64 {
 	return bytesSent
 }
 
+// StalledMedias returns medias that haven't received any unit for the given duration.
+func (s *Stream) StalledMedias(timeout time.Duration) []*description.Media {
+	var medias []*description.Media
+
+	for _, medi := range s.desc.Medias {
+		lastUnit := time.Unix(0, atomic.LoadInt64(s.smedias[medi].lastUnit))
+		if time.Since(lastUnit) >= timeout {
+			medias = append(medias, medi)
+		}
+	}
+
+	return medias
+}
+
 // RTSPStream returns the RTSP stream.
 func (s *Stream) RTSPStream(server *gortsplib.Server) *gortsplib.ServerStream {
 	s.mutex.Lock()
@@ -88,6 +88,7 @@ func (sf *streamFormat) writeUnitInner(s *Stream, medi *description.Media, u uni
 	size := unitSize(u)
 
 	atomic.AddUint64(s.bytesReceived, size)
+	atomic.StoreInt64(s.smedias[medi].lastUnit, time.Now().UnixNano())
 
 	if s.rtspStream != nil {
 		for _, pkt := range u.GetRTPPackets() {
@@ -1,6 +1,9 @@
 package stream
 
 import (
+	"sync/atomic"
+	"time"
+
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
 
@@ -8,7 +11,8 @@ import (
 )
 
 type streamMedia struct {
-	formats map[format.Format]*streamFormat
+	formats  map[format.Format]*streamFormat
+	lastUnit *int64
 }
 
 func newStreamMedia(udpMaxPayloadSize int,
@@ -17,9 +21,12 @@ func newStreamMedia(udpMaxPayloadSize int,
 	decodeErrLogger logger.Writer,
 ) (*streamMedia, error) {
 	sm := &streamMedia{
-		formats: make(map[format.Format]*streamFormat),
+		formats:  make(map[format.Format]*streamFormat),
+		lastUnit: new(int64),
 	}
 
+	atomic.StoreInt64(sm.lastUnit, time.Now().UnixNano())
+
 	for _, forma := range medi.Formats {
 		var err error
 		sm.formats[forma], err = newStreamFormat(udpMaxPayloadSize, forma, generateRTPPackets, decodeErrLogger)
@@ -1,7 +1,30 @@
 package unit
 
+import (
+	"bytes"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4video"
+)
+
 // MPEG4Video is a MPEG-4 Video data unit.
 type MPEG4Video struct {
 	Base
 	Frame []byte
 }
+
+// IsRandomAccess returns whether the frame contains a group of VOP
+// or an intra-coded VOP. Many encoders don't emit group of VOP headers,
+// therefore the coding type of the VOP must be checked too.
+func (u *MPEG4Video) IsRandomAccess() bool {
+	if bytes.Contains(u.Frame, []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)}) {
+		return true
+	}
+
+	i := bytes.Index(u.Frame, []byte{0, 0, 1, byte(mpeg4video.VOPStartCode)})
+	if i < 0 || (i+4) >= len(u.Frame) {
+		return false
+	}
+
+	// vop_coding_type is made of the first two bits after the start code; 0 means I-VOP.
+	return (u.Frame[i+4] >> 6) == 0
+}